@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/danmrichards/dessego/internal/archive"
+	"github.com/danmrichards/dessego/internal/database"
+	"github.com/danmrichards/dessego/internal/service/character"
+	"github.com/danmrichards/dessego/internal/service/msg"
+	"github.com/danmrichards/dessego/internal/service/replay"
+	"github.com/rs/zerolog"
+)
+
+// initTables initialises the services, so the archived tables exist and are
+// migrated.
+func initTables(db *database.DB, l zerolog.Logger) error {
+	if _, err := character.NewSQLiteService(db); err != nil {
+		return err
+	}
+	if _, err := msg.NewSQLiteService(db, l); err != nil {
+		return err
+	}
+	_, err := replay.NewSQLiteService(db, l)
+	return err
+}
+
+// exportCmd writes the server dataset to an archive.
+func exportCmd(db *database.DB, l zerolog.Logger, args []string) (err error) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	out := fs.String("out", "-", "Path to write the archive to, - for stdout")
+	if err = fs.Parse(args); err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *out == "-" {
+		// Log to stderr, so the log doesn't end up in the archive.
+		l = l.Output(os.Stderr)
+	} else {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}()
+		w = f
+	}
+
+	if err = initTables(db, l); err != nil {
+		return err
+	}
+
+	r, err := archive.Export(context.Background(), db.Reader, w)
+	if err != nil {
+		return err
+	}
+	l.Info().Msgf("exported archive %s", r)
+
+	return nil
+}
+
+// importCmd adds the contents of an archive to the server dataset.
+func importCmd(db *database.DB, l zerolog.Logger, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "Report the records which would be added without adding them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: import [-dry-run] <path>")
+	}
+
+	if err := initTables(db, l); err != nil {
+		return err
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r, err := archive.Import(context.Background(), db.Writer, f, *dryRun)
+	if err != nil {
+		return err
+	}
+	l.Info().Msgf("imported archive %s", r)
+
+	if *dryRun {
+		return nil
+	}
+
+	// Imported ratings and grades may be for characters which already existed.
+	return recount(storage{sqlite: db}, l)
+}
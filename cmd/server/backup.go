@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/danmrichards/dessego/internal/backup"
+	"github.com/danmrichards/dessego/internal/database"
+	"github.com/rs/zerolog"
+)
+
+// backupCmd backs up the database, while the server is running if need be.
+func backupCmd(db *database.DB, l zerolog.Logger, args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	out := fs.String("out", "", "Path to write the backup to, instead of a snapshot in the backup directory")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *out != "" {
+		if err := backup.Backup(context.Background(), db.Reader, *out); err != nil {
+			return err
+		}
+		l.Info().Msgf("backed up database to %q", *out)
+		return nil
+	}
+
+	path, err := backup.NewSnapshotter(db.Reader, backupDir, backupKeep, l).
+		Snapshot(context.Background())
+	if err != nil {
+		return err
+	}
+	l.Info().Msgf("backed up database to %q", path)
+
+	return nil
+}
+
+// restoreCmd replaces the database with a backup. The server must be stopped
+// first.
+func restoreCmd(l zerolog.Logger, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: restore <path>")
+	}
+
+	if err := backup.Restore(args[0], dbPath); err != nil {
+		return err
+	}
+	l.Info().Msgf("restored database from %q, replaced database kept as %q", args[0], dbPath+".pre-restore")
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// scheduler runs jobs at intervals until stopped.
+type scheduler struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	l      zerolog.Logger
+}
+
+// newScheduler returns a scheduler which logs any errors returned by its jobs.
+func newScheduler(l zerolog.Logger) *scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &scheduler{ctx: ctx, cancel: cancel, l: l}
+}
+
+// every runs fn every interval in the background, until the scheduler is
+// stopped.
+func (s *scheduler) every(interval time.Duration, fn func() error) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-t.C:
+				if err := fn(); err != nil {
+					s.l.Err(err).Msg("scheduled job")
+				}
+			}
+		}
+	}()
+}
+
+// stop stops scheduling jobs and waits for any running jobs to complete.
+func (s *scheduler) stop() {
+	s.cancel()
+	s.wg.Wait()
+}
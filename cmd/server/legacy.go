@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/danmrichards/dessego/internal/database"
+	"github.com/danmrichards/dessego/internal/legacy"
+	"github.com/danmrichards/dessego/internal/service/character"
+	"github.com/danmrichards/dessego/internal/service/msg"
+	"github.com/danmrichards/dessego/internal/service/replay"
+	"github.com/rs/zerolog"
+)
+
+// seedLegacy imports the legacy message and replay dumps. Missing dumps are
+// skipped, as the legacy replay dataset is not distributed with the server.
+func seedLegacy(db *database.DB, l zerolog.Logger) error {
+	im, err := newImporter(db, l)
+	if err != nil {
+		return err
+	}
+
+	for kind, path := range map[legacy.Kind]string{
+		legacy.KindMessages: legacyMessages,
+		legacy.KindReplays:  legacyReplays,
+	} {
+		if path == "" {
+			continue
+		}
+
+		r, err := im.Import(context.Background(), kind, path, false)
+		switch {
+		case os.IsNotExist(err):
+			l.Warn().Msgf("legacy %s dump %q not found, skipping", kind, path)
+		case err != nil:
+			return err
+		default:
+			l.Info().Msgf("seeded legacy %s %s", kind, r)
+		}
+	}
+
+	return nil
+}
+
+// legacyCmd imports a legacy data dump.
+func legacyCmd(db *database.DB, l zerolog.Logger, args []string) error {
+	fs := flag.NewFlagSet("legacy", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "Validate the dump without importing it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 2 {
+		return fmt.Errorf("usage: legacy [-dry-run] <messages|replays|world-tendency> <path>")
+	}
+
+	im, err := newImporter(db, l)
+	if err != nil {
+		return err
+	}
+
+	r, err := im.Import(context.Background(), legacy.Kind(fs.Arg(0)), fs.Arg(1), *dryRun)
+	if err != nil {
+		return err
+	}
+	l.Info().Msgf("legacy import %s", r)
+
+	return nil
+}
+
+// newImporter returns a legacy data importer for the SQLite database.
+func newImporter(db *database.DB, l zerolog.Logger) (*legacy.Importer, error) {
+	ms, err := msg.NewSQLiteService(db, l)
+	if err != nil {
+		return nil, err
+	}
+	rs, err := replay.NewSQLiteService(db, l)
+	if err != nil {
+		return nil, err
+	}
+	cs, err := character.NewSQLiteService(db)
+	if err != nil {
+		return nil, err
+	}
+
+	return legacy.NewImporter(db.Writer, ms, rs, cs, l)
+}
@@ -16,51 +16,138 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
-	"io"
+	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
+	"github.com/danmrichards/dessego/internal/backup"
+	"github.com/danmrichards/dessego/internal/config"
 	"github.com/danmrichards/dessego/internal/crypto"
 	"github.com/danmrichards/dessego/internal/database"
+	"github.com/danmrichards/dessego/internal/events"
+	"github.com/danmrichards/dessego/internal/logging"
+	"github.com/danmrichards/dessego/internal/server/admin"
 	"github.com/danmrichards/dessego/internal/server/bootstrap"
 	"github.com/danmrichards/dessego/internal/server/game"
-	"github.com/danmrichards/dessego/internal/service/character"
 	"github.com/danmrichards/dessego/internal/service/gamestate"
 	"github.com/danmrichards/dessego/internal/service/ghost"
 	"github.com/danmrichards/dessego/internal/service/msg"
+	"github.com/danmrichards/dessego/internal/service/quarantine"
 	"github.com/danmrichards/dessego/internal/service/replay"
 	"github.com/danmrichards/dessego/internal/service/sos"
 	"github.com/rs/zerolog"
 )
 
 const (
-	// TODO: Make configurable
-	hostGame      = "127.0.0.1"
 	portBootstrap = "18000"
-	portUS        = "18666"
-	portEU        = "18667"
-	portJP        = "18668"
 
 	dbPath = "./db/dessego.db"
 )
 
 var (
-	gameServers = map[string]string{
-		"US": portUS,
-		"EU": portEU,
-		"JP": portJP,
-	}
+	configPath string
+	configPoll time.Duration
+
+	seed           bool
+	legacyMessages string
+	legacyReplays  string
+	ratingLimit    int
+	ratingWindow   time.Duration
+
+	msgRetention     msg.RetentionPolicy
+	msgPruneInterval time.Duration
+	msgStrategy      string
+
+	replayRetention     replay.RetentionPolicy
+	replayPruneInterval time.Duration
+
+	adminAddr         string
+	quarantineUploads bool
+
+	backupDir      string
+	backupInterval time.Duration
+	backupKeep     int
+
+	storageKind string
+	ephemeral   bool
+	postgresDSN string
+
+	drainTimeout time.Duration
+	stateFile    string
 
-	seed bool
+	logOutput     logging.Output
+	logMaxSizeMiB int64
 )
 
 func main() {
+	flag.StringVar(&configPath, "config", "", "Path to the JSON server configuration file (empty for the defaults)")
+	flag.DurationVar(&configPoll, "config-poll", 0, "Interval between checks for changes to the configuration file, which is reloaded when modified (0 to only reload on SIGHUP)")
 	flag.BoolVar(&seed, "seed", false, "Seed database tables with legacy data")
+	flag.StringVar(&legacyMessages, "legacy-messages", "internal/service/msg/legacymessages.bin", "Path to the legacy blood message dump imported by -seed")
+	flag.StringVar(&legacyReplays, "legacy-replays", "internal/service/replay/legacyreplays.bin", "Path to the legacy bloodstain replay dump imported by -seed")
+	flag.IntVar(&ratingLimit, "rating-limit", 0, "Maximum number of message ratings a character can give per rating window (0 for unlimited)")
+	flag.DurationVar(&ratingWindow, "rating-window", time.Hour, "Window over which the message rating limit applies")
+	flag.IntVar(&msgRetention.MaxPerCharacter, "msg-max-per-character", 0, "Maximum number of active blood messages per character (0 for unlimited)")
+	flag.IntVar(&msgRetention.MaxPerBlock, "msg-max-per-block", 0, "Maximum number of blood messages per block, favouring the highest rated (0 for unlimited)")
+	flag.DurationVar(&msgRetention.LowRatedAge, "msg-low-rated-age", 0, "Age after which low rated blood messages are deleted (0 to keep forever)")
+	flag.IntVar(&msgRetention.LowRating, "msg-low-rating", 1, "Rating below which a blood message is considered low rated")
+	flag.DurationVar(&msgPruneInterval, "msg-prune-interval", time.Hour, "Interval between blood message retention clean ups (0 to disable)")
+	flag.StringVar(&msgStrategy, "msg-strategy", "weighted", "Blood message selection strategy: weighted or uniform")
+	flag.IntVar(&replayRetention.MaxPerCharacter, "replay-max-per-character", 0, "Maximum number of bloodstains per character (0 for unlimited)")
+	flag.IntVar(&replayRetention.MaxPerBlock, "replay-max-per-block", 0, "Maximum number of bloodstains per block, favouring the newest (0 for unlimited)")
+	flag.Float64Var(&replayRetention.DedupeRadius, "replay-dedupe-radius", 0, "Distance within which a new bloodstain replaces the character's existing bloodstains (0 to disable)")
+	flag.DurationVar(&replayPruneInterval, "replay-prune-interval", time.Hour, "Interval between bloodstain retention clean ups (0 to disable)")
+	flag.BoolVar(&quarantineUploads, "quarantine", false, "Store rejected replay and ghost uploads for investigation")
+	flag.StringVar(&backupDir, "backup-dir", "./db/backups", "Directory to write database snapshots to")
+	flag.DurationVar(&backupInterval, "backup-interval", 0, "Interval between database snapshots (0 to disable)")
+	flag.IntVar(&backupKeep, "backup-keep", 7, "Number of database snapshots to keep (0 to keep all)")
+	flag.StringVar(&storageKind, "storage", storageSQLite, "Database for characters, messages and replays: sqlite or postgres")
+	flag.BoolVar(&ephemeral, "ephemeral", false, "Hold characters, messages and replays in memory only, discarding them on shutdown")
+	flag.StringVar(&postgresDSN, "postgres-dsn", os.Getenv("DESSEGO_POSTGRES_DSN"), "PostgreSQL data source name used by postgres storage (default $DESSEGO_POSTGRES_DSN)")
+	flag.StringVar(&adminAddr, "admin-addr", "127.0.0.1:18001", "Address for the admin server to listen on (empty to disable)")
+	flag.DurationVar(&drainTimeout, "drain-timeout", 30*time.Second, "Time to wait for in-flight requests to complete on shutdown")
+	flag.StringVar(&stateFile, "state-file", "", "Path to save ghosts, SOS signs and connected players to on shutdown, and restore them from on start (empty to disable)")
+	flag.StringVar(&logOutput.Format, "log-format", logging.FormatJSON, "Log format: json or console")
+	flag.StringVar(&logOutput.Path, "log-file", "", "Path to write logs to (empty for stdout)")
+	flag.Int64Var(&logMaxSizeMiB, "log-max-size", 100, "Size in MiB at which the log file is rotated (0 to never rotate)")
+	flag.IntVar(&logOutput.MaxBackups, "log-max-backups", 5, "Number of rotated log files to keep (0 to keep all)")
 	flag.Parse()
 
-	l := zerolog.New(os.Stdout)
+	logOutput.MaxSize = logMaxSizeMiB << 20
+	l, lc, err := logging.New(logOutput)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	defer lc.Close()
+
+	if cmd := flag.Arg(0); sqliteCommands[cmd] && storageKind != storageSQLite {
+		fatal(l, fmt.Errorf("command %q requires %s storage", cmd, storageSQLite))
+	}
+
+	// The database file is replaced by a restore, so must not be opened.
+	if flag.Arg(0) == "restore" {
+		if err := restoreCmd(l, flag.Args()[1:]); err != nil {
+			fatal(l, err)
+		}
+		return
+	}
+
+	// Ephemeral servers don't touch the database.
+	if ephemeral {
+		if cmd := flag.Arg(0); cmd != "" {
+			fatal(l, fmt.Errorf("command %q cannot be used with -ephemeral", cmd))
+		}
+		runServers(nil, storage{ephemeral: true}, l)
+		return
+	}
 
 	db, err := database.NewSQLite(dbPath)
 	if err != nil {
@@ -68,24 +155,89 @@ func main() {
 	}
 	defer db.Close()
 
-	// Track the servers, so we can close them down later.
-	servers := make([]io.Closer, 0, 4)
+	if err = database.EnsureVersion(db.Writer); err != nil {
+		fatal(l, err)
+	}
 
-	// Bootstrap server; used to allow Demon's Souls to configure it's network
-	// client.
-	var bs *bootstrap.Server
-	bs, err = bootstrap.NewServer(portBootstrap, hostGame, gameServers, l)
+	st, err := openStorage(storageKind, postgresDSN, db)
 	if err != nil {
 		fatal(l, err)
 	}
-	servers = append(servers, bs)
+	defer st.Close()
 
-	l.Info().Msg("bootstrap server listening on " + portBootstrap)
-	go func() {
-		if err = bs.Serve(); err != nil {
+	switch cmd := flag.Arg(0); cmd {
+	case "":
+		// No command, run the servers.
+	case "recount":
+		if err = recount(st, l); err != nil {
 			fatal(l, err)
 		}
-	}()
+		return
+	case "prune":
+		if err = prune(st, l, flag.Args()[1:]); err != nil {
+			fatal(l, err)
+		}
+		return
+	case "backup":
+		if err = backupCmd(db, l, flag.Args()[1:]); err != nil {
+			fatal(l, err)
+		}
+		return
+	case "export":
+		if err = exportCmd(db, l, flag.Args()[1:]); err != nil {
+			fatal(l, err)
+		}
+		return
+	case "import":
+		if err = importCmd(db, l, flag.Args()[1:]); err != nil {
+			fatal(l, err)
+		}
+		return
+	case "legacy":
+		if err = legacyCmd(db, l, flag.Args()[1:]); err != nil {
+			fatal(l, err)
+		}
+		return
+	case "render":
+		if err = renderMaps(db, l, flag.Args()[1:]); err != nil {
+			fatal(l, err)
+		}
+		return
+	default:
+		fatal(l, fmt.Errorf("unknown command %q", cmd))
+	}
+
+	runServers(db, st, l)
+}
+
+// runServers runs the bootstrap, game and admin servers until interrupted.
+//
+// db is the local SQLite database, which is nil for ephemeral servers.
+func runServers(db *database.DB, st storage, l zerolog.Logger) {
+	if db == nil {
+		for name, set := range map[string]bool{
+			"-seed":            seed,
+			"-quarantine":      quarantineUploads,
+			"-backup-interval": backupInterval > 0,
+		} {
+			if set {
+				fatal(l, fmt.Errorf("%s cannot be used with -ephemeral", name))
+			}
+		}
+	}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		fatal(l, err)
+	}
+	zerolog.SetGlobalLevel(cfg.Level())
+
+	// Bootstrap server; used to allow Demon's Souls to configure it's network
+	// client.
+	bs, err := bootstrap.NewServer(portBootstrap, cfg.Bootstrap, l)
+	if err != nil {
+		fatal(l, err)
+	}
 
 	// Dependencies for the gamestate server.
 	rd, err := crypto.NewDecrypter(crypto.DefaultAESKey)
@@ -93,68 +245,274 @@ func main() {
 		fatal(l, err)
 	}
 
-	c, err := character.NewSQLiteService(db)
+	c, err := st.characters()
 	if err != nil {
 		fatal(l, err)
 	}
 
-	var mo []msg.Option
-	if seed {
-		mo = append(mo, msg.Seed())
+	mo := []msg.Option{
+		msg.RatingLimit(ratingLimit, ratingWindow),
+		msg.Retention(msgRetention),
 	}
-	ms, err := msg.NewSQLiteService(db, l, mo...)
+	switch msgStrategy {
+	case "weighted":
+		mo = append(mo, msg.Selection(msg.DefaultStrategy))
+	case "uniform":
+		mo = append(mo, msg.Selection(msg.Uniform))
+	default:
+		fatal(l, fmt.Errorf("unknown message selection strategy %q", msgStrategy))
+	}
+	ms, err := st.messages(l, mo...)
 	if err != nil {
 		fatal(l, err)
 	}
 
-	var ro []replay.Option
-	if seed {
-		ro = append(ro, replay.Seed())
+	jobs := newScheduler(l)
+	if msgPruneInterval > 0 {
+		jobs.every(msgPruneInterval, func() error {
+			pr, err := ms.Prune(context.Background(), false)
+			if err != nil {
+				return fmt.Errorf("prune messages: %w", err)
+			}
+			l.Info().Msgf("pruned blood messages %s", pr)
+			return nil
+		})
 	}
-	rs, err := replay.NewSQLiteService(db, l, ro...)
+
+	rs, err := st.replays(l, replay.Retention(replayRetention))
 	if err != nil {
 		fatal(l, err)
 	}
 
+	if replayPruneInterval > 0 {
+		jobs.every(replayPruneInterval, func() error {
+			pr, err := rs.Prune(context.Background(), false)
+			if err != nil {
+				return fmt.Errorf("prune replays: %w", err)
+			}
+			l.Info().Msgf("pruned replays %s", pr)
+			return nil
+		})
+	}
+
+	if seed {
+		if st.pg != nil {
+			fatal(l, fmt.Errorf("-seed requires %s storage", storageSQLite))
+		}
+		if err = seedLegacy(db, l); err != nil {
+			fatal(l, err)
+		}
+	}
+
+	if backupInterval > 0 {
+		snap := backup.NewSnapshotter(db.Reader, backupDir, backupKeep, l)
+		jobs.every(backupInterval, func() error {
+			path, err := snap.Snapshot(context.Background())
+			if err != nil {
+				return fmt.Errorf("snapshot database: %w", err)
+			}
+			l.Info().Msgf("snapshot database to %q", path)
+			return nil
+		})
+	}
+
+	// Rejected uploads are only stored if quarantine is enabled.
+	var (
+		gq game.Quarantine
+		aq admin.Quarantine
+	)
+	if quarantineUploads {
+		qs, err := quarantine.NewSQLiteService(db, l)
+		if err != nil {
+			fatal(l, err)
+		}
+		gq, aq = qs, qs
+	}
+
+	// In-memory state shared by every region, if not partitioned.
+	pt := cfg.Partitioning
+	var (
+		sharedSOS    *sos.Manager
+		sharedState  *gamestate.Memory
+		sharedGhosts *ghost.Memory
+	)
+	if pt.SOS == config.Shared {
+		sharedSOS, sharedState = sos.NewManager(l), gamestate.NewMemory()
+	}
+	if pt.Ghosts == config.Shared {
+		sharedGhosts = ghost.NewMemory(l)
+	}
+
+	// Game activity published by every region, streamed by the admin server.
+	bus := events.NewBus()
+
 	// Create a gamestate server for each supported region
-	for region, port := range gameServers {
+	regions := make([]admin.Region, 0, len(cfg.Regions))
+	stores := make(map[string]memoryStores, len(cfg.Regions))
+	servers := make([]server, 0, len(cfg.Regions)+1)
+	games := make(map[string]*game.Server, len(cfg.Regions))
+	rl := newReloader(configPath, cfg, bs, l)
+	for region, rc := range cfg.Regions {
+		sm, gst := sharedSOS, sharedState
+		if sm == nil {
+			sm, gst = sos.NewManager(l), gamestate.NewMemory()
+		}
+		gm := sharedGhosts
+		if gm == nil {
+			gm = ghost.NewMemory(l)
+		}
+		regions = append(regions, admin.Region{Name: region, SOS: sm})
+		stores[region] = memoryStores{ghosts: gm, sos: sm, players: gst}
+
 		gs, err := game.NewServer(
-			port,
+			rc.Listen,
+			game.Region{
+				Name:                   region,
+				PartitionMessages:      pt.Messages == config.Partitioned,
+				PartitionReplays:       pt.Replays == config.Partitioned,
+				PartitionWorldTendency: pt.WorldTendency == config.Partitioned,
+			},
+			cfg.Game,
 			rd,
 			c,
-			gamestate.NewMemory(),
+			gst,
 			ms,
-			ghost.NewMemory(l),
+			gm,
 			rs,
-			sos.NewManager(l),
+			sm,
+			gq,
+			bus,
 			l,
 		)
 		if err != nil {
 			fatal(l, err)
 		}
 		servers = append(servers, gs)
+		games[region] = gs
+		rl.games = append(rl.games, gs)
+	}
 
-		l.Info().Msg(region + " game server listening on " + port)
-		go func() {
-			if err = gs.Serve(); err != nil {
-				fatal(l, err)
+	// Restore the saved state before any server accepts requests, so the
+	// restore cannot race with, or overwrite, state from early requests.
+	if stateFile != "" {
+		if err = loadState(stateFile, stores, l); err != nil {
+			fatal(l, err)
+		}
+	}
+
+	for region, rc := range cfg.Regions {
+		l.Info().Msg(region + " game server listening on " + rc.Listen)
+		serve(l, games[region])
+	}
+
+	// Clients are only sent to the game servers once they are serving.
+	l.Info().Msg("bootstrap server listening on " + portBootstrap)
+	serve(l, bs)
+
+	// Admin server; used by operators and community tools to query data.
+	if adminAddr != "" {
+		as, err := admin.NewServer(adminAddr, ms, rs, regions, aq, bus, l)
+		if err != nil {
+			fatal(l, err)
+		}
+		servers = append(servers, as)
+
+		l.Info().Msg("admin server listening on " + adminAddr)
+		serve(l, as)
+	}
+
+	// The configuration is reloaded on SIGHUP, or when the file is modified.
+	reload := make(chan struct{}, 1)
+	if configPoll > 0 && configPath != "" {
+		jobs.every(configPoll, func() error {
+			if rl.modified() {
+				select {
+				case reload <- struct{}{}:
+				default:
+				}
 			}
-		}()
+			return nil
+		})
 	}
 
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+
 	sigChan := make(chan os.Signal, 2)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-	<-sigChan
+
+wait:
+	for {
+		select {
+		case <-sigChan:
+			break wait
+		case <-hupChan:
+		case <-reload:
+		}
+
+		if err = rl.reload(); err != nil {
+			l.Error().Err(err).Msg("reload config, keeping current config")
+		}
+	}
 
 	l.Info().Msg("shutting down servers...")
 
-	for _, s := range servers {
-		if err = s.Close(); err != nil {
-			l.Error().Err(err).Msg("close server")
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+
+	// Stop sending clients to the game servers before draining them, then
+	// wait for any scheduled jobs, so nothing is using the database by the
+	// time it is closed.
+	shutdown(ctx, l, bs)
+	shutdown(ctx, l, servers...)
+	jobs.stop()
+
+	if stateFile != "" {
+		if err = saveState(stateFile, stores); err != nil {
+			l.Error().Err(err).Msg("save state")
+		} else {
+			l.Info().Msgf("saved state to %q", stateFile)
 		}
 	}
 }
 
+// server is an HTTP server run by runServers.
+type server interface {
+	Serve() error
+	Shutdown(ctx context.Context) error
+	Close() error
+}
+
+// serve runs the server in the background, exiting if it stops for any reason
+// other than being shut down.
+func serve(l zerolog.Logger, s server) {
+	go func() {
+		if err := s.Serve(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal(l, err)
+		}
+	}()
+}
+
+// shutdown gracefully shuts down the servers concurrently. Servers with
+// requests still in-flight when the context is done are closed.
+func shutdown(ctx context.Context, l zerolog.Logger, servers ...server) {
+	var wg sync.WaitGroup
+	for _, s := range servers {
+		wg.Add(1)
+		go func(s server) {
+			defer wg.Done()
+
+			if err := s.Shutdown(ctx); err != nil {
+				l.Warn().Err(err).Msg("shutdown server, closing in-flight requests")
+				if err = s.Close(); err != nil {
+					l.Error().Err(err).Msg("close server")
+				}
+			}
+		}(s)
+	}
+	wg.Wait()
+}
+
 func fatal(l zerolog.Logger, err error) {
 	l.Fatal().Err(err).Msg("fatal error")
 }
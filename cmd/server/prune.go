@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"flag"
+
+	"github.com/danmrichards/dessego/internal/service/msg"
+	"github.com/danmrichards/dessego/internal/service/replay"
+	"github.com/rs/zerolog"
+)
+
+// prune deletes blood messages and replays according to the configured
+// retention policies.
+func prune(st storage, l zerolog.Logger, args []string) error {
+	fs := flag.NewFlagSet("prune", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "Report the messages and replays which would be deleted without deleting them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	ms, err := st.messages(l, msg.Retention(msgRetention))
+	if err != nil {
+		return err
+	}
+
+	pr, err := ms.Prune(context.Background(), *dryRun)
+	if err != nil {
+		return err
+	}
+	l.Info().Msgf("pruned blood messages %s", pr)
+
+	rs, err := st.replays(l, replay.Retention(replayRetention))
+	if err != nil {
+		return err
+	}
+
+	rpr, err := rs.Prune(context.Background(), *dryRun)
+	if err != nil {
+		return err
+	}
+	l.Info().Msgf("pruned replays %s", rpr)
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+
+	"github.com/rs/zerolog"
+)
+
+// recount rebuilds the message ratings and character message ratings from the
+// message rating ledger, and the character multiplayer grades from the grade
+// ledger.
+func recount(st storage, l zerolog.Logger) error {
+	c, err := st.characters()
+	if err != nil {
+		return err
+	}
+
+	ms, err := st.messages(l)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	l.Info().Msg("recounting message ratings")
+	if err = ms.RecountRatings(ctx); err != nil {
+		return err
+	}
+
+	ar, err := ms.AuthorRatings(ctx)
+	if err != nil {
+		return err
+	}
+
+	l.Info().Msgf("recounting character message ratings from %d authors", len(ar))
+	if err = c.SetMsgRatings(ctx, ar); err != nil {
+		return err
+	}
+
+	l.Info().Msg("recounting multiplayer grades")
+
+	return c.RecountGrades(ctx)
+}
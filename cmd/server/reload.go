@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/danmrichards/dessego/internal/config"
+	"github.com/danmrichards/dessego/internal/server/bootstrap"
+	"github.com/danmrichards/dessego/internal/server/game"
+	"github.com/rs/zerolog"
+)
+
+// reloader reloads the configuration file, applying the settings which may be
+// changed while the servers are running.
+type reloader struct {
+	path  string
+	bs    *bootstrap.Server
+	games []*game.Server
+	l     zerolog.Logger
+
+	// mu serialises reloads, which may be triggered by a signal and by the
+	// file changing at once.
+	mu      sync.Mutex
+	cfg     config.Config
+	modTime time.Time
+}
+
+// newReloader returns a reloader for the configuration file at path, which
+// the servers are running with cfg.
+func newReloader(path string, cfg config.Config, bs *bootstrap.Server, l zerolog.Logger) *reloader {
+	r := &reloader{path: path, cfg: cfg, bs: bs, l: l}
+	if fi, err := os.Stat(path); err == nil {
+		r.modTime = fi.ModTime()
+	}
+
+	return r
+}
+
+// reload reloads the configuration file. The running configuration is kept
+// if the file is invalid.
+func (r *reloader) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.path == "" {
+		return fmt.Errorf("no configuration file to reload")
+	}
+	if fi, err := os.Stat(r.path); err == nil {
+		r.modTime = fi.ModTime()
+	}
+
+	next, err := config.Load(r.path)
+	if err != nil {
+		return err
+	}
+	// Reload validates every setting, so nothing is applied unless all of
+	// them can be.
+	cfg, changed, restart, err := r.cfg.Reload(next)
+	if len(restart) > 0 {
+		r.l.Warn().
+			Str("path", r.path).
+			Strs("restart", restart).
+			Msg("config changes only take effect on restart")
+	}
+	if err != nil {
+		return fmt.Errorf("config %q: %w", r.path, err)
+	}
+
+	r.bs.ApplyConfig(cfg.Bootstrap)
+	for _, gs := range r.games {
+		gs.ApplySettings(cfg.Game)
+	}
+	zerolog.SetGlobalLevel(cfg.Level())
+	r.cfg = cfg
+
+	r.l.Info().
+		Str("path", r.path).
+		Strs("changed", changed).
+		Msg("reloaded config")
+
+	return nil
+}
+
+// modified returns true if the configuration file has been modified since it
+// was last loaded.
+func (r *reloader) modified() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fi, err := os.Stat(r.path)
+	return err == nil && !fi.ModTime().Equal(r.modTime)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/danmrichards/dessego/internal/database"
+	"github.com/danmrichards/dessego/internal/render"
+	"github.com/danmrichards/dessego/internal/service/gamestate"
+	"github.com/danmrichards/dessego/internal/service/msg"
+	"github.com/danmrichards/dessego/internal/service/replay"
+	"github.com/rs/zerolog"
+)
+
+// renderMaps writes an SVG map for each of the given blocks, or every known
+// block if none are given.
+//
+// Ghosts and SOS signs are only held in memory by a running server, so are
+// not drawn.
+func renderMaps(db *database.DB, l zerolog.Logger, args []string) error {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	out := fs.String("out", ".", "Directory to write the maps to")
+	limit := fs.Int("limit", 500, "Maximum number of the most recent replays to draw per block")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var ids []int32
+	for _, a := range fs.Args() {
+		if id, err := strconv.ParseInt(a, 10, 32); err == nil {
+			ids = append(ids, int32(id))
+			continue
+		}
+
+		bids := gamestate.Blocks(a)
+		if len(bids) == 0 {
+			return fmt.Errorf("unknown block %q", a)
+		}
+		ids = append(ids, bids...)
+	}
+	if len(ids) == 0 {
+		ids = gamestate.Blocks("")
+	}
+
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		return err
+	}
+
+	ms, err := msg.NewSQLiteService(db, l)
+	if err != nil {
+		return err
+	}
+	rs, err := replay.NewSQLiteService(db, l)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	for _, id := range ids {
+		m := render.Map{BlockID: id}
+
+		rps, err := rs.Recent(ctx, id, *limit)
+		if err != nil {
+			return err
+		}
+		m.AddReplays(rps)
+
+		mps, err := ms.Positions(ctx, id)
+		if err != nil {
+			return err
+		}
+		m.Items = append(m.Items, mps...)
+
+		fn := filepath.Join(*out, strconv.Itoa(int(id))+".svg")
+		if err = writeMap(fn, m); err != nil {
+			return err
+		}
+		l.Info().Msgf("rendered block %q to %s", gamestate.Block(id), fn)
+	}
+
+	return nil
+}
+
+// writeMap writes the map as an SVG image to the named file.
+func writeMap(fn string, m render.Map) error {
+	f, err := os.Create(fn)
+	if err != nil {
+		return err
+	}
+
+	if err = m.WriteSVG(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/danmrichards/dessego/internal/service/gamestate"
+	"github.com/danmrichards/dessego/internal/service/ghost"
+	"github.com/danmrichards/dessego/internal/service/sos"
+	"github.com/rs/zerolog"
+)
+
+// stateVersion is the version of the state file format.
+const stateVersion = 1
+
+// memoryStores are the in-memory stores of a region, which are lost on
+// shutdown unless saved to a state file.
+type memoryStores struct {
+	ghosts  *ghost.Memory
+	sos     *sos.Manager
+	players *gamestate.Memory
+}
+
+// savedState is the saved state of the in-memory stores of every region.
+type savedState struct {
+	Version int                    `json:"version"`
+	Saved   time.Time              `json:"saved"`
+	Regions map[string]regionState `json:"regions"`
+}
+
+// regionState is the saved state of the in-memory stores of a region.
+type regionState struct {
+	Ghosts  ghost.State       `json:"ghosts"`
+	SOS     sos.State         `json:"sos"`
+	Players map[string]string `json:"players"`
+}
+
+// saveState writes the state of the in-memory stores of each region to the
+// file at path.
+//
+// The state is written to a temporary file which replaces path once complete,
+// so path is never left partially written.
+func saveState(path string, stores map[string]memoryStores) (err error) {
+	sf := savedState{
+		Version: stateVersion,
+		Saved:   time.Now().UTC(),
+		Regions: make(map[string]regionState, len(stores)),
+	}
+	for region, ms := range stores {
+		sf.Regions[region] = regionState{
+			Ghosts:  ms.ghosts.State(),
+			SOS:     ms.sos.State(),
+			Players: ms.players.Players(),
+		}
+	}
+
+	b, err := json.Marshal(sf)
+	if err != nil {
+		return fmt.Errorf("encode state: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	defer func() {
+		if err != nil {
+			os.Remove(tmp)
+		}
+	}()
+	if err = ioutil.WriteFile(tmp, b, 0o600); err != nil {
+		return fmt.Errorf("write state: %w", err)
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("rename state: %w", err)
+	}
+
+	return nil
+}
+
+// loadState restores the in-memory stores of each region from the state file
+// at path, if it exists.
+//
+// Stores shared by several regions are restored from each of them, which is
+// harmless as restoring adds to the stores. The state of regions which are no
+// longer configured is discarded.
+func loadState(path string, stores map[string]memoryStores, l zerolog.Logger) error {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("read state: %w", err)
+	}
+
+	var sf savedState
+	if err = json.Unmarshal(b, &sf); err != nil {
+		return fmt.Errorf("decode state %q: %w", path, err)
+	}
+	if sf.Version != stateVersion {
+		return fmt.Errorf("state %q: unsupported version %d", path, sf.Version)
+	}
+
+	for region, rs := range sf.Regions {
+		ms, ok := stores[region]
+		if !ok {
+			l.Warn().Msgf("discarding saved state of unknown region %q", region)
+			continue
+		}
+
+		ms.ghosts.Restore(rs.Ghosts)
+		ms.sos.Restore(rs.SOS)
+		ms.players.Restore(rs.Players)
+
+		l.Info().Msgf(
+			"restored %d ghosts, %d SOS and %d players in region %q saved at %s",
+			len(rs.Ghosts.Ghosts), len(rs.SOS.Active), len(rs.Players), region,
+			sf.Saved.Format(time.RFC3339),
+		)
+	}
+
+	return nil
+}
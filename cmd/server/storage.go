@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/danmrichards/dessego/internal/database"
+	"github.com/danmrichards/dessego/internal/server/admin"
+	"github.com/danmrichards/dessego/internal/server/game"
+	"github.com/danmrichards/dessego/internal/service/character"
+	"github.com/danmrichards/dessego/internal/service/msg"
+	"github.com/danmrichards/dessego/internal/service/replay"
+	"github.com/rs/zerolog"
+)
+
+const (
+	storageSQLite   = "sqlite"
+	storagePostgres = "postgres"
+)
+
+// sqliteCommands are the commands which only work with the local SQLite
+// database, as they read or write characters, messages and replays directly.
+var sqliteCommands = map[string]bool{
+	"backup":  true,
+	"export":  true,
+	"import":  true,
+	"legacy":  true,
+	"render":  true,
+	"restore": true,
+}
+
+// characterService is a character service usable by the servers and commands.
+type characterService interface {
+	game.Characters
+
+	SetMsgRatings(ctx context.Context, ratings map[string]int) error
+	RecountGrades(ctx context.Context) error
+}
+
+// msgService is a messages service usable by the servers and commands.
+type msgService interface {
+	game.Messages
+	admin.Messages
+
+	Prune(ctx context.Context, dryRun bool) (msg.PruneReport, error)
+	RecountRatings(ctx context.Context) error
+	AuthorRatings(ctx context.Context) (map[string]int, error)
+}
+
+// replayService is a replays service usable by the servers and commands.
+type replayService interface {
+	game.Replays
+	admin.Replays
+
+	Prune(ctx context.Context, dryRun bool) (replay.PruneReport, error)
+}
+
+// storage is the database holding characters, messages and replays.
+//
+// Everything else, such as quarantined uploads, is always stored in the local
+// SQLite database.
+type storage struct {
+	sqlite *database.DB
+
+	// pg is the PostgreSQL database, if selected.
+	pg *sql.DB
+
+	// ephemeral is true if nothing is stored in a database. Each service
+	// returned holds its data in memory, so must only be requested once.
+	ephemeral bool
+}
+
+// openStorage returns the storage of the given kind.
+func openStorage(kind, dsn string, db *database.DB) (storage, error) {
+	switch kind {
+	case storageSQLite:
+		return storage{sqlite: db}, nil
+	case storagePostgres:
+		if dsn == "" {
+			return storage{}, fmt.Errorf("%s storage requires -postgres-dsn", kind)
+		}
+
+		pg, err := database.NewPostgres(dsn)
+		if err != nil {
+			return storage{}, err
+		}
+		return storage{sqlite: db, pg: pg}, nil
+	default:
+		return storage{}, fmt.Errorf("unknown storage %q", kind)
+	}
+}
+
+// Close closes the PostgreSQL database, if open. The SQLite database is owned
+// by the caller.
+func (st storage) Close() error {
+	if st.pg == nil {
+		return nil
+	}
+	return st.pg.Close()
+}
+
+// characters returns the character service for the storage.
+func (st storage) characters() (characterService, error) {
+	if st.ephemeral {
+		return character.NewMemoryService(), nil
+	}
+	if st.pg != nil {
+		return character.NewPostgresService(st.pg)
+	}
+	return character.NewSQLiteService(st.sqlite)
+}
+
+// messages returns the messages service for the storage.
+func (st storage) messages(l zerolog.Logger, opts ...msg.Option) (msgService, error) {
+	if st.ephemeral {
+		return msg.NewMemoryService(l, opts...), nil
+	}
+	if st.pg != nil {
+		return msg.NewPostgresService(st.pg, l, opts...)
+	}
+	return msg.NewSQLiteService(st.sqlite, l, opts...)
+}
+
+// replays returns the replays service for the storage.
+func (st storage) replays(l zerolog.Logger, opts ...replay.Option) (replayService, error) {
+	if st.ephemeral {
+		return replay.NewMemoryService(l, opts...), nil
+	}
+	if st.pg != nil {
+		return replay.NewPostgresService(st.pg, l, opts...)
+	}
+	return replay.NewSQLiteService(st.sqlite, l, opts...)
+}
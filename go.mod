@@ -3,6 +3,7 @@ module github.com/danmrichards/dessego
 go 1.15
 
 require (
+	github.com/lib/pq v1.10.9
 	github.com/mattn/go-sqlite3 v1.14.4
 	github.com/rs/zerolog v1.20.0
 )
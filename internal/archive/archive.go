@@ -0,0 +1,198 @@
+// Package archive exports and imports the persistent server dataset as a
+// portable, versioned archive, so a server can be moved between hosts or two
+// servers can merge their data.
+//
+// An archive is a JSON lines file. The first line is a header giving the
+// archive version, every following line is a record:
+//
+//	{"type":"header","data":{"version":1,"created":"2020-11-01T12:00:00Z"}}
+//	{"type":"character","data":{"id":"name0","grade_s":1,...}}
+//	{"type":"message","data":{"id":12,"character_id":"name0",...}}
+//
+// Records are written in dependency order: characters, world tendencies,
+// multiplayer grades, messages, message ratings and then replays.
+//
+// SOS signs, wandering ghosts and other game state are held in memory only and
+// are not archived.
+package archive
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Version is the archive version written by Export. Import accepts archives up
+// to and including this version.
+//
+// Version 2 added multiplayer grades, and version 3 the region of world
+// tendencies, messages and replays.
+const Version = 3
+
+// Type is the type of a record in an archive.
+type Type string
+
+const (
+	// TypeHeader is the archive header.
+	TypeHeader Type = "header"
+
+	// TypeCharacter is a character and their multiplayer stats.
+	TypeCharacter Type = "character"
+
+	// TypeWorldTendency is the world tendency of a character.
+	TypeWorldTendency Type = "world_tendency"
+
+	// TypeMultiplayerGrade is a multiplayer grade given to a character.
+	TypeMultiplayerGrade Type = "multiplayer_grade"
+
+	// TypeMessage is a blood message.
+	TypeMessage Type = "message"
+
+	// TypeMessageRating is a rating given to a blood message.
+	TypeMessageRating Type = "message_rating"
+
+	// TypeReplay is a bloodstain replay.
+	TypeReplay Type = "replay"
+)
+
+// record is a single line of an archive.
+type record struct {
+	Type Type            `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Header describes an archive.
+type Header struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+}
+
+// Character is an archived character.
+type Character struct {
+	ID        string `json:"id"`
+	GradeS    int    `json:"grade_s"`
+	GradeA    int    `json:"grade_a"`
+	GradeB    int    `json:"grade_b"`
+	GradeC    int    `json:"grade_c"`
+	GradeD    int    `json:"grade_d"`
+	Sessions  int    `json:"sessions"`
+	MsgRating int    `json:"msg_rating"`
+}
+
+// Tendency is the tendency of a single area.
+type Tendency struct {
+	Area int `json:"area"`
+	WB   int `json:"wb"`
+	LR   int `json:"lr"`
+}
+
+// WorldTendency is an archived character world tendency.
+type WorldTendency struct {
+	CharacterID string      `json:"character_id"`
+	Areas       [7]Tendency `json:"areas"`
+	Region      string      `json:"region,omitempty"`
+}
+
+// MultiplayerGrade is an archived multiplayer grade.
+type MultiplayerGrade struct {
+	GiverID    string `json:"giver_id"`
+	ReceiverID string `json:"receiver_id"`
+	Grade      string `json:"grade"`
+	Session    int    `json:"session"`
+	Created    int64  `json:"created"`
+}
+
+// Message is an archived blood message.
+type Message struct {
+	ID           int64   `json:"id"`
+	CharacterID  string  `json:"character_id"`
+	BlockID      int32   `json:"block_id"`
+	PosX         float32 `json:"posx"`
+	PosY         float32 `json:"posy"`
+	PosZ         float32 `json:"posz"`
+	AngX         float32 `json:"angx"`
+	AngY         float32 `json:"angy"`
+	AngZ         float32 `json:"angz"`
+	MsgID        uint32  `json:"msg_id"`
+	MainMsgID    uint32  `json:"main_msg_id"`
+	AddMsgCateID uint32  `json:"add_msg_cate_id"`
+	Rating       uint32  `json:"rating"`
+	Legacy       uint32  `json:"legacy"`
+	Created      int64   `json:"created"`
+	Text         string  `json:"text"`
+	Region       string  `json:"region,omitempty"`
+}
+
+// MessageRating is an archived blood message rating.
+type MessageRating struct {
+	MessageID   int64  `json:"message_id"`
+	CharacterID string `json:"character_id"`
+	AuthorID    string `json:"author_id"`
+	Created     int64  `json:"created"`
+}
+
+// Replay is an archived bloodstain replay.
+type Replay struct {
+	ID           int64   `json:"id"`
+	CharacterID  string  `json:"character_id"`
+	BlockID      int32   `json:"block_id"`
+	PosX         float32 `json:"posx"`
+	PosY         float32 `json:"posy"`
+	PosZ         float32 `json:"posz"`
+	AngX         float32 `json:"angx"`
+	AngY         float32 `json:"angy"`
+	AngZ         float32 `json:"angz"`
+	MsgID        uint32  `json:"msg_id"`
+	MainMsgID    uint32  `json:"main_msg_id"`
+	AddMsgCateID uint32  `json:"add_msg_cate_id"`
+	Data         []byte  `json:"data"`
+	Legacy       uint32  `json:"legacy"`
+	Created      int64   `json:"created"`
+	Region       string  `json:"region,omitempty"`
+}
+
+// Count is the number of records of a type processed.
+type Count struct {
+	// Records is the number of records in the archive.
+	Records int
+
+	// Added is the number of records written to the archive on export, or
+	// added to the database on import. Records which already exist in the
+	// database are not added again.
+	Added int
+}
+
+// Report details the outcome of an export or import.
+type Report map[Type]*Count
+
+// count returns the count for the given type.
+func (r Report) count(t Type) *Count {
+	c, ok := r[t]
+	if !ok {
+		c = &Count{}
+		r[t] = c
+	}
+	return c
+}
+
+// String implements fmt.Stringer.
+func (r Report) String() string {
+	types := make([]string, 0, len(r))
+	for t := range r {
+		types = append(types, string(t))
+	}
+	sort.Strings(types)
+
+	var sb strings.Builder
+	for i, t := range types {
+		if i > 0 {
+			sb.WriteString(" ")
+		}
+		c := r[Type(t)]
+		fmt.Fprintf(&sb, "%s: %d/%d", t, c.Added, c.Records)
+	}
+
+	return sb.String()
+}
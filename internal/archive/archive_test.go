@@ -0,0 +1,217 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danmrichards/dessego/internal/database"
+	"github.com/danmrichards/dessego/internal/service/character"
+	"github.com/danmrichards/dessego/internal/service/msg"
+	"github.com/danmrichards/dessego/internal/service/replay"
+	"github.com/rs/zerolog"
+)
+
+func TestMain(m *testing.M) {
+	// The services load their DDL relative to the repository root.
+	if err := os.Chdir("../.."); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	os.Exit(m.Run())
+}
+
+type testServices struct {
+	db *database.DB
+	cs *character.SQLiteService
+	ms *msg.SQLiteService
+	rs *replay.SQLiteService
+}
+
+func newTestServices(t *testing.T) testServices {
+	t.Helper()
+
+	db, err := database.NewSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	ts := testServices{db: db}
+	if ts.cs, err = character.NewSQLiteService(db); err != nil {
+		t.Fatal(err)
+	}
+	if ts.ms, err = msg.NewSQLiteService(db, zerolog.Nop()); err != nil {
+		t.Fatal(err)
+	}
+	if ts.rs, err = replay.NewSQLiteService(db, zerolog.Nop()); err != nil {
+		t.Fatal(err)
+	}
+
+	return ts
+}
+
+func TestExportImport(t *testing.T) {
+	src := newTestServices(t)
+
+	if err := src.cs.EnsureCreate(context.Background(), "author0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.cs.SetTendency(context.Background(), "author0", "EU", character.WorldTendency{Area1: 1, LR7: 7}); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.cs.AddGrade(context.Background(), &character.Grade{
+		GiverID:    "rater0",
+		ReceiverID: "author0",
+		Grade:      character.GradeA,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := src.ms.Add(context.Background(), msg.BloodMsg{
+			CharacterID: "author0",
+			BlockID:     20070,
+			PosX:        float32(i),
+			Created:     time.Unix(1600000000, 0),
+			Region:      "US",
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := src.ms.Rate(context.Background(), 2, "rater0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.rs.Add(context.Background(), &replay.Replay{
+		CharacterID: "author0",
+		BlockID:     20070,
+		Data:        []byte("replay\x00data"),
+		Region:      "JP",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	rep, err := Export(context.Background(), src.db.Reader, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rep.String(); got != "character: 1/1 message: 2/2 message_rating: 1/1 multiplayer_grade: 1/1 replay: 1/1 world_tendency: 1/1" {
+		t.Fatalf("unexpected export report: %s", got)
+	}
+
+	// The destination already has a message, so imported messages are given
+	// new IDs.
+	dst := newTestServices(t)
+	if err = dst.ms.Add(context.Background(), msg.BloodMsg{CharacterID: "other0", BlockID: 20070}); err != nil {
+		t.Fatal(err)
+	}
+
+	archive := buf.String()
+	for i, want := range []string{
+		"character: 1/1 message: 2/2 message_rating: 1/1 multiplayer_grade: 1/1 replay: 1/1 world_tendency: 1/1",
+		"character: 0/1 message: 0/2 message_rating: 0/1 multiplayer_grade: 0/1 replay: 0/1 world_tendency: 0/1",
+	} {
+		if rep, err = Import(context.Background(), dst.db.Writer, strings.NewReader(archive), false); err != nil {
+			t.Fatal(err)
+		}
+		if got := rep.String(); got != want {
+			t.Fatalf("import %d: expected report %q got %q", i, want, got)
+		}
+	}
+
+	var (
+		id     int
+		posX   float32
+		rating int
+		region string
+	)
+	if err = dst.db.Reader.QueryRow(
+		`SELECT m.id, m.posx, m.rating, m.region
+		FROM message_rating mr
+		JOIN message m ON m.id = mr.message_id
+		WHERE mr.character_id = 'rater0'`,
+	).Scan(&id, &posX, &rating, &region); err != nil {
+		t.Fatal(err)
+	}
+	if id != 3 || posX != 1 || rating != 1 || region != "US" {
+		t.Fatalf("expected rating of message 3 at x 1 with rating 1 in US got message %d at x %v with rating %d in %q", id, posX, rating, region)
+	}
+
+	wts, err := dst.cs.WorldTendency(context.Background(), "EU", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(wts) != 1 || wts[0].LR7 != 7 {
+		t.Fatalf("expected EU world tendency got: %v", wts)
+	}
+
+	st, err := dst.cs.Stats(context.Background(), "author0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.GradeA != 1 {
+		t.Fatalf("expected grade A: 1 got: %d", st.GradeA)
+	}
+
+	r, err := dst.rs.Get(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(r.Data) != "replay\x00data" || r.Region != "JP" {
+		t.Fatalf("unexpected replay: %q in %q", r.Data, r.Region)
+	}
+}
+
+func TestImport_dryRun(t *testing.T) {
+	src := newTestServices(t)
+	if err := src.cs.EnsureCreate(context.Background(), "author0"); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := Export(context.Background(), src.db.Reader, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := newTestServices(t)
+	rep, err := Import(context.Background(), dst.db.Writer, &buf, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep[TypeCharacter].Added != 1 {
+		t.Fatalf("expected 1 character to be added got: %s", rep)
+	}
+
+	var n int
+	if err = dst.db.Reader.QueryRow(`SELECT count(*) FROM character`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatalf("expected no characters got %d", n)
+	}
+}
+
+func TestImport_invalid(t *testing.T) {
+	dst := newTestServices(t)
+
+	for name, tc := range map[string]string{
+		"empty":          "",
+		"missing header": `{"type":"character","data":{"id":"a"}}`,
+		"future version": `{"type":"header","data":{"version":99}}`,
+		"unknown type":   `{"type":"header","data":{"version":1}}` + "\n" + `{"type":"ban","data":{}}`,
+		"unknown message": `{"type":"header","data":{"version":1}}` + "\n" +
+			`{"type":"message_rating","data":{"message_id":1}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Import(context.Background(), dst.db.Writer, strings.NewReader(tc), false); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package archive
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// exporter writes records to an archive.
+type exporter struct {
+	enc *json.Encoder
+	r   Report
+}
+
+// write writes a record of the given type.
+func (e *exporter) write(t Type, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("marshal %s: %w", t, err)
+	}
+	if err = e.enc.Encode(record{Type: t, Data: data}); err != nil {
+		return fmt.Errorf("write %s: %w", t, err)
+	}
+
+	c := e.r.count(t)
+	c.Records++
+	c.Added++
+
+	return nil
+}
+
+// query writes a record of the given type for each row selected by the query.
+// scan scans a row into a new record.
+func (e *exporter) query(
+	ctx context.Context,
+	tx *sql.Tx,
+	t Type,
+	query string,
+	scan func(rows *sql.Rows) (interface{}, error),
+) error {
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("query %s: %w", t, err)
+	}
+	defer rows.Close()
+
+	e.r.count(t)
+	for rows.Next() {
+		v, err := scan(rows)
+		if err != nil {
+			return fmt.Errorf("scan %s: %w", t, err)
+		}
+		if err = e.write(t, v); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// Export writes every character, world tendency, multiplayer grade, message,
+// message rating and replay in the database to w as an archive.
+func Export(ctx context.Context, db *sql.DB, w io.Writer) (Report, error) {
+	bw := bufio.NewWriter(w)
+	e := &exporter{enc: json.NewEncoder(bw), r: make(Report)}
+
+	if err := e.write(TypeHeader, Header{
+		Version: Version,
+		Created: time.Now().UTC(),
+	}); err != nil {
+		return nil, err
+	}
+	delete(e.r, TypeHeader)
+
+	// Export from a single snapshot of the database.
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("db tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err = e.query(ctx, tx, TypeCharacter,
+		`SELECT id, grade_s, grade_a, grade_b, grade_c, grade_d, sessions, msg_rating
+		FROM character
+		ORDER BY id`,
+		func(rows *sql.Rows) (interface{}, error) {
+			c := &Character{}
+			return c, rows.Scan(
+				&c.ID, &c.GradeS, &c.GradeA, &c.GradeB, &c.GradeC, &c.GradeD,
+				&c.Sessions, &c.MsgRating,
+			)
+		},
+	); err != nil {
+		return nil, err
+	}
+
+	if err = e.query(ctx, tx, TypeWorldTendency,
+		`SELECT character_id,
+			area_1, wb_1, lr_1,
+			area_2, wb_2, lr_2,
+			area_3, wb_3, lr_3,
+			area_4, wb_4, lr_4,
+			area_5, wb_5, lr_5,
+			area_6, wb_6, lr_6,
+			area_7, wb_7, lr_7,
+			region
+		FROM world_tendency
+		ORDER BY id`,
+		func(rows *sql.Rows) (interface{}, error) {
+			wt := &WorldTendency{}
+			dest := []interface{}{&wt.CharacterID}
+			for i := range wt.Areas {
+				a := &wt.Areas[i]
+				dest = append(dest, &a.Area, &a.WB, &a.LR)
+			}
+			return wt, rows.Scan(append(dest, &wt.Region)...)
+		},
+	); err != nil {
+		return nil, err
+	}
+
+	if err = e.query(ctx, tx, TypeMultiplayerGrade,
+		`SELECT giver_id, receiver_id, grade, session, created
+		FROM multiplayer_grade
+		ORDER BY id`,
+		func(rows *sql.Rows) (interface{}, error) {
+			mg := &MultiplayerGrade{}
+			return mg, rows.Scan(
+				&mg.GiverID, &mg.ReceiverID, &mg.Grade, &mg.Session, &mg.Created,
+			)
+		},
+	); err != nil {
+		return nil, err
+	}
+
+	if err = e.query(ctx, tx, TypeMessage,
+		`SELECT id, character_id, block_id, posx, posy, posz, angx, angy, angz,
+			msg_id, main_msg_id, add_msg_cate_id, rating, legacy, created, text,
+			region
+		FROM message
+		ORDER BY id`,
+		func(rows *sql.Rows) (interface{}, error) {
+			m := &Message{}
+			return m, rows.Scan(
+				&m.ID, &m.CharacterID, &m.BlockID,
+				&m.PosX, &m.PosY, &m.PosZ, &m.AngX, &m.AngY, &m.AngZ,
+				&m.MsgID, &m.MainMsgID, &m.AddMsgCateID,
+				&m.Rating, &m.Legacy, &m.Created, &m.Text, &m.Region,
+			)
+		},
+	); err != nil {
+		return nil, err
+	}
+
+	if err = e.query(ctx, tx, TypeMessageRating,
+		`SELECT message_id, character_id, author_id, created
+		FROM message_rating
+		ORDER BY message_id, character_id`,
+		func(rows *sql.Rows) (interface{}, error) {
+			mr := &MessageRating{}
+			return mr, rows.Scan(
+				&mr.MessageID, &mr.CharacterID, &mr.AuthorID, &mr.Created,
+			)
+		},
+	); err != nil {
+		return nil, err
+	}
+
+	if err = e.query(ctx, tx, TypeReplay,
+		`SELECT id, character_id, block_id, posx, posy, posz, angx, angy, angz,
+			msg_id, main_msg_id, add_msg_cate_id, data, legacy, created, region
+		FROM replay
+		ORDER BY id`,
+		func(rows *sql.Rows) (interface{}, error) {
+			r := &Replay{}
+			return r, rows.Scan(
+				&r.ID, &r.CharacterID, &r.BlockID,
+				&r.PosX, &r.PosY, &r.PosZ, &r.AngX, &r.AngY, &r.AngZ,
+				&r.MsgID, &r.MainMsgID, &r.AddMsgCateID,
+				&r.Data, &r.Legacy, &r.Created, &r.Region,
+			)
+		},
+	); err != nil {
+		return nil, err
+	}
+
+	if err = bw.Flush(); err != nil {
+		return nil, fmt.Errorf("flush: %w", err)
+	}
+
+	return e.r, nil
+}
@@ -0,0 +1,315 @@
+package archive
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxLineSize is the maximum size in bytes of a single archive record.
+const maxLineSize = 4 << 20
+
+// importer adds records from an archive to the database.
+type importer struct {
+	ctx context.Context
+	tx  *sql.Tx
+	r   Report
+
+	// msgIDs maps archived message IDs to their IDs in the database.
+	msgIDs map[int64]int64
+}
+
+// Import adds the records in the archive read from r to the database.
+//
+// Messages and replays are given new IDs, and message ratings are remapped to
+// the new message IDs, so archives from other servers can be merged into an
+// existing database. Records which already exist are not added again, so
+// importing the same archive twice has no effect.
+//
+// The multiplayer grades of existing characters are not updated by imported
+// grades until they are recounted from the grade ledger. Imported messages and
+// characters keep the ratings they have beyond the imported rating ledger when
+// they are next recounted.
+//
+// The archive is imported in a single transaction. If dryRun is true the
+// transaction is rolled back, reporting what would have been added.
+func Import(ctx context.Context, db *sql.DB, r io.Reader, dryRun bool) (rep Report, err error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, maxLineSize)
+
+	if err = readHeader(sc); err != nil {
+		return nil, err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("db tx: %w", err)
+	}
+	defer func() {
+		if err != nil || dryRun {
+			tx.Rollback()
+		}
+	}()
+
+	im := &importer{ctx: ctx, tx: tx, r: make(Report), msgIDs: make(map[int64]int64)}
+	for line := 2; sc.Scan(); line++ {
+		var rec record
+		if err = json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if err = im.add(rec); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	if err = sc.Err(); err != nil {
+		return nil, fmt.Errorf("read archive: %w", err)
+	}
+
+	if dryRun {
+		return im.r, nil
+	}
+
+	return im.r, tx.Commit()
+}
+
+// readHeader reads and checks the archive header.
+func readHeader(sc *bufio.Scanner) error {
+	if !sc.Scan() {
+		if err := sc.Err(); err != nil {
+			return fmt.Errorf("read header: %w", err)
+		}
+		return errors.New("empty archive")
+	}
+
+	var (
+		rec record
+		h   Header
+	)
+	if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+		return fmt.Errorf("read header: %w", err)
+	}
+	if rec.Type != TypeHeader {
+		return errors.New("missing archive header")
+	}
+	if err := json.Unmarshal(rec.Data, &h); err != nil {
+		return fmt.Errorf("read header: %w", err)
+	}
+	if h.Version < 1 || h.Version > Version {
+		return fmt.Errorf("unsupported archive version %d", h.Version)
+	}
+
+	return nil
+}
+
+// add adds a single record to the database.
+func (im *importer) add(rec record) (err error) {
+	var (
+		v   interface{}
+		add func() (bool, error)
+	)
+	switch rec.Type {
+	case TypeCharacter:
+		c := &Character{}
+		v, add = c, func() (bool, error) { return im.addCharacter(c) }
+	case TypeWorldTendency:
+		wt := &WorldTendency{}
+		v, add = wt, func() (bool, error) { return im.addWorldTendency(wt) }
+	case TypeMultiplayerGrade:
+		mg := &MultiplayerGrade{}
+		v, add = mg, func() (bool, error) { return im.addMultiplayerGrade(mg) }
+	case TypeMessage:
+		m := &Message{}
+		v, add = m, func() (bool, error) { return im.addMessage(m) }
+	case TypeMessageRating:
+		mr := &MessageRating{}
+		v, add = mr, func() (bool, error) { return im.addMessageRating(mr) }
+	case TypeReplay:
+		r := &Replay{}
+		v, add = r, func() (bool, error) { return im.addReplay(r) }
+	default:
+		return fmt.Errorf("unknown record type %q", rec.Type)
+	}
+
+	if err = json.Unmarshal(rec.Data, v); err != nil {
+		return fmt.Errorf("decode %s: %w", rec.Type, err)
+	}
+
+	added, err := add()
+	if err != nil {
+		return fmt.Errorf("add %s: %w", rec.Type, err)
+	}
+
+	c := im.r.count(rec.Type)
+	c.Records++
+	if added {
+		c.Added++
+	}
+
+	return nil
+}
+
+// exec executes the query, returning true if any rows were affected.
+func (im *importer) exec(query string, args ...interface{}) (bool, error) {
+	res, err := im.tx.ExecContext(im.ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// addCharacter adds the character, unless a character with the same ID
+// exists.
+func (im *importer) addCharacter(c *Character) (bool, error) {
+	return im.exec(
+		`INSERT OR IGNORE INTO character (
+			id, grade_s, grade_a, grade_b, grade_c, grade_d, sessions, msg_rating,
+			msg_rating_base
+		)
+		VALUES (?,?,?,?,?,?,?,?,NULL)`,
+		c.ID, c.GradeS, c.GradeA, c.GradeB, c.GradeC, c.GradeD,
+		c.Sessions, c.MsgRating,
+	)
+}
+
+// addWorldTendency adds the world tendency, unless the character already has
+// a world tendency.
+func (im *importer) addWorldTendency(wt *WorldTendency) (bool, error) {
+	args := []interface{}{wt.CharacterID}
+	for _, a := range wt.Areas {
+		args = append(args, a.Area, a.WB, a.LR)
+	}
+	args = append(args, wt.Region)
+
+	return im.exec(
+		`INSERT INTO world_tendency (
+			character_id,
+			area_1, wb_1, lr_1,
+			area_2, wb_2, lr_2,
+			area_3, wb_3, lr_3,
+			area_4, wb_4, lr_4,
+			area_5, wb_5, lr_5,
+			area_6, wb_6, lr_6,
+			area_7, wb_7, lr_7,
+			region
+		)
+		SELECT ?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?
+		WHERE NOT EXISTS (
+			SELECT 1 FROM world_tendency WHERE character_id = ?
+		)`,
+		append(args, wt.CharacterID)...,
+	)
+}
+
+// addMultiplayerGrade adds the grade, unless the giver has already graded the
+// receiver in the same session.
+func (im *importer) addMultiplayerGrade(mg *MultiplayerGrade) (bool, error) {
+	return im.exec(
+		`INSERT OR IGNORE INTO multiplayer_grade
+			(giver_id, receiver_id, grade, session, created)
+		VALUES (?,?,?,?,?)`,
+		mg.GiverID, mg.ReceiverID, mg.Grade, mg.Session, mg.Created,
+	)
+}
+
+// addMessage adds the message with a new ID, unless an identical message
+// exists. The new or existing ID is recorded so ratings can be remapped.
+func (im *importer) addMessage(m *Message) (bool, error) {
+	var id int64
+	err := im.tx.QueryRowContext(
+		im.ctx,
+		`SELECT id
+		FROM message
+		WHERE character_id = ?
+		AND block_id = ?
+		AND posx = ? AND posy = ? AND posz = ?
+		AND msg_id = ? AND main_msg_id = ? AND add_msg_cate_id = ?
+		AND created = ?
+		LIMIT 1`,
+		m.CharacterID, m.BlockID, m.PosX, m.PosY, m.PosZ,
+		m.MsgID, m.MainMsgID, m.AddMsgCateID, m.Created,
+	).Scan(&id)
+	switch {
+	case err == nil:
+		im.msgIDs[m.ID] = id
+		return false, nil
+	case !errors.Is(err, sql.ErrNoRows):
+		return false, fmt.Errorf("query existing: %w", err)
+	}
+
+	res, err := im.tx.ExecContext(
+		im.ctx,
+		`INSERT INTO message (
+			character_id, block_id, posx, posy, posz, angx, angy, angz,
+			msg_id, main_msg_id, add_msg_cate_id, rating, legacy, created, text,
+			region, rating_base
+		)
+		VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,NULL)`,
+		m.CharacterID, m.BlockID, m.PosX, m.PosY, m.PosZ, m.AngX, m.AngY, m.AngZ,
+		m.MsgID, m.MainMsgID, m.AddMsgCateID, m.Rating, m.Legacy, m.Created, m.Text,
+		m.Region,
+	)
+	if err != nil {
+		return false, err
+	}
+	if im.msgIDs[m.ID], err = res.LastInsertId(); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// addMessageRating adds the rating to the remapped message, unless the
+// character has already rated the message.
+func (im *importer) addMessageRating(mr *MessageRating) (bool, error) {
+	id, ok := im.msgIDs[mr.MessageID]
+	if !ok {
+		return false, fmt.Errorf("unknown message %d", mr.MessageID)
+	}
+
+	return im.exec(
+		`INSERT OR IGNORE INTO message_rating
+			(message_id, character_id, author_id, created)
+		VALUES (?,?,?,?)`,
+		id, mr.CharacterID, mr.AuthorID, mr.Created,
+	)
+}
+
+// addReplay adds the replay with a new ID, unless an identical replay exists.
+func (im *importer) addReplay(r *Replay) (bool, error) {
+	var exists bool
+	if err := im.tx.QueryRowContext(
+		im.ctx,
+		`SELECT EXISTS (
+			SELECT 1
+			FROM replay
+			WHERE character_id = ?
+			AND block_id = ?
+			AND posx = ? AND posy = ? AND posz = ?
+			AND created = ?
+			AND data = ?
+		)`,
+		r.CharacterID, r.BlockID, r.PosX, r.PosY, r.PosZ, r.Created, r.Data,
+	).Scan(&exists); err != nil {
+		return false, fmt.Errorf("query existing: %w", err)
+	}
+	if exists {
+		return false, nil
+	}
+
+	return im.exec(
+		`INSERT INTO replay (
+			character_id, block_id, posx, posy, posz, angx, angy, angz,
+			msg_id, main_msg_id, add_msg_cate_id, data, legacy, created, region
+		)
+		VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+		r.CharacterID, r.BlockID, r.PosX, r.PosY, r.PosZ, r.AngX, r.AngY, r.AngZ,
+		r.MsgID, r.MainMsgID, r.AddMsgCateID, r.Data, r.Legacy, r.Created,
+		r.Region,
+	)
+}
@@ -0,0 +1,177 @@
+// Package backup takes consistent snapshots of the SQLite database while the
+// server is running, using the SQLite online backup API, and restores them.
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/danmrichards/dessego/internal/database"
+	"github.com/mattn/go-sqlite3"
+)
+
+// Backup writes a consistent copy of the database db to the file dest.
+//
+// The copy is written to a temporary file which replaces dest once complete,
+// so dest is never left partially written.
+func Backup(ctx context.Context, db *sql.DB, dest string) (err error) {
+	tmp := dest + ".tmp"
+	defer func() {
+		if err != nil {
+			os.Remove(tmp)
+		}
+	}()
+
+	if err = copyDB(ctx, db, tmp); err != nil {
+		return err
+	}
+
+	if err = os.Rename(tmp, dest); err != nil {
+		return fmt.Errorf("rename backup: %w", err)
+	}
+
+	return nil
+}
+
+// copyDB copies every page of the database db to a new database at path.
+func copyDB(ctx context.Context, db *sql.DB, path string) error {
+	destDB, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return fmt.Errorf("open backup: %w", err)
+	}
+	defer destDB.Close()
+
+	destConn, err := destDB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("backup conn: %w", err)
+	}
+	defer destConn.Close()
+
+	srcConn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("database conn: %w", err)
+	}
+	defer srcConn.Close()
+
+	return destConn.Raw(func(dc interface{}) error {
+		return srcConn.Raw(func(sc interface{}) error {
+			d, ok := dc.(*sqlite3.SQLiteConn)
+			if !ok {
+				return errors.New("backup is not a SQLite database")
+			}
+			s, ok := sc.(*sqlite3.SQLiteConn)
+			if !ok {
+				return errors.New("database is not a SQLite database")
+			}
+
+			b, err := d.Backup("main", s, "main")
+			if err != nil {
+				return fmt.Errorf("start backup: %w", err)
+			}
+
+			// Copy every page in a single step, so the backup is a snapshot
+			// of the database at a single point in time.
+			if _, err = b.Step(-1); err != nil {
+				b.Close()
+				return fmt.Errorf("backup step: %w", err)
+			}
+
+			if err = b.Finish(); err != nil {
+				return fmt.Errorf("finish backup: %w", err)
+			}
+
+			return nil
+		})
+	})
+}
+
+// VersionError is returned when restoring a backup with a schema version
+// which this server does not support.
+type VersionError int
+
+// Error implements error.
+func (v VersionError) Error() string {
+	return fmt.Sprintf(
+		"unsupported schema version %d, expected 0 to %d",
+		int(v), database.SchemaVersion,
+	)
+}
+
+// Validate checks the backup at path is an intact database with a schema
+// version supported by this server. Older schemas, including those of
+// databases created before the schema was versioned, are migrated when the
+// server next starts.
+func Validate(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return fmt.Errorf("open backup: %w", err)
+	}
+	defer db.Close()
+
+	var res string
+	if err = db.QueryRow(`PRAGMA integrity_check`).Scan(&res); err != nil {
+		return fmt.Errorf("integrity check: %w", err)
+	}
+	if res != "ok" {
+		return fmt.Errorf("integrity check: %s", res)
+	}
+
+	v, err := database.UserVersion(db)
+	if err != nil {
+		return err
+	}
+	if v < 0 || v > database.SchemaVersion {
+		return VersionError(v)
+	}
+
+	return nil
+}
+
+// Restore replaces the database file at dbPath with the backup at path, once
+// the backup has been validated. The replaced database is kept alongside it,
+// with the suffix ".pre-restore".
+//
+// The server must not be running while the database is restored.
+func Restore(path, dbPath string) (err error) {
+	if err = Validate(path); err != nil {
+		return err
+	}
+
+	// Copy through the backup API, so the backup itself is left untouched.
+	src, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return fmt.Errorf("open backup: %w", err)
+	}
+	defer src.Close()
+
+	tmp := dbPath + ".restore"
+	defer func() {
+		if err != nil {
+			os.Remove(tmp)
+		}
+	}()
+	if err = copyDB(context.Background(), src, tmp); err != nil {
+		return err
+	}
+
+	// Journals belong to the replaced database, so are kept with it.
+	for _, suffix := range []string{"", "-journal", "-wal", "-shm"} {
+		err = os.Rename(dbPath+suffix, dbPath+".pre-restore"+suffix)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("keep database: %w", err)
+		}
+	}
+
+	if err = os.Rename(tmp, dbPath); err != nil {
+		return fmt.Errorf("swap database: %w", err)
+	}
+
+	return nil
+}
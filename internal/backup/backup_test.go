@@ -0,0 +1,180 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/danmrichards/dessego/internal/database"
+	"github.com/rs/zerolog"
+)
+
+func newTestDB(t *testing.T, path string, version int) *database.DB {
+	t.Helper()
+
+	db, err := database.NewSQLite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err = db.Writer.Exec(`CREATE TABLE test (id INTEGER PRIMARY KEY)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Writer.Exec(`INSERT INTO test (id) VALUES (1), (2)`); err != nil {
+		t.Fatal(err)
+	}
+	if err = database.SetUserVersion(db.Writer, version); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func countRows(t *testing.T, path string) (n int) {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err = db.QueryRow(`SELECT count(*) FROM test`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+
+	return n
+}
+
+func TestBackupRestore(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "dessego.db")
+	db := newTestDB(t, dbPath, database.SchemaVersion)
+
+	bp := filepath.Join(dir, "backup.db")
+	if err := Backup(context.Background(), db.Reader, bp); err != nil {
+		t.Fatal(err)
+	}
+
+	// Changes after the backup are lost on restore.
+	if _, err := db.Writer.Exec(`INSERT INTO test (id) VALUES (3)`); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	if err := Restore(bp, dbPath); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := countRows(t, dbPath); n != 2 {
+		t.Fatalf("expected 2 rows in restored database got %d", n)
+	}
+	if n := countRows(t, dbPath+".pre-restore"); n != 3 {
+		t.Fatalf("expected 3 rows in replaced database got %d", n)
+	}
+}
+
+func TestRestore_version(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "dessego.db")
+
+	for _, v := range []int{-1, database.SchemaVersion + 1} {
+		bp := filepath.Join(dir, "backup.db")
+		os.Remove(bp)
+		newTestDB(t, bp, v)
+
+		var verr VersionError
+		if err := Restore(bp, dbPath); !errors.As(err, &verr) {
+			t.Fatalf("version %d: expected version error got: %v", v, err)
+		}
+	}
+
+	if _, err := os.Stat(dbPath); !os.IsNotExist(err) {
+		t.Fatalf("expected database not to be restored got: %v", err)
+	}
+}
+
+func TestBackupRestore_version(t *testing.T) {
+	tests := []struct {
+		name    string
+		version int
+		valid   bool
+	}{
+		{name: "current", version: database.SchemaVersion, valid: true},
+		{name: "older", version: database.SchemaVersion - 1, valid: true},
+		{name: "unversioned", version: 0, valid: true},
+		{name: "newer", version: database.SchemaVersion + 1},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			dbPath := filepath.Join(dir, "dessego.db")
+
+			// A backup taken by a server with the given schema version.
+			src := newTestDB(t, filepath.Join(dir, "src.db"), tc.version)
+			bp := filepath.Join(dir, "backup.db")
+			if err := Backup(context.Background(), src.Reader, bp); err != nil {
+				t.Fatal(err)
+			}
+
+			var verr VersionError
+			err := Restore(bp, dbPath)
+			switch {
+			case tc.valid && err != nil:
+				t.Fatal(err)
+			case !tc.valid && !errors.As(err, &verr):
+				t.Fatalf("expected version error got: %v", err)
+			}
+
+			_, err = os.Stat(dbPath)
+			if restored := err == nil; restored != tc.valid {
+				t.Fatalf("expected restored: %t got: %t", tc.valid, restored)
+			}
+		})
+	}
+}
+
+func TestSnapshotter_Snapshot(t *testing.T) {
+	dir := t.TempDir()
+	db := newTestDB(t, filepath.Join(dir, "dessego.db"), database.SchemaVersion)
+
+	bd := filepath.Join(dir, "backups")
+	if err := os.Mkdir(bd, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []string{
+		"dessego-20200101T000000Z.db",
+		"dessego-20200102T000000Z.db",
+		"unrelated.db",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(bd, n), nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := NewSnapshotter(db.Reader, bd, 2, zerolog.Nop())
+	path, err := s.Snapshot(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = Validate(path); err != nil {
+		t.Fatal(err)
+	}
+
+	paths, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 2 || paths[0] != filepath.Join(bd, "dessego-20200102T000000Z.db") || paths[1] != path {
+		t.Fatalf("unexpected snapshots: %v", paths)
+	}
+	if _, err = os.Stat(filepath.Join(bd, "unrelated.db")); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,120 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// snapshotPrefix and snapshotExt surround the timestamp in the name of
+	// each snapshot file.
+	snapshotPrefix = "dessego-"
+	snapshotExt    = ".db"
+
+	// snapshotTime is the layout of the timestamp in snapshot file names,
+	// which sorts in time order.
+	snapshotTime = "20060102T150405Z"
+)
+
+// Snapshotter takes timestamped backups of a database into a directory,
+// keeping a limited number of the most recent.
+type Snapshotter struct {
+	db   *sql.DB
+	dir  string
+	keep int
+	l    zerolog.Logger
+}
+
+// NewSnapshotter returns a snapshotter writing backups of db to dir. If keep
+// is positive only the keep most recent snapshots are retained.
+func NewSnapshotter(db *sql.DB, dir string, keep int, l zerolog.Logger) *Snapshotter {
+	return &Snapshotter{
+		db:   db,
+		dir:  dir,
+		keep: keep,
+		l:    l,
+	}
+}
+
+// Snapshot backs up the database, deleting any snapshots beyond the retention
+// limit. It returns the path of the new snapshot.
+func (s *Snapshotter) Snapshot(ctx context.Context) (string, error) {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return "", fmt.Errorf("create backup dir: %w", err)
+	}
+
+	path := filepath.Join(
+		s.dir,
+		snapshotPrefix+time.Now().UTC().Format(snapshotTime)+snapshotExt,
+	)
+	if err := Backup(ctx, s.db, path); err != nil {
+		return "", err
+	}
+
+	if err := s.prune(); err != nil {
+		return path, fmt.Errorf("prune snapshots: %w", err)
+	}
+
+	return path, nil
+}
+
+// List returns the paths of the snapshots in the directory, oldest first.
+func (s *Snapshotter) List() ([]string, error) {
+	fis, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(fis))
+	for _, fi := range fis {
+		n := fi.Name()
+		if fi.IsDir() ||
+			!strings.HasPrefix(n, snapshotPrefix) ||
+			!strings.HasSuffix(n, snapshotExt) {
+			continue
+		}
+		ts := strings.TrimSuffix(strings.TrimPrefix(n, snapshotPrefix), snapshotExt)
+		if _, err = time.Parse(snapshotTime, ts); err != nil {
+			continue
+		}
+
+		paths = append(paths, filepath.Join(s.dir, n))
+	}
+	sort.Strings(paths)
+
+	return paths, nil
+}
+
+// prune deletes the oldest snapshots beyond the retention limit.
+func (s *Snapshotter) prune() error {
+	if s.keep <= 0 {
+		return nil
+	}
+
+	paths, err := s.List()
+	if err != nil {
+		return err
+	}
+
+	for len(paths) > s.keep {
+		if err = os.Remove(paths[0]); err != nil {
+			return err
+		}
+		s.l.Debug().Msgf("deleted snapshot %q", paths[0])
+		paths = paths[1:]
+	}
+
+	return nil
+}
@@ -0,0 +1,337 @@
+// Package config loads the server configuration file.
+//
+// The configuration is a JSON document. Every setting is optional and settings
+// missing from the file keep their default values. The regions and browser
+// URLs given in the file replace the defaults entirely, whereas each language
+// slot given replaces only that slot:
+//
+//	{
+//		"regions": {
+//			"ALL": {
+//				"listen": ":18666",
+//				"url": "http://dessego.example.com:18666/cgi-bin/",
+//				"slots": [1, 2, 3, 4, 5, 6, 7, 8, 11, 12]
+//			},
+//			"EVENT": {
+//				"listen": ":18669",
+//				"url": "http://event.example.com:18669/cgi-bin/"
+//			}
+//		},
+//		"bootstrap": {
+//			"blood_message_num": 40,
+//			"wandering_ghosts": false
+//		},
+//		"game": {
+//			"motd": ["Welcome!\n", "Players online: {players}"],
+//			"bans": {"networks": ["203.0.113.0/24"]}
+//		},
+//		"log_level": "info"
+//	}
+//
+// The bootstrap document, game server settings and log level may be reloaded
+// while the server is running; the regions and partitioning only change on
+// restart.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"sort"
+
+	"github.com/danmrichards/dessego/internal/server/bootstrap"
+	"github.com/danmrichards/dessego/internal/server/game"
+	"github.com/rs/zerolog"
+)
+
+// Config is the server configuration.
+type Config struct {
+	// Regions are the regional game servers, keyed by region name.
+	Regions map[string]Region `json:"regions"`
+
+	// Bootstrap is the bootstrap document served to the game client.
+	Bootstrap bootstrap.Config `json:"bootstrap"`
+
+	// Partitioning is how each type of data is divided between regions.
+	Partitioning Partitioning `json:"partitioning"`
+
+	// Game are the settings of every game server.
+	Game game.Settings `json:"game"`
+
+	// LogLevel is the minimum level of logged messages, such as "info".
+	LogLevel string `json:"log_level"`
+}
+
+// Region is the configuration of a regional game server.
+type Region struct {
+	// Listen is the address the game server listens on. The host may be
+	// omitted to listen on every interface.
+	Listen string `json:"listen"`
+
+	// URL is the URL of the game server advertised to the game client. It
+	// defaults to the listen address, or the local host if the listen address
+	// has no host.
+	URL string `json:"url"`
+
+	// Slots are the bootstrap language slots whose players connect to the
+	// region. A region serving no slots is only used by bootstrap profiles.
+	Slots []int `json:"slots"`
+}
+
+// GameURL returns the URL of the game server advertised to the game client.
+func (r Region) GameURL() string {
+	if r.URL != "" {
+		return r.URL
+	}
+
+	host, port, err := net.SplitHostPort(r.Listen)
+	if err != nil {
+		return ""
+	}
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = "127.0.0.1"
+	}
+
+	return "http://" + net.JoinHostPort(host, port) + "/cgi-bin/"
+}
+
+// Policy is how a type of data is divided between regions.
+type Policy string
+
+const (
+	// Shared data is seen by players in every region.
+	Shared Policy = "shared"
+
+	// Partitioned data is only seen by players in the region it was written
+	// in.
+	Partitioned Policy = "region"
+)
+
+// Partitioning is how each type of data is divided between regions.
+//
+// Players are tracked alongside SOS signs, so players summoned from other
+// regions can be graded.
+type Partitioning struct {
+	Messages      Policy `json:"messages"`
+	Replays       Policy `json:"replays"`
+	WorldTendency Policy `json:"world_tendency"`
+	Ghosts        Policy `json:"ghosts"`
+	SOS           Policy `json:"sos"`
+}
+
+// Validate returns an error if any policy is unknown.
+func (p Partitioning) Validate() error {
+	for name, pol := range map[string]Policy{
+		"messages":       p.Messages,
+		"replays":        p.Replays,
+		"world_tendency": p.WorldTendency,
+		"ghosts":         p.Ghosts,
+		"sos":            p.SOS,
+	} {
+		if pol != Shared && pol != Partitioned {
+			return fmt.Errorf(
+				"partitioning %s: policy must be %q or %q", name, Shared, Partitioned,
+			)
+		}
+	}
+
+	return nil
+}
+
+// Default returns the default configuration, with every region on the local
+// host.
+func Default() Config {
+	return Config{
+		Regions: map[string]Region{
+			"US": {Listen: ":18666", Slots: []int{1}},
+			"EU": {Listen: ":18667", Slots: []int{2, 5, 6, 7, 8}},
+			"JP": {Listen: ":18668", Slots: []int{3, 4, 11, 12}},
+		},
+		Bootstrap: bootstrap.DefaultConfig(),
+		Game:      game.DefaultSettings(),
+		LogLevel:  zerolog.DebugLevel.String(),
+
+		// Each game server has always held its own ghosts and SOS signs.
+		Partitioning: Partitioning{
+			Messages:      Shared,
+			Replays:       Shared,
+			WorldTendency: Shared,
+			Ghosts:        Partitioned,
+			SOS:           Partitioned,
+		},
+	}
+}
+
+// Load returns the configuration in the file at path, or the default
+// configuration if path is empty. The configuration is validated.
+func Load(path string) (Config, error) {
+	c := Default()
+	if path != "" {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return Config{}, fmt.Errorf("read config: %w", err)
+		}
+		if c, err = Parse(b); err != nil {
+			return Config{}, fmt.Errorf("config %q: %w", path, err)
+		}
+	}
+
+	if err := c.Validate(); err != nil {
+		return Config{}, err
+	}
+
+	return c, nil
+}
+
+// Parse returns the configuration in the given JSON document, applied over
+// the default configuration.
+func Parse(b []byte) (Config, error) {
+	c := Default()
+
+	// Regions and browser URLs are replaced rather than merged with the
+	// defaults, so entries can be removed.
+	var present struct {
+		Regions   json.RawMessage `json:"regions"`
+		Bootstrap struct {
+			BrowserURLs json.RawMessage `json:"browser_urls"`
+		} `json:"bootstrap"`
+	}
+	if err := json.Unmarshal(b, &present); err != nil {
+		return Config{}, err
+	}
+	if present.Regions != nil {
+		c.Regions = nil
+	}
+	if present.Bootstrap.BrowserURLs != nil {
+		c.Bootstrap.BrowserURLs = nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return Config{}, err
+	}
+
+	return c, nil
+}
+
+// Validate returns an error if the configuration is invalid.
+func (c *Config) Validate() error {
+	if len(c.Regions) == 0 {
+		return errors.New("no regions configured")
+	}
+
+	c.Bootstrap.GameURLs = make(map[string]string, len(c.Regions))
+	listen := make(map[string]string, len(c.Regions))
+	served := make(map[int]string, len(bootstrap.Slots))
+	for name, r := range c.Regions {
+		if name == "" {
+			return errors.New("region name is required")
+		}
+
+		if _, port, err := net.SplitHostPort(r.Listen); err != nil || port == "" {
+			return fmt.Errorf("region %q: invalid listen address %q", name, r.Listen)
+		}
+		if other, ok := listen[r.Listen]; ok {
+			return fmt.Errorf("regions %q and %q listen on %q", other, name, r.Listen)
+		}
+		listen[r.Listen] = name
+
+		for _, n := range r.Slots {
+			if other, ok := served[n]; ok {
+				return fmt.Errorf("regions %q and %q both serve slot %d", other, name, n)
+			}
+			served[n] = name
+		}
+
+		c.Bootstrap.GameURLs[name] = r.GameURL()
+	}
+
+	// Each language slot uses the game server of the region serving it.
+	slots := make(map[int]bootstrap.Slot, len(c.Bootstrap.Slots))
+	for n, sl := range c.Bootstrap.Slots {
+		slots[n] = sl
+	}
+	for n, name := range served {
+		sl, ok := slots[n]
+		if !ok {
+			return fmt.Errorf("region %q: unknown slot %d", name, n)
+		}
+		sl.Region = name
+		slots[n] = sl
+	}
+	c.Bootstrap.Slots = slots
+
+	if err := c.Partitioning.Validate(); err != nil {
+		return err
+	}
+	if err := c.Game.Validate(); err != nil {
+		return fmt.Errorf("game: %w", err)
+	}
+	if _, err := zerolog.ParseLevel(c.LogLevel); err != nil || c.LogLevel == "" {
+		return fmt.Errorf("unknown log level %q", c.LogLevel)
+	}
+
+	return c.Bootstrap.Validate()
+}
+
+// Level returns the minimum level of logged messages.
+func (c Config) Level() zerolog.Level {
+	l, _ := zerolog.ParseLevel(c.LogLevel)
+	return l
+}
+
+// Reload returns the running configuration c with the settings which may be
+// changed while running replaced by those of next, which must be valid.
+//
+// The names of the reloaded settings which changed are returned, along with
+// those which only change on restart, which are otherwise ignored. An error is
+// returned if the bootstrap document is invalid for the running regions or the
+// game settings are invalid, so the returned configuration can be applied
+// without further validation.
+func (c Config) Reload(next Config) (rc Config, changed, restart []string, err error) {
+	if !reflect.DeepEqual(c.Regions, next.Regions) {
+		restart = append(restart, "regions")
+	}
+	if c.Partitioning != next.Partitioning {
+		restart = append(restart, "partitioning")
+	}
+
+	// The language slots are served by the running regions.
+	rc = c
+	rc.Bootstrap = next.Bootstrap
+	rc.Bootstrap.GameURLs = c.Bootstrap.GameURLs
+	rc.Bootstrap.Slots = make(map[int]bootstrap.Slot, len(next.Bootstrap.Slots))
+	for n, sl := range next.Bootstrap.Slots {
+		sl.Region = c.Bootstrap.Slots[n].Region
+		rc.Bootstrap.Slots[n] = sl
+	}
+	if err = rc.Bootstrap.Validate(); err != nil {
+		return c, nil, restart, fmt.Errorf("invalid bootstrap config: %w", err)
+	}
+	if err = next.Game.Validate(); err != nil {
+		return c, nil, restart, fmt.Errorf("invalid game settings: %w", err)
+	}
+	rc.Game = next.Game
+	rc.LogLevel = next.LogLevel
+
+	for name, diff := range map[string]bool{
+		"bootstrap":        !reflect.DeepEqual(c.Bootstrap, rc.Bootstrap),
+		"game.motd":        !reflect.DeepEqual(c.Game.Motd, rc.Game.Motd),
+		"game.bans":        !reflect.DeepEqual(c.Game.Bans, rc.Game.Bans),
+		"game.maintenance": !reflect.DeepEqual(c.Game.Maintenance, rc.Game.Maintenance),
+		"game.deny":        !reflect.DeepEqual(c.Game.Deny, rc.Game.Deny),
+		"log_level":        c.LogLevel != rc.LogLevel,
+	} {
+		if diff {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+
+	return rc, changed, restart, nil
+}
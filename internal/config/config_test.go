@@ -0,0 +1,198 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/danmrichards/dessego/internal/server/bootstrap"
+	"github.com/rs/zerolog"
+)
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	err := ioutil.WriteFile(path, []byte(`{
+		"regions": {
+			"US": {"listen": ":18666", "url": "http://us.example.com:18666/cgi-bin/", "slots": [1, 2, 5, 6, 7, 8]},
+			"JP": {"listen": "0.0.0.0:18668", "slots": [3, 4, 11, 12]}
+		},
+		"bootstrap": {
+			"slots": {
+				"3": {"lang": "ja", "interval": 60}
+			},
+			"blood_message_num": 40
+		},
+		"partitioning": {
+			"messages": "region",
+			"replays": "shared",
+			"world_tendency": "shared",
+			"ghosts": "region",
+			"sos": "shared"
+		}
+	}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := c.Regions["EU"]; ok {
+		t.Fatal("expected EU region to be removed")
+	}
+	for region, exp := range map[string]string{
+		"US": "http://us.example.com:18666/cgi-bin/",
+		"JP": "http://127.0.0.1:18668/cgi-bin/",
+	} {
+		if got := c.Bootstrap.GameURLs[region]; got != exp {
+			t.Fatalf("expected %s game URL %q got %q", region, exp, got)
+		}
+	}
+	if got := c.Bootstrap.Slots[3]; got.Lang != "ja" || got.Interval != 60 || got.Region != "JP" {
+		t.Fatalf("unexpected slot 3: %+v", got)
+	}
+	if got := c.Bootstrap.Slots[2]; got.Region != "US" || got.Interval != 120 {
+		t.Fatalf("unexpected slot 2: %+v", got)
+	}
+	if c.Bootstrap.BloodMessageNum != 40 {
+		t.Fatalf("expected blood message num 40 got %d", c.Bootstrap.BloodMessageNum)
+	}
+
+	// Settings missing from the file keep their defaults.
+	if c.Bootstrap.ReplayListNum != 80 || !c.Bootstrap.WanderingGhosts {
+		t.Fatalf("expected defaults to be kept got: %+v", c.Bootstrap)
+	}
+	if c.Partitioning.Messages != Partitioned || c.Partitioning.Ghosts != Partitioned || c.Partitioning.SOS != Shared {
+		t.Fatalf("unexpected partitioning: %+v", c.Partitioning)
+	}
+}
+
+func TestLoad_default(t *testing.T) {
+	c, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, exp := c.Bootstrap.GameURLs["EU"], "http://127.0.0.1:18667/cgi-bin/"; got != exp {
+		t.Fatalf("expected EU game URL %q got %q", exp, got)
+	}
+	if got := c.Bootstrap.Slots[11].Region; got != "JP" {
+		t.Fatalf("expected slot 11 region JP got %q", got)
+	}
+}
+
+func TestParse_regions(t *testing.T) {
+	c, err := Parse([]byte(`{
+		"regions": {
+			"ALL": {"listen": ":18666", "slots": [1, 2, 3, 4, 5, 6, 7, 8, 11, 12]},
+			"EVENT": {"listen": ":18669", "url": "http://event.example.com:18669/cgi-bin/"}
+		},
+		"bootstrap": {
+			"profiles": [{"name": "event", "networks": ["10.0.0.0/8"], "game_urls": {"ALL": "http://event.example.com:18669/cgi-bin/"}}]
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	for n, sl := range c.Bootstrap.Slots {
+		if sl.Region != "ALL" {
+			t.Fatalf("expected slot %d region ALL got %q", n, sl.Region)
+		}
+	}
+	if got, exp := c.Bootstrap.GameURLs["EVENT"], "http://event.example.com:18669/cgi-bin/"; got != exp {
+		t.Fatalf("expected EVENT game URL %q got %q", exp, got)
+	}
+}
+
+func TestParse_invalid(t *testing.T) {
+	for name, doc := range map[string]string{
+		"syntax":        `{"regions": `,
+		"unknown field": `{"bootstrap": {"gameurl1": "http://example.com/"}}`,
+		"no regions":    `{"regions": {}}`,
+		"missing port":  `{"regions": {"US": {"listen": "127.0.0.1", "slots": [1, 2, 3, 4, 5, 6, 7, 8, 11, 12]}}}`,
+		"same listen":   `{"regions": {"US": {"listen": ":1", "slots": [1, 2, 3, 4, 5, 6, 7, 8, 11, 12]}, "EU": {"listen": ":1"}}}`,
+		"unserved slot": `{"regions": {"US": {"listen": ":1", "slots": [1, 2, 3, 4, 5, 6, 7, 8, 11]}}}`,
+		"shared slot":   `{"regions": {"US": {"listen": ":1", "slots": [1, 2, 3, 4, 5, 6, 7, 8, 11, 12]}, "EU": {"listen": ":2", "slots": [2]}}}`,
+		"unknown slot":  `{"regions": {"US": {"listen": ":1", "slots": [1, 2, 3, 4, 5, 6, 7, 8, 9, 11, 12]}}}`,
+		"slot region":   `{"bootstrap": {"slots": {"1": {"region": "US"}}}}`,
+		"bad url":       `{"regions": {"US": {"listen": ":1", "url": "ftp://x/", "slots": [1, 2, 3, 4, 5, 6, 7, 8, 11, 12]}}}`,
+		"policy":        `{"partitioning": {"messages": "global"}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			c, err := Parse([]byte(doc))
+			if err == nil {
+				err = c.Validate()
+			}
+			if err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestConfig_Reload(t *testing.T) {
+	c, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next, err := Parse([]byte(`{
+		"regions": {
+			"ALL": {"listen": ":18666", "slots": [1, 2, 3, 4, 5, 6, 7, 8, 11, 12]}
+		},
+		"bootstrap": {"slots": {"1": {"interval": 60}}},
+		"game": {"motd": ["Hello"]},
+		"log_level": "info"
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = next.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	rc, changed, restart, err := c.Reload(next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := []string{"bootstrap", "game.motd", "log_level"}; !reflect.DeepEqual(changed, exp) {
+		t.Fatalf("expected changed: %v got: %v", exp, changed)
+	}
+	if exp := []string{"regions"}; !reflect.DeepEqual(restart, exp) {
+		t.Fatalf("expected restart: %v got: %v", exp, restart)
+	}
+
+	// The running regions are kept.
+	if !reflect.DeepEqual(rc.Regions, c.Regions) {
+		t.Fatalf("expected regions to be kept got: %+v", rc.Regions)
+	}
+	if got := rc.Bootstrap.Slots[1]; got.Region != "US" || got.Interval != 60 {
+		t.Fatalf("unexpected slot 1: %+v", got)
+	}
+	if rc.Level() != zerolog.InfoLevel || rc.Game.Motd[0] != "Hello" {
+		t.Fatalf("expected reloaded settings got: %+v", rc)
+	}
+
+	// Profiles cannot refer to regions which are not running.
+	next.Bootstrap.Profiles = []bootstrap.Profile{{
+		Name:     "all",
+		GameURLs: map[string]string{"ALL": "http://all.example.com/cgi-bin/"},
+	}}
+	if _, _, _, err = c.Reload(next); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// Invalid game settings are rejected along with the rest of the reload.
+	next.Bootstrap.Profiles = nil
+	next.Game.Motd = nil
+	if _, _, _, err = c.Reload(next); err == nil {
+		t.Fatal("expected error for invalid game settings")
+	}
+}
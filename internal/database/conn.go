@@ -0,0 +1,101 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// Dialect is the SQL dialect of a database.
+type Dialect int
+
+const (
+	// SQLiteDialect is the dialect of SQLite, with ? placeholders.
+	SQLiteDialect Dialect = iota
+
+	// PostgresDialect is the dialect of PostgreSQL, with $n placeholders.
+	PostgresDialect
+)
+
+// Rebind returns the query, written with ? placeholders, with the placeholders
+// of the dialect. Question marks within string literals are left as they are.
+func (d Dialect) Rebind(query string) string {
+	if d != PostgresDialect || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var (
+		b       strings.Builder
+		n       int
+		literal bool
+	)
+	b.Grow(len(query) + 8)
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			literal = !literal
+		case r == '?' && !literal:
+			n++
+			b.WriteString(Param(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// Conn is a database used by a service with both SQLite and PostgreSQL
+// implementations. Their queries are written once, with ? placeholders, and
+// rebound for the dialect of the database.
+type Conn struct {
+	Dialect Dialect
+
+	// Reader and Writer are the connection pools for reads and writes, which
+	// are the same pool for PostgreSQL.
+	Reader *sql.DB
+	Writer *sql.DB
+
+	read  *Stmts
+	write *Stmts
+}
+
+// SQLiteConn returns a connection to the SQLite database.
+func SQLiteConn(db *DB) *Conn {
+	return &Conn{
+		Dialect: SQLiteDialect,
+		Reader:  db.Reader,
+		Writer:  db.Writer,
+		read:    NewStmts(db.Reader),
+		write:   NewStmts(db.Writer),
+	}
+}
+
+// PostgresConn returns a connection to the PostgreSQL database.
+func PostgresConn(db *sql.DB) *Conn {
+	stmts := NewStmts(db)
+
+	return &Conn{
+		Dialect: PostgresDialect,
+		Reader:  db,
+		Writer:  db,
+		read:    stmts,
+		write:   stmts,
+	}
+}
+
+// Rebind returns the query with the placeholders of the database dialect.
+func (c *Conn) Rebind(query string) string {
+	return c.Dialect.Rebind(query)
+}
+
+// PrepareRead returns the cached prepared statement for the query on the
+// reader pool. See Stmts.Prepare.
+func (c *Conn) PrepareRead(query string) (*sql.Stmt, error) {
+	return c.read.Prepare(c.Rebind(query))
+}
+
+// PrepareWrite returns the cached prepared statement for the query on the
+// writer pool. See Stmts.Prepare.
+func (c *Conn) PrepareWrite(query string) (*sql.Stmt, error) {
+	return c.write.Prepare(c.Rebind(query))
+}
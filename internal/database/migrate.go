@@ -0,0 +1,44 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// EnsureColumn adds the column with the given name and definition to table, if
+// it does not already exist. It returns true if the column was added.
+//
+// Tables are created with "CREATE TABLE IF NOT EXISTS", so columns added after
+// a table was first created need to be migrated onto existing databases.
+func EnsureColumn(db *sql.DB, table, column, def string) (bool, error) {
+	rows, err := db.Query(`PRAGMA table_info(` + table + `)`)
+	if err != nil {
+		return false, fmt.Errorf("table info: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, typ        string
+			dflt             sql.NullString
+		)
+		if err = rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			return false, fmt.Errorf("scan row: %w", err)
+		}
+		if name == column {
+			return false, nil
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return false, fmt.Errorf("table info: %w", err)
+	}
+
+	if _, err = db.Exec(
+		`ALTER TABLE ` + table + ` ADD COLUMN ` + column + ` ` + def,
+	); err != nil {
+		return false, fmt.Errorf("add column: %w", err)
+	}
+
+	return true, nil
+}
@@ -3,24 +3,94 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"net/url"
 	"os"
+	"runtime"
+	"time"
 
 	// SQLite driver.
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// BusyTimeout is how long a connection waits for a lock held by another
+// connection before failing with "database is locked".
+const BusyTimeout = 5 * time.Second
+
+// DB is a SQLite database in WAL mode, with separate connection pools for
+// reads and writes.
+//
+// SQLite allows a single writer at a time, so the writer pool has a single
+// connection and writes queue in Go rather than contending for the database
+// lock. In WAL mode readers do not block the writer, or each other, so reads
+// are spread across a pool of read only connections.
+type DB struct {
+	// Writer is the connection pool for writes, and reads which must see
+	// uncommitted writes in a transaction.
+	Writer *sql.DB
+
+	// Reader is the connection pool for reads.
+	Reader *sql.DB
+}
+
 // NewSQLite returns a new SQLite database.
-func NewSQLite(path string) (*sql.DB, error) {
+func NewSQLite(path string) (*DB, error) {
 	if _, err := os.Stat(path); os.IsNotExist(err) {
 		if _, err = os.Create(path); err != nil {
 			return nil, fmt.Errorf("create DB: %w", err)
 		}
 	}
 
-	db, err := sql.Open("sqlite3", path)
+	timeout := fmt.Sprint(BusyTimeout.Milliseconds())
+
+	// Writes take the database lock at the start of each transaction, so
+	// transactions which read before writing cannot deadlock.
+	wp := url.Values{
+		"_journal_mode": {"WAL"},
+		"_busy_timeout": {timeout},
+		"_synchronous":  {"NORMAL"},
+		"_txlock":       {"immediate"},
+	}
+	w, err := sql.Open("sqlite3", "file:"+path+"?"+wp.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("open DB: %w", err)
+	}
+	w.SetMaxOpenConns(1)
+
+	// Switch to WAL mode before opening any readers. The journal mode is
+	// stored in the database, so readers need not set it.
+	if err = w.Ping(); err != nil {
+		w.Close()
+		return nil, fmt.Errorf("open DB: %w", err)
+	}
+
+	rp := url.Values{
+		"_busy_timeout": {timeout},
+		"_query_only":   {"true"},
+	}
+	r, err := sql.Open("sqlite3", "file:"+path+"?"+rp.Encode())
 	if err != nil {
+		w.Close()
 		return nil, fmt.Errorf("open DB: %w", err)
 	}
+	r.SetMaxOpenConns(readers())
+	r.SetMaxIdleConns(readers())
+
+	return &DB{Writer: w, Reader: r}, nil
+}
+
+// readers returns the number of connections in the reader pool.
+func readers() int {
+	if n := runtime.NumCPU(); n > 4 {
+		return n
+	}
+	return 4
+}
 
-	return db, nil
+// Close closes both connection pools.
+func (db *DB) Close() error {
+	rerr := db.Reader.Close()
+	if err := db.Writer.Close(); err != nil {
+		return err
+	}
+	return rerr
 }
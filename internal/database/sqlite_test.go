@@ -0,0 +1,87 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestNewSQLite(t *testing.T) {
+	db, err := NewSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var mode string
+	if err = db.Reader.QueryRow(`PRAGMA journal_mode`).Scan(&mode); err != nil {
+		t.Fatal(err)
+	}
+	if mode != "wal" {
+		t.Fatalf("expected journal mode: wal got: %s", mode)
+	}
+
+	if _, err = db.Writer.Exec(`CREATE TABLE test (id INTEGER)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Reader.Exec(`INSERT INTO test (id) VALUES (1)`); err == nil {
+		t.Fatal("expected reader to reject writes")
+	}
+}
+
+func TestStmts_Prepare(t *testing.T) {
+	db, err := NewSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	s := NewStmts(db.Reader)
+	defer s.Close()
+
+	a, err := s.Prepare(`SELECT 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := s.Prepare(`SELECT 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != b {
+		t.Fatal("expected the cached statement to be reused")
+	}
+}
+
+func TestDialect_Rebind(t *testing.T) {
+	tcs := []struct {
+		name string
+		d    Dialect
+		q    string
+		exp  string
+	}{
+		{
+			name: "sqlite",
+			d:    SQLiteDialect,
+			q:    `SELECT id FROM message WHERE block_id = ? LIMIT ?`,
+			exp:  `SELECT id FROM message WHERE block_id = ? LIMIT ?`,
+		},
+		{
+			name: "postgres",
+			d:    PostgresDialect,
+			q:    `SELECT id FROM message WHERE block_id = ? LIMIT ?`,
+			exp:  `SELECT id FROM message WHERE block_id = $1 LIMIT $2`,
+		},
+		{
+			name: "literal",
+			d:    PostgresDialect,
+			q:    `SELECT '?', 'it''s?' WHERE id = ?`,
+			exp:  `SELECT '?', 'it''s?' WHERE id = $1`,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if q := tc.d.Rebind(tc.q); q != tc.exp {
+				t.Fatalf("expected: %q got: %q", tc.exp, q)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"database/sql"
+	"sync"
+)
+
+// Stmts is a cache of prepared statements for a connection pool, so each
+// query is only prepared once.
+//
+// Statements returned by Prepare are owned by the cache and must not be
+// closed. Preparing a statement needs a connection from the pool, so a writer
+// cache must not be used while a transaction holds the writer's only
+// connection; use the transaction directly instead.
+type Stmts struct {
+	db *sql.DB
+
+	mu    sync.Mutex
+	stmts map[string]*sql.Stmt
+}
+
+// NewStmts returns an empty statement cache for the connection pool db.
+func NewStmts(db *sql.DB) *Stmts {
+	return &Stmts{
+		db:    db,
+		stmts: make(map[string]*sql.Stmt),
+	}
+}
+
+// Prepare returns the prepared statement for query, preparing it if it is not
+// already cached.
+func (s *Stmts) Prepare(query string) (*sql.Stmt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stmt, ok := s.stmts[query]; ok {
+		return stmt, nil
+	}
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	s.stmts[query] = stmt
+
+	return stmt, nil
+}
+
+// Close closes every cached statement.
+func (s *Stmts) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	for q, stmt := range s.stmts {
+		if cerr := stmt.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		delete(s.stmts, q)
+	}
+
+	return err
+}
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// SchemaVersion is the version of the database schema, stored in the SQLite
+// user_version pragma. It must be incremented whenever a change is made to the
+// schema that older versions of the server cannot read.
+//
+// The versions are:
+//
+//  1. The schema when versioning was introduced.
+//  2. Adds the multiplayer_grade ledger.
+//  3. Adds the region column to messages, replays and world tendencies.
+//  4. Adds message rating baselines and the ratings of deleted messages.
+const SchemaVersion = 4
+
+// UserVersion returns the schema version stored in the database. Databases
+// created before the schema was versioned return 0.
+func UserVersion(db *sql.DB) (v int, err error) {
+	if err = db.QueryRow(`PRAGMA user_version`).Scan(&v); err != nil {
+		return 0, fmt.Errorf("query user version: %w", err)
+	}
+
+	return v, nil
+}
+
+// SetUserVersion stores the schema version in the database.
+func SetUserVersion(db *sql.DB, v int) error {
+	// Pragmas do not accept bound parameters.
+	if _, err := db.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, v)); err != nil {
+		return fmt.Errorf("set user version: %w", err)
+	}
+
+	return nil
+}
+
+// EnsureVersion stores the current schema version in the database, returning
+// an error if the database was written by a newer version of the server.
+func EnsureVersion(db *sql.DB) error {
+	v, err := UserVersion(db)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case v > SchemaVersion:
+		return fmt.Errorf(
+			"database schema version %d is newer than supported version %d",
+			v, SchemaVersion,
+		)
+	case v < SchemaVersion:
+		return SetUserVersion(db, SchemaVersion)
+	}
+
+	return nil
+}
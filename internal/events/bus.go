@@ -0,0 +1,89 @@
+package events
+
+import (
+	"expvar"
+	"sync"
+)
+
+// subscriptionBuffer is the number of events buffered for each subscriber
+// before further events are dropped.
+const subscriptionBuffer = 64
+
+// eventsDropped counts the events dropped for slow subscribers, by type.
+var eventsDropped = expvar.NewMap("events_dropped")
+
+// Bus is an in-memory event bus, delivering each published event to the
+// subscribers whose filter matches it.
+type Bus struct {
+	mu   sync.RWMutex
+	subs map[*Subscription]struct{}
+}
+
+// NewBus returns an event bus without subscribers.
+func NewBus() *Bus {
+	return &Bus{
+		subs: make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish delivers the event to every matching subscriber. It never blocks;
+// the event is dropped for subscribers which have fallen behind.
+func (b *Bus) Publish(e Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for s := range b.subs {
+		if !s.f.Match(e) {
+			continue
+		}
+
+		select {
+		case s.c <- e:
+		default:
+			eventsDropped.Add(string(e.Type), 1)
+		}
+	}
+}
+
+// Subscribe returns a subscription to the events matching the filter. The
+// subscription must be closed once no longer required.
+func (b *Bus) Subscribe(f Filter) *Subscription {
+	s := &Subscription{
+		b: b,
+		f: f,
+		c: make(chan Event, subscriptionBuffer),
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.subs[s] = struct{}{}
+
+	return s
+}
+
+// Subscription is a subscription to the events published to a bus.
+type Subscription struct {
+	b *Bus
+	f Filter
+	c chan Event
+
+	once sync.Once
+}
+
+// Events returns the channel the events are delivered on, which is closed
+// when the subscription is closed.
+func (s *Subscription) Events() <-chan Event {
+	return s.c
+}
+
+// Close stops delivery of events to the subscription.
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.b.mu.Lock()
+		defer s.b.mu.Unlock()
+
+		delete(s.b.subs, s)
+		close(s.c)
+	})
+}
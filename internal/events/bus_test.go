@@ -0,0 +1,103 @@
+package events
+
+import (
+	"testing"
+)
+
+func TestFilter_Match(t *testing.T) {
+	e := Event{Type: Message, Region: "EU", BlockID: 40000}
+
+	tests := []struct {
+		name string
+		f    Filter
+		want bool
+	}{
+		{
+			name: "empty",
+			want: true,
+		},
+		{
+			name: "region",
+			f:    Filter{Regions: []string{"US", "EU"}},
+			want: true,
+		},
+		{
+			name: "other region",
+			f:    Filter{Regions: []string{"US"}},
+		},
+		{
+			name: "block",
+			f:    Filter{Blocks: []int32{40000, 40001}},
+			want: true,
+		},
+		{
+			name: "other block",
+			f:    Filter{Blocks: []int32{40001}},
+		},
+		{
+			name: "type",
+			f:    Filter{Types: []Type{Message}},
+			want: true,
+		},
+		{
+			name: "other type",
+			f:    Filter{Types: []Type{SOS, Ghost}},
+		},
+		{
+			name: "all",
+			f: Filter{
+				Regions: []string{"EU"},
+				Blocks:  []int32{40000},
+				Types:   []Type{Message},
+			},
+			want: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.f.Match(e); got != tc.want {
+				t.Fatalf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestBus_Publish(t *testing.T) {
+	b := NewBus()
+
+	all := b.Subscribe(Filter{})
+	defer all.Close()
+
+	sos := b.Subscribe(Filter{Types: []Type{SOS}})
+	defer sos.Close()
+
+	b.Publish(Event{Type: Message})
+	b.Publish(Event{Type: SOS})
+
+	for _, want := range []Type{Message, SOS} {
+		if e := <-all.Events(); e.Type != want {
+			t.Fatalf("expected %q, got %q", want, e.Type)
+		}
+	}
+	if e := <-sos.Events(); e.Type != SOS {
+		t.Fatalf("expected %q, got %q", SOS, e.Type)
+	}
+	if n := len(sos.Events()); n != 0 {
+		t.Fatalf("expected no more events, got %d", n)
+	}
+
+	// Slow subscribers miss events, rather than blocking the publisher.
+	for i := 0; i < subscriptionBuffer+1; i++ {
+		b.Publish(Event{Type: SOS})
+	}
+	if n := len(sos.Events()); n != subscriptionBuffer {
+		t.Fatalf("expected %d buffered events, got %d", subscriptionBuffer, n)
+	}
+
+	// Closed subscriptions no longer receive events.
+	sos.Close()
+	b.Publish(Event{Type: SOS})
+	for range sos.Events() {
+	}
+}
@@ -0,0 +1,177 @@
+// Package events publishes live game activity, such as messages written and
+// players summoned, to subscribers.
+package events
+
+import (
+	"time"
+
+	"github.com/danmrichards/dessego/internal/service/gamestate"
+)
+
+// Type is the type of game activity an event records.
+type Type string
+
+const (
+	// Message is a blood message written by a player.
+	Message Type = "message"
+
+	// Rating is a blood message recommended by a player.
+	Rating Type = "rating"
+
+	// Bloodstain is a bloodstain left by a player on death.
+	Bloodstain Type = "bloodstain"
+
+	// Ghost is a player ghost spawning into, or moving to, a block.
+	Ghost Type = "ghost"
+
+	// SOS is an SOS sign placed by a player.
+	SOS Type = "sos"
+
+	// Summon is a player summoned into the world of another.
+	Summon Type = "summon"
+
+	// Grade is a grade given to a player after a multiplayer session.
+	Grade Type = "grade"
+)
+
+// Types are the types of every event.
+var Types = []Type{Message, Rating, Bloodstain, Ghost, SOS, Summon, Grade}
+
+// Event is a record of game activity.
+type Event struct {
+	Type   Type      `json:"type"`
+	Time   time.Time `json:"time"`
+	Region string    `json:"region"`
+
+	// BlockID and Block are the block the activity took place in, if known.
+	BlockID int32  `json:"block_id,omitempty"`
+	Block   string `json:"block,omitempty"`
+
+	// CharacterID is the character responsible for the activity.
+	CharacterID string `json:"character_id,omitempty"`
+
+	// Data holds details specific to the type of event.
+	Data interface{} `json:"data,omitempty"`
+}
+
+// New returns an event of the given type by the character in the given block,
+// which may be 0 if unknown.
+func New(t Type, characterID string, blockID int32, data interface{}) Event {
+	e := Event{
+		Type:        t,
+		Time:        time.Now().UTC(),
+		BlockID:     blockID,
+		CharacterID: characterID,
+		Data:        data,
+	}
+	if blockID != 0 {
+		e.Block = gamestate.Block(blockID).String()
+	}
+
+	return e
+}
+
+// Filter selects events. Empty fields match every event.
+type Filter struct {
+	Regions []string
+	Blocks  []int32
+	Types   []Type
+}
+
+// Match returns true if the event is selected by the filter.
+func (f Filter) Match(e Event) bool {
+	if len(f.Regions) > 0 && !containsString(f.Regions, e.Region) {
+		return false
+	}
+	if len(f.Blocks) > 0 && !containsBlock(f.Blocks, e.BlockID) {
+		return false
+	}
+	if len(f.Types) > 0 && !containsType(f.Types, e.Type) {
+		return false
+	}
+
+	return true
+}
+
+func containsString(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsBlock(ids []int32, id int32) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsType(ts []Type, t Type) bool {
+	for _, v := range ts {
+		if v == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Position is the position within a block at which activity took place.
+type Position struct {
+	X float32 `json:"x"`
+	Y float32 `json:"y"`
+	Z float32 `json:"z"`
+}
+
+// MessageData are the details of a Message event.
+type MessageData struct {
+	Text     string   `json:"text"`
+	Position Position `json:"position"`
+}
+
+// RatingData are the details of a Rating event, by the rating character.
+type RatingData struct {
+	MessageID uint32 `json:"message_id"`
+	AuthorID  string `json:"author_id"`
+}
+
+// BloodstainData are the details of a Bloodstain event.
+type BloodstainData struct {
+	Position Position `json:"position"`
+}
+
+// GhostData are the details of a Ghost event. The previous block is empty if
+// the ghost spawned, rather than moved.
+type GhostData struct {
+	PreviousBlockID int32  `json:"previous_block_id,omitempty"`
+	PreviousBlock   string `json:"previous_block,omitempty"`
+}
+
+// SOSData are the details of an SOS event.
+type SOSData struct {
+	ID       int32    `json:"id"`
+	Level    uint32   `json:"level"`
+	Black    bool     `json:"black"`
+	Position Position `json:"position"`
+}
+
+// SummonData are the details of a Summon event, by the summoning character.
+// The SOS ID is 0 if a monk was summoned.
+type SummonData struct {
+	SOSID int32 `json:"sos_id,omitempty"`
+	Monk  bool  `json:"monk"`
+}
+
+// GradeData are the details of a Grade event, by the graded character. The
+// giver is empty if the grade was reported by the game, rather than a player.
+type GradeData struct {
+	Grade   string `json:"grade"`
+	GiverID string `json:"giver_id,omitempty"`
+}
@@ -0,0 +1,271 @@
+// Package legacy imports data dumps from legacy Demon's Souls servers, such as
+// the original desse project.
+package legacy
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/danmrichards/dessego/internal/service/character"
+	"github.com/danmrichards/dessego/internal/service/msg"
+	"github.com/danmrichards/dessego/internal/service/replay"
+	"github.com/rs/zerolog"
+)
+
+// batchSize is the number of records imported in each transaction.
+const batchSize = 5000
+
+// Kind is a kind of legacy data dump.
+type Kind string
+
+const (
+	// KindMessages is a dump of blood messages.
+	KindMessages Kind = "messages"
+
+	// KindReplays is a dump of bloodstain replays.
+	KindReplays Kind = "replays"
+
+	// KindWorldTendency is a dump of character world tendencies.
+	KindWorldTendency Kind = "world-tendency"
+)
+
+// Messages is the interface that wraps methods that types must implement to
+// import legacy messages.
+type Messages interface {
+	// Import adds legacy messages, returning the number added.
+	Import(ctx context.Context, bms []*msg.BloodMsg) (int64, error)
+}
+
+// Replays is the interface that wraps methods that types must implement to
+// import legacy replays.
+type Replays interface {
+	// Import adds legacy replays, returning the number added.
+	Import(ctx context.Context, rs []*replay.Replay) (int64, error)
+}
+
+// Characters is the interface that wraps methods that types must implement to
+// import legacy world tendencies.
+type Characters interface {
+	// ImportTendency adds legacy world tendencies, returning the number
+	// added.
+	ImportTendency(ctx context.Context, cts []character.CharacterTendency) (int64, error)
+}
+
+// Report details the outcome of an import.
+type Report struct {
+	Kind Kind
+	Path string
+
+	// DryRun is true if the dump was only validated.
+	DryRun bool
+
+	// AlreadyImported is true if the dump was skipped, as it has been
+	// imported before.
+	AlreadyImported bool
+
+	// Records is the number of records in the dump.
+	Records int
+
+	// Imported is the number of records added. Records which already exist
+	// are not added again.
+	Imported int64
+}
+
+// String implements fmt.Stringer.
+func (r Report) String() string {
+	return fmt.Sprintf(
+		"kind: %s path: %q dry run: %t already imported: %t records: %d imported: %d",
+		r.Kind, r.Path, r.DryRun, r.AlreadyImported, r.Records, r.Imported,
+	)
+}
+
+// Importer imports legacy data dumps.
+//
+// Imports are idempotent. Each dump is recorded once imported, so importing
+// the same dump again is skipped, and records which already exist are not
+// added again.
+type Importer struct {
+	db *sql.DB
+	ms Messages
+	rs Replays
+	cs Characters
+	l  zerolog.Logger
+}
+
+// NewImporter returns an initialised legacy data importer.
+func NewImporter(
+	db *sql.DB,
+	ms Messages,
+	rs Replays,
+	cs Characters,
+	l zerolog.Logger,
+) (*Importer, error) {
+	im := &Importer{
+		db: db,
+		ms: ms,
+		rs: rs,
+		cs: cs,
+		l:  l,
+	}
+
+	ddl, err := ioutil.ReadFile("internal/legacy/legacy_import.sql")
+	if err != nil {
+		return nil, fmt.Errorf("read DDL: %w", err)
+	}
+	if _, err = db.Exec(string(ddl)); err != nil {
+		return nil, fmt.Errorf("init table: %w", err)
+	}
+
+	return im, nil
+}
+
+// dump is a parsed legacy data dump.
+type dump struct {
+	// parse parses and stores a record.
+	parse func(rec []byte) error
+
+	// save saves the records in the range [i, j).
+	save func(i, j int) (int64, error)
+}
+
+// newDump returns an empty dump of the given kind.
+func (im *Importer) newDump(ctx context.Context, kind Kind) (*dump, error) {
+	switch kind {
+	case KindMessages:
+		var bms []*msg.BloodMsg
+		return &dump{
+			parse: func(rec []byte) error {
+				bm, err := msg.NewBloodMsgFromBytes(rec)
+				if err != nil {
+					return err
+				}
+				bms = append(bms, bm)
+				return nil
+			},
+			save: func(i, j int) (int64, error) {
+				return im.ms.Import(ctx, bms[i:j])
+			},
+		}, nil
+	case KindReplays:
+		var rs []*replay.Replay
+		return &dump{
+			parse: func(rec []byte) error {
+				r, err := replay.NewReplayFromBytes(rec)
+				if err != nil {
+					return err
+				}
+				rs = append(rs, r)
+				return nil
+			},
+			save: func(i, j int) (int64, error) {
+				return im.rs.Import(ctx, rs[i:j])
+			},
+		}, nil
+	case KindWorldTendency:
+		var cts []character.CharacterTendency
+		return &dump{
+			parse: func(rec []byte) error {
+				ct, err := parseTendency(rec)
+				if err != nil {
+					return err
+				}
+				cts = append(cts, *ct)
+				return nil
+			},
+			save: func(i, j int) (int64, error) {
+				return im.cs.ImportTendency(ctx, cts[i:j])
+			},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown kind %q", kind)
+	}
+}
+
+// Import imports the dump of the given kind at path.
+//
+// Every record is validated before any are imported. If dryRun is true the
+// dump is only validated.
+func (im *Importer) Import(
+	ctx context.Context,
+	kind Kind,
+	path string,
+	dryRun bool,
+) (r Report, err error) {
+	r = Report{Kind: kind, Path: path, DryRun: dryRun}
+
+	d, err := im.newDump(ctx, kind)
+	if err != nil {
+		return r, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return r, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return r, fmt.Errorf("checksum: %w", err)
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	err = im.db.QueryRowContext(
+		ctx,
+		`SELECT 1 FROM legacy_import WHERE kind = ? AND checksum = ?`,
+		kind, sum,
+	).Scan(new(int))
+	switch {
+	case err == nil:
+		r.AlreadyImported = true
+		return r, nil
+	case !errors.Is(err, sql.ErrNoRows):
+		return r, fmt.Errorf("query imports: %w", err)
+	}
+
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return r, err
+	}
+
+	im.l.Info().Msgf("validating legacy %s from %q", kind, path)
+	if r.Records, err = ReadRecords(f, d.parse); err != nil {
+		return r, fmt.Errorf("parse %s: %w", kind, err)
+	}
+	if dryRun {
+		return r, nil
+	}
+
+	for i := 0; i < r.Records; i += batchSize {
+		j := i + batchSize
+		if j > r.Records {
+			j = r.Records
+		}
+
+		n, err := d.save(i, j)
+		if err != nil {
+			return r, fmt.Errorf("import %s: %w", kind, err)
+		}
+		r.Imported += n
+
+		im.l.Info().Msgf("imported legacy %s: %d/%d", kind, j, r.Records)
+	}
+
+	if _, err = im.db.ExecContext(
+		ctx,
+		`INSERT INTO legacy_import (kind, checksum, records, imported, created)
+		VALUES (?,?,?,?,?)`,
+		kind, sum, r.Records, r.Imported, time.Now().Unix(),
+	); err != nil {
+		return r, fmt.Errorf("record import: %w", err)
+	}
+
+	return r, nil
+}
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS legacy_import (
+   kind TEXT,
+   checksum TEXT,
+   records INTEGER DEFAULT 0,
+   imported INTEGER DEFAULT 0,
+   created INTEGER DEFAULT 0,
+   PRIMARY KEY (kind, checksum)
+);
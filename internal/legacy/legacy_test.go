@@ -0,0 +1,195 @@
+package legacy
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/danmrichards/dessego/internal/database"
+	"github.com/danmrichards/dessego/internal/service/character"
+	"github.com/danmrichards/dessego/internal/service/msg"
+	"github.com/danmrichards/dessego/internal/service/replay"
+	"github.com/rs/zerolog"
+)
+
+func TestMain(m *testing.M) {
+	// The services load their DDL relative to the repository root.
+	if err := os.Chdir("../.."); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	os.Exit(m.Run())
+}
+
+func newTestImporter(t *testing.T) (*Importer, *database.DB) {
+	t.Helper()
+
+	db, err := database.NewSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	ms, err := msg.NewSQLiteService(db, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs, err := replay.NewSQLiteService(db, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs, err := character.NewSQLiteService(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	im, err := NewImporter(db.Writer, ms, rs, cs, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return im, db
+}
+
+// writeDump writes the records to a dump file, returning its path.
+func writeDump(t *testing.T, recs ...[]byte) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	for _, rec := range recs {
+		binary.Write(&buf, binary.LittleEndian, uint32(len(rec)))
+		buf.Write(rec)
+	}
+
+	fn := filepath.Join(t.TempDir(), "dump.bin")
+	if err := ioutil.WriteFile(fn, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return fn
+}
+
+func TestImporter_Import_messages(t *testing.T) {
+	im, _ := newTestImporter(t)
+
+	r, err := im.Import(context.Background(), KindMessages, "internal/service/msg/legacymessages.bin", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Records == 0 || r.Imported != int64(r.Records) {
+		t.Fatalf("unexpected report: %s", r)
+	}
+
+	// Importing the same dump again is skipped.
+	if r, err = im.Import(context.Background(), KindMessages, "internal/service/msg/legacymessages.bin", false); err != nil {
+		t.Fatal(err)
+	} else if !r.AlreadyImported {
+		t.Fatalf("expected dump to be skipped: %s", r)
+	}
+}
+
+func TestImporter_Import_replays(t *testing.T) {
+	im, db := newTestImporter(t)
+
+	recs := make([][]byte, 0, 3)
+	for i := 1; i <= 3; i++ {
+		rp := replay.Replay{
+			ID:          uint32(i),
+			CharacterID: fmt.Sprintf("char%d", i),
+			BlockID:     40070,
+			Data:        []byte("data\x00with zero bytes"),
+		}
+		recs = append(recs, append(rp.Header(), rp.Data...))
+	}
+
+	r, err := im.Import(context.Background(), KindReplays, writeDump(t, recs...), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Records != 3 || r.Imported != 3 {
+		t.Fatalf("unexpected report: %s", r)
+	}
+
+	// A different dump containing the same replays does not duplicate them.
+	if r, err = im.Import(context.Background(), KindReplays, writeDump(t, recs[:2]...), false); err != nil {
+		t.Fatal(err)
+	} else if r.AlreadyImported || r.Imported != 0 {
+		t.Fatalf("unexpected report: %s", r)
+	}
+
+	var data []byte
+	if err = db.Reader.QueryRow(`SELECT data FROM replay WHERE id = 2`).Scan(&data); err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "data\x00with zero bytes" {
+		t.Fatalf("unexpected replay data: %q", data)
+	}
+}
+
+func TestImporter_Import_worldTendency(t *testing.T) {
+	im, db := newTestImporter(t)
+
+	rec := []byte("char0\x00")
+	for i := int32(1); i <= 21; i++ {
+		rec = append(rec, byte(i), 0, 0, 0)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := im.Import(context.Background(), KindWorldTendency, writeDump(t, rec), false); err != nil {
+			t.Fatal(err)
+		}
+
+		// Change the dump, so it isn't skipped as already imported.
+		rec = append(rec, 0x00)
+	}
+
+	var n, lr7 int
+	if err := db.Reader.QueryRow(
+		`SELECT count(*), max(lr_7) FROM world_tendency WHERE character_id = 'char0'`,
+	).Scan(&n, &lr7); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || lr7 != 21 {
+		t.Fatalf("expected 1 tendency with lr_7 21 got %d with %d", n, lr7)
+	}
+}
+
+func TestImporter_Import_invalid(t *testing.T) {
+	im, db := newTestImporter(t)
+
+	valid := append(replay.Replay{CharacterID: "char0"}.Header(), 'x')
+	fn := writeDump(t, valid, []byte("char1"))
+
+	_, err := im.Import(context.Background(), KindReplays, fn, false)
+
+	var rerr RecordError
+	if !errors.As(err, &rerr) || rerr.Index != 1 {
+		t.Fatalf("expected error for record 1 got: %v", err)
+	}
+
+	// Nothing should be imported if any record is invalid.
+	var n int
+	if err = db.Reader.QueryRow(`SELECT count(*) FROM replay`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatalf("expected no replays got %d", n)
+	}
+}
+
+func TestReadRecords_truncated(t *testing.T) {
+	b := []byte{0x08, 0x00, 0x00, 0x00, 0x01, 0x02}
+
+	_, err := ReadRecords(bytes.NewReader(b), func([]byte) error { return nil })
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected unexpected EOF got: %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package legacy
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MaxRecordSize is the maximum size in bytes of a single record.
+const MaxRecordSize = 64 << 10
+
+// RecordError is returned when a record in a dump cannot be read or parsed.
+type RecordError struct {
+	Index int
+	Err   error
+}
+
+// Error implements error.
+func (r RecordError) Error() string {
+	return fmt.Sprintf("record %d: %v", r.Index, r.Err)
+}
+
+// Unwrap returns the underlying error.
+func (r RecordError) Unwrap() error {
+	return r.Err
+}
+
+// ReadRecords calls fn for each record read from r, returning the number of
+// records read.
+//
+// Legacy dumps consist of records, each prefixed by its length as a 4 byte
+// little-endian integer. The record passed to fn is only valid until fn
+// returns.
+func ReadRecords(r io.Reader, fn func(rec []byte) error) (n int, err error) {
+	var (
+		lb  [4]byte
+		buf []byte
+	)
+	for ; ; n++ {
+		if _, err = io.ReadFull(r, lb[:]); err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return n, RecordError{Index: n, Err: fmt.Errorf("read length: %w", err)}
+		}
+
+		l := binary.LittleEndian.Uint32(lb[:])
+		if l > MaxRecordSize {
+			return n, RecordError{
+				Index: n,
+				Err:   fmt.Errorf("length %d exceeds maximum of %d", l, MaxRecordSize),
+			}
+		}
+
+		if cap(buf) < int(l) {
+			buf = make([]byte, l)
+		}
+		if _, err = io.ReadFull(r, buf[:l]); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return n, RecordError{Index: n, Err: fmt.Errorf("read record: %w", err)}
+		}
+
+		if err = fn(buf[:l]); err != nil {
+			return n, RecordError{Index: n, Err: err}
+		}
+	}
+}
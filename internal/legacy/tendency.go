@@ -0,0 +1,51 @@
+package legacy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+
+	"github.com/danmrichards/dessego/internal/service/character"
+)
+
+// tendencySize is the size in bytes of the world tendency values following
+// the character ID in a world tendency record.
+const tendencySize = 21 * 4
+
+// parseTendency returns the world tendency parsed from the given record.
+//
+// World tendency records are in the following binary format:
+//
+// CharacterID 		= n bytes (terminated by a zero byte)
+// Tendency 		= 84 bytes (4 byte little-endian integers)
+//   - Area, white/black and left/right tendency for each of the 7 areas
+func parseTendency(b []byte) (*character.CharacterTendency, error) {
+	n := bytes.IndexByte(b, 0x00)
+	if n < 0 {
+		return nil, errors.New("unterminated character ID")
+	}
+	if len(b) < n+1+tendencySize {
+		return nil, errors.New("world tendency too short")
+	}
+
+	vals := make([]int32, 21)
+	if err := binary.Read(
+		bytes.NewReader(b[n+1:]), binary.LittleEndian, vals,
+	); err != nil {
+		return nil, err
+	}
+
+	v := func(i int) int { return int(vals[i]) }
+	return &character.CharacterTendency{
+		CharacterID: string(b[:n]),
+		WorldTendency: character.WorldTendency{
+			Area1: v(0), WB1: v(1), LR1: v(2),
+			Area2: v(3), WB2: v(4), LR2: v(5),
+			Area3: v(6), WB3: v(7), LR3: v(8),
+			Area4: v(9), WB4: v(10), LR4: v(11),
+			Area5: v(12), WB5: v(13), LR5: v(14),
+			Area6: v(15), WB6: v(16), LR6: v(17),
+			Area7: v(18), WB7: v(19), LR7: v(20),
+		},
+	}, nil
+}
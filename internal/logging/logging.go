@@ -0,0 +1,70 @@
+// Package logging creates the server logger, writing to the console or to a
+// rotated log file.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// FormatJSON writes a JSON object per log message.
+	FormatJSON = "json"
+
+	// FormatConsole writes human readable log messages, using zerolog's
+	// ConsoleWriter.
+	FormatConsole = "console"
+)
+
+// Output configures where and how log messages are written.
+type Output struct {
+	// Format is FormatJSON or FormatConsole.
+	Format string
+
+	// Path is the file to write to, or empty to write to stdout.
+	Path string
+
+	// MaxSize is the size in bytes at which the log file is rotated, or 0 to
+	// never rotate it.
+	MaxSize int64
+
+	// MaxBackups is the number of rotated log files kept, or 0 to keep all of
+	// them.
+	MaxBackups int
+}
+
+// New returns a logger writing to the given output, and a closer which closes
+// the log file, if any.
+func New(o Output) (zerolog.Logger, io.Closer, error) {
+	var (
+		w      io.Writer = os.Stdout
+		closer io.Closer = nopCloser{}
+		l      zerolog.Logger
+	)
+	if o.Path != "" {
+		f, err := OpenRotatingFile(o.Path, o.MaxSize, o.MaxBackups)
+		if err != nil {
+			return l, nil, err
+		}
+		w, closer = f, f
+	}
+
+	switch o.Format {
+	case FormatJSON:
+	case FormatConsole:
+		w = zerolog.ConsoleWriter{Out: w, NoColor: o.Path != ""}
+	default:
+		closer.Close()
+		return l, nil, fmt.Errorf("unknown log format %q", o.Format)
+	}
+
+	return zerolog.New(w).With().Timestamp().Logger(), closer, nil
+}
+
+// nopCloser is an io.Closer which does nothing.
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
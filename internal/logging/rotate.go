@@ -0,0 +1,122 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RotatingFile is a log file which is rotated once it reaches a maximum size.
+//
+// Rotated files are renamed with the time of rotation, such as
+// dessego.2006-01-02T15-04-05.000.log for dessego.log.
+type RotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// OpenRotatingFile opens the log file at path for appending, rotating it once
+// it reaches maxSize bytes and keeping maxBackups rotated files. The file is
+// never rotated if maxSize is 0, and every rotated file is kept if maxBackups
+// is 0.
+func OpenRotatingFile(path string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	rf := &RotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+
+	return rf, nil
+}
+
+// Write implements io.Writer. The file is rotated before the write if the
+// write would take it over the maximum size.
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.maxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := rf.f.Write(p)
+	rf.size += int64(n)
+
+	return n, err
+}
+
+// Close closes the log file.
+func (rf *RotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	return rf.f.Close()
+}
+
+// open opens the log file for appending.
+func (rf *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(rf.path), 0o755); err != nil {
+		return fmt.Errorf("create log directory: %w", err)
+	}
+
+	f, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open log file: %w", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("stat log file: %w", err)
+	}
+
+	rf.f, rf.size = f, fi.Size()
+
+	return nil
+}
+
+// rotate renames the log file with the current time, opens a new log file and
+// removes the oldest rotated files over the maximum kept.
+func (rf *RotatingFile) rotate() error {
+	if err := rf.f.Close(); err != nil {
+		return fmt.Errorf("close log file: %w", err)
+	}
+
+	ext := filepath.Ext(rf.path)
+	base := rf.path[:len(rf.path)-len(ext)]
+	rotated := base + "." + time.Now().UTC().Format("2006-01-02T15-04-05.000") + ext
+	if err := os.Rename(rf.path, rotated); err != nil {
+		return fmt.Errorf("rotate log file: %w", err)
+	}
+
+	if err := rf.open(); err != nil {
+		return err
+	}
+
+	if rf.maxBackups <= 0 {
+		return nil
+	}
+	backups, err := filepath.Glob(base + ".*" + ext)
+	if err != nil {
+		return fmt.Errorf("list rotated log files: %w", err)
+	}
+
+	// The timestamps sort oldest first.
+	sort.Strings(backups)
+	for len(backups) > rf.maxBackups {
+		if err = os.Remove(backups[0]); err != nil {
+			return fmt.Errorf("remove rotated log file: %w", err)
+		}
+		backups = backups[1:]
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package logging
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "dessego.log")
+
+	rf, err := OpenRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err = rf.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+
+		// Rotated files are named by the time of rotation.
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(b); got != "fourth\n" {
+		t.Fatalf("expected log file %q got %q", "fourth\n", got)
+	}
+
+	backups, err := filepath.Glob(filepath.Join(dir, "dessego.*.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("expected 2 rotated files got: %v", backups)
+	}
+
+	var contents []string
+	for _, bp := range backups {
+		b, err = ioutil.ReadFile(bp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents = append(contents, string(b))
+	}
+	if got, exp := strings.Join(contents, ""), "second\nthird\n"; got != exp {
+		t.Fatalf("expected rotated files %q got %q", exp, got)
+	}
+}
+
+func TestNew_invalidFormat(t *testing.T) {
+	if _, _, err := New(Output{Format: "xml"}); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,136 @@
+// Package render draws top-down maps of the Demon's Souls game world.
+package render
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/danmrichards/dessego/internal/service/gamestate"
+	"github.com/danmrichards/dessego/internal/service/replay"
+	"github.com/danmrichards/dessego/internal/spatial"
+)
+
+const (
+	// size is the length in pixels of the longest side of a rendered map.
+	size = 1024
+
+	// margin is the space in pixels around the edge of a rendered map.
+	margin = 20
+)
+
+// style is the stylesheet embedded in rendered maps. Markers are drawn
+// translucent so that clusters stand out.
+const style = `
+svg { background: #111; font-family: sans-serif; }
+text { fill: #ddd; font-size: 14px; }
+circle { fill-opacity: 0.6; }
+circle.bloodstain { fill: #f22; }
+circle.message { fill: #fc3; }
+circle.sos { fill: #3f6; }
+`
+
+// markerRadius is the radius in pixels of the marker drawn for each kind of
+// item.
+var markerRadius = map[spatial.Kind]float64{
+	spatial.KindBloodstain: 3,
+	spatial.KindMessage:    2.5,
+	spatial.KindSOS:        4,
+}
+
+// Map is a top-down map of a block, looking down the Y axis.
+//
+// Only markers are drawn. The movement paths recorded in bloodstains and
+// ghosts are not, as the layout of the recordings has not been verified.
+type Map struct {
+	BlockID int32
+	Items   []spatial.Item
+}
+
+// AddReplays adds the bloodstain of each replay to the map.
+func (m *Map) AddReplays(rs []replay.Replay) {
+	for _, r := range rs {
+		m.Items = append(m.Items, spatial.Item{
+			Kind:        spatial.KindBloodstain,
+			ID:          r.ID,
+			CharacterID: r.CharacterID,
+			BlockID:     r.BlockID,
+			Point:       spatial.Point{X: r.PosX, Y: r.PosY, Z: r.PosZ},
+		})
+	}
+}
+
+// projection maps game world X and Z coordinates to SVG coordinates.
+type projection struct {
+	minX, maxZ, scale float64
+}
+
+// point returns the SVG coordinates of the game world X and Z coordinates.
+// The Z axis is flipped, so positive Z points up the map.
+func (p projection) point(x, z float32) (float64, float64) {
+	return margin + (float64(x)-p.minX)*p.scale,
+		margin + (p.maxZ-float64(z))*p.scale
+}
+
+// WriteSVG writes the map to w as an SVG image.
+func (m Map) WriteSVG(w io.Writer) error {
+	var (
+		minX, minZ = math.Inf(1), math.Inf(1)
+		maxX, maxZ = math.Inf(-1), math.Inf(-1)
+	)
+	extend := func(x, z float32) {
+		minX, maxX = math.Min(minX, float64(x)), math.Max(maxX, float64(x))
+		minZ, maxZ = math.Min(minZ, float64(z)), math.Max(maxZ, float64(z))
+	}
+	for _, it := range m.Items {
+		extend(it.Point.X, it.Point.Z)
+	}
+	if math.IsInf(minX, 1) {
+		// Nothing to draw.
+		minX, maxX, minZ, maxZ = 0, 1, 0, 1
+	}
+
+	span := math.Max(math.Max(maxX-minX, maxZ-minZ), 1)
+	pr := projection{
+		minX:  minX,
+		maxZ:  maxZ,
+		scale: (size - 2*margin) / span,
+	}
+	width := (maxX-minX)*pr.scale + 2*margin
+	height := (maxZ-minZ)*pr.scale + 2*margin
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(
+		bw,
+		`<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" viewBox="0 0 %.0f %.0f">`+"\n",
+		width, height, width, height,
+	)
+
+	title := gamestate.Block(m.BlockID).String()
+	bw.WriteString("<title>")
+	xml.EscapeText(bw, []byte(title))
+	bw.WriteString("</title>\n<style>")
+	bw.WriteString(style)
+	bw.WriteString("</style>\n")
+
+	for _, it := range m.Items {
+		r, ok := markerRadius[it.Kind]
+		if !ok {
+			continue
+		}
+
+		x, y := pr.point(it.Point.X, it.Point.Z)
+		fmt.Fprintf(
+			bw, `<circle class="%s" cx="%.1f" cy="%.1f" r="%.1f"/>`+"\n",
+			it.Kind, x, y, r,
+		)
+	}
+
+	bw.WriteString(`<text x="8" y="18">`)
+	xml.EscapeText(bw, []byte(title))
+	bw.WriteString("</text>\n</svg>\n")
+
+	return bw.Flush()
+}
@@ -0,0 +1,62 @@
+package render
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/danmrichards/dessego/internal/spatial"
+)
+
+func TestMap_WriteSVG(t *testing.T) {
+	m := Map{
+		BlockID: 40070,
+		Items: []spatial.Item{
+			{Kind: spatial.KindBloodstain, Point: spatial.Point{X: 10, Z: 5}},
+			{Kind: spatial.KindMessage, Point: spatial.Point{X: 5, Z: 0}},
+			{Kind: spatial.KindSOS, Point: spatial.Point{X: 0, Z: 5}},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := m.WriteSVG(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// The output should be well formed XML.
+	d := xml.NewDecoder(bytes.NewReader(buf.Bytes()))
+	for {
+		if _, err := d.Token(); err != nil {
+			if err == io.EOF {
+				break
+			}
+			t.Fatalf("invalid XML: %v", err)
+		}
+	}
+
+	svg := buf.String()
+	for _, want := range []string{
+		`width="1024" height="532"`,
+		`<title>3-1 Prison 1</title>`,
+		`<circle class="bloodstain" cx="1004.0" cy="20.0" r="3.0"/>`,
+		`<circle class="message" cx="512.0" cy="512.0" r="2.5"/>`,
+		`<circle class="sos" cx="20.0" cy="20.0" r="4.0"/>`,
+	} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("expected SVG to contain %q\n%s", want, svg)
+		}
+	}
+}
+
+func TestMap_WriteSVG_empty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := (Map{BlockID: 1}).WriteSVG(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(buf.String(), "UNKNOWN BLOCK") {
+		t.Fatalf("expected block name in %s", buf.String())
+	}
+}
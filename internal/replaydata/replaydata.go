@@ -0,0 +1,67 @@
+// Package replaydata validates the recordings Demon's Souls uploads for
+// bloodstains and wandering ghosts.
+//
+// The game sends recordings as base64 text, often with broken characters, of
+// a zlib compressed payload. The layout of the decompressed payload has not
+// been verified against a recording captured from the game, so recordings are
+// only checked to be intact compressed data of a reasonable size, and are
+// stored and served as they were uploaded.
+package replaydata
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/danmrichards/dessego/internal/transport/encoding/base64"
+)
+
+// MaxPayloadSize is the maximum size in bytes of a decompressed payload.
+const MaxPayloadSize = 2 << 20
+
+// FormatError is returned when a recording is not in the expected format.
+type FormatError string
+
+// Error implements error.
+func (f FormatError) Error() string {
+	return "invalid replay data: " + string(f)
+}
+
+// SizeError is returned when a recording exceeds the maximum size.
+type SizeError string
+
+// Error implements error.
+func (s SizeError) Error() string {
+	return "replay data too large: " + string(s)
+}
+
+// Validate checks the base64 text b, as sent by Demon's Souls, is valid
+// compressed data within the size limits.
+func Validate(b []byte) error {
+	c, err := base64.StdEncoding.DecodeString(string(b))
+	if err != nil {
+		return FormatError("base64: " + err.Error())
+	}
+
+	zr, err := zlib.NewReader(bytes.NewReader(c))
+	if err != nil {
+		return FormatError("zlib: " + err.Error())
+	}
+	defer zr.Close()
+
+	// Reading to the end verifies the zlib checksum.
+	n, err := io.Copy(ioutil.Discard, io.LimitReader(zr, MaxPayloadSize+1))
+	if err != nil {
+		return FormatError("zlib: " + err.Error())
+	}
+	switch {
+	case n > MaxPayloadSize:
+		return SizeError(fmt.Sprintf("payload exceeds %d bytes", MaxPayloadSize))
+	case n == 0:
+		return FormatError("empty payload")
+	}
+
+	return nil
+}
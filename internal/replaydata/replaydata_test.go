@@ -0,0 +1,67 @@
+package replaydata
+
+import (
+	"bytes"
+	"compress/zlib"
+	stdbase64 "encoding/base64"
+	"errors"
+	"testing"
+)
+
+// encode returns the payload p compressed and base64 encoded, as Demon's
+// Souls sends it.
+func encode(p []byte) []byte {
+	var c bytes.Buffer
+	zw := zlib.NewWriter(&c)
+
+	// Writes to a bytes.Buffer cannot fail.
+	zw.Write(p)
+	zw.Close()
+
+	return []byte(stdbase64.StdEncoding.EncodeToString(c.Bytes()))
+}
+
+func TestValidate(t *testing.T) {
+	p := bytes.Repeat([]byte{0x3f, 0xc0, 0x00, 0x00, 0xfb}, 64)
+
+	// Demon's Souls sends spaces in place of plus signs and terminates the
+	// data with a zero byte.
+	broken := bytes.ReplaceAll(encode(p), []byte("+"), []byte(" "))
+	broken = append(broken, 0x00)
+
+	tests := map[string]struct {
+		b    []byte
+		want interface{}
+	}{
+		"valid":          {b: encode(p)},
+		"broken":         {b: broken},
+		"any layout":     {b: encode([]byte{0x01})},
+		"not compressed": {b: []byte("aGVsbG8gd29ybGQ="), want: FormatError("")},
+		"empty":          {b: encode(nil), want: FormatError("")},
+		"truncated":      {b: encode(p)[:20], want: FormatError("")},
+		"too large":      {b: encode(make([]byte, MaxPayloadSize+1)), want: SizeError("")},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := Validate(tc.b)
+
+			switch tc.want.(type) {
+			case nil:
+				if err != nil {
+					t.Fatal(err)
+				}
+			case FormatError:
+				var fe FormatError
+				if !errors.As(err, &fe) {
+					t.Fatalf("expected FormatError got %v", err)
+				}
+			case SizeError:
+				var se SizeError
+				if !errors.As(err, &se) {
+					t.Fatalf("expected SizeError got %v", err)
+				}
+			}
+		})
+	}
+}
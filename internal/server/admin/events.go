@@ -0,0 +1,157 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/danmrichards/dessego/internal/events"
+)
+
+// eventsKeepAlive is the interval at which a comment is written to idle event
+// streams, so proxies and clients do not close them.
+const eventsKeepAlive = 15 * time.Second
+
+// swagger:operation GET /events eventsHandler
+//
+// Streams live game activity as server-sent events
+//
+// ---
+// summary: Stream game activity
+// tags:
+// - "admin"
+// produces:
+// - text/event-stream
+// parameters:
+// - in: "query"
+//   name: "region"
+//   description: "Comma separated regions to stream activity from"
+//   type: "string"
+// - in: "query"
+//   name: "block"
+//   description: "Comma separated block IDs or area prefixes, such as 4-2, to stream activity from"
+//   type: "string"
+// - in: "query"
+//   name: "type"
+//   description: "Comma separated types of activity to stream: message, rating, bloodstain, ghost, sos, summon or grade"
+//   type: "string"
+// responses:
+//   '200':
+//     description: successful operation
+//   '400':
+//     description: invalid query
+//   '404':
+//     description: event stream is disabled
+//   '500':
+//     description: unsuccessful operation
+func (s *Server) eventsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.ev == nil {
+			http.Error(w, "event stream is disabled", http.StatusNotFound)
+			return
+		}
+
+		f, err := parseFilter(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		fl, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		sub := s.ev.Subscribe(f)
+		defer sub.Close()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		fl.Flush()
+
+		ka := time.NewTicker(eventsKeepAlive)
+		defer ka.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-s.closing:
+				return
+			case <-ka.C:
+				_, err = fmt.Fprint(w, ": keep-alive\n\n")
+			case e, ok := <-sub.Events():
+				if !ok {
+					return
+				}
+
+				var b []byte
+				if b, err = json.Marshal(e); err != nil {
+					s.log(r.Context()).Err(err).Msg("")
+					continue
+				}
+				_, err = fmt.Fprintf(w, "data: %s\n\n", b)
+			}
+			if err != nil {
+				// The client has gone away.
+				return
+			}
+
+			fl.Flush()
+		}
+	}
+}
+
+// parseFilter returns the events filter given by the region, block and type
+// query parameters, each of which may hold several comma separated values.
+func parseFilter(q url.Values) (f events.Filter, err error) {
+	f.Regions = splitQuery(q, "region")
+
+	for _, b := range splitQuery(q, "block") {
+		var ids []int32
+		if ids, err = parseBlocks(b); err != nil {
+			return f, err
+		}
+		f.Blocks = append(f.Blocks, ids...)
+	}
+
+	for _, t := range splitQuery(q, "type") {
+		if !validType(events.Type(t)) {
+			return f, fmt.Errorf("unknown event type: %s", t)
+		}
+		f.Types = append(f.Types, events.Type(t))
+	}
+
+	return f, nil
+}
+
+// splitQuery returns the comma separated values of the query parameter with
+// the given key, which may be repeated.
+func splitQuery(q url.Values, key string) []string {
+	var vs []string
+	for _, v := range q[key] {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				vs = append(vs, s)
+			}
+		}
+	}
+
+	return vs
+}
+
+// validType returns true if t is a known event type.
+func validType(t events.Type) bool {
+	for _, et := range events.Types {
+		if et == t {
+			return true
+		}
+	}
+
+	return false
+}
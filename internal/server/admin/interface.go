@@ -0,0 +1,69 @@
+package admin
+
+import (
+	"context"
+
+	"github.com/danmrichards/dessego/internal/events"
+	"github.com/danmrichards/dessego/internal/service/msg"
+	"github.com/danmrichards/dessego/internal/service/quarantine"
+	"github.com/danmrichards/dessego/internal/service/replay"
+	"github.com/danmrichards/dessego/internal/spatial"
+)
+
+// Positions is the interface that wraps methods that types must implement to
+// be queried for the positions of items they store.
+type Positions interface {
+	// Positions returns the position of every item within the given block.
+	Positions(ctx context.Context, blockID int32) ([]spatial.Item, error)
+
+	// Near returns the position of every item within radius of the center
+	// point in the given block.
+	Near(ctx context.Context, blockID int32, center spatial.Point, radius float64) ([]spatial.Item, error)
+}
+
+// Messages is the interface that wraps methods that types must implement to be
+// used as a service for querying messages.
+type Messages interface {
+	Positions
+
+	// Search returns the messages matching the given query.
+	Search(ctx context.Context, q msg.Query) ([]msg.BloodMsg, error)
+}
+
+// Replays is the interface that wraps methods that types must implement to be
+// used as a service for querying replays.
+type Replays interface {
+	Positions
+
+	// Recent returns the n most recently added replays for the given block
+	// ID.
+	Recent(ctx context.Context, blockID int32, n int) ([]replay.Replay, error)
+}
+
+// SOS is the interface that wraps methods that types must implement to be
+// used as a service for querying SOS signs.
+type SOS interface {
+	// Positions returns the position of every active SOS within the given
+	// block.
+	Positions(blockID int32) []spatial.Item
+}
+
+// Quarantine is the interface that wraps methods that types must implement to
+// be used as a service for querying rejected uploads.
+type Quarantine interface {
+	// List returns the n most recently rejected uploads.
+	List(ctx context.Context, n int) ([]quarantine.Upload, error)
+}
+
+// Events is the interface that wraps methods that types must implement to be
+// used to subscribe to live game activity.
+type Events interface {
+	// Subscribe returns a subscription to the events matching the filter.
+	Subscribe(f events.Filter) *events.Subscription
+}
+
+// Region is the in-memory state held by the game server for a region.
+type Region struct {
+	Name string
+	SOS  SOS
+}
@@ -0,0 +1,144 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/danmrichards/dessego/internal/service/gamestate"
+	"github.com/danmrichards/dessego/internal/service/msg"
+)
+
+// swagger:model msgRes
+type msgRes struct {
+	ID          uint32     `json:"id"`
+	CharacterID string     `json:"character_id"`
+	BlockID     int32      `json:"block_id"`
+	Block       string     `json:"block"`
+	Text        string     `json:"text"`
+	Rating      uint32     `json:"rating"`
+	Legacy      bool       `json:"legacy"`
+	PosX        float32    `json:"posx"`
+	PosY        float32    `json:"posy"`
+	PosZ        float32    `json:"posz"`
+	Created     *time.Time `json:"created,omitempty"`
+}
+
+// swagger:operation GET /messages searchMsgHandler
+//
+// Searches blood messages, returning the highest rated first
+//
+// ---
+// summary: Search blood messages
+// tags:
+// - "admin"
+// produces:
+// - application/json
+// parameters:
+// - in: "query"
+//   name: "block"
+//   description: "Block ID or area prefix, e.g. 4-2"
+//   type: "string"
+// - in: "query"
+//   name: "text"
+//   description: "Text contained in the English rendering of the message"
+//   type: "string"
+// - in: "query"
+//   name: "character"
+//   type: "string"
+// - in: "query"
+//   name: "min_rating"
+//   type: "integer"
+// - in: "query"
+//   name: "max_rating"
+//   type: "integer"
+// - in: "query"
+//   name: "lang"
+//   description: "Language to render messages in, only en is supported"
+//   type: "string"
+// - in: "query"
+//   name: "limit"
+//   type: "integer"
+// - in: "query"
+//   name: "offset"
+//   type: "integer"
+// responses:
+//   '200':
+//     description: successful operation
+//   '400':
+//     description: invalid query
+//   '500':
+//     description: unsuccessful operation
+func (s *Server) searchMsgHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		qv := r.URL.Query()
+
+		q := msg.Query{
+			Text:        qv.Get("text"),
+			CharacterID: qv.Get("character"),
+		}
+
+		var err error
+		if b := qv.Get("block"); b != "" {
+			if q.BlockIDs, err = parseBlocks(b); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		for p, v := range map[string]*int{
+			"min_rating": &q.MinRating,
+			"max_rating": &q.MaxRating,
+			"limit":      &q.Limit,
+			"offset":     &q.Offset,
+		} {
+			if qv.Get(p) == "" {
+				continue
+			}
+
+			if *v, err = strconv.Atoi(qv.Get(p)); err != nil {
+				http.Error(w, "invalid "+p+": "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		lang := gamestate.English
+		if l := qv.Get("lang"); l != "" {
+			if lang = gamestate.Language(l); !lang.Supported() {
+				http.Error(w, "unsupported language: "+l, http.StatusBadRequest)
+				return
+			}
+		}
+
+		bms, err := s.ms.Search(r.Context(), q)
+		if err != nil {
+			s.log(r.Context()).Err(err).Msg("")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		res := make([]msgRes, 0, len(bms))
+		for _, bm := range bms {
+			mr := msgRes{
+				ID:          bm.ID,
+				CharacterID: bm.CharacterID,
+				BlockID:     bm.BlockID,
+				Block:       gamestate.Block(bm.BlockID).String(),
+				Text:        bm.Render(lang),
+				Rating:      bm.Rating,
+				Legacy:      bm.Legacy == 1,
+				PosX:        bm.PosX,
+				PosY:        bm.PosY,
+				PosZ:        bm.PosZ,
+			}
+			if !bm.Created.IsZero() {
+				c := bm.Created
+				mr.Created = &c
+			}
+
+			res = append(res, mr)
+		}
+
+		s.writeJSON(w, res)
+	}
+}
@@ -0,0 +1,61 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// defaultQuarantineLimit is the number of rejected uploads returned when no
+// limit is given.
+const defaultQuarantineLimit = 100
+
+// swagger:operation GET /quarantine quarantineHandler
+//
+// Returns the most recently rejected replay and ghost uploads
+//
+// ---
+// summary: List rejected uploads
+// tags:
+// - "admin"
+// produces:
+// - application/json
+// parameters:
+// - in: "query"
+//   name: "limit"
+//   description: "Maximum number of uploads to return, defaults to 100"
+//   type: "integer"
+// responses:
+//   '200':
+//     description: successful operation
+//   '400':
+//     description: invalid query
+//   '404':
+//     description: quarantine is disabled
+//   '500':
+//     description: unsuccessful operation
+func (s *Server) quarantineHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.q == nil {
+			http.Error(w, "quarantine is disabled", http.StatusNotFound)
+			return
+		}
+
+		limit := defaultQuarantineLimit
+		if l := r.URL.Query().Get("limit"); l != "" {
+			var err error
+			if limit, err = strconv.Atoi(l); err != nil {
+				http.Error(w, "invalid limit: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		us, err := s.q.List(r.Context(), limit)
+		if err != nil {
+			s.log(r.Context()).Err(err).Msg("")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		s.writeJSON(w, us)
+	}
+}
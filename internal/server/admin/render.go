@@ -0,0 +1,90 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/danmrichards/dessego/internal/render"
+)
+
+// defaultRenderReplays is the number of replays drawn on a rendered map when no
+// limit is given.
+const defaultRenderReplays = 500
+
+// swagger:operation GET /render renderHandler
+//
+// Renders a top-down SVG map of a block, drawing the positions of bloodstains,
+// messages and SOS signs
+//
+// ---
+// summary: Render block map
+// tags:
+// - "admin"
+// produces:
+// - image/svg+xml
+// parameters:
+// - in: "query"
+//   name: "block"
+//   description: "Block ID or a name prefix matching a single block"
+//   type: "string"
+//   required: true
+// - in: "query"
+//   name: "limit"
+//   description: "Maximum number of the most recent replays to draw, defaults to 500"
+//   type: "integer"
+// responses:
+//   '200':
+//     description: successful operation
+//   '400':
+//     description: invalid query
+//   '500':
+//     description: unsuccessful operation
+func (s *Server) renderHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		qv := r.URL.Query()
+
+		ids, err := parseBlocks(qv.Get("block"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		} else if len(ids) != 1 {
+			http.Error(w, "block matches more than one block", http.StatusBadRequest)
+			return
+		}
+
+		limit := defaultRenderReplays
+		if l := qv.Get("limit"); l != "" {
+			if limit, err = strconv.Atoi(l); err != nil {
+				http.Error(w, "invalid limit: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		m := render.Map{BlockID: ids[0]}
+
+		rps, err := s.rs.Recent(r.Context(), m.BlockID, limit)
+		if err != nil {
+			s.log(r.Context()).Err(err).Msg("")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		m.AddReplays(rps)
+
+		mps, err := s.ms.Positions(r.Context(), m.BlockID)
+		if err != nil {
+			s.log(r.Context()).Err(err).Msg("")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		m.Items = append(m.Items, mps...)
+
+		for _, ss := range s.sos() {
+			m.Items = append(m.Items, ss.Positions(m.BlockID)...)
+		}
+
+		w.Header().Set("Content-Type", "image/svg+xml")
+		if err = m.WriteSVG(w); err != nil {
+			s.log(r.Context()).Err(err).Msg("")
+		}
+	}
+}
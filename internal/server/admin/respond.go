@@ -0,0 +1,37 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/danmrichards/dessego/internal/service/gamestate"
+)
+
+// writeJSON writes v to the response as JSON. The content type defaults to
+// application/json if not already set.
+func (s *Server) writeJSON(w http.ResponseWriter, v interface{}) {
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.l.Err(err).Msg("")
+	}
+}
+
+// parseBlocks returns the block IDs represented by the given block ID or area
+// prefix, such as "4-2".
+func parseBlocks(b string) ([]int32, error) {
+	if id, err := strconv.ParseInt(b, 10, 32); err == nil {
+		return []int32{int32(id)}, nil
+	}
+
+	ids := gamestate.Blocks(b)
+	if len(ids) == 0 {
+		return nil, errors.New("unknown block: " + b)
+	}
+
+	return ids, nil
+}
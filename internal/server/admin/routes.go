@@ -0,0 +1,26 @@
+package admin
+
+import (
+	"expvar"
+
+	"github.com/danmrichards/dessego/internal/server/middleware"
+)
+
+func (s *Server) routes() {
+	s.r.HandleFunc("/messages", middleware.LogRequest(s.l, s.searchMsgHandler()))
+
+	// Spatial routes.
+	s.r.HandleFunc("/spatial/near", middleware.LogRequest(s.l, s.nearHandler()))
+	s.r.HandleFunc("/spatial/clusters", middleware.LogRequest(s.l, s.clustersHandler()))
+	s.r.HandleFunc("/spatial/export", middleware.LogRequest(s.l, s.exportHandler()))
+	s.r.HandleFunc("/render", middleware.LogRequest(s.l, s.renderHandler()))
+
+	// Upload validation routes.
+	s.r.HandleFunc("/quarantine", middleware.LogRequest(s.l, s.quarantineHandler()))
+
+	// Live game activity, streamed as server-sent events.
+	s.r.HandleFunc("/events", middleware.LogRequest(s.l, s.eventsHandler()))
+
+	// Metrics, such as rejected uploads, published by expvar.
+	s.r.Handle("/debug/vars", expvar.Handler())
+}
@@ -0,0 +1,109 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/danmrichards/dessego/internal/server/middleware"
+	"github.com/rs/zerolog"
+)
+
+// Server is an admin server, providing a JSON API for server operators and
+// community tools.
+type Server struct {
+	nl net.Listener
+	r  *http.ServeMux
+	h  *http.Server
+
+	l zerolog.Logger
+
+	ms      Messages
+	rs      Replays
+	regions []Region
+	q       Quarantine
+	ev      Events
+
+	// closing is closed when the server starts shutting down, ending event
+	// streams which would otherwise hold up the shutdown.
+	closing chan struct{}
+}
+
+// NewServer returns an admin server configured to run on the given address.
+//
+// As SOS signs and ghosts may be held separately by each game server, every
+// region should be given. Regions may share SOS signs and ghosts, which are
+// then only listed once. The quarantine service may be nil if rejected
+// uploads are not stored, and the events subscriber may be nil if live game
+// activity is not streamed.
+func NewServer(
+	addr string,
+	ms Messages,
+	rs Replays,
+	regions []Region,
+	q Quarantine,
+	ev Events,
+	l zerolog.Logger,
+) (s *Server, err error) {
+	s = &Server{
+		r:       http.NewServeMux(),
+		ms:      ms,
+		rs:      rs,
+		regions: regions,
+		q:       q,
+		ev:      ev,
+		closing: make(chan struct{}),
+		l:       l,
+	}
+
+	s.nl, err = net.Listen("tcp4", addr)
+	if err != nil {
+		return nil, fmt.Errorf("net listen: %w", err)
+	}
+
+	s.routes()
+
+	s.h = &http.Server{
+		Addr:    addr,
+		Handler: s.r,
+	}
+	s.h.RegisterOnShutdown(func() { close(s.closing) })
+
+	return s, nil
+}
+
+// sos returns the SOS signs of every region, once each.
+func (s *Server) sos() []SOS {
+	seen := make(map[SOS]bool, len(s.regions))
+	sos := make([]SOS, 0, len(s.regions))
+	for _, rg := range s.regions {
+		if !seen[rg.SOS] {
+			seen[rg.SOS] = true
+			sos = append(sos, rg.SOS)
+		}
+	}
+
+	return sos
+}
+
+// Serve accepts incoming admin connections.
+func (s *Server) Serve() error {
+	return s.h.Serve(s.nl)
+}
+
+// Close closes the admin server.
+func (s *Server) Close() error {
+	return s.h.Close()
+}
+
+// Shutdown gracefully shuts down the admin server, waiting for in-flight
+// requests to complete until the context is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.h.Shutdown(ctx)
+}
+
+// log returns the logger for the request with the given context.
+func (s *Server) log(ctx context.Context) *zerolog.Logger {
+	return middleware.Logger(ctx, &s.l)
+}
@@ -0,0 +1,310 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/danmrichards/dessego/internal/spatial"
+)
+
+// defaultClusterEps is the distance within which items are clustered when no
+// distance is given.
+const defaultClusterEps = 0.5
+
+// spatialQuery is a query for the positions of items.
+type spatialQuery struct {
+	blockIDs []int32
+	kinds    map[spatial.Kind]bool
+}
+
+// parseSpatialQuery parses the block and kind parameters shared by the spatial
+// routes. A block is required, kind defaults to every kind.
+func parseSpatialQuery(qv url.Values) (q spatialQuery, err error) {
+	b := qv.Get("block")
+	if b == "" {
+		return q, errors.New("block is required")
+	}
+	if q.blockIDs, err = parseBlocks(b); err != nil {
+		return q, err
+	}
+
+	q.kinds = map[spatial.Kind]bool{
+		spatial.KindMessage:    true,
+		spatial.KindBloodstain: true,
+		spatial.KindSOS:        true,
+	}
+	if k := qv.Get("kind"); k != "" {
+		want := make(map[spatial.Kind]bool)
+		for _, kind := range strings.Split(k, ",") {
+			if !q.kinds[spatial.Kind(kind)] {
+				return q, errors.New("unknown kind: " + kind)
+			}
+			want[spatial.Kind(kind)] = true
+		}
+		q.kinds = want
+	}
+
+	return q, nil
+}
+
+// parseFloat parses the named float parameter, returning def if absent.
+func parseFloat(qv url.Values, name string, def float64) (float64, error) {
+	v := qv.Get(name)
+	if v == "" {
+		return def, nil
+	}
+
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, errors.New("invalid " + name + ": " + err.Error())
+	}
+
+	return f, nil
+}
+
+// positions returns the positions of the items matching q. If radius is
+// positive only items within radius of center are returned.
+func (s *Server) positions(
+	ctx context.Context,
+	q spatialQuery,
+	center spatial.Point,
+	radius float64,
+) ([]spatial.Item, error) {
+	items := make([]spatial.Item, 0)
+
+	for _, id := range q.blockIDs {
+		for kind, p := range map[spatial.Kind]Positions{
+			spatial.KindMessage:    s.ms,
+			spatial.KindBloodstain: s.rs,
+		} {
+			if !q.kinds[kind] {
+				continue
+			}
+
+			var (
+				its []spatial.Item
+				err error
+			)
+			if radius > 0 {
+				its, err = p.Near(ctx, id, center, radius)
+			} else {
+				its, err = p.Positions(ctx, id)
+			}
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, its...)
+		}
+
+		if !q.kinds[spatial.KindSOS] {
+			continue
+		}
+		for _, ss := range s.sos() {
+			its := ss.Positions(id)
+			if radius > 0 {
+				its = spatial.Within(its, center, radius)
+			}
+			items = append(items, its...)
+		}
+	}
+
+	return items, nil
+}
+
+// swagger:operation GET /spatial/near nearHandler
+//
+// Returns the messages, bloodstains and SOS signs within a radius of a point
+//
+// ---
+// summary: Find items near a point
+// tags:
+// - "admin"
+// produces:
+// - application/json
+// parameters:
+// - in: "query"
+//   name: "block"
+//   description: "Block ID or area prefix, e.g. 4-2"
+//   type: "string"
+//   required: true
+// - in: "query"
+//   name: "kind"
+//   description: "Comma separated kinds: message, bloodstain, sos"
+//   type: "string"
+// - in: "query"
+//   name: "x"
+//   type: "number"
+// - in: "query"
+//   name: "y"
+//   type: "number"
+// - in: "query"
+//   name: "z"
+//   type: "number"
+// - in: "query"
+//   name: "radius"
+//   type: "number"
+//   required: true
+// responses:
+//   '200':
+//     description: successful operation
+//   '400':
+//     description: invalid query
+//   '500':
+//     description: unsuccessful operation
+func (s *Server) nearHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		qv := r.URL.Query()
+
+		q, err := parseSpatialQuery(qv)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var c [4]float64
+		for i, p := range []string{"x", "y", "z", "radius"} {
+			if c[i], err = parseFloat(qv, p, 0); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if c[3] <= 0 {
+			http.Error(w, "radius must be positive", http.StatusBadRequest)
+			return
+		}
+
+		center := spatial.Point{X: float32(c[0]), Y: float32(c[1]), Z: float32(c[2])}
+		items, err := s.positions(r.Context(), q, center, c[3])
+		if err != nil {
+			s.log(r.Context()).Err(err).Msg("")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		s.writeJSON(w, items)
+	}
+}
+
+// swagger:operation GET /spatial/clusters clustersHandler
+//
+// Groups messages, bloodstains and SOS signs at near identical positions,
+// returning only groups with more than one item
+//
+// ---
+// summary: Find clusters of duplicate items
+// tags:
+// - "admin"
+// produces:
+// - application/json
+// parameters:
+// - in: "query"
+//   name: "block"
+//   description: "Block ID or area prefix, e.g. 4-2"
+//   type: "string"
+//   required: true
+// - in: "query"
+//   name: "kind"
+//   description: "Comma separated kinds: message, bloodstain, sos"
+//   type: "string"
+// - in: "query"
+//   name: "eps"
+//   description: "Positive distance within which items are clustered, defaults to 0.5"
+//   type: "number"
+// responses:
+//   '200':
+//     description: successful operation
+//   '400':
+//     description: invalid query
+//   '500':
+//     description: unsuccessful operation
+func (s *Server) clustersHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		qv := r.URL.Query()
+
+		q, err := parseSpatialQuery(qv)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		eps, err := parseFloat(qv, "eps", defaultClusterEps)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		items, err := s.positions(r.Context(), q, spatial.Point{}, 0)
+		if err != nil {
+			s.log(r.Context()).Err(err).Msg("")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		cs, err := spatial.Clusters(items, eps)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		res := make([]spatial.Cluster, 0)
+		for _, c := range cs {
+			if len(c.Items) > 1 {
+				res = append(res, c)
+			}
+		}
+
+		s.writeJSON(w, res)
+	}
+}
+
+// swagger:operation GET /spatial/export exportHandler
+//
+// Exports the positions of messages, bloodstains and SOS signs as a
+// GeoJSON-like feature collection
+//
+// ---
+// summary: Export item positions
+// tags:
+// - "admin"
+// produces:
+// - application/geo+json
+// parameters:
+// - in: "query"
+//   name: "block"
+//   description: "Block ID or area prefix, e.g. 4-2"
+//   type: "string"
+//   required: true
+// - in: "query"
+//   name: "kind"
+//   description: "Comma separated kinds: message, bloodstain, sos"
+//   type: "string"
+// responses:
+//   '200':
+//     description: successful operation
+//   '400':
+//     description: invalid query
+//   '500':
+//     description: unsuccessful operation
+func (s *Server) exportHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q, err := parseSpatialQuery(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		items, err := s.positions(r.Context(), q, spatial.Point{}, 0)
+		if err != nil {
+			s.log(r.Context()).Err(err).Msg("")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/geo+json")
+		s.writeJSON(w, spatial.NewFeatureCollection(items))
+	}
+}
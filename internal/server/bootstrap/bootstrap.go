@@ -3,16 +3,13 @@ package bootstrap
 import (
 	"bytes"
 	"encoding/base64"
+	"encoding/xml"
+	"net"
 	"net/http"
+	"strings"
 	"text/template"
 )
 
-type bootstrapData struct {
-	Servers map[int]string
-
-	// TODO: Configure other bootstrap elements
-}
-
 // swagger:operation GET / bootstrap
 //
 // Returns a base64 encoded XML document to configure the game client for
@@ -28,33 +25,35 @@ type bootstrapData struct {
 //   '200':
 //     description: successful operation
 func (s *Server) bootstrapHandler() http.HandlerFunc {
-	tpl := template.Must(template.ParseFiles("internal/server/bootstrap/res.tpl"))
+	tpl := template.Must(
+		template.New("res.tpl").
+			Funcs(template.FuncMap{"xml": escapeXML}).
+			ParseFiles("internal/server/bootstrap/res.tpl"),
+	)
 
-	// Regional gamestate server URLs.
-	urlUS := "http://" + s.gsHost + ":" + s.gs["US"] + "/cgi-bin/"
-	urlEU := "http://" + s.gsHost + ":" + s.gs["EU"] + "/cgi-bin/"
-	urlJP := "http://" + s.gsHost + ":" + s.gs["JP"] + "/cgi-bin/"
+	return func(w http.ResponseWriter, r *http.Request) {
+		var ip net.IP
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			ip = net.ParseIP(host)
+		}
 
-	// Data needed for gamestate bootstrap.
-	bd := bootstrapData{
-		Servers: map[int]string{
-			1:  urlUS,
-			2:  urlEU,
-			3:  urlJP,
-			4:  urlJP,
-			5:  urlEU,
-			6:  urlEU,
-			7:  urlEU,
-			8:  urlEU,
-			11: urlJP,
-			12: urlJP,
-		},
-	}
+		// The configuration may change between requests.
+		c, profile, reason := s.config().forClient(ip)
+		if profile != "" {
+			s.log(r.Context()).Debug().
+				Str("client", r.RemoteAddr).
+				Str("profile", profile).
+				Str("reason", reason).
+				Msg("bootstrap profile chosen")
+		} else {
+			s.log(r.Context()).Debug().
+				Str("client", r.RemoteAddr).
+				Msg("bootstrap default chosen")
+		}
 
-	return func(w http.ResponseWriter, r *http.Request) {
 		var buf bytes.Buffer
-		if err := tpl.Execute(&buf, bd); err != nil {
-			s.l.Err(err).Msg("")
+		if err := tpl.Execute(&buf, c.document()); err != nil {
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -66,3 +65,11 @@ func (s *Server) bootstrapHandler() http.HandlerFunc {
 		w.Write(res)
 	}
 }
+
+// escapeXML returns s with the XML special characters escaped.
+func escapeXML(s string) string {
+	var sb strings.Builder
+	xml.EscapeText(&sb, []byte(s))
+
+	return sb.String()
+}
@@ -1,3 +1,263 @@
 package bootstrap
 
-// TODO: TestServer_bootstrapHandler
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestMain(m *testing.M) {
+	// The template is loaded relative to the repository root.
+	if err := os.Chdir("../../.."); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	os.Exit(m.Run())
+}
+
+func testConfig() Config {
+	c := DefaultConfig()
+	c.GameURLs = map[string]string{
+		"US": "http://us.example.com:18666/cgi-bin/",
+		"EU": "http://eu.example.com:18667/cgi-bin/",
+		"JP": "http://jp.example.com:18668/cgi-bin/",
+	}
+	for n, region := range map[int]string{
+		1: "US", 2: "EU", 3: "JP", 4: "JP", 5: "EU",
+		6: "EU", 7: "EU", 8: "EU", 11: "JP", 12: "JP",
+	} {
+		sl := c.Slots[n]
+		sl.Region = region
+		c.Slots[n] = sl
+	}
+
+	return c
+}
+
+func bootstrap(t *testing.T, s *Server) string {
+	t.Helper()
+
+	return bootstrapFrom(t, s, "192.0.2.1")
+}
+
+func bootstrapFrom(t *testing.T, s *Server, ip string) string {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = ip + ":3000"
+	w := httptest.NewRecorder()
+	s.bootstrapHandler()(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status: %d got: %d %s", http.StatusOK, w.Code, w.Body)
+	}
+
+	b, err := base64.StdEncoding.DecodeString(w.Body.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(b)
+}
+
+func TestServer_bootstrapHandler(t *testing.T) {
+	s := &Server{l: zerolog.Nop()}
+	if err := s.SetConfig(testConfig()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The default configuration renders the original bootstrap document.
+	exp := `<ss>0</ss>
+<lang1></lang1>
+<lang2></lang2>
+<lang3></lang3>
+<lang4></lang4>
+<lang5></lang5>
+<lang6></lang6>
+<lang7></lang7>
+<lang8></lang8>
+<lang11></lang11>
+<lang12></lang12>
+<gameurl1>http://us.example.com:18666/cgi-bin/</gameurl1>
+<gameurl2>http://eu.example.com:18667/cgi-bin/</gameurl2>
+<gameurl3>http://jp.example.com:18668/cgi-bin/</gameurl3>
+<gameurl4>http://jp.example.com:18668/cgi-bin/</gameurl4>
+<gameurl5>http://eu.example.com:18667/cgi-bin/</gameurl5>
+<gameurl6>http://eu.example.com:18667/cgi-bin/</gameurl6>
+<gameurl7>http://eu.example.com:18667/cgi-bin/</gameurl7>
+<gameurl8>http://eu.example.com:18667/cgi-bin/</gameurl8>
+<gameurl11>http://jp.example.com:18668/cgi-bin/</gameurl11>
+<gameurl12>http://jp.example.com:18668/cgi-bin/</gameurl12>
+<browserurl1></browserurl1>
+<browserurl2></browserurl2>
+<browserurl3></browserurl3>
+<interval1>120</interval1>
+<interval2>120</interval2>
+<interval3>120</interval3>
+<interval4>120</interval4>
+<interval5>120</interval5>
+<interval6>120</interval6>
+<interval7>120</interval7>
+<interval8>120</interval8>
+<interval11>120</interval11>
+<interval12>120</interval12>
+<getWanderingGhostInterval>20</getWanderingGhostInterval>
+<setWanderingGhostInterval>20</setWanderingGhostInterval>
+<getBloodMessageNum>80</getBloodMessageNum>
+<getReplayListNum>80</getReplayListNum>
+<enableWanderingGhost>1</enableWanderingGhost>`
+	if got := bootstrap(t, s); got != exp {
+		t.Fatalf("expected document:\n%s\ngot:\n%s", exp, got)
+	}
+
+	c := testConfig()
+	c.Slots[3] = Slot{Lang: "<ja>", Region: "US", Interval: 60}
+	c.BrowserURLs[2] = "http://example.com/?a=1&b=2"
+	c.WanderingGhosts = false
+	if err := s.SetConfig(c); err != nil {
+		t.Fatal(err)
+	}
+
+	got := bootstrap(t, s)
+	for _, el := range []string{
+		"<lang3>&lt;ja&gt;</lang3>",
+		"<gameurl3>http://us.example.com:18666/cgi-bin/</gameurl3>",
+		"<interval3>60</interval3>",
+		"<browserurl2>http://example.com/?a=1&amp;b=2</browserurl2>",
+		"<enableWanderingGhost>0</enableWanderingGhost>",
+	} {
+		if !strings.Contains(got, el) {
+			t.Fatalf("expected document to contain %s got:\n%s", el, got)
+		}
+	}
+}
+
+func TestServer_SetConfig(t *testing.T) {
+	for name, mod := range map[string]func(c *Config){
+		"missing slot":         func(c *Config) { delete(c.Slots, 11) },
+		"extra slot":           func(c *Config) { c.Slots[9] = Slot{Region: "US", Interval: 1} },
+		"unknown region":       func(c *Config) { c.Slots[1] = Slot{Region: "AU", Interval: 1} },
+		"zero interval":        func(c *Config) { c.Slots[1] = Slot{Region: "US"} },
+		"browser URL ID":       func(c *Config) { c.BrowserURLs[4] = "http://example.com/" },
+		"game URL scheme":      func(c *Config) { c.GameURLs["US"] = "ftp://us.example.com/" },
+		"ghost interval":       func(c *Config) { c.GetGhostInterval = 0 },
+		"negative message num": func(c *Config) { c.BloodMessageNum = -1 },
+		"profile name":         func(c *Config) { c.Profiles = []Profile{{Percent: 10}} },
+		"profile duplicate":    func(c *Config) { c.Profiles = []Profile{{Name: "a"}, {Name: "a"}} },
+		"profile address":      func(c *Config) { c.Profiles = []Profile{{Name: "a", Addresses: []string{"nope"}}} },
+		"profile network":      func(c *Config) { c.Profiles = []Profile{{Name: "a", Networks: []string{"10.0.0.0"}}} },
+		"profile percent":      func(c *Config) { c.Profiles = []Profile{{Name: "a", Percent: 101}} },
+		"profile region": func(c *Config) {
+			c.Profiles = []Profile{{Name: "a", GameURLs: map[string]string{"AU": "http://au.example.com/"}}}
+		},
+		"profile interval": func(c *Config) { c.Profiles = []Profile{{Name: "a", Interval: -1}} },
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := &Server{l: zerolog.Nop()}
+			if err := s.SetConfig(testConfig()); err != nil {
+				t.Fatal(err)
+			}
+
+			c := testConfig()
+			mod(&c)
+			if err := s.SetConfig(c); err == nil {
+				t.Fatal("expected error")
+			}
+
+			// The previous configuration is kept.
+			if got := s.config().document(); got.Slots[0].GameURL != "http://us.example.com:18666/cgi-bin/" ||
+				len(got.Config.Slots) != len(Slots) || got.BloodMessageNum != 80 || got.GetGhostInterval != 20 {
+				t.Fatalf("expected previous config to be kept got: %+v", got.Config)
+			}
+		})
+	}
+}
+
+func TestServer_bootstrapHandler_profiles(t *testing.T) {
+	off := false
+	c := testConfig()
+	c.Profiles = []Profile{
+		{
+			Name:      "canary",
+			Addresses: []string{"192.0.2.10"},
+			Networks:  []string{"198.51.100.0/24"},
+			GameURLs: map[string]string{
+				"EU": "http://canary.example.com:18667/cgi-bin/",
+			},
+		},
+		{
+			Name:            "slow",
+			Percent:         100,
+			Interval:        300,
+			WanderingGhosts: &off,
+			BloodMessageNum: 20,
+		},
+	}
+
+	s := &Server{l: zerolog.Nop()}
+	if err := s.SetConfig(c); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ip := range []string{"192.0.2.10", "198.51.100.7"} {
+		got := bootstrapFrom(t, s, ip)
+		for _, el := range []string{
+			"<gameurl2>http://canary.example.com:18667/cgi-bin/</gameurl2>",
+			"<gameurl1>http://us.example.com:18666/cgi-bin/</gameurl1>",
+			"<interval2>120</interval2>",
+		} {
+			if !strings.Contains(got, el) {
+				t.Fatalf("expected %s document to contain %s got:\n%s", ip, el, got)
+			}
+		}
+	}
+
+	got := bootstrapFrom(t, s, "203.0.113.5")
+	for _, el := range []string{
+		"<gameurl2>http://eu.example.com:18667/cgi-bin/</gameurl2>",
+		"<interval2>300</interval2>",
+		"<enableWanderingGhost>0</enableWanderingGhost>",
+		"<getBloodMessageNum>20</getBloodMessageNum>",
+		"<getReplayListNum>80</getReplayListNum>",
+	} {
+		if !strings.Contains(got, el) {
+			t.Fatalf("expected document to contain %s got:\n%s", el, got)
+		}
+	}
+
+	// Clients no longer given a profile are given the default document.
+	c.Profiles = c.Profiles[:1]
+	if err := s.SetConfig(c); err != nil {
+		t.Fatal(err)
+	}
+	if got = bootstrapFrom(t, s, "203.0.113.5"); !strings.Contains(got, "<interval2>120</interval2>") {
+		t.Fatalf("expected default document got:\n%s", got)
+	}
+}
+
+func TestProfile_bucket(t *testing.T) {
+	p := Profile{Name: "half", Percent: 50}
+
+	var n int
+	for i := 0; i < 1000; i++ {
+		ip := net.IPv4(10, 0, byte(i>>8), byte(i))
+		m := p.match(ip)
+		if m != p.match(ip) {
+			t.Fatalf("expected %s to be given the same profile every time", ip)
+		}
+		if m != "" {
+			n++
+		}
+	}
+
+	if n < 400 || n > 600 {
+		t.Fatalf("expected about half of clients to match got %d of 1000", n)
+	}
+}
@@ -0,0 +1,198 @@
+package bootstrap
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// Slots are the language slots of the bootstrap document. The game client
+// picks the slot for its language and connects to the game server for it.
+var Slots = []int{1, 2, 3, 4, 5, 6, 7, 8, 11, 12}
+
+// browserURLs are the IDs of the browser URL elements of the bootstrap
+// document.
+var browserURLs = []int{1, 2, 3}
+
+// Config is the bootstrap document served to the game client.
+type Config struct {
+	// SS is the value of the ss element. The game client expects 0.
+	SS int `json:"ss"`
+
+	// Slots configures each language slot, keyed by slot number.
+	Slots map[int]Slot `json:"slots"`
+
+	// BrowserURLs are the browser URLs, keyed by number. Missing URLs are
+	// empty.
+	BrowserURLs map[int]string `json:"browser_urls"`
+
+	// WanderingGhosts enables wandering ghosts.
+	WanderingGhosts bool `json:"wandering_ghosts"`
+
+	// GetGhostInterval and SetGhostInterval are the intervals, in seconds, at
+	// which the client fetches and uploads wandering ghosts.
+	GetGhostInterval int `json:"get_ghost_interval"`
+	SetGhostInterval int `json:"set_ghost_interval"`
+
+	// BloodMessageNum and ReplayListNum are the number of blood messages and
+	// bloodstains the client requests for each block.
+	BloodMessageNum int `json:"blood_message_num"`
+	ReplayListNum   int `json:"replay_list_num"`
+
+	// Profiles are alternative bootstrap documents served to subsets of
+	// clients, in order of precedence.
+	Profiles []Profile `json:"profiles"`
+
+	// GameURLs maps region names to the URL of their game server. It is set
+	// from the region configuration, rather than configured directly.
+	GameURLs map[string]string `json:"-"`
+}
+
+// Slot is the configuration of a language slot.
+type Slot struct {
+	// Lang is the value of the langN element.
+	Lang string `json:"lang"`
+
+	// Region is the name of the region whose game server the slot uses. It is
+	// set from the region configuration, rather than configured directly.
+	Region string `json:"-"`
+
+	// Interval is the value of the intervalN element.
+	Interval int `json:"interval"`
+}
+
+// DefaultConfig returns the bootstrap document served unless configured
+// otherwise, without any regions.
+func DefaultConfig() Config {
+	c := Config{
+		Slots:            make(map[int]Slot, len(Slots)),
+		BrowserURLs:      make(map[int]string),
+		WanderingGhosts:  true,
+		GetGhostInterval: 20,
+		SetGhostInterval: 20,
+		BloodMessageNum:  80,
+		ReplayListNum:    80,
+	}
+
+	for _, n := range Slots {
+		c.Slots[n] = Slot{Interval: 120}
+	}
+
+	return c
+}
+
+// Validate returns an error if the configuration would not produce a usable
+// bootstrap document.
+func (c Config) Validate() error {
+	if c.SS < 0 {
+		return fmt.Errorf("ss must not be negative")
+	}
+
+	for _, n := range Slots {
+		sl, ok := c.Slots[n]
+		if !ok {
+			return fmt.Errorf("slot %d not configured", n)
+		}
+		if sl.Region == "" {
+			return fmt.Errorf("slot %d: not served by any region", n)
+		}
+		if _, ok = c.GameURLs[sl.Region]; !ok {
+			return fmt.Errorf("slot %d: unknown region %q", n, sl.Region)
+		}
+		if sl.Interval <= 0 {
+			return fmt.Errorf("slot %d: interval must be positive", n)
+		}
+	}
+	if len(c.Slots) != len(Slots) {
+		return fmt.Errorf("slots must be %v", Slots)
+	}
+
+	for n, u := range c.BrowserURLs {
+		if n < 1 || n > len(browserURLs) {
+			return fmt.Errorf("browser URL %d: must be 1 to %d", n, len(browserURLs))
+		}
+		if u == "" {
+			continue
+		}
+		if _, err := url.Parse(u); err != nil {
+			return fmt.Errorf("browser URL %d: %w", n, err)
+		}
+	}
+
+	for name, u := range c.GameURLs {
+		pu, err := url.Parse(u)
+		if err != nil {
+			return fmt.Errorf("region %q: %w", name, err)
+		}
+		if pu.Scheme != "http" || pu.Host == "" {
+			return fmt.Errorf("region %q: game URL %q must be an http URL", name, u)
+		}
+	}
+
+	for name, v := range map[string]int{
+		"get_ghost_interval": c.GetGhostInterval,
+		"set_ghost_interval": c.SetGhostInterval,
+		"blood_message_num":  c.BloodMessageNum,
+		"replay_list_num":    c.ReplayListNum,
+	} {
+		if v <= 0 {
+			return fmt.Errorf("%s must be positive", name)
+		}
+	}
+
+	names := make(map[string]bool, len(c.Profiles))
+	for i, p := range c.Profiles {
+		if err := p.validate(c); err != nil {
+			return fmt.Errorf("profile %d: %w", i, err)
+		}
+		if names[p.Name] {
+			return fmt.Errorf("profile %d: duplicate name %q", i, p.Name)
+		}
+		names[p.Name] = true
+	}
+
+	return nil
+}
+
+// document is the data rendered by the bootstrap template.
+type document struct {
+	Config
+
+	// Slots are the language slots, in slot order.
+	Slots []slotDocument
+
+	// BrowserURLs are the browser URLs, in order.
+	BrowserURLs []numbered
+}
+
+// slotDocument is a language slot rendered by the bootstrap template.
+type slotDocument struct {
+	N int
+	Slot
+	GameURL string
+}
+
+// numbered is a numbered element rendered by the bootstrap template.
+type numbered struct {
+	N     int
+	Value string
+}
+
+// document returns the data rendered by the bootstrap template for the
+// configuration.
+func (c Config) document() document {
+	d := document{Config: c}
+	for _, n := range Slots {
+		sl := c.Slots[n]
+		d.Slots = append(d.Slots, slotDocument{
+			N:       n,
+			Slot:    sl,
+			GameURL: c.GameURLs[sl.Region],
+		})
+	}
+
+	for _, n := range browserURLs {
+		d.BrowserURLs = append(d.BrowserURLs, numbered{N: n, Value: c.BrowserURLs[n]})
+	}
+
+	return d
+}
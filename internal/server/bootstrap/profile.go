@@ -0,0 +1,187 @@
+package bootstrap
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net"
+	"net/url"
+)
+
+// Profile is an alternative bootstrap document served to a subset of clients,
+// such as those testing a canary game server.
+//
+// A client is given the first profile it matches, by address, network or hash
+// bucket. Settings not given by the profile are taken from the configuration.
+type Profile struct {
+	// Name identifies the profile in logs.
+	Name string `json:"name"`
+
+	// Addresses are the client IP addresses given the profile.
+	Addresses []string `json:"addresses"`
+
+	// Networks are the client networks, in CIDR notation, given the profile.
+	Networks []string `json:"networks"`
+
+	// Percent is the percentage of clients given the profile, chosen by a hash
+	// of their IP address so each client is always given the same profile.
+	Percent int `json:"percent"`
+
+	// GameURLs replaces the game server URL of the given regions.
+	GameURLs map[string]string `json:"game_urls"`
+
+	// Interval replaces the interval of every language slot, if positive.
+	Interval int `json:"interval"`
+
+	// WanderingGhosts replaces the wandering ghost setting, if given.
+	WanderingGhosts *bool `json:"wandering_ghosts"`
+
+	// GetGhostInterval, SetGhostInterval, BloodMessageNum and ReplayListNum
+	// replace the corresponding settings, if positive.
+	GetGhostInterval int `json:"get_ghost_interval"`
+	SetGhostInterval int `json:"set_ghost_interval"`
+	BloodMessageNum  int `json:"blood_message_num"`
+	ReplayListNum    int `json:"replay_list_num"`
+}
+
+// validate returns an error if the profile is invalid for the given
+// configuration.
+func (p Profile) validate(c Config) error {
+	if p.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	for _, a := range p.Addresses {
+		if net.ParseIP(a) == nil {
+			return fmt.Errorf("invalid address %q", a)
+		}
+	}
+	for _, n := range p.Networks {
+		if _, _, err := net.ParseCIDR(n); err != nil {
+			return err
+		}
+	}
+	if p.Percent < 0 || p.Percent > 100 {
+		return fmt.Errorf("percent must be 0 to 100")
+	}
+
+	for region, u := range p.GameURLs {
+		if _, ok := c.GameURLs[region]; !ok {
+			return fmt.Errorf("unknown region %q", region)
+		}
+		pu, err := url.Parse(u)
+		if err != nil {
+			return fmt.Errorf("region %q: %w", region, err)
+		}
+		if pu.Scheme != "http" || pu.Host == "" {
+			return fmt.Errorf("region %q: game URL %q must be an http URL", region, u)
+		}
+	}
+
+	for name, v := range map[string]int{
+		"interval":           p.Interval,
+		"get_ghost_interval": p.GetGhostInterval,
+		"set_ghost_interval": p.SetGhostInterval,
+		"blood_message_num":  p.BloodMessageNum,
+		"replay_list_num":    p.ReplayListNum,
+	} {
+		if v < 0 {
+			return fmt.Errorf("%s must not be negative", name)
+		}
+	}
+
+	return nil
+}
+
+// match returns why the client with the given IP address is given the
+// profile, or an empty string if it is not.
+func (p Profile) match(ip net.IP) string {
+	for _, a := range p.Addresses {
+		if ip.Equal(net.ParseIP(a)) {
+			return "address " + a
+		}
+	}
+
+	for _, n := range p.Networks {
+		if _, ipn, err := net.ParseCIDR(n); err == nil && ipn.Contains(ip) {
+			return "network " + n
+		}
+	}
+
+	if p.Percent > 0 {
+		if b := bucket(p.Name, ip); b < p.Percent {
+			return fmt.Sprintf("bucket %d of %d%%", b, p.Percent)
+		}
+	}
+
+	return ""
+}
+
+// bucket returns the hash bucket, from 0 to 99, of the given IP address for
+// the named profile. The profile name is hashed with the address, so each
+// profile is given a different subset of clients.
+func bucket(profile string, ip net.IP) int {
+	h := fnv.New32a()
+	h.Write([]byte(profile))
+	h.Write([]byte{0})
+	h.Write([]byte(ip.String()))
+
+	return int(h.Sum32() % 100)
+}
+
+// apply returns the configuration with the settings of the profile.
+func (p Profile) apply(c Config) Config {
+	if len(p.GameURLs) > 0 {
+		urls := make(map[string]string, len(c.GameURLs))
+		for region, u := range c.GameURLs {
+			urls[region] = u
+		}
+		for region, u := range p.GameURLs {
+			urls[region] = u
+		}
+		c.GameURLs = urls
+	}
+
+	if p.Interval > 0 {
+		slots := make(map[int]Slot, len(c.Slots))
+		for n, sl := range c.Slots {
+			sl.Interval = p.Interval
+			slots[n] = sl
+		}
+		c.Slots = slots
+	}
+
+	if p.WanderingGhosts != nil {
+		c.WanderingGhosts = *p.WanderingGhosts
+	}
+	if p.GetGhostInterval > 0 {
+		c.GetGhostInterval = p.GetGhostInterval
+	}
+	if p.SetGhostInterval > 0 {
+		c.SetGhostInterval = p.SetGhostInterval
+	}
+	if p.BloodMessageNum > 0 {
+		c.BloodMessageNum = p.BloodMessageNum
+	}
+	if p.ReplayListNum > 0 {
+		c.ReplayListNum = p.ReplayListNum
+	}
+
+	return c
+}
+
+// forClient returns the configuration for the client with the given IP
+// address, along with the name of its profile and why it was chosen. The
+// name is empty if the client is not given a profile.
+func (c Config) forClient(ip net.IP) (cc Config, profile, reason string) {
+	if ip == nil {
+		return c, "", ""
+	}
+
+	for _, p := range c.Profiles {
+		if reason = p.match(ip); reason != "" {
+			return p.apply(c), p.Name, reason
+		}
+	}
+
+	return c, "", ""
+}
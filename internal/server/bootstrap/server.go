@@ -1,34 +1,40 @@
 package bootstrap
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"net/http"
+	"sync"
 
+	"github.com/danmrichards/dessego/internal/server/middleware"
 	"github.com/rs/zerolog"
 )
 
 // Server is a bootstrap server.
 type Server struct {
-	gsHost string
-	gs     map[string]string
-
 	nl net.Listener
 	r  *http.ServeMux
 	h  *http.Server
 
 	l zerolog.Logger
+
+	// mu guards the configuration, which may be replaced while serving.
+	mu sync.RWMutex
+	c  Config
 }
 
-// NewServer returns a bootstrap server configured to run on the given host and port.
+// NewServer returns a bootstrap server configured to run on the given port.
 //
-// The server will provide data for a gamestate to bootstrap and talk to the configured gamestate servers.
-func NewServer(port, gsHost string, gameServers map[string]string, l zerolog.Logger) (s *Server, err error) {
+// The server will provide the bootstrap document given by the configuration,
+// so the game client can talk to the configured gamestate servers.
+func NewServer(port string, c Config, l zerolog.Logger) (s *Server, err error) {
 	s = &Server{
-		gsHost: gsHost,
-		r:      http.NewServeMux(),
-		gs:     gameServers,
-		l:      l,
+		r: http.NewServeMux(),
+		l: l,
+	}
+	if err = s.SetConfig(c); err != nil {
+		return nil, err
 	}
 
 	addr := net.JoinHostPort("", port)
@@ -47,6 +53,35 @@ func NewServer(port, gsHost string, gameServers map[string]string, l zerolog.Log
 	return s, nil
 }
 
+// SetConfig validates and replaces the configuration of the bootstrap
+// document. The current configuration is kept if the new one is invalid.
+func (s *Server) SetConfig(c Config) error {
+	if err := c.Validate(); err != nil {
+		return fmt.Errorf("invalid bootstrap config: %w", err)
+	}
+	s.ApplyConfig(c)
+
+	return nil
+}
+
+// ApplyConfig replaces the configuration of the bootstrap document with one
+// which has already been validated, so configuration validated together can
+// be applied together.
+func (s *Server) ApplyConfig(c Config) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.c = c
+}
+
+// config returns the current configuration of the bootstrap document.
+func (s *Server) config() Config {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.c
+}
+
 // Serve accepts incoming bootstrap connections.
 func (s *Server) Serve() error {
 	return s.h.Serve(s.nl)
@@ -56,3 +91,14 @@ func (s *Server) Serve() error {
 func (s *Server) Close() error {
 	return s.h.Close()
 }
+
+// Shutdown gracefully shuts down the bootstrap server, waiting for in-flight
+// requests to complete until the context is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.h.Shutdown(ctx)
+}
+
+// log returns the logger for the request with the given context.
+func (s *Server) log(ctx context.Context) *zerolog.Logger {
+	return middleware.Logger(ctx, &s.l)
+}
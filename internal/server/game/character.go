@@ -46,7 +46,7 @@ func (s *Server) initCharacterHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		b, err := ioutil.ReadAll(r.Body)
 		if err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -54,17 +54,24 @@ func (s *Server) initCharacterHandler() http.HandlerFunc {
 
 		var icr initCharacterReq
 		if err = transport.DecodeRequest(s.rd, b, &icr); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
 		// Unique character ID.
 		ucID := fmt.Sprintf("%s%d", icr.CharacterID, icr.Index)
+		logCharacter(r.Context(), ucID)
+
+		if s.settings().bannedPlayer(ucID) {
+			s.log(r.Context()).Info().Msgf("refused banned character %q", ucID)
+			http.Error(w, "banned", http.StatusForbidden)
+			return
+		}
 
 		// Create the character, if it does not exist, in the DB.
-		if err = s.cs.EnsureCreate(ucID); err != nil {
-			s.l.Err(err).Msg("")
+		if err = s.cs.EnsureCreate(r.Context(), ucID); err != nil {
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -72,7 +79,7 @@ func (s *Server) initCharacterHandler() http.HandlerFunc {
 		var ip string
 		ip, _, err = net.SplitHostPort(r.RemoteAddr)
 		if err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -80,7 +87,7 @@ func (s *Server) initCharacterHandler() http.HandlerFunc {
 		// Track the player in game state.
 		s.gs.AddPlayer(ip, ucID)
 
-		s.l.Debug().Msgf("character %q logged in", ucID)
+		s.log(r.Context()).Debug().Msgf("character %q logged in", ucID)
 
 		// Response contains the character ID followed by a zero byte terminator.
 		data := new(bytes.Buffer)
@@ -90,7 +97,7 @@ func (s *Server) initCharacterHandler() http.HandlerFunc {
 		if err = transport.WriteResponse(
 			w, transport.ResponseGeneric, data.Bytes(),
 		); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -130,7 +137,7 @@ func (s *Server) worldTendencyHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		b, err := ioutil.ReadAll(r.Body)
 		if err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -138,21 +145,25 @@ func (s *Server) worldTendencyHandler() http.HandlerFunc {
 
 		var ctr worldTendencyReq
 		if err = transport.DecodeRequest(s.rd, b, &ctr); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		wts, err := s.cs.WorldTendency(ctr.MaxNum)
+		wts, err := s.cs.WorldTendency(
+			r.Context(),
+			s.region.scope(s.region.PartitionWorldTendency),
+			ctr.MaxNum,
+		)
 		if err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
 		avg := averageWorldTendency(wts)
 
-		s.l.Debug().Msgf("current average world tendency: %q", avg)
+		s.log(r.Context()).Debug().Msgf("current average world tendency: %q", avg)
 
 		data := new(bytes.Buffer)
 		binary.Write(data, binary.LittleEndian, avg.WB1)
@@ -173,7 +184,7 @@ func (s *Server) worldTendencyHandler() http.HandlerFunc {
 		if err = transport.WriteResponse(
 			w, transport.ResponseCharacterTendency, data.Bytes(),
 		); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -233,7 +244,7 @@ func (s *Server) addWorldTendencyHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		b, err := ioutil.ReadAll(r.Body)
 		if err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -241,11 +252,13 @@ func (s *Server) addWorldTendencyHandler() http.HandlerFunc {
 
 		var atr addWorldTendencyReq
 		if err = transport.DecodeRequest(s.rd, b, &atr); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
+		logCharacter(r.Context(), atr.CharacterID)
+
 		wt := character.WorldTendency{
 			Area1: atr.Area1,
 			WB1:   atr.WB1,
@@ -270,8 +283,8 @@ func (s *Server) addWorldTendencyHandler() http.HandlerFunc {
 			LR7:   atr.LR7,
 		}
 
-		if err = s.cs.SetTendency(atr.CharacterID, wt); err != nil {
-			s.l.Err(err).Msg("")
+		if err = s.cs.SetTendency(r.Context(), atr.CharacterID, s.region.Name, wt); err != nil {
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -279,7 +292,7 @@ func (s *Server) addWorldTendencyHandler() http.HandlerFunc {
 		if err = transport.WriteResponse(
 			w, transport.ResponseAddQWCData, []byte{0x01},
 		); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -319,7 +332,7 @@ func (s *Server) characterMPGradeHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		b, err := ioutil.ReadAll(r.Body)
 		if err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -327,19 +340,19 @@ func (s *Server) characterMPGradeHandler() http.HandlerFunc {
 
 		var mgr multiplayerGradeReq
 		if err = transport.DecodeRequest(s.rd, b, &mgr); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		stats, err := s.cs.Stats(mgr.CharacterID)
+		stats, err := s.cs.Stats(r.Context(), mgr.CharacterID)
 		if err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		s.l.Debug().Msgf("character %q stats %s", mgr.CharacterID, stats)
+		s.log(r.Context()).Debug().Msgf("character %q stats %s", mgr.CharacterID, stats)
 
 		data := new(bytes.Buffer)
 		for _, s := range stats.Vals() {
@@ -349,7 +362,7 @@ func (s *Server) characterMPGradeHandler() http.HandlerFunc {
 		if err = transport.WriteResponse(
 			w, transport.ResponseCharacterMPGrade, data.Bytes(),
 		); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -389,7 +402,7 @@ func (s *Server) characterBloodMsgGradeHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		b, err := ioutil.ReadAll(r.Body)
 		if err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -397,19 +410,19 @@ func (s *Server) characterBloodMsgGradeHandler() http.HandlerFunc {
 
 		var bmr bloodMsgGradeReq
 		if err = transport.DecodeRequest(s.rd, b, &bmr); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		mr, err := s.cs.MsgRating(bmr.CharacterID)
+		mr, err := s.cs.MsgRating(r.Context(), bmr.CharacterID)
 		if err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		s.l.Debug().Msgf("character %q blood msg rating %d", bmr.CharacterID, mr)
+		s.log(r.Context()).Debug().Msgf("character %q blood msg rating %d", bmr.CharacterID, mr)
 
 		data := new(bytes.Buffer)
 		binary.Write(data, binary.LittleEndian, int32(mr))
@@ -417,7 +430,7 @@ func (s *Server) characterBloodMsgGradeHandler() http.HandlerFunc {
 		if err = transport.WriteResponse(
 			w, transport.ResponseCharacterBloodMsgGrade, data.Bytes(),
 		); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
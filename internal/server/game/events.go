@@ -0,0 +1,16 @@
+package game
+
+import (
+	"github.com/danmrichards/dessego/internal/events"
+)
+
+// publish publishes game activity, recorded as taking place in the region of
+// the server. It does nothing if the server has no events publisher.
+func (s *Server) publish(e events.Event) {
+	if s.ev == nil {
+		return
+	}
+
+	e.Region = s.region.Name
+	s.ev.Publish(e)
+}
@@ -0,0 +1,60 @@
+package game
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/danmrichards/dessego/internal/events"
+)
+
+// recorder is an events publisher which records the published events.
+type recorder []events.Event
+
+func (r *recorder) Publish(e events.Event) { *r = append(*r, e) }
+
+func TestServer_publish(t *testing.T) {
+	var rec recorder
+
+	s := newMultiplayerServer()
+	s.region = Region{Name: "EU"}
+	s.ev = &rec
+
+	login(t, s, "10.0.0.1", "host")
+	login(t, s, "10.0.0.2", "phantom")
+
+	serve(t, s.initMultiplayHandler(), "10.0.0.1", "characterID=host0&ver=100")
+	serve(t, s.initMultiplayHandler(), "10.0.0.2", "characterID=phantom0&ver=100")
+
+	// Only grades which are recorded are published.
+	serve(t, s.updateOtherPlayerGradeHandler(), "10.0.0.1", "characterID=phantom&grade=0&ver=100")
+	serve(t, s.updateOtherPlayerGradeHandler(), "10.0.0.1", "characterID=phantom&grade=4&ver=100")
+	serve(t, s.finaliseMultiplayHandler(), "10.0.0.1", "characterID=host0&gradeB=1&ver=100")
+
+	exp := []events.Event{
+		{
+			Type:        events.Grade,
+			Region:      "EU",
+			CharacterID: "phantom0",
+			Data:        events.GradeData{Grade: "grade_s", GiverID: "host0"},
+		},
+		{
+			Type:        events.Grade,
+			Region:      "EU",
+			CharacterID: "host0",
+			Data:        events.GradeData{Grade: "grade_b"},
+		},
+	}
+	for i := range rec {
+		rec[i].Time = exp[0].Time
+	}
+	if !reflect.DeepEqual([]events.Event(rec), exp) {
+		t.Fatalf("expected events: %+v got: %+v", exp, rec)
+	}
+
+	// Servers without a publisher publish nothing.
+	s.ev = nil
+	s.publish(events.Event{Type: events.Grade})
+	if len(rec) != len(exp) {
+		t.Fatalf("expected %d events got: %d", len(exp), len(rec))
+	}
+}
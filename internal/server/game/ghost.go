@@ -8,8 +8,10 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/danmrichards/dessego/internal/events"
 	"github.com/danmrichards/dessego/internal/service/gamestate"
 	"github.com/danmrichards/dessego/internal/service/ghost"
+	"github.com/danmrichards/dessego/internal/service/quarantine"
 	"github.com/danmrichards/dessego/internal/transport"
 	dsbase64 "github.com/danmrichards/dessego/internal/transport/encoding/base64"
 )
@@ -54,7 +56,7 @@ func (s *Server) getGhostHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		b, err := ioutil.ReadAll(r.Body)
 		if err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -62,11 +64,14 @@ func (s *Server) getGhostHandler() http.HandlerFunc {
 
 		var ggr getGhostReq
 		if err = transport.DecodeRequest(s.rd, b, &ggr); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
+		logCharacter(r.Context(), ggr.CharacterID)
+		logBlock(r.Context(), int32(ggr.BlockID))
+
 		// Demon's Souls doesn't send signed integers for block IDs for some
 		// reason. Coerce it.
 		blockID := int32(ggr.BlockID)
@@ -75,7 +80,7 @@ func (s *Server) getGhostHandler() http.HandlerFunc {
 		s.gh.ClearBefore(time.Now().Add(-maxGhostAge))
 
 		gs := s.gh.Get(ggr.CharacterID, blockID, ggr.MaxGhosts)
-		s.l.Debug().Msgf(
+		s.log(r.Context()).Debug().Msgf(
 			"found %d ghosts for block: %q character: %q",
 			len(gs), gamestate.Block(blockID), ggr.CharacterID,
 		)
@@ -96,7 +101,7 @@ func (s *Server) getGhostHandler() http.HandlerFunc {
 		if err = transport.WriteResponse(
 			w, transport.ResponseGetWanderingGhost, res.Bytes(),
 		); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -124,6 +129,10 @@ func (s *Server) getGhostHandler() http.HandlerFunc {
 // responses:
 //   '200':
 //     description: successful operation
+//   '400':
+//     description: invalid ghost data
+//   '413':
+//     description: request body too large
 //   '500':
 //     description: unsuccessful operation
 func (s *Server) setGhostHandler() http.HandlerFunc {
@@ -140,7 +149,7 @@ func (s *Server) setGhostHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		b, err := ioutil.ReadAll(r.Body)
 		if err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -148,20 +157,30 @@ func (s *Server) setGhostHandler() http.HandlerFunc {
 
 		var sgr setGhostReq
 		if err = transport.DecodeRequest(s.rd, b, &sgr); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
+		logCharacter(r.Context(), sgr.CharacterID)
+		logBlock(r.Context(), int32(sgr.GhostBlockID))
+
 		// Demon's Souls doesn't send signed integers for block IDs for some
 		// reason. Coerce it.
 		blockID := int32(sgr.GhostBlockID)
 
+		if !s.validRecording(
+			r.Context(), quarantine.KindGhost, sgr.CharacterID, blockID, sgr.ReplayData,
+		) {
+			http.Error(w, "invalid ghost data", http.StatusBadRequest)
+			return
+		}
+
 		// Cannot use the std library decoding as Demon's Souls sends replay
 		// data with broken encoding.
 		rd, err := dsbase64.StdEncoding.DecodeString(sgr.ReplayData)
 		if err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -169,33 +188,46 @@ func (s *Server) setGhostHandler() http.HandlerFunc {
 		g := ghost.NewGhost(blockID, sgr.CharacterID, rd)
 
 		// Check if the character has spawned or changed area.
+		var ge *events.GhostData
 		prev, err := s.gh.Character(sgr.CharacterID)
 		if err != nil {
 			var cgerr ghost.CharacterGhostNotFoundError
 			if !errors.As(err, &cgerr) {
-				s.l.Err(err).Msg("")
+				s.log(r.Context()).Err(err).Msg("")
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
 			err = nil
 
-			s.l.Debug().Msgf(
+			s.log(r.Context()).Debug().Msgf(
 				"character: %q spawned into block: %q",
 				sgr.CharacterID, gamestate.Block(blockID),
 			)
+			ge = &events.GhostData{}
 		} else if prev.BlockID != blockID {
-			s.l.Debug().Msgf(
+			s.log(r.Context()).Debug().Msgf(
 				"character: %q moved from block: %q to block: %q",
 				sgr.CharacterID, gamestate.Block(prev.BlockID), gamestate.Block(blockID),
 			)
+			ge = &events.GhostData{
+				PreviousBlockID: prev.BlockID,
+				PreviousBlock:   gamestate.Block(prev.BlockID).String(),
+			}
 		}
 
-		s.gh.Set(sgr.CharacterID, g)
+		// Ghosts of denied characters appear to be set.
+		if !s.discard(r.Context(), "ghost", sgr.CharacterID) {
+			s.gh.Set(sgr.CharacterID, g)
+
+			if ge != nil {
+				s.publish(events.New(events.Ghost, sgr.CharacterID, blockID, *ge))
+			}
+		}
 
 		if err = transport.WriteResponse(
 			w, transport.ResponseGeneric, []byte{0x01},
 		); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -1,11 +1,14 @@
 package game
 
 import (
+	"context"
 	"time"
 
+	"github.com/danmrichards/dessego/internal/events"
 	"github.com/danmrichards/dessego/internal/service/character"
 	"github.com/danmrichards/dessego/internal/service/ghost"
 	"github.com/danmrichards/dessego/internal/service/msg"
+	"github.com/danmrichards/dessego/internal/service/quarantine"
 	"github.com/danmrichards/dessego/internal/service/replay"
 	"github.com/danmrichards/dessego/internal/service/sos"
 )
@@ -17,70 +20,85 @@ type Characters interface {
 	//
 	// If a character with the given ID and index already exists, no error will
 	// be returned.
-	EnsureCreate(id string) error
+	EnsureCreate(ctx context.Context, id string) error
 
-	// WorldTendency returns a maximum of n world tendency entries.
-	WorldTendency(n int) ([]character.WorldTendency, error)
+	// WorldTendency returns a maximum of n world tendency entries, set in the
+	// given region. Entries from every region are returned if region is empty.
+	WorldTendency(ctx context.Context, region string, n int) ([]character.WorldTendency, error)
 
-	// SetTendency sets the world tendency for the character with the given ID.
-	SetTendency(id string, wt character.WorldTendency) error
+	// SetTendency sets the world tendency for the character with the given
+	// ID, in the given region.
+	SetTendency(ctx context.Context, id, region string, wt character.WorldTendency) error
 
 	// Stats returns a map of statistics for the given character.
-	Stats(id string) (*character.Stats, error)
+	Stats(ctx context.Context, id string) (*character.Stats, error)
 
 	// MsgRating returns the message rating for the character with the given ID.
-	MsgRating(id string) (int, error)
+	MsgRating(ctx context.Context, id string) (int, error)
 
 	// UpdateMsgRating updates the message rating for the character with the
 	// given ID.
-	UpdateMsgRating(id string) error
+	UpdateMsgRating(ctx context.Context, id string) error
 
 	// InitMultiplayer initialises a multiplayer session for the given
 	// characterID.
-	InitMultiplayer(id string) error
+	InitMultiplayer(ctx context.Context, id string) error
 
-	// UpdatePlayerGrade updates the given player with the given grade.
-	UpdatePlayerGrade(id string, grade character.MultiplayerGrade) error
+	// AddGrade records a multiplayer grade given to a character in the
+	// receiver's current session.
+	//
+	// Only one grade may be given by each character to another per session.
+	AddGrade(ctx context.Context, g *character.Grade) error
 }
 
 // State is the interface that wraps methods that types must implement to be
 // used as a service for managing gamestate state.
+//
+// State, like Ghosts and SOS, is held in memory, so its methods never block
+// and take no context.
 type State interface {
-	// Motd returns the messages of the day.
-	Motd() []string
+	// PlayerCount returns the number of connected players.
+	PlayerCount() int
 
 	// AddPlayer adds a new player to the current gamestate state.
 	AddPlayer(ip, id string)
 
 	// Player returns the ID of a player with the given IP address
 	Player(ip string) (string, error)
+
+	// PlayerCharacter returns the ID of the connected character belonging to
+	// the player with the given NPID.
+	PlayerCharacter(npid string) (string, error)
 }
 
 // Messages is the interface that wraps methods that types must implement to be
 // used as a service for managing messages.
 type Messages interface {
 	// Character returns n messages for the given character and within the given
-	// block ID.
-	Character(characterID string, blockID int32, n int) ([]msg.BloodMsg, error)
+	// block ID, visible in the given region. Messages from every region are
+	// returned if region is empty.
+	Character(ctx context.Context, region, characterID string, blockID int32, n int) ([]msg.BloodMsg, error)
 
 	// NonCharacter returns n messages for anyone other than the given character
-	// and within the given block ID.
-	NonCharacter(characterID string, blockID int32, n int) ([]msg.BloodMsg, error)
+	// and within the given block ID, visible in the given region. Messages
+	// from every region are returned if region is empty.
+	NonCharacter(ctx context.Context, region, characterID string, blockID int32, n int) ([]msg.BloodMsg, error)
 
 	// Legacy returns n legacy messages within the given block ID.
-	Legacy(blockID int32, n int) ([]msg.BloodMsg, error)
+	Legacy(ctx context.Context, blockID int32, n int) ([]msg.BloodMsg, error)
 
-	// Add adds a new message.
-	Add(bm msg.BloodMsg) error
+	// Add adds a new message, recording the region it was written in.
+	Add(ctx context.Context, bm msg.BloodMsg) error
 
 	// Delete deletes the message with the given ID.
-	Delete(id int) error
+	Delete(ctx context.Context, id int) error
 
 	// Get returns the message with the given ID.
-	Get(id int) (*msg.BloodMsg, error)
+	Get(ctx context.Context, id int) (*msg.BloodMsg, error)
 
-	// UpdateRating updates the rating for the message with the given ID.
-	UpdateRating(id int) error
+	// Rate records a rating for the message with the given ID by the
+	// character with the given rater ID.
+	Rate(ctx context.Context, id int, raterID string) error
 }
 
 // Ghosts is the interface that wraps methods that types must implement to be
@@ -103,14 +121,16 @@ type Ghosts interface {
 // Replays is the interface that wraps methods that types must implement to be
 // used as a service for managing replays.
 type Replays interface {
-	// List returns n replays for the given block ID and legacy type.
-	List(blockID int32, n int, legacy replay.LegacyType) ([]replay.Replay, error)
+	// List returns n replays for the given block ID and legacy type, visible
+	// in the given region. Replays from every region are returned if region is
+	// empty.
+	List(ctx context.Context, region string, blockID int32, n int, legacy replay.LegacyType) ([]replay.Replay, error)
 
 	// Get returns a given replay.
-	Get(id uint32) (*replay.Replay, error)
+	Get(ctx context.Context, id uint32) (*replay.Replay, error)
 
-	// Add adds a new replay.
-	Add(r *replay.Replay) error
+	// Add adds a new replay, recording the region it was recorded in.
+	Add(ctx context.Context, r *replay.Replay) error
 }
 
 // SOS is the interface that wraps methods that types must implement to be used
@@ -136,3 +156,17 @@ type SOS interface {
 	// Monk returns true if a monk was able to be summoned to the given room.
 	Monk(room string) bool
 }
+
+// Quarantine is the interface that wraps methods that types must implement to
+// be used as a service for storing rejected uploads.
+type Quarantine interface {
+	// Add stores a rejected upload.
+	Add(ctx context.Context, u quarantine.Upload) error
+}
+
+// Events is the interface that wraps methods that types must implement to be
+// used to publish live game activity.
+type Events interface {
+	// Publish publishes the event to its subscribers.
+	Publish(e events.Event)
+}
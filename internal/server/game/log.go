@@ -0,0 +1,79 @@
+package game
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/danmrichards/dessego/internal/server/middleware"
+	"github.com/danmrichards/dessego/internal/service/gamestate"
+	"github.com/danmrichards/dessego/internal/transport"
+	"github.com/rs/zerolog"
+)
+
+// log returns the logger for the request with the given context.
+func (s *Server) log(ctx context.Context) *zerolog.Logger {
+	return middleware.Logger(ctx, &s.l)
+}
+
+// logCharacter adds the ID of the character making the request to the request
+// logger.
+func logCharacter(ctx context.Context, characterID string) {
+	zerolog.Ctx(ctx).UpdateContext(func(c zerolog.Context) zerolog.Context {
+		return c.Str("character_id", characterID)
+	})
+}
+
+// logBlock adds the block of the request to the request logger.
+func logBlock(ctx context.Context, blockID int32) {
+	zerolog.Ctx(ctx).UpdateContext(func(c zerolog.Context) zerolog.Context {
+		return c.Int32("block_id", blockID).Str("block", gamestate.Block(blockID).String())
+	})
+}
+
+// logResponseType is a HTTP middleware that adds the type of the game response
+// to the request logger.
+func logResponseType(h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tw := &typeWriter{ResponseWriter: w}
+		h.ServeHTTP(tw, r)
+
+		// Errors are written as plain text, rather than game responses.
+		if tw.code != 0 && tw.code != http.StatusOK {
+			return
+		}
+		if rt, ok := transport.ParseResponseType(tw.head); ok {
+			zerolog.Ctx(r.Context()).UpdateContext(func(c zerolog.Context) zerolog.Context {
+				return c.Stringer("response_type", rt)
+			})
+		}
+	}
+}
+
+// typeWriter is a http.ResponseWriter which keeps the status code and the
+// start of the response, which holds its type.
+type typeWriter struct {
+	http.ResponseWriter
+
+	code int
+	head []byte
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (t *typeWriter) WriteHeader(code int) {
+	if t.code == 0 {
+		t.code = code
+	}
+	t.ResponseWriter.WriteHeader(code)
+}
+
+// Write implements io.Writer.
+func (t *typeWriter) Write(p []byte) (int, error) {
+	if n := 4 - len(t.head); n > 0 {
+		if n > len(p) {
+			n = len(p)
+		}
+		t.head = append(t.head, p[:n]...)
+	}
+
+	return t.ResponseWriter.Write(p)
+}
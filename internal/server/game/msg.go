@@ -3,9 +3,12 @@ package game
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"io/ioutil"
+	"net"
 	"net/http"
 
+	"github.com/danmrichards/dessego/internal/events"
 	"github.com/danmrichards/dessego/internal/service/gamestate"
 	"github.com/danmrichards/dessego/internal/service/msg"
 	"github.com/danmrichards/dessego/internal/transport"
@@ -49,7 +52,7 @@ func (s *Server) getBloodMsgHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		b, err := ioutil.ReadAll(r.Body)
 		if err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -57,11 +60,14 @@ func (s *Server) getBloodMsgHandler() http.HandlerFunc {
 
 		var bmr getBloodMsgReq
 		if err = transport.DecodeRequest(s.rd, b, &bmr); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
+		logCharacter(r.Context(), bmr.CharacterID)
+		logBlock(r.Context(), int32(bmr.BlockID))
+
 		// Demon's Souls doesn't send signed integers for block IDs for some
 		// reason. Coerce it.
 		blockID := int32(bmr.BlockID)
@@ -69,9 +75,10 @@ func (s *Server) getBloodMsgHandler() http.HandlerFunc {
 		msgs := make([]msg.BloodMsg, 0, 10)
 
 		// Character own messages.
-		cm, err := s.ms.Character(bmr.CharacterID, blockID, bmr.ReplayNum)
+		region := s.region.scope(s.region.PartitionMessages)
+		cm, err := s.ms.Character(r.Context(), region, bmr.CharacterID, blockID, bmr.ReplayNum)
 		if err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -79,9 +86,9 @@ func (s *Server) getBloodMsgHandler() http.HandlerFunc {
 		msgs = append(msgs, cm...)
 
 		// Other character messages.
-		ocm, err := s.ms.NonCharacter(bmr.CharacterID, blockID, remaining)
+		ocm, err := s.ms.NonCharacter(r.Context(), region, bmr.CharacterID, blockID, remaining)
 		if err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -90,16 +97,16 @@ func (s *Server) getBloodMsgHandler() http.HandlerFunc {
 
 		// Legacy messages.
 		if len(msgs) < legacyMessageLimit && remaining > 0 {
-			lm, err := s.ms.Legacy(blockID, remaining)
+			lm, err := s.ms.Legacy(r.Context(), blockID, remaining)
 			if err != nil {
-				s.l.Err(err).Msg("")
+				s.log(r.Context()).Err(err).Msg("")
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
 			msgs = append(msgs, lm...)
 		}
 
-		s.l.Debug().Msgf(
+		s.log(r.Context()).Debug().Msgf(
 			"found %d blood messages for block: %q character: %q",
 			len(msgs), gamestate.Block(blockID), bmr.CharacterID,
 		)
@@ -115,7 +122,7 @@ func (s *Server) getBloodMsgHandler() http.HandlerFunc {
 		if err = transport.WriteResponse(
 			w, transport.ResponseListData, res.Bytes(),
 		); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -165,7 +172,7 @@ func (s *Server) addBloodMsgHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		b, err := ioutil.ReadAll(r.Body)
 		if err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -173,11 +180,14 @@ func (s *Server) addBloodMsgHandler() http.HandlerFunc {
 
 		var amr addBloodMsgReq
 		if err = transport.DecodeRequest(s.rd, b, &amr); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
+		logCharacter(r.Context(), amr.CharacterID)
+		logBlock(r.Context(), int32(amr.BlockID))
+
 		bm := msg.BloodMsg{
 			CharacterID:  amr.CharacterID,
 			BlockID:      int32(amr.BlockID),
@@ -190,20 +200,29 @@ func (s *Server) addBloodMsgHandler() http.HandlerFunc {
 			MsgID:        amr.MsgID,
 			MainMsgID:    amr.MainMsgID,
 			AddMsgCateID: amr.AddMsgCateID,
+			Region:       s.region.Name,
 		}
 
-		if err = s.ms.Add(bm); err != nil {
-			s.l.Err(err).Msg("")
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+		// Messages from denied characters appear to be added.
+		if !s.discard(r.Context(), "blood message", bm.CharacterID) {
+			if err = s.ms.Add(r.Context(), bm); err != nil {
+				s.log(r.Context()).Err(err).Msg("")
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			s.log(r.Context()).Debug().Msgf("added new message %q", bm)
 
-		s.l.Debug().Msgf("added new message %q", bm)
+			s.publish(events.New(events.Message, bm.CharacterID, bm.BlockID, events.MessageData{
+				Text:     bm.Render(gamestate.English),
+				Position: events.Position{X: bm.PosX, Y: bm.PosY, Z: bm.PosZ},
+			}))
+		}
 
 		if err = transport.WriteResponse(
 			w, transport.ResponseAddData, []byte{0x01},
 		); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -243,7 +262,7 @@ func (s *Server) deleteBloodMsgHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		b, err := ioutil.ReadAll(r.Body)
 		if err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -251,23 +270,23 @@ func (s *Server) deleteBloodMsgHandler() http.HandlerFunc {
 
 		var dmr deleteBloodMsgReq
 		if err = transport.DecodeRequest(s.rd, b, &dmr); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		if err = s.ms.Delete(dmr.BloodMsgID); err != nil {
-			s.l.Err(err).Msg("")
+		if err = s.ms.Delete(r.Context(), dmr.BloodMsgID); err != nil {
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		s.l.Debug().Msgf("deleted message %d", dmr.BloodMsgID)
+		s.log(r.Context()).Debug().Msgf("deleted message %d", dmr.BloodMsgID)
 
 		if err = transport.WriteResponse(
 			w, transport.ResponseDeleteBloodMsg, []byte{0x01},
 		); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -307,7 +326,7 @@ func (s *Server) updateBloodMsgGradeHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		b, err := ioutil.ReadAll(r.Body)
 		if err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -315,40 +334,78 @@ func (s *Server) updateBloodMsgGradeHandler() http.HandlerFunc {
 
 		var ugr updateBloodMsgGradeReq
 		if err = transport.DecodeRequest(s.rd, b, &ugr); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		bm, err := s.ms.Get(ugr.BloodMsgID)
+		bm, err := s.ms.Get(r.Context(), ugr.BloodMsgID)
 		if err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		if err = s.ms.UpdateRating(ugr.BloodMsgID); err != nil {
-			s.l.Err(err).Msg("")
+		// Load the current player, who is rating the message.
+		var ip string
+		ip, _, err = net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			s.log(r.Context()).Err(err).Msg("")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		p, err := s.gs.Player(ip)
+		if err != nil {
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		s.l.Debug().Msgf("recommended message %q", bm)
 
-		if err = s.cs.UpdateMsgRating(bm.CharacterID); err != nil {
-			s.l.Err(err).Msg("")
+		switch err = s.ms.Rate(r.Context(), ugr.BloodMsgID, p); {
+		case ratingRejected(err):
+			// Acknowledge the rating so the game carries on as normal, but
+			// don't count it towards the author's message rating.
+			s.log(r.Context()).Info().Msgf("rejected rating of message %q: %s", bm, err)
+		case err != nil:
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
+		default:
+			s.log(r.Context()).Debug().Msgf("character %q recommended message %q", p, bm)
+
+			if err = s.cs.UpdateMsgRating(r.Context(), bm.CharacterID); err != nil {
+				s.log(r.Context()).Err(err).Msg("")
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			s.log(r.Context()).Debug().Msgf(
+				"updated message rating for character: %q", bm.CharacterID,
+			)
+
+			s.publish(events.New(events.Rating, p, bm.BlockID, events.RatingData{
+				MessageID: bm.ID,
+				AuthorID:  bm.CharacterID,
+			}))
 		}
-		s.l.Debug().Msgf(
-			"updated message rating for character: %q", bm.CharacterID,
-		)
 
 		if err = transport.WriteResponse(
 			w, transport.ResponseUpdateMsgGrade, []byte{0x01},
 		); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 	}
 }
+
+// ratingRejected returns true if err indicates that a message rating was
+// rejected by the messages service.
+func ratingRejected(err error) bool {
+	var (
+		serr msg.SelfRatingError
+		derr msg.DuplicateRatingError
+		lerr msg.RatingLimitError
+	)
+
+	return errors.As(err, &serr) || errors.As(err, &derr) || errors.As(err, &lerr)
+}
@@ -1,11 +1,14 @@
 package game
 
 import (
+	"errors"
 	"io/ioutil"
 	"net"
 	"net/http"
 
+	"github.com/danmrichards/dessego/internal/events"
 	"github.com/danmrichards/dessego/internal/service/character"
+	"github.com/danmrichards/dessego/internal/service/gamestate"
 	"github.com/danmrichards/dessego/internal/transport"
 )
 
@@ -39,6 +42,8 @@ func (f finaliseMultiplayReq) Grade() character.MultiplayerGrade {
 
 // swagger:model updateOtherPlayerGradeReq
 type updateOtherPlayerGradeReq struct {
+	// CharacterID is the NPID of the graded player, without the index of
+	// their character.
 	CharacterID string `form:"characterID"`
 	Grade       int    `form:"grade"`
 	Version     int    `form:"ver"`
@@ -52,8 +57,18 @@ func (u updateOtherPlayerGradeReq) PlayerGrade() character.MultiplayerGrade {
 	return character.GradeUnknown
 }
 
-func (u updateOtherPlayerGradeReq) Character() string {
-	return u.CharacterID + "0"
+// rejectedGrade returns true if err is the reason a grade was rejected,
+// rather than a failure to record it.
+func rejectedGrade(err error) bool {
+	var (
+		derr character.DuplicateGradeError
+		serr character.SelfGradeError
+		ierr character.InvalidGradeError
+	)
+
+	return errors.As(err, &derr) ||
+		errors.As(err, &serr) ||
+		errors.As(err, &ierr)
 }
 
 // swagger:operation POST /cgi-bin/outOfBlock.spd outOfBlockHandler
@@ -89,7 +104,7 @@ func (s *Server) outOfBlockHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		b, err := ioutil.ReadAll(r.Body)
 		if err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -97,17 +112,19 @@ func (s *Server) outOfBlockHandler() http.HandlerFunc {
 
 		var obr outOfBlockReq
 		if err = transport.DecodeRequest(s.rd, b, &obr); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
+		logCharacter(r.Context(), obr.CharacterID)
+
 		s.sos.Delete(obr.CharacterID)
 
 		if err = transport.WriteResponse(
 			w, transport.ResponseMultiplayerOp, []byte{0x01},
 		); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -147,7 +164,7 @@ func (s *Server) initMultiplayHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		b, err := ioutil.ReadAll(r.Body)
 		if err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -155,24 +172,26 @@ func (s *Server) initMultiplayHandler() http.HandlerFunc {
 
 		var imr initMultiplayHandler
 		if err = transport.DecodeRequest(s.rd, b, &imr); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		if err = s.cs.InitMultiplayer(imr.CharacterID); err != nil {
-			s.l.Err(err).Msg("")
+		logCharacter(r.Context(), imr.CharacterID)
+
+		if err = s.cs.InitMultiplayer(r.Context(), imr.CharacterID); err != nil {
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		s.l.Info().Msgf(
+		s.log(r.Context()).Info().Msgf(
 			"character %q started a multiplayer session", imr.CharacterID,
 		)
 
 		if err = transport.WriteResponse(
 			w, transport.ResponseMultiplayerOp, []byte{0x01},
 		); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -206,7 +225,7 @@ func (s *Server) finaliseMultiplayHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		b, err := ioutil.ReadAll(r.Body)
 		if err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -214,27 +233,50 @@ func (s *Server) finaliseMultiplayHandler() http.HandlerFunc {
 
 		var fmr finaliseMultiplayReq
 		if err = transport.DecodeRequest(s.rd, b, &fmr); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
+		logCharacter(r.Context(), fmr.CharacterID)
+
 		grade := fmr.Grade()
-		if err = s.cs.UpdatePlayerGrade(fmr.CharacterID, grade); err != nil {
-			s.l.Err(err).Msg("")
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+		if grade == character.GradeUnknown {
+			// The game reports no grade if the session ended early.
+			s.log(r.Context()).Info().Msgf(
+				"character %q finished a multiplayer session without a grade",
+				fmr.CharacterID,
+			)
+		} else {
+			err = s.cs.AddGrade(r.Context(), &character.Grade{
+				ReceiverID: fmr.CharacterID,
+				Grade:      grade,
+			})
+			switch {
+			case rejectedGrade(err):
+				// Already graded by another player in this session.
+				s.log(r.Context()).Debug().Err(err).Msg("reported grade not recorded")
+			case err != nil:
+				s.log(r.Context()).Err(err).Msg("")
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			default:
+				s.log(r.Context()).Info().Msgf(
+					"character %q finished a multiplayer session and got grade %q",
+					fmr.CharacterID,
+					grade,
+				)
+
+				s.publish(events.New(events.Grade, fmr.CharacterID, 0, events.GradeData{
+					Grade: string(grade),
+				}))
+			}
 		}
-		s.l.Info().Msgf(
-			"character %q finished a multiplayer session and got grade %q",
-			fmr.CharacterID,
-			grade,
-		)
 
 		if err = transport.WriteResponse(
 			w, transport.ResponseFinaliseMultiplayer, []byte{0x01},
 		); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -268,7 +310,7 @@ func (s *Server) updateOtherPlayerGradeHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		b, err := ioutil.ReadAll(r.Body)
 		if err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -276,15 +318,7 @@ func (s *Server) updateOtherPlayerGradeHandler() http.HandlerFunc {
 
 		var upr updateOtherPlayerGradeReq
 		if err = transport.DecodeRequest(s.rd, b, &upr); err != nil {
-			s.l.Err(err).Msg("")
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		grade := upr.PlayerGrade()
-		char := upr.Character()
-		if err = s.cs.UpdatePlayerGrade(char, grade); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -293,25 +327,62 @@ func (s *Server) updateOtherPlayerGradeHandler() http.HandlerFunc {
 		var ip string
 		ip, _, err = net.SplitHostPort(r.RemoteAddr)
 		if err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 		p, err := s.gs.Player(ip)
 		if err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		s.l.Info().Msgf(
-			"character %q gave character %q grade %q", p, char, grade,
-		)
+		grade := upr.PlayerGrade()
+
+		// The game identifies the graded player by NPID only, so find the
+		// character they are playing.
+		char, err := s.gs.PlayerCharacter(upr.CharacterID)
+		var cerr gamestate.CharacterNotFoundError
+		switch {
+		case errors.As(err, &cerr):
+			s.log(r.Context()).Warn().Err(err).Msgf(
+				"grade %q from character %q not recorded", grade, p,
+			)
+		case err != nil:
+			s.log(r.Context()).Err(err).Msg("")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		default:
+			err = s.cs.AddGrade(r.Context(), &character.Grade{
+				GiverID:    p,
+				ReceiverID: char,
+				Grade:      grade,
+			})
+			switch {
+			case rejectedGrade(err):
+				// The game still expects success, so the grade is dropped.
+				s.log(r.Context()).Warn().Err(err).Msg("grade not recorded")
+			case err != nil:
+				s.log(r.Context()).Err(err).Msg("")
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			default:
+				s.log(r.Context()).Info().Msgf(
+					"character %q gave character %q grade %q", p, char, grade,
+				)
+
+				s.publish(events.New(events.Grade, char, 0, events.GradeData{
+					Grade:   string(grade),
+					GiverID: p,
+				}))
+			}
+		}
 
 		if err = transport.WriteResponse(
 			w, transport.ResponseUpdateOtherPlayerGrade, []byte{0x01},
 		); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
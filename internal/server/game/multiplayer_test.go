@@ -0,0 +1,85 @@
+package game
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/danmrichards/dessego/internal/service/character"
+	"github.com/danmrichards/dessego/internal/service/gamestate"
+	"github.com/rs/zerolog"
+)
+
+// plainText is a request decrypter for unencrypted requests.
+type plainText struct{}
+
+func (plainText) Decrypt(b []byte) []byte { return b }
+
+func newMultiplayerServer() *Server {
+	return &Server{
+		l:  zerolog.Nop(),
+		rd: plainText{},
+		cs: character.NewMemoryService(),
+		gs: gamestate.NewMemory(),
+	}
+}
+
+// login logs the character in from the given IP address.
+func login(t *testing.T, s *Server, ip, npid string) {
+	t.Helper()
+
+	serve(t, s.initCharacterHandler(), ip, "characterID="+npid+"&index=0&ver=100")
+}
+
+// serve serves a request with the given body from the given IP address.
+func serve(t *testing.T, h http.HandlerFunc, ip, body string) {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	r.RemoteAddr = ip + ":3000"
+	w := httptest.NewRecorder()
+
+	h(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status: %d got: %d %s", http.StatusOK, w.Code, w.Body)
+	}
+}
+
+func TestServer_multiplayerGrades(t *testing.T) {
+	s := newMultiplayerServer()
+
+	login(t, s, "10.0.0.1", "host")
+	login(t, s, "10.0.0.2", "phantom")
+
+	serve(t, s.initMultiplayHandler(), "10.0.0.1", "characterID=host0&ver=100")
+	serve(t, s.initMultiplayHandler(), "10.0.0.2", "characterID=phantom0&ver=100")
+
+	// The host grades the phantom twice, but only the first grade counts.
+	serve(t, s.updateOtherPlayerGradeHandler(), "10.0.0.1", "characterID=phantom&grade=0&ver=100")
+	serve(t, s.updateOtherPlayerGradeHandler(), "10.0.0.1", "characterID=phantom&grade=4&ver=100")
+
+	// Players cannot grade themselves, nor players who are not connected.
+	serve(t, s.updateOtherPlayerGradeHandler(), "10.0.0.2", "characterID=phantom&grade=0&ver=100")
+	serve(t, s.updateOtherPlayerGradeHandler(), "10.0.0.2", "characterID=nobody&grade=0&ver=100")
+
+	// The phantom's own report is ignored, as the host graded them, whereas
+	// the host's own report is recorded.
+	serve(t, s.finaliseMultiplayHandler(), "10.0.0.2", "characterID=phantom0&gradeD=1&ver=100")
+	serve(t, s.finaliseMultiplayHandler(), "10.0.0.1", "characterID=host0&gradeB=1&ver=100")
+
+	for id, exp := range map[string]character.Stats{
+		"phantom0": {GradeS: 1, Sessions: 1},
+		"host0":    {GradeB: 1, Sessions: 1},
+	} {
+		st, err := s.cs.Stats(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *st != exp {
+			t.Fatalf("expected %q stats: %s got: %s", id, exp, st)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package game
+
+// Region is the region served by a game server, and whether its players see
+// the data written in other regions.
+type Region struct {
+	// Name is recorded with the messages, bloodstains and world tendencies
+	// written by players in the region.
+	Name string
+
+	// PartitionMessages, PartitionReplays and PartitionWorldTendency restrict
+	// players to the messages, bloodstains and world tendencies written in the
+	// region, rather than those written in every region.
+	PartitionMessages      bool
+	PartitionReplays       bool
+	PartitionWorldTendency bool
+}
+
+// scope returns the region to read data from, which is empty to read the data
+// of every region unless the data is partitioned.
+func (r Region) scope(partitioned bool) string {
+	if !partitioned {
+		return ""
+	}
+
+	return r.Name
+}
@@ -2,13 +2,14 @@ package game
 
 import (
 	"bytes"
-	"database/sql"
 	"encoding/binary"
 	"errors"
 	"io/ioutil"
 	"net/http"
 
+	"github.com/danmrichards/dessego/internal/events"
 	"github.com/danmrichards/dessego/internal/service/gamestate"
+	"github.com/danmrichards/dessego/internal/service/quarantine"
 	"github.com/danmrichards/dessego/internal/service/replay"
 	"github.com/danmrichards/dessego/internal/transport"
 )
@@ -83,7 +84,7 @@ func (s *Server) replayListHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		b, err := ioutil.ReadAll(r.Body)
 		if err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -91,11 +92,13 @@ func (s *Server) replayListHandler() http.HandlerFunc {
 
 		var rlr replayListReq
 		if err = transport.DecodeRequest(s.rd, b, &rlr); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
+		logBlock(r.Context(), int32(rlr.BlockID))
+
 		// Demon's Souls doesn't send signed integers for block IDs for some
 		// reason. Coerce it.
 		blockID := int32(rlr.BlockID)
@@ -103,9 +106,10 @@ func (s *Server) replayListHandler() http.HandlerFunc {
 		rs := make([]replay.Replay, 0, 10)
 
 		// Non-legacy replays.
-		nlr, err := s.rs.List(blockID, rlr.ReplayNum, replay.NonLegacy)
+		region := s.region.scope(s.region.PartitionReplays)
+		nlr, err := s.rs.List(r.Context(), region, blockID, rlr.ReplayNum, replay.NonLegacy)
 		if err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -113,15 +117,15 @@ func (s *Server) replayListHandler() http.HandlerFunc {
 		rs = append(rs, nlr...)
 
 		// Legacy replays.
-		lr, err := s.rs.List(blockID, remaining, replay.Legacy)
+		lr, err := s.rs.List(r.Context(), region, blockID, remaining, replay.Legacy)
 		if err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 		rs = append(rs, lr...)
 
-		s.l.Debug().Msgf(
+		s.log(r.Context()).Debug().Msgf(
 			"found %d replays for block: %q", len(rs), gamestate.Block(blockID),
 		)
 
@@ -136,7 +140,7 @@ func (s *Server) replayListHandler() http.HandlerFunc {
 		if err = transport.WriteResponse(
 			w, transport.ResponseListData, res.Bytes(),
 		); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -176,7 +180,7 @@ func (s *Server) getReplayDataHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		b, err := ioutil.ReadAll(r.Body)
 		if err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -184,34 +188,39 @@ func (s *Server) getReplayDataHandler() http.HandlerFunc {
 
 		var rdr replayDataReq
 		if err = transport.DecodeRequest(s.rd, b, &rdr); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		rp, err := s.rs.Get(rdr.GhostID)
+		var data []byte
+		rp, err := s.rs.Get(r.Context(), rdr.GhostID)
 		switch {
-		case errors.Is(err, sql.ErrNoRows):
-			s.l.Warn().Msgf("no replay exists with ID: %d", rdr.GhostID)
+		case errors.Is(err, replay.ErrNotFound):
+			// The replay may have been pruned or replaced since the game
+			// listed it, so respond with an empty recording, which the game
+			// does not play.
+			s.log(r.Context()).Warn().Msgf("no replay exists with ID: %d", rdr.GhostID)
 		case err != nil:
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
+		default:
+			s.log(r.Context()).Debug().Msgf("loading replay %s", rp)
+			data = rp.Data
 		}
 
-		s.l.Debug().Msgf("loading replay %s", rp)
-
 		// Response is in the format ghost ID, replay length followed by replay
 		// data.
 		res := new(bytes.Buffer)
 		binary.Write(res, binary.LittleEndian, rdr.GhostID)
-		binary.Write(res, binary.LittleEndian, uint32(len(rp.Data)))
-		res.Write(rp.Data)
+		binary.Write(res, binary.LittleEndian, uint32(len(data)))
+		res.Write(data)
 
 		if err = transport.WriteResponse(
 			w, transport.ResponseReplayData, res.Bytes(),
 		); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -239,13 +248,17 @@ func (s *Server) getReplayDataHandler() http.HandlerFunc {
 // responses:
 //   '200':
 //     description: successful operation
+//   '400':
+//     description: invalid replay data
+//   '413':
+//     description: request body too large
 //   '500':
 //     description: unsuccessful operation
 func (s *Server) addReplayDataHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		b, err := ioutil.ReadAll(r.Body)
 		if err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -253,24 +266,42 @@ func (s *Server) addReplayDataHandler() http.HandlerFunc {
 
 		var adr addReplayDataReq
 		if err = transport.DecodeRequest(s.rd, b, &adr); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
+		logCharacter(r.Context(), adr.CharacterID)
+		logBlock(r.Context(), int32(adr.BlockID))
+
 		nr := adr.ToReplay()
-		if err = s.rs.Add(nr); err != nil {
-			s.l.Err(err).Msg("")
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		nr.Region = s.region.Name
+		if !s.validRecording(
+			r.Context(), quarantine.KindReplay, nr.CharacterID, nr.BlockID, adr.Data,
+		) {
+			http.Error(w, "invalid replay data", http.StatusBadRequest)
 			return
 		}
 
-		s.l.Debug().Msgf("added new replay replay %s", nr)
+		// Bloodstains from denied characters appear to be added.
+		if !s.discard(r.Context(), "bloodstain", nr.CharacterID) {
+			if err = s.rs.Add(r.Context(), nr); err != nil {
+				s.log(r.Context()).Err(err).Msg("")
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			s.log(r.Context()).Debug().Msgf("added new replay replay %s", nr)
+
+			s.publish(events.New(events.Bloodstain, nr.CharacterID, nr.BlockID, events.BloodstainData{
+				Position: events.Position{X: nr.PosX, Y: nr.PosY, Z: nr.PosZ},
+			}))
+		}
 
 		if err = transport.WriteResponse(
 			w, transport.ResponseAddData, []byte{0x01},
 		); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
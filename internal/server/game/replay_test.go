@@ -0,0 +1,61 @@
+package game
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/danmrichards/dessego/internal/service/replay"
+	"github.com/danmrichards/dessego/internal/transport"
+	"github.com/rs/zerolog"
+)
+
+func TestServer_getReplayDataHandler(t *testing.T) {
+	rs := replay.NewMemoryService(zerolog.Nop())
+	if err := rs.Add(context.Background(), &replay.Replay{
+		CharacterID: "player0",
+		BlockID:     40070,
+		Data:        []byte("data"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{l: zerolog.Nop(), rd: plainText{}, rs: rs}
+
+	tests := []struct {
+		name string
+		id   string
+		exp  []byte
+	}{
+		{
+			name: "found",
+			id:   "1",
+			exp:  []byte{0x01, 0x00, 0x00, 0x00, 0x04, 0x00, 0x00, 0x00, 'd', 'a', 't', 'a'},
+		},
+		{
+			// Replays may be pruned after the game has listed them.
+			name: "not found",
+			id:   "2",
+			exp:  []byte{0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(
+				http.MethodPost, "/", strings.NewReader("ghostID="+tc.id+"&ver=100"),
+			)
+			w := httptest.NewRecorder()
+			s.getReplayDataHandler()(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status: %d got: %d %s", http.StatusOK, w.Code, w.Body)
+			}
+			if exp := response(t, transport.ResponseReplayData, tc.exp); w.Body.String() != exp {
+				t.Fatalf("expected response: %q got: %q", exp, w.Body)
+			}
+		})
+	}
+}
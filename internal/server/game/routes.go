@@ -2,12 +2,29 @@ package game
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/danmrichards/dessego/internal/server/middleware"
 )
 
 const routePrefix = "/cgi-bin"
 
+const (
+	// maxBodySize is the maximum size in bytes of a request body.
+	maxBodySize = 16 << 10
+
+	// maxUploadSize is the maximum size in bytes of a request body uploading
+	// a replay or ghost recording.
+	maxUploadSize = 256 << 10
+
+	// defaultTimeout is the deadline for handling a request.
+	defaultTimeout = 5 * time.Second
+
+	// uploadTimeout is the deadline for handling a request uploading a replay
+	// or ghost recording, which are validated and may be quarantined.
+	uploadTimeout = 10 * time.Second
+)
+
 func (s *Server) routes() {
 	s.r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		s.l.Warn().
@@ -24,116 +41,50 @@ func (s *Server) routes() {
 	})
 
 	// System routes.
-	s.r.HandleFunc(
-		routePrefix+"/login.spd",
-		middleware.LogRequest(s.l, s.loginHandler()),
-	)
-	s.r.HandleFunc(
-		routePrefix+"/getTimeMessage.spd",
-		middleware.LogRequest(s.l, s.timeMsgHandler()),
-	)
+	s.handle("/login.spd", maxBodySize, defaultTimeout, s.loginHandler())
+	s.handle("/getTimeMessage.spd", maxBodySize, defaultTimeout, s.timeMsgHandler())
 
 	// Character/Player routes.
-	s.r.HandleFunc(
-		routePrefix+"/initializeCharacter.spd",
-		middleware.LogRequest(s.l, s.initCharacterHandler()),
-	)
-	s.r.HandleFunc(
-		routePrefix+"/getQWCData.spd",
-		middleware.LogRequest(s.l, s.worldTendencyHandler()),
-	)
-	s.r.HandleFunc(
-		routePrefix+"/addQWCData.spd",
-		middleware.LogRequest(s.l, s.addWorldTendencyHandler()),
-	)
-	s.r.HandleFunc(
-		routePrefix+"/getMultiPlayGrade.spd",
-		middleware.LogRequest(s.l, s.characterMPGradeHandler()),
-	)
-	s.r.HandleFunc(
-		routePrefix+"/getBloodMessageGrade.spd",
-		middleware.LogRequest(s.l, s.characterBloodMsgGradeHandler()),
-	)
+	s.handle("/initializeCharacter.spd", maxBodySize, defaultTimeout, s.initCharacterHandler())
+	s.handle("/getQWCData.spd", maxBodySize, defaultTimeout, s.worldTendencyHandler())
+	s.handle("/addQWCData.spd", maxBodySize, defaultTimeout, s.addWorldTendencyHandler())
+	s.handle("/getMultiPlayGrade.spd", maxBodySize, defaultTimeout, s.characterMPGradeHandler())
+	s.handle("/getBloodMessageGrade.spd", maxBodySize, defaultTimeout, s.characterBloodMsgGradeHandler())
 
 	// Ghost routes.
-	s.r.HandleFunc(
-		routePrefix+"/getWanderingGhost.spd",
-		middleware.LogRequest(s.l, s.getGhostHandler()),
-	)
-	s.r.HandleFunc(
-		routePrefix+"/setWanderingGhost.spd",
-		middleware.LogRequest(s.l, s.setGhostHandler()),
-	)
+	s.handle("/getWanderingGhost.spd", maxBodySize, defaultTimeout, s.getGhostHandler())
+	s.handle("/setWanderingGhost.spd", maxUploadSize, uploadTimeout, s.setGhostHandler())
 
 	// Blood message routes.
-	s.r.HandleFunc(
-		routePrefix+"/getBloodMessage.spd",
-		middleware.LogRequest(s.l, s.getBloodMsgHandler()),
-	)
-	s.r.HandleFunc(
-		routePrefix+"/addBloodMessage.spd",
-		middleware.LogRequest(s.l, s.addBloodMsgHandler()),
-	)
-	s.r.HandleFunc(
-		routePrefix+"/deleteBloodMessage.spd",
-		middleware.LogRequest(s.l, s.deleteBloodMsgHandler()),
-	)
-	s.r.HandleFunc(
-		routePrefix+"/updateBloodMessageGrade.spd",
-		middleware.LogRequest(s.l, s.updateBloodMsgGradeHandler()),
-	)
+	s.handle("/getBloodMessage.spd", maxBodySize, defaultTimeout, s.getBloodMsgHandler())
+	s.handle("/addBloodMessage.spd", maxBodySize, defaultTimeout, s.addBloodMsgHandler())
+	s.handle("/deleteBloodMessage.spd", maxBodySize, defaultTimeout, s.deleteBloodMsgHandler())
+	s.handle("/updateBloodMessageGrade.spd", maxBodySize, defaultTimeout, s.updateBloodMsgGradeHandler())
 
 	// Replay routes.
-	s.r.HandleFunc(
-		routePrefix+"/getReplayList.spd",
-		middleware.LogRequest(s.l, s.replayListHandler()),
-	)
-	s.r.HandleFunc(
-		routePrefix+"/getReplayData.spd",
-		middleware.LogRequest(s.l, s.getReplayDataHandler()),
-	)
-	s.r.HandleFunc(
-		routePrefix+"/addReplayData.spd",
-		middleware.LogRequest(s.l, s.addReplayDataHandler()),
-	)
+	s.handle("/getReplayList.spd", maxBodySize, defaultTimeout, s.replayListHandler())
+	s.handle("/getReplayData.spd", maxBodySize, defaultTimeout, s.getReplayDataHandler())
+	s.handle("/addReplayData.spd", maxUploadSize, uploadTimeout, s.addReplayDataHandler())
 
 	// SOS routes.
-	s.r.HandleFunc(
-		routePrefix+"/getSosData.spd",
-		middleware.LogRequest(s.l, s.getSosDataHandler()),
-	)
-	s.r.HandleFunc(
-		routePrefix+"/addSosData.spd",
-		middleware.LogRequest(s.l, s.addSosDataHandler()),
-	)
-	s.r.HandleFunc(
-		routePrefix+"/checkSosData.spd",
-		middleware.LogRequest(s.l, s.checkSosDataHandler()),
-	)
-	s.r.HandleFunc(
-		routePrefix+"/summonOtherCharacter.spd",
-		middleware.LogRequest(s.l, s.summonCharacterHandler()),
-	)
-	s.r.HandleFunc(
-		routePrefix+"/summonBlackGhost.spd",
-		middleware.LogRequest(s.l, s.summonBlackGhostHandler()),
-	)
+	s.handle("/getSosData.spd", maxBodySize, defaultTimeout, s.getSosDataHandler())
+	s.handle("/addSosData.spd", maxBodySize, defaultTimeout, s.addSosDataHandler())
+	s.handle("/checkSosData.spd", maxBodySize, defaultTimeout, s.checkSosDataHandler())
+	s.handle("/summonOtherCharacter.spd", maxBodySize, defaultTimeout, s.summonCharacterHandler())
+	s.handle("/summonBlackGhost.spd", maxBodySize, defaultTimeout, s.summonBlackGhostHandler())
 
 	// Multiplayer routes.
+	s.handle("/outOfBlock.spd", maxBodySize, defaultTimeout, s.outOfBlockHandler())
+	s.handle("/initializeMultiPlay.spd", maxBodySize, defaultTimeout, s.initMultiplayHandler())
+	s.handle("/finalizeMultiPlay.spd", maxBodySize, defaultTimeout, s.finaliseMultiplayHandler())
+	s.handle("/updateOtherPlayerGrade.spd", maxBodySize, defaultTimeout, s.updateOtherPlayerGradeHandler())
+}
+
+// handle registers the handler for the given path, limiting the request body to
+// n bytes and the handler to the given deadline.
+func (s *Server) handle(path string, n int64, d time.Duration, h http.Handler) {
 	s.r.HandleFunc(
-		routePrefix+"/outOfBlock.spd",
-		middleware.LogRequest(s.l, s.outOfBlockHandler()),
-	)
-	s.r.HandleFunc(
-		routePrefix+"/initializeMultiPlay.spd",
-		middleware.LogRequest(s.l, s.initMultiplayHandler()),
-	)
-	s.r.HandleFunc(
-		routePrefix+"/finalizeMultiPlay.spd",
-		middleware.LogRequest(s.l, s.finaliseMultiplayHandler()),
-	)
-	s.r.HandleFunc(
-		routePrefix+"/updateOtherPlayerGrade.spd",
-		middleware.LogRequest(s.l, s.updateOtherPlayerGradeHandler()),
+		routePrefix+path,
+		middleware.LogRequest(s.l, middleware.LimitBody(s.l, n, middleware.Deadline(s.l, d, logResponseType(h)))),
 	)
 }
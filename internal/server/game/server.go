@@ -1,9 +1,11 @@
 package game
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"net/http"
+	"sync"
 
 	"github.com/rs/zerolog"
 
@@ -20,17 +22,39 @@ type Server struct {
 
 	rd transport.RequestDecrypter
 
+	region Region
+
 	cs  Characters
 	gs  State
 	ms  Messages
 	gh  Ghosts
 	rs  Replays
 	sos SOS
+	q   Quarantine
+	ev  Events
+
+	// mu guards the settings, which may be replaced while serving.
+	mu sync.RWMutex
+	st Settings
 }
 
-// NewServer returns a gamestate server configured to run on the given host and port.
+// NewServer returns a gamestate server configured to listen on the given
+// address.
+//
+// Messages, replays and world tendencies written by players are recorded as
+// written in the given region.
+//
+// The settings may be replaced while serving with SetSettings.
+//
+// Rejected replay and ghost uploads are stored in q, which may be nil to
+// discard them.
+//
+// Game activity, such as messages written and players summoned, is published
+// to ev, which may be nil to not publish it.
 func NewServer(
-	port string,
+	addr string,
+	region Region,
+	st Settings,
 	rd transport.RequestDecrypter,
 	cs Characters,
 	gs State,
@@ -38,21 +62,28 @@ func NewServer(
 	gh Ghosts,
 	rs Replays,
 	sos SOS,
+	q Quarantine,
+	ev Events,
 	l zerolog.Logger,
 ) (s *Server, err error) {
 	s = &Server{
-		r:   http.NewServeMux(),
-		rd:  rd,
-		cs:  cs,
-		gs:  gs,
-		ms:  ms,
-		gh:  gh,
-		l:   l,
-		rs:  rs,
-		sos: sos,
+		r:      http.NewServeMux(),
+		rd:     rd,
+		region: region,
+		cs:     cs,
+		gs:     gs,
+		ms:     ms,
+		gh:     gh,
+		l:      l.With().Str("region", region.Name).Logger(),
+		rs:     rs,
+		sos:    sos,
+		q:      q,
+		ev:     ev,
+	}
+	if err = s.SetSettings(st); err != nil {
+		return nil, err
 	}
 
-	addr := net.JoinHostPort("", port)
 	s.nl, err = net.Listen("tcp4", addr)
 	if err != nil {
 		return nil, fmt.Errorf("net listen: %w", err)
@@ -77,3 +108,9 @@ func (s *Server) Serve() error {
 func (s *Server) Close() error {
 	return s.h.Close()
 }
+
+// Shutdown gracefully shuts down the gamestate server, waiting for in-flight
+// requests to complete until the context is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.h.Shutdown(ctx)
+}
@@ -0,0 +1,216 @@
+package game
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danmrichards/dessego/internal/service/gamestate"
+)
+
+// playersPlaceholder is replaced in the messages of the day with the number of
+// players online.
+const playersPlaceholder = "{players}"
+
+// Settings are the settings of a game server which may be changed while it is
+// running.
+type Settings struct {
+	// Motd are the messages of the day shown to players on login. Any
+	// occurrence of {players} is replaced with the number of players online.
+	Motd []string `json:"motd"`
+
+	// Bans are the players refused login.
+	Bans Bans `json:"bans"`
+
+	// Maintenance are the windows during which the server is shown to be
+	// undergoing maintenance, refusing login.
+	Maintenance []Maintenance `json:"maintenance"`
+
+	// Deny are the NPIDs or character IDs whose blood messages, bloodstains,
+	// ghosts and SOS signs are silently discarded.
+	Deny []string `json:"deny"`
+}
+
+// Bans are the players refused login.
+type Bans struct {
+	// Players are banned NPIDs or character IDs. As the game does not identify
+	// the player on login, they are refused by the address they last
+	// connected from, and refused when initialising a character.
+	Players []string `json:"players"`
+
+	// Addresses are banned IP addresses.
+	Addresses []string `json:"addresses"`
+
+	// Networks are banned networks, in CIDR notation.
+	Networks []string `json:"networks"`
+}
+
+// Maintenance is a maintenance window.
+type Maintenance struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// DefaultSettings returns the settings used unless configured otherwise.
+func DefaultSettings() Settings {
+	return Settings{
+		Motd: []string{
+			"Welcome to DeSSE Go\n" +
+				"A server emulator for Demon's Souls implemented in Go\n" +
+				"Source code:\n" +
+				"https://github.com/danmrichards/dessego\n",
+			"Current players online: " + playersPlaceholder,
+		},
+	}
+}
+
+// Validate returns an error if the settings are invalid.
+func (st Settings) Validate() error {
+	if len(st.Motd) == 0 || len(st.Motd) > 255 {
+		return errors.New("motd must have 1 to 255 messages")
+	}
+
+	for _, p := range st.Bans.Players {
+		if p == "" {
+			return errors.New("banned player must not be empty")
+		}
+	}
+	for _, a := range st.Bans.Addresses {
+		if net.ParseIP(a) == nil {
+			return fmt.Errorf("invalid banned address %q", a)
+		}
+	}
+	for _, n := range st.Bans.Networks {
+		if _, _, err := net.ParseCIDR(n); err != nil {
+			return fmt.Errorf("banned network: %w", err)
+		}
+	}
+
+	for i, m := range st.Maintenance {
+		if !m.End.After(m.Start) {
+			return fmt.Errorf("maintenance %d: end must be after start", i)
+		}
+	}
+
+	for _, d := range st.Deny {
+		if d == "" {
+			return errors.New("denied character must not be empty")
+		}
+	}
+
+	return nil
+}
+
+// motd returns the messages of the day, given the number of players online.
+func (st Settings) motd(players int) []string {
+	motd := make([]string, len(st.Motd))
+	for i, m := range st.Motd {
+		m = strings.ReplaceAll(m, playersPlaceholder, strconv.Itoa(players))
+
+		// The game expects Windows line endings.
+		m = strings.ReplaceAll(m, "\r\n", "\n")
+		motd[i] = strings.ReplaceAll(m, "\n", "\r\n")
+	}
+
+	return motd
+}
+
+// maintenance returns true if t is within a maintenance window.
+func (st Settings) maintenance(t time.Time) bool {
+	for _, m := range st.Maintenance {
+		if !t.Before(m.Start) && t.Before(m.End) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// bannedAddr returns true if the IP address is banned.
+func (st Settings) bannedAddr(ip string) bool {
+	pip := net.ParseIP(ip)
+	if pip == nil {
+		return false
+	}
+
+	for _, a := range st.Bans.Addresses {
+		if pip.Equal(net.ParseIP(a)) {
+			return true
+		}
+	}
+	for _, n := range st.Bans.Networks {
+		if _, ipn, err := net.ParseCIDR(n); err == nil && ipn.Contains(pip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// bannedPlayer returns true if the character with the given ID is banned.
+func (st Settings) bannedPlayer(characterID string) bool {
+	return listed(st.Bans.Players, characterID)
+}
+
+// denied returns true if uploads by the character with the given ID are
+// discarded.
+func (st Settings) denied(characterID string) bool {
+	return listed(st.Deny, characterID)
+}
+
+// listed returns true if the character with the given ID, or the player it
+// belongs to, is in the list of NPIDs and character IDs.
+func listed(ids []string, characterID string) bool {
+	for _, id := range ids {
+		if id == characterID || gamestate.IsCharacterOf(characterID, id) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SetSettings validates and replaces the settings of the server. The current
+// settings are kept if the new ones are invalid.
+func (s *Server) SetSettings(st Settings) error {
+	if err := st.Validate(); err != nil {
+		return fmt.Errorf("invalid game settings: %w", err)
+	}
+	s.ApplySettings(st)
+
+	return nil
+}
+
+// ApplySettings replaces the settings of the server with settings which have
+// already been validated, so settings validated together can be applied
+// together.
+func (s *Server) ApplySettings(st Settings) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.st = st
+}
+
+// settings returns the current settings of the server.
+func (s *Server) settings() Settings {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.st
+}
+
+// discard returns true if an upload of the given kind by the character with
+// the given ID is to be discarded, as they are on the deny-list.
+func (s *Server) discard(ctx context.Context, kind, characterID string) bool {
+	if !s.settings().denied(characterID) {
+		return false
+	}
+
+	s.log(ctx).Info().Msgf("discarded %s from denied character %q", kind, characterID)
+
+	return true
+}
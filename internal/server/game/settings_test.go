@@ -0,0 +1,39 @@
+package game
+
+import (
+	"context"
+	"testing"
+
+	"github.com/danmrichards/dessego/internal/service/msg"
+	"github.com/rs/zerolog"
+)
+
+func TestServer_discard(t *testing.T) {
+	s := newMultiplayerServer()
+	s.ms = msg.NewMemoryService(zerolog.Nop())
+	if err := s.SetSettings(Settings{
+		Motd: []string{"hi"},
+		Deny: []string{"troll", "spammer1"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every character of a denied NPID is denied, whereas a denied character
+	// ID only denies that character.
+	for _, id := range []string{"troll0", "troll1", "spammer1", "spammer0", "trolley0"} {
+		serve(t, s.addBloodMsgHandler(), "10.0.0.1", "characterID="+id+"&blockID=40070&messageID=1&mainMsgID=2&addMsgCateID=3&ver=100")
+	}
+
+	bms, err := s.ms.NonCharacter(context.Background(), "", "", 40070, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]bool, len(bms))
+	for _, bm := range bms {
+		got[bm.CharacterID] = true
+	}
+	if len(got) != 2 || !got["spammer0"] || !got["trolley0"] {
+		t.Fatalf("expected messages from spammer0 and trolley0 got: %v", got)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/danmrichards/dessego/internal/events"
 	"github.com/danmrichards/dessego/internal/service/sos"
 	"github.com/danmrichards/dessego/internal/transport"
 )
@@ -104,7 +105,7 @@ func (s *Server) getSosDataHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		b, err := ioutil.ReadAll(r.Body)
 		if err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -112,11 +113,13 @@ func (s *Server) getSosDataHandler() http.HandlerFunc {
 
 		var gsr getSosDataReq
 		if err = transport.DecodeRequest(s.rd, b, &gsr); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
+		logBlock(r.Context(), int32(gsr.BlockID))
+
 		// Demon's Souls doesn't send signed integers for block IDs for some
 		// reason. Coerce it.
 		blockID := int32(gsr.BlockID)
@@ -156,7 +159,7 @@ func (s *Server) getSosDataHandler() http.HandlerFunc {
 		if err = transport.WriteResponse(
 			w, transport.ResponseGetSOSData, res.Bytes(),
 		); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -190,7 +193,7 @@ func (s *Server) addSosDataHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		b, err := ioutil.ReadAll(r.Body)
 		if err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -198,17 +201,31 @@ func (s *Server) addSosDataHandler() http.HandlerFunc {
 
 		var asr addSosDataReq
 		if err = transport.DecodeRequest(s.rd, b, &asr); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
+		logCharacter(r.Context(), asr.CharacterID)
+		logBlock(r.Context(), int32(asr.BlockID))
+
 		ns := asr.ToSos()
 
+		// SOS signs of denied characters appear to be added.
+		if s.discard(r.Context(), "SOS", ns.CharacterID) {
+			if err = transport.WriteResponse(
+				w, transport.ResponseAddSummonSOSData, []byte{0x01},
+			); err != nil {
+				s.log(r.Context()).Err(err).Msg("")
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
 		// Populate the SOS with the stats for the player.
-		stats, err := s.cs.Stats(asr.CharacterID)
+		stats, err := s.cs.Stats(r.Context(), asr.CharacterID)
 		if err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -219,10 +236,17 @@ func (s *Server) addSosDataHandler() http.HandlerFunc {
 
 		s.sos.Add(ns)
 
+		s.publish(events.New(events.SOS, ns.CharacterID, ns.BlockID, events.SOSData{
+			ID:       ns.ID,
+			Level:    ns.PlayerLevel,
+			Black:    ns.Black != 0,
+			Position: events.Position{X: ns.PosX, Y: ns.PosY, Z: ns.PosZ},
+		}))
+
 		if err = transport.WriteResponse(
 			w, transport.ResponseAddSummonSOSData, []byte{0x01},
 		); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -263,7 +287,7 @@ func (s *Server) checkSosDataHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		b, err := ioutil.ReadAll(r.Body)
 		if err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -271,11 +295,13 @@ func (s *Server) checkSosDataHandler() http.HandlerFunc {
 
 		var csr checkSosDataReq
 		if err = transport.DecodeRequest(s.rd, b, &csr); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
+		logCharacter(r.Context(), csr.CharacterID)
+
 		data := new(bytes.Buffer)
 		if rid := s.sos.Check(csr.CharacterID); rid != "" {
 			data.WriteString(rid)
@@ -286,7 +312,7 @@ func (s *Server) checkSosDataHandler() http.HandlerFunc {
 		if err = transport.WriteResponse(
 			w, transport.ResponseCheckSOSData, data.Bytes(),
 		); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -328,7 +354,7 @@ func (s *Server) summonCharacterHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		b, err := ioutil.ReadAll(r.Body)
 		if err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -336,7 +362,7 @@ func (s *Server) summonCharacterHandler() http.HandlerFunc {
 
 		var sor summonOtherCharacterReq
 		if err = transport.DecodeRequest(s.rd, b, &sor); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -345,22 +371,26 @@ func (s *Server) summonCharacterHandler() http.HandlerFunc {
 		var ip string
 		ip, _, err = net.SplitHostPort(r.RemoteAddr)
 		if err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 		p, err := s.gs.Player(ip)
 		if err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		s.l.Info().Msgf("player %q attempting to summon id %d", p, sor.GhostID)
+		s.log(r.Context()).Info().Msgf("player %q attempting to summon id %d", p, sor.GhostID)
 
 		data := []byte{0x01}
-		if !s.sos.Summon(sor.GhostID, sor.NPRoomID) {
+		if s.sos.Summon(sor.GhostID, sor.NPRoomID) {
+			s.publish(events.New(events.Summon, p, 0, events.SummonData{
+				SOSID: sor.GhostID,
+			}))
+		} else {
 			data = []byte{0x00}
-			s.l.Info().Msgf(
+			s.log(r.Context()).Info().Msgf(
 				"player %q failed to summon non-existing id %d", p, sor.GhostID,
 			)
 		}
@@ -368,7 +398,7 @@ func (s *Server) summonCharacterHandler() http.HandlerFunc {
 		if err = transport.WriteResponse(
 			w, transport.ResponseAddSummonSOSData, data,
 		); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -408,7 +438,7 @@ func (s *Server) summonBlackGhostHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		b, err := ioutil.ReadAll(r.Body)
 		if err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -416,7 +446,7 @@ func (s *Server) summonBlackGhostHandler() http.HandlerFunc {
 
 		var sbr summonBlackGhostReq
 		if err = transport.DecodeRequest(s.rd, b, &sbr); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -425,28 +455,30 @@ func (s *Server) summonBlackGhostHandler() http.HandlerFunc {
 		var ip string
 		ip, _, err = net.SplitHostPort(r.RemoteAddr)
 		if err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 		p, err := s.gs.Player(ip)
 		if err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		s.l.Info().Msgf("player %q attempting to summon monk", p)
+		s.log(r.Context()).Info().Msgf("player %q attempting to summon monk", p)
 
 		data := []byte{0x01}
-		if !s.sos.Monk(sbr.NPRoomID) {
+		if s.sos.Monk(sbr.NPRoomID) {
+			s.publish(events.New(events.Summon, p, 0, events.SummonData{Monk: true}))
+		} else {
 			data = []byte{0x00}
-			s.l.Info().Msgf("player %q failed to summon monk", p)
+			s.log(r.Context()).Info().Msgf("player %q failed to summon monk", p)
 		}
 
 		if err = transport.WriteResponse(
 			w, transport.ResponseSummonMonk, data,
 		); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -2,7 +2,9 @@ package game
 
 import (
 	"bytes"
+	"net"
 	"net/http"
+	"time"
 
 	"github.com/danmrichards/dessego/internal/transport"
 )
@@ -34,18 +36,26 @@ func (s *Server) loginHandler() http.HandlerFunc {
 		// 0x05 - undergoing maintenance
 		// 0x06 - online service has been terminated
 		// 0x07 - network play cannot be used with this version
+		st := s.settings()
 		data := new(bytes.Buffer)
-		data.Write([]byte{0x01, 0x02})
-
-		for _, m := range s.gs.Motd() {
-			data.WriteString(m)
-			data.WriteByte(0x00)
+		switch {
+		case st.maintenance(time.Now()):
+			data.WriteByte(0x05)
+		case s.banned(r, st):
+			data.WriteByte(0x03)
+		default:
+			motd := st.motd(s.gs.PlayerCount())
+			data.Write([]byte{0x01, byte(len(motd))})
+			for _, m := range motd {
+				data.WriteString(m)
+				data.WriteByte(0x00)
+			}
 		}
 
 		if err := transport.WriteResponse(
 			w, transport.ResponseLogin, data.Bytes(),
 		); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -76,13 +86,37 @@ func (s *Server) timeMsgHandler() http.HandlerFunc {
 		// 0x01 - undergoing maintenance
 		// 0x02 - online service has been terminated
 		data := []byte{0x00, 0x00, 0x00}
+		if s.settings().maintenance(time.Now()) {
+			data[0] = 0x01
+		}
 
 		if err := transport.WriteResponse(
 			w, transport.ResponseTimeMsg, data,
 		); err != nil {
-			s.l.Err(err).Msg("")
+			s.log(r.Context()).Err(err).Msg("")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 	}
 }
+
+// banned returns true if the client making the request is banned, by address
+// or by the player who last connected from it.
+func (s *Server) banned(r *http.Request, st Settings) bool {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	if st.bannedAddr(ip) {
+		s.log(r.Context()).Info().Msgf("refused login from banned address %q", ip)
+		return true
+	}
+
+	id, err := s.gs.Player(ip)
+	if err == nil && st.bannedPlayer(id) {
+		s.log(r.Context()).Info().Msgf("refused login from banned character %q", id)
+		return true
+	}
+
+	return false
+}
@@ -1,3 +1,116 @@
 package game
 
-// TODO: TestServer_loginHandler
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/danmrichards/dessego/internal/transport"
+)
+
+// response returns the response body written for the given type and data.
+func response(t *testing.T, rt transport.ResponseType, data []byte) string {
+	t.Helper()
+
+	b := new(bytes.Buffer)
+	if err := transport.WriteResponse(b, rt, data); err != nil {
+		t.Fatal(err)
+	}
+
+	return b.String()
+}
+
+func TestServer_loginHandler(t *testing.T) {
+	s := newMultiplayerServer()
+	login(t, s, "10.0.0.1", "player")
+	login(t, s, "10.0.0.2", "cheat")
+
+	st := Settings{
+		Motd: []string{"Welcome\n", "Players online: {players}"},
+		Bans: Bans{
+			Players:   []string{"cheat"},
+			Addresses: []string{"10.0.0.3"},
+			Networks:  []string{"192.168.0.0/16"},
+		},
+	}
+	if err := s.SetSettings(st); err != nil {
+		t.Fatal(err)
+	}
+
+	motd := []byte{0x01, 0x02}
+	motd = append(motd, "Welcome\r\n\x00Players online: 2\x00"...)
+
+	tcs := []struct {
+		name        string
+		ip          string
+		maintenance bool
+		exp         []byte
+	}{
+		{name: "motd", ip: "10.0.0.1", exp: motd},
+		{name: "banned player", ip: "10.0.0.2", exp: []byte{0x03}},
+		{name: "banned address", ip: "10.0.0.3", exp: []byte{0x03}},
+		{name: "banned network", ip: "192.168.1.1", exp: []byte{0x03}},
+		{name: "maintenance", ip: "10.0.0.1", maintenance: true, exp: []byte{0x05}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			st.Maintenance = nil
+			if tc.maintenance {
+				st.Maintenance = []Maintenance{{
+					Start: time.Now().Add(-time.Minute),
+					End:   time.Now().Add(time.Minute),
+				}}
+			}
+			if err := s.SetSettings(st); err != nil {
+				t.Fatal(err)
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			r.RemoteAddr = tc.ip + ":3000"
+			w := httptest.NewRecorder()
+			s.loginHandler()(w, r)
+
+			if got, exp := w.Body.String(), response(t, transport.ResponseLogin, tc.exp); got != exp {
+				t.Fatalf("expected response: %q got: %q", exp, got)
+			}
+
+			w = httptest.NewRecorder()
+			s.timeMsgHandler()(w, r)
+
+			exp := []byte{0x00, 0x00, 0x00}
+			if tc.maintenance {
+				exp[0] = 0x01
+			}
+			if got, exp := w.Body.String(), response(t, transport.ResponseTimeMsg, exp); got != exp {
+				t.Fatalf("expected time message: %q got: %q", exp, got)
+			}
+		})
+	}
+}
+
+func TestServer_SetSettings(t *testing.T) {
+	s := newMultiplayerServer()
+	if err := s.SetSettings(DefaultSettings()); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for name, st := range map[string]Settings{
+		"no motd":     {},
+		"address":     {Motd: []string{"hi"}, Bans: Bans{Addresses: []string{"10.0.0"}}},
+		"network":     {Motd: []string{"hi"}, Bans: Bans{Networks: []string{"10.0.0.0"}}},
+		"maintenance": {Motd: []string{"hi"}, Maintenance: []Maintenance{{Start: now, End: now}}},
+		"deny":        {Motd: []string{"hi"}, Deny: []string{""}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if err := s.SetSettings(st); err == nil {
+				t.Fatal("expected error")
+			}
+			if got := s.settings().Motd; len(got) != 2 {
+				t.Fatalf("expected the previous settings to be kept got: %q", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package game
+
+import (
+	"context"
+	"errors"
+	"expvar"
+
+	"github.com/danmrichards/dessego/internal/replaydata"
+	"github.com/danmrichards/dessego/internal/service/gamestate"
+	"github.com/danmrichards/dessego/internal/service/quarantine"
+)
+
+// uploadsRejected counts rejected replay and ghost uploads, by kind and
+// reason.
+var uploadsRejected = expvar.NewMap("uploads_rejected")
+
+// validRecording returns true if the base64 recording data uploaded by the
+// given character is valid. Invalid recordings are counted, logged and
+// quarantined.
+func (s *Server) validRecording(
+	ctx context.Context,
+	kind, characterID string,
+	blockID int32,
+	data string,
+) bool {
+	err := replaydata.Validate([]byte(data))
+	if err == nil {
+		return true
+	}
+
+	reason := "malformed"
+	var serr replaydata.SizeError
+	if errors.As(err, &serr) {
+		reason = "oversized"
+	}
+	uploadsRejected.Add(kind+"_"+reason, 1)
+
+	s.log(ctx).Warn().Err(err).Msgf(
+		"rejected %s upload from character: %q in block: %q",
+		kind, characterID, gamestate.Block(blockID),
+	)
+
+	if s.q == nil {
+		return false
+	}
+	if err = s.q.Add(ctx, quarantine.Upload{
+		Kind:        kind,
+		CharacterID: characterID,
+		BlockID:     blockID,
+		Reason:      err.Error(),
+		Data:        []byte(data),
+	}); err != nil {
+		s.log(ctx).Err(err).Msg("quarantine upload")
+	}
+
+	return false
+}
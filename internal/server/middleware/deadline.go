@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"expvar"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// requestsTimedOut counts requests aborted for exceeding their deadline or
+// being cancelled by the client, by path.
+var requestsTimedOut = expvar.NewMap("requests_timed_out")
+
+// Deadline is a HTTP middleware that gives the request context a deadline of
+// d from when the request is received.
+//
+// The response is buffered until the handler returns. If the handler fails
+// once the deadline has passed, or the client has gone away, the response is
+// discarded and the connection aborted. Demon's Souls treats an aborted
+// request as failed and retries it, whereas it would accept any response
+// written. A handler which completes its response is assumed to have committed
+// its changes, so the response is always sent, as retrying the request could
+// repeat them.
+func Deadline(l zerolog.Logger, d time.Duration, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+
+		bw := &bufferedWriter{ResponseWriter: w}
+		h.ServeHTTP(bw, r.WithContext(ctx))
+
+		if err := ctx.Err(); err != nil && bw.failed() {
+			requestsTimedOut.Add(r.URL.Path, 1)
+
+			rl := Logger(r.Context(), &l)
+			ev := rl.Warn()
+			if errors.Is(err, context.Canceled) {
+				ev = rl.Debug()
+			}
+			ev.Err(err).
+				Str("path", r.URL.Path).
+				Str("client", r.RemoteAddr).
+				Dur("deadline", d).
+				Msg("request aborted")
+
+			// Abort the request without the server logging a stack trace.
+			panic(http.ErrAbortHandler)
+		}
+
+		if bw.code != 0 {
+			w.WriteHeader(bw.code)
+		}
+		if _, err := w.Write(bw.buf.Bytes()); err != nil {
+			Logger(r.Context(), &l).Err(err).Msg("write response")
+		}
+	}
+}
+
+// bufferedWriter is a http.ResponseWriter which buffers the status code and
+// body of the response. Headers are set on the underlying writer.
+type bufferedWriter struct {
+	http.ResponseWriter
+
+	code int
+	buf  bytes.Buffer
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (b *bufferedWriter) WriteHeader(code int) {
+	if b.code == 0 {
+		b.code = code
+	}
+}
+
+// Write implements io.Writer.
+func (b *bufferedWriter) Write(p []byte) (int, error) {
+	return b.buf.Write(p)
+}
+
+// failed returns true if the handler did not write a response, or wrote a
+// server error.
+func (b *bufferedWriter) failed() bool {
+	return b.code >= http.StatusInternalServerError || (b.code == 0 && b.buf.Len() == 0)
+}
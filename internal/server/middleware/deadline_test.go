@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestDeadline(t *testing.T) {
+	h := Deadline(zerolog.Nop(), 50*time.Millisecond, http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+			w.Write([]byte("ok"))
+		},
+	))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+
+	if rec.Code != http.StatusTeapot {
+		t.Fatalf("expected status %d got %d", http.StatusTeapot, rec.Code)
+	}
+	if got := rec.Body.String(); got != "ok" {
+		t.Fatalf("expected body %q got %q", "ok", got)
+	}
+}
+
+func TestDeadline_exceeded(t *testing.T) {
+	h := Deadline(zerolog.Nop(), 10*time.Millisecond, http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+			http.Error(w, r.Context().Err().Error(), http.StatusInternalServerError)
+		},
+	))
+
+	rec := httptest.NewRecorder()
+	defer func() {
+		if r := recover(); r != http.ErrAbortHandler {
+			t.Fatalf("expected abort panic got %v", r)
+		}
+		if rec.Body.Len() != 0 {
+			t.Fatalf("expected no response got %q", rec.Body.String())
+		}
+	}()
+
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+}
+
+func TestDeadline_completed(t *testing.T) {
+	tests := map[string]func(w http.ResponseWriter){
+		"body":      func(w http.ResponseWriter) { w.Write([]byte("late")) },
+		"forbidden": func(w http.ResponseWriter) { http.Error(w, "late", http.StatusForbidden) },
+	}
+
+	for name, write := range tests {
+		t.Run(name, func(t *testing.T) {
+			// The handler commits its response after the deadline has passed.
+			h := Deadline(zerolog.Nop(), 10*time.Millisecond, http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					<-r.Context().Done()
+					write(w)
+				},
+			))
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+
+			if got := rec.Body.String(); !strings.HasPrefix(got, "late") {
+				t.Fatalf("expected body %q got %q", "late", got)
+			}
+		})
+	}
+}
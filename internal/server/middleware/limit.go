@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"bytes"
+	"expvar"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/rs/zerolog"
+)
+
+// requestsTooLarge counts requests rejected for exceeding the body size limit,
+// by path.
+var requestsTooLarge = expvar.NewMap("requests_too_large")
+
+// LimitBody is a HTTP middleware that rejects requests with a body larger
+// than n bytes.
+//
+// The body is read into memory up front, so handlers can continue to read the
+// whole body without checking its size.
+func LimitBody(l zerolog.Logger, n int64, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		b, err := ioutil.ReadAll(io.LimitReader(r.Body, n+1))
+		r.Body.Close()
+		if err != nil {
+			Logger(r.Context(), &l).Err(err).Msg("")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if int64(len(b)) > n {
+			requestsTooLarge.Add(r.URL.Path, 1)
+			Logger(r.Context(), &l).Warn().
+				Str("path", r.URL.Path).
+				Str("client", r.RemoteAddr).
+				Int64("limit", n).
+				Msg("request body too large")
+
+			http.Error(
+				w,
+				http.StatusText(http.StatusRequestEntityTooLarge),
+				http.StatusRequestEntityTooLarge,
+			)
+			return
+		}
+
+		r.Body = ioutil.NopCloser(bytes.NewReader(b))
+		h.ServeHTTP(w, r)
+	}
+}
@@ -1,21 +1,119 @@
 package middleware
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"net/http"
+	"time"
 
 	"github.com/rs/zerolog"
 )
 
-// LogRequest is a HTTP middleware that logs the incoming request to the given
-// endpoint.
+// LogRequest is a HTTP middleware that logs each request to the given endpoint
+// once it has been handled, with the status, size and latency of the response.
+//
+// Each request is given an ID, and a logger with the ID is attached to the
+// request context. Handlers log with it, and may add fields which are logged
+// with the request, using Logger.
 func LogRequest(l zerolog.Logger, h http.Handler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		l.Info().
-			Str("method", r.Method).
-			Str("path", r.URL.Path).
-			Str("client", r.RemoteAddr).
-			Msg("")
+		start := time.Now()
 
-		h.ServeHTTP(w, r)
+		rl := l.With().Str("request_id", requestID()).Logger()
+		r = r.WithContext(rl.WithContext(r.Context()))
+
+		sw := &statusWriter{ResponseWriter: w}
+		defer func() {
+			// Log requests aborted by a panic, then let the server handle it.
+			p := recover()
+
+			status, level := sw.status(), zerolog.InfoLevel
+			switch {
+			case p != nil:
+				status, level = 0, zerolog.WarnLevel
+			case status >= http.StatusInternalServerError:
+				level = zerolog.ErrorLevel
+			case status >= http.StatusBadRequest:
+				level = zerolog.WarnLevel
+			}
+			rl.WithLevel(level).
+				Bool("aborted", p != nil).
+				Str("method", r.Method).
+				Str("path", r.URL.Path).
+				Str("client", r.RemoteAddr).
+				Int("status", status).
+				Int("size", sw.size).
+				Dur("latency", time.Since(start)).
+				Msg("request")
+
+			if p != nil {
+				panic(p)
+			}
+		}()
+
+		h.ServeHTTP(sw, r)
+	}
+}
+
+// Logger returns the logger attached to the context by LogRequest, or l if
+// there is none.
+func Logger(ctx context.Context, l *zerolog.Logger) *zerolog.Logger {
+	if rl := zerolog.Ctx(ctx); rl.GetLevel() != zerolog.Disabled {
+		return rl
+	}
+
+	return l
+}
+
+// requestID returns a random ID for a request.
+func requestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// statusWriter is a http.ResponseWriter which records the status code and
+// size of the response.
+type statusWriter struct {
+	http.ResponseWriter
+
+	code int
+	size int
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (s *statusWriter) WriteHeader(code int) {
+	if s.code == 0 {
+		s.code = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+// Write implements io.Writer.
+func (s *statusWriter) Write(p []byte) (int, error) {
+	n, err := s.ResponseWriter.Write(p)
+	s.size += n
+
+	return n, err
+}
+
+// Flush implements http.Flusher, so responses may be streamed, if the
+// underlying http.ResponseWriter supports it.
+func (s *statusWriter) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
 	}
 }
+
+// status returns the status code of the response.
+func (s *statusWriter) status() int {
+	if s.code == 0 {
+		return http.StatusOK
+	}
+
+	return s.code
+}
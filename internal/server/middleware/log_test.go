@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestLogRequest(t *testing.T) {
+	buf := new(bytes.Buffer)
+	l := zerolog.New(buf)
+
+	var ids []string
+	h := LogRequest(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rl := Logger(r.Context(), &l)
+		rl.UpdateContext(func(c zerolog.Context) zerolog.Context {
+			return c.Str("character_id", "player0")
+		})
+		rl.Info().Msg("handled")
+
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("ok"))
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/login.spd", nil))
+
+	dec := json.NewDecoder(buf)
+	for _, exp := range []string{"handled", "request"} {
+		var entry map[string]interface{}
+		if err := dec.Decode(&entry); err != nil {
+			t.Fatal(err)
+		}
+
+		if entry["message"] != exp || entry["character_id"] != "player0" {
+			t.Fatalf("expected %q entry for player0 got: %v", exp, entry)
+		}
+		id, _ := entry["request_id"].(string)
+		ids = append(ids, id)
+
+		if exp != "request" {
+			continue
+		}
+		if entry["level"] != "warn" || entry["status"] != float64(http.StatusTeapot) ||
+			entry["size"] != float64(2) || entry["path"] != "/login.spd" {
+			t.Fatalf("unexpected request entry: %v", entry)
+		}
+		if _, ok := entry["latency"]; !ok {
+			t.Fatalf("expected latency got: %v", entry)
+		}
+	}
+
+	if ids[0] == "" || ids[0] != ids[1] {
+		t.Fatalf("expected matching request IDs got: %q", ids)
+	}
+}
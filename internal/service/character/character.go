@@ -1,6 +1,10 @@
 package character
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
 
 // MultiplayerGrade is a string representation of a Multiplayer grade.
 type MultiplayerGrade string
@@ -34,6 +38,40 @@ var Grades = map[int]MultiplayerGrade{
 	4: GradeD,
 }
 
+// grades is the list of valid multiplayer grades, best first.
+var grades = []MultiplayerGrade{GradeS, GradeA, GradeB, GradeC, GradeD}
+
+// Valid returns true if g is one of the S, A, B, C or D grades.
+//
+// Valid grades are also the names of the character columns counting them.
+func (g MultiplayerGrade) Valid() bool {
+	for _, vg := range grades {
+		if g == vg {
+			return true
+		}
+	}
+	return false
+}
+
+// Grade is a multiplayer grade given to a character, as recorded in the grade
+// ledger.
+type Grade struct {
+	// GiverID is the character who gave the grade. It is empty if the grade
+	// was reported by the receiver when finalising their session.
+	GiverID string
+
+	// ReceiverID is the character who was graded.
+	ReceiverID string
+
+	Grade MultiplayerGrade
+
+	// Session is the number of the receiver's multiplayer session in which
+	// the grade was given.
+	Session int
+
+	Created time.Time
+}
+
 // Stats represents a characters statistics.
 type Stats struct {
 	GradeS   int
@@ -51,6 +89,22 @@ func (s Stats) Vals() []int {
 	}
 }
 
+// add adds n to the count of the given grade.
+func (s *Stats) add(g MultiplayerGrade, n int) {
+	switch g {
+	case GradeS:
+		s.GradeS += n
+	case GradeA:
+		s.GradeA += n
+	case GradeB:
+		s.GradeB += n
+	case GradeC:
+		s.GradeC += n
+	case GradeD:
+		s.GradeD += n
+	}
+}
+
 // String implements fmt.Stringer.
 func (s Stats) String() string {
 	return fmt.Sprintf(
@@ -97,3 +151,53 @@ func (w WorldTendency) String() string {
 		w.Area7, w.WB7, w.LR7,
 	)
 }
+
+// tendencyFilter returns the where clause selecting world tendencies set in
+// the given region, or every region if region is empty, and its arguments
+// followed by the limit n.
+//
+// World tendencies without a region were set before regions were recorded,
+// so are used in every region.
+func tendencyFilter(region string, n int) (where string, args []interface{}) {
+	if region == "" {
+		return "", []interface{}{n}
+	}
+
+	return `WHERE region IN (?, '')`, []interface{}{region, n}
+}
+
+// CharacterTendency is the world tendency of a given character.
+type CharacterTendency struct {
+	CharacterID string
+	WorldTendency
+}
+
+// recountGradesQuery returns the query setting every grade column of every
+// character to the number of grades in the ledger.
+func recountGradesQuery() string {
+	var qb strings.Builder
+	qb.WriteString("UPDATE character SET ")
+	for i, g := range grades {
+		if i > 0 {
+			qb.WriteString(", ")
+		}
+		qb.WriteString(string(g) + ` = (
+			SELECT count(*)
+			FROM multiplayer_grade
+			WHERE multiplayer_grade.receiver_id = character.id
+			AND grade = ?
+		)`)
+	}
+
+	return qb.String()
+}
+
+// recountGradesArgs returns the arguments to the recountGradesQuery.
+func recountGradesArgs() []interface{} {
+	args := make([]interface{}, len(grades))
+	for i, g := range grades {
+		args[i] = g
+	}
+
+	return args
+}
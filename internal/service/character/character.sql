@@ -6,5 +6,6 @@ CREATE TABLE IF NOT EXISTS character (
     grade_c INTEGER DEFAULT 0,
     grade_d INTEGER DEFAULT 0,
     sessions INTEGER DEFAULT 0,
-    msg_rating INTEGER DEFAULT 0
+    msg_rating INTEGER DEFAULT 0,
+    msg_rating_base INTEGER DEFAULT 0
 );
\ No newline at end of file
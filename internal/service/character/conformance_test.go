@@ -0,0 +1,49 @@
+package character_test
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/danmrichards/dessego/internal/server/game"
+	"github.com/danmrichards/dessego/internal/service/character"
+	"github.com/danmrichards/dessego/internal/service/servicetest"
+)
+
+func TestMain(m *testing.M) {
+	// The service loads its DDL relative to the repository root.
+	if err := os.Chdir("../../.."); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	os.Exit(servicetest.Run(m))
+}
+
+func TestConformance(t *testing.T) {
+	t.Run("Memory", func(t *testing.T) {
+		servicetest.Characters(t, func(t *testing.T) game.Characters {
+			return character.NewMemoryService()
+		})
+	})
+
+	t.Run("SQLite", func(t *testing.T) {
+		servicetest.Characters(t, func(t *testing.T) game.Characters {
+			s, err := character.NewSQLiteService(servicetest.SQLite(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s
+		})
+	})
+
+	t.Run("Postgres", func(t *testing.T) {
+		servicetest.Characters(t, func(t *testing.T) game.Characters {
+			s, err := character.NewPostgresService(servicetest.Postgres(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s
+		})
+	})
+}
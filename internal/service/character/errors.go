@@ -0,0 +1,45 @@
+package character
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNotFound is returned when a character does not exist.
+var ErrNotFound = errors.New("character not found")
+
+// DuplicateGradeError is returned when a character has already been graded by
+// the giver in their current multiplayer session.
+type DuplicateGradeError struct {
+	GiverID    string
+	ReceiverID string
+	Session    int
+}
+
+func (d DuplicateGradeError) Error() string {
+	if d.GiverID == "" {
+		return fmt.Sprintf(
+			"character %q has already been graded in session %d",
+			d.ReceiverID, d.Session,
+		)
+	}
+
+	return fmt.Sprintf(
+		"character %q has already graded character %q in session %d",
+		d.GiverID, d.ReceiverID, d.Session,
+	)
+}
+
+// SelfGradeError is returned when a character attempts to grade themselves.
+type SelfGradeError string
+
+func (s SelfGradeError) Error() string {
+	return fmt.Sprintf("character %q cannot grade themselves", string(s))
+}
+
+// InvalidGradeError is returned when a grade is not one of S, A, B, C or D.
+type InvalidGradeError MultiplayerGrade
+
+func (i InvalidGradeError) Error() string {
+	return fmt.Sprintf("invalid multiplayer grade %q", string(i))
+}
@@ -0,0 +1,224 @@
+package character
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// memCharacter is a character held by the in-memory service.
+type memCharacter struct {
+	stats     Stats
+	msgRating int
+}
+
+// memTendency is a world tendency held by the in-memory service.
+type memTendency struct {
+	region string
+	wt     WorldTendency
+}
+
+// gradeKey identifies a grade in the in-memory grade ledger.
+type gradeKey struct {
+	giverID    string
+	receiverID string
+	session    int
+}
+
+// MemoryService is a character service which holds characters in memory, for
+// tests and ephemeral servers.
+type MemoryService struct {
+	sync.Mutex
+
+	characters map[string]*memCharacter
+
+	// tendencies are the world tendencies, oldest first.
+	tendencies []memTendency
+
+	// grades is the grade ledger.
+	grades map[gradeKey]Grade
+}
+
+// NewMemoryService returns an empty in-memory character service.
+func NewMemoryService() *MemoryService {
+	return &MemoryService{
+		characters: make(map[string]*memCharacter),
+		grades:     make(map[gradeKey]Grade),
+	}
+}
+
+// EnsureCreate creates a character with the given ID and index.
+//
+// If a character with the given ID and index already exists, no error will
+// be returned.
+func (s *MemoryService) EnsureCreate(_ context.Context, id string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.characters[id]; !ok {
+		s.characters[id] = &memCharacter{}
+	}
+
+	return nil
+}
+
+// WorldTendency returns a maximum of n world tendency entries, set in the
+// given region. Entries from every region are returned if region is empty.
+func (s *MemoryService) WorldTendency(_ context.Context, region string, n int) ([]WorldTendency, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	wts := make([]WorldTendency, 0, n)
+	for i := len(s.tendencies) - 1; i >= 0 && len(wts) < n; i-- {
+		if t := s.tendencies[i]; region == "" || t.region == "" || t.region == region {
+			wts = append(wts, t.wt)
+		}
+	}
+
+	return wts, nil
+}
+
+// SetTendency sets the world tendency for the character with the given ID, in
+// the given region.
+func (s *MemoryService) SetTendency(_ context.Context, _, region string, wt WorldTendency) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.tendencies = append(s.tendencies, memTendency{region: region, wt: wt})
+
+	return nil
+}
+
+// Stats returns a map of statistics for the given character.
+func (s *MemoryService) Stats(_ context.Context, id string) (*Stats, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	c, ok := s.characters[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	st := c.stats
+
+	return &st, nil
+}
+
+// MsgRating returns the message rating for the character with the given ID.
+func (s *MemoryService) MsgRating(_ context.Context, id string) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	c, ok := s.characters[id]
+	if !ok {
+		return 0, ErrNotFound
+	}
+
+	return c.msgRating, nil
+}
+
+// UpdateMsgRating updates the message rating for the character with the
+// given ID.
+func (s *MemoryService) UpdateMsgRating(_ context.Context, id string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if c, ok := s.characters[id]; ok {
+		c.msgRating++
+	}
+
+	return nil
+}
+
+// SetMsgRatings sets the message rating of every character to its ratings in
+// the given ledger ratings, keyed by character ID. In memory every rating is in
+// the ledger, so there are no pre-ledger ratings to keep.
+func (s *MemoryService) SetMsgRatings(_ context.Context, ratings map[string]int) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for id, c := range s.characters {
+		c.msgRating = ratings[id]
+	}
+
+	return nil
+}
+
+// InitMultiplayer initialises a multiplayer session for the given
+// characterID.
+func (s *MemoryService) InitMultiplayer(_ context.Context, id string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if c, ok := s.characters[id]; ok {
+		c.stats.Sessions++
+	}
+
+	return nil
+}
+
+// AddGrade records a multiplayer grade in the grade ledger and adds it to the
+// stats of the receiver, following the same rules as SQLiteService.AddGrade.
+func (s *MemoryService) AddGrade(_ context.Context, g *Grade) error {
+	if !g.Grade.Valid() {
+		return InvalidGradeError(g.Grade)
+	}
+	if g.GiverID != "" && g.GiverID == g.ReceiverID {
+		return SelfGradeError(g.GiverID)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	c, ok := s.characters[g.ReceiverID]
+	if !ok {
+		return ErrNotFound
+	}
+	g.Session = c.stats.Sessions
+	g.Created = time.Now()
+
+	dup := DuplicateGradeError{
+		GiverID:    g.GiverID,
+		ReceiverID: g.ReceiverID,
+		Session:    g.Session,
+	}
+	if _, ok = s.grades[gradeKey{g.GiverID, g.ReceiverID, g.Session}]; ok {
+		return dup
+	}
+
+	reported := gradeKey{receiverID: g.ReceiverID, session: g.Session}
+	if g.GiverID == "" {
+		for k := range s.grades {
+			if k.receiverID == g.ReceiverID && k.session == g.Session {
+				return dup
+			}
+		}
+	} else if rg, ok := s.grades[reported]; ok {
+		// Replace any grade the receiver reported themselves.
+		delete(s.grades, reported)
+		c.stats.add(rg.Grade, -1)
+	}
+
+	s.grades[gradeKey{g.GiverID, g.ReceiverID, g.Session}] = *g
+	c.stats.add(g.Grade, 1)
+
+	return nil
+}
+
+// RecountGrades rebuilds the multiplayer grades of every character from the
+// grade ledger.
+func (s *MemoryService) RecountGrades(context.Context) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, c := range s.characters {
+		sessions := c.stats.Sessions
+		c.stats = Stats{Sessions: sessions}
+	}
+	for _, g := range s.grades {
+		if c, ok := s.characters[g.ReceiverID]; ok {
+			c.stats.add(g.Grade, 1)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS multiplayer_grade (
+    id INTEGER PRIMARY KEY autoincrement,
+    giver_id TEXT NOT NULL,
+    receiver_id TEXT NOT NULL,
+    grade TEXT NOT NULL,
+    session INTEGER NOT NULL,
+    created INTEGER DEFAULT 0,
+    UNIQUE (giver_id, receiver_id, session)
+);
+
+CREATE INDEX IF NOT EXISTS multiplayer_grade_receiver
+    ON multiplayer_grade (receiver_id, session);
@@ -0,0 +1,45 @@
+package character
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/danmrichards/dessego/internal/database"
+)
+
+// PostgresService is a character service backed by a PostgreSQL database.
+type PostgresService struct {
+	db *sql.DB
+
+	sqlService
+}
+
+// NewPostgresService returns an initialised PostgreSQL character service.
+func NewPostgresService(db *sql.DB) (*PostgresService, error) {
+	s := &PostgresService{
+		db:         db,
+		sqlService: sqlService{c: database.PostgresConn(db)},
+	}
+
+	if err := s.init(); err != nil {
+		return nil, fmt.Errorf("initialise: %w", err)
+	}
+
+	return s, nil
+}
+
+// init initialises the database tables required by this service.
+func (s *PostgresService) init() error {
+	ddl, err := ioutil.ReadFile("internal/service/character/postgres.sql")
+	if err != nil {
+		return fmt.Errorf("read DDL: %w", err)
+	}
+
+	// Exec rather than prepare, as the DDL contains multiple statements.
+	if _, err = s.db.Exec(string(ddl)); err != nil {
+		return fmt.Errorf("init tables: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+CREATE TABLE IF NOT EXISTS character (
+    id TEXT PRIMARY KEY,
+    grade_s INTEGER DEFAULT 0,
+    grade_a INTEGER DEFAULT 0,
+    grade_b INTEGER DEFAULT 0,
+    grade_c INTEGER DEFAULT 0,
+    grade_d INTEGER DEFAULT 0,
+    sessions INTEGER DEFAULT 0,
+    msg_rating INTEGER DEFAULT 0,
+    msg_rating_base INTEGER DEFAULT 0
+);
+
+ALTER TABLE character ADD COLUMN IF NOT EXISTS msg_rating_base INTEGER;
+
+CREATE TABLE IF NOT EXISTS world_tendency (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    character_id TEXT REFERENCES character (id),
+    area_1 INTEGER DEFAULT 0,
+    wb_1 INTEGER DEFAULT 0,
+    lr_1 INTEGER DEFAULT 0,
+    area_2 INTEGER DEFAULT 0,
+    wb_2 INTEGER DEFAULT 0,
+    lr_2 INTEGER DEFAULT 0,
+    area_3 INTEGER DEFAULT 0,
+    wb_3 INTEGER DEFAULT 0,
+    lr_3 INTEGER DEFAULT 0,
+    area_4 INTEGER DEFAULT 0,
+    wb_4 INTEGER DEFAULT 0,
+    lr_4 INTEGER DEFAULT 0,
+    area_5 INTEGER DEFAULT 0,
+    wb_5 INTEGER DEFAULT 0,
+    lr_5 INTEGER DEFAULT 0,
+    area_6 INTEGER DEFAULT 0,
+    wb_6 INTEGER DEFAULT 0,
+    lr_6 INTEGER DEFAULT 0,
+    area_7 INTEGER DEFAULT 0,
+    wb_7 INTEGER DEFAULT 0,
+    lr_7 INTEGER DEFAULT 0,
+    region TEXT DEFAULT ''
+);
+
+ALTER TABLE world_tendency ADD COLUMN IF NOT EXISTS region TEXT DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS multiplayer_grade (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    giver_id TEXT NOT NULL,
+    receiver_id TEXT NOT NULL,
+    grade TEXT NOT NULL,
+    session INTEGER NOT NULL,
+    created BIGINT DEFAULT 0,
+    UNIQUE (giver_id, receiver_id, session)
+);
+
+CREATE INDEX IF NOT EXISTS multiplayer_grade_receiver
+    ON multiplayer_grade (receiver_id, session);
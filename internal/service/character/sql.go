@@ -0,0 +1,439 @@
+package character
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/danmrichards/dessego/internal/database"
+)
+
+// sqlService implements the character service for both SQLite and PostgreSQL,
+// so the two cannot drift apart. Queries are written in the SQL common to
+// both, with ? placeholders rebound for the dialect of the database.
+type sqlService struct {
+	c *database.Conn
+}
+
+// EnsureCreate creates a character with the given ID and index.
+//
+// If a character with the given ID and index already exists, no error will
+// be returned.
+func (s *sqlService) EnsureCreate(ctx context.Context, id string) error {
+	stmt, err := s.c.PrepareWrite(
+		`INSERT INTO character (id) VALUES (?) ON CONFLICT DO NOTHING`,
+	)
+	if err != nil {
+		return fmt.Errorf("prepare insert: %w", err)
+	}
+	if _, err = stmt.ExecContext(ctx, id); err != nil {
+		return fmt.Errorf("create character: %w", err)
+	}
+
+	return nil
+}
+
+// WorldTendency returns a maximum of n world tendency entries, set in the
+// given region. Entries from every region are returned if region is empty.
+func (s *sqlService) WorldTendency(ctx context.Context, region string, n int) (wts []WorldTendency, err error) {
+	wts = make([]WorldTendency, 0, n)
+
+	where, args := tendencyFilter(region, n)
+
+	var stmt *sql.Stmt
+	stmt, err = s.c.PrepareRead(
+		`SELECT area_1, wb_1, lr_1,
+		area_2, wb_2, lr_2,
+		area_3, wb_3, lr_3,
+		area_4, wb_4, lr_4,
+		area_5, wb_5, lr_5,
+		area_6, wb_6, lr_6,
+		area_7, wb_7, lr_7
+		FROM world_tendency
+		` + where + `
+		ORDER BY id DESC
+		LIMIT ?`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("prepare select: %w", err)
+	}
+
+	var rows *sql.Rows
+	rows, err = stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query rows: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var wt WorldTendency
+		if err = rows.Scan(
+			&wt.Area1, &wt.WB1, &wt.LR1,
+			&wt.Area2, &wt.WB2, &wt.LR2,
+			&wt.Area3, &wt.WB3, &wt.LR3,
+			&wt.Area4, &wt.WB4, &wt.LR4,
+			&wt.Area5, &wt.WB5, &wt.LR5,
+			&wt.Area6, &wt.WB6, &wt.LR6,
+			&wt.Area7, &wt.WB7, &wt.LR7,
+		); err != nil {
+			return nil, fmt.Errorf("query row: %w", err)
+		}
+
+		wts = append(wts, wt)
+	}
+
+	return wts, rows.Err()
+}
+
+// SetTendency sets the world tendency for the character with the given ID, in
+// the given region.
+func (s *sqlService) SetTendency(ctx context.Context, id, region string, wt WorldTendency) error {
+	stmt, err := s.c.PrepareWrite(
+		`INSERT INTO world_tendency (
+			character_id,
+			region,
+			area_1, wb_1, lr_1,
+			area_2, wb_2, lr_2,
+			area_3, wb_3, lr_3,
+			area_4, wb_4, lr_4,
+			area_5, wb_5, lr_5,
+			area_6, wb_6, lr_6,
+			area_7, wb_7, lr_7
+		) VALUES (
+			?,
+			?,
+			?, ?, ?,
+			?, ?, ?,
+			?, ?, ?,
+			?, ?, ?,
+			?, ?, ?,
+			?, ?, ?,
+			?, ?, ?
+		)`,
+	)
+	if err != nil {
+		return fmt.Errorf("prepare update: %w", err)
+	}
+
+	if _, err := stmt.ExecContext(
+		ctx,
+		id,
+		region,
+		wt.Area1, wt.WB1, wt.LR1,
+		wt.Area2, wt.WB2, wt.LR2,
+		wt.Area3, wt.WB3, wt.LR3,
+		wt.Area4, wt.WB4, wt.LR4,
+		wt.Area5, wt.WB5, wt.LR5,
+		wt.Area6, wt.WB6, wt.LR6,
+		wt.Area7, wt.WB7, wt.LR7,
+	); err != nil {
+		return fmt.Errorf("update row: %w", err)
+	}
+
+	return nil
+}
+
+// Stats returns a map of statistics for the given character.
+func (s *sqlService) Stats(ctx context.Context, id string) (*Stats, error) {
+	stmt, err := s.c.PrepareRead(
+		`SELECT grade_s, grade_a, grade_b, grade_c, grade_d, sessions
+		FROM character
+		WHERE id = ?`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("prepare select: %w", err)
+	}
+
+	st := &Stats{}
+	switch err = stmt.QueryRowContext(ctx, id).Scan(
+		&st.GradeS, &st.GradeA, &st.GradeB, &st.GradeC, &st.GradeD, &st.Sessions,
+	); {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, ErrNotFound
+	case err != nil:
+		return nil, fmt.Errorf("query row: %w", err)
+	}
+
+	return st, nil
+}
+
+// MsgRating returns the message rating for the character with the given ID.
+func (s *sqlService) MsgRating(ctx context.Context, id string) (mr int, err error) {
+	var stmt *sql.Stmt
+	stmt, err = s.c.PrepareRead(
+		`SELECT msg_rating FROM character WHERE id = ?`,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("prepare select: %w", err)
+	}
+
+	switch err = stmt.QueryRowContext(ctx, id).Scan(&mr); {
+	case errors.Is(err, sql.ErrNoRows):
+		return 0, ErrNotFound
+	case err != nil:
+		return 0, fmt.Errorf("query row: %w", err)
+	}
+
+	return mr, nil
+}
+
+// UpdateMsgRating updates the message rating for the character with the
+// given ID.
+func (s *sqlService) UpdateMsgRating(ctx context.Context, id string) error {
+	stmt, err := s.c.PrepareWrite(
+		`UPDATE character SET msg_rating = msg_rating + 1 WHERE id = ?`,
+	)
+	if err != nil {
+		return fmt.Errorf("prepare query: %w", err)
+	}
+
+	if _, err = stmt.ExecContext(ctx, id); err != nil {
+		return fmt.Errorf("update message rating: %w", err)
+	}
+
+	return nil
+}
+
+// SetMsgRatings sets the message rating of every character to the ratings it
+// earned before the rating ledger existed, plus its ratings in the given
+// ledger ratings, keyed by character ID.
+//
+// Characters migrated or imported with an unknown baseline have it set to the
+// message rating they have beyond the ledger, the first time they are set.
+func (s *sqlService) SetMsgRatings(ctx context.Context, ratings map[string]int) (err error) {
+	var tx *sql.Tx
+	tx, err = s.c.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("db tx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var stmt *sql.Stmt
+	stmt, err = tx.PrepareContext(
+		ctx,
+		s.c.Rebind(`UPDATE character
+		SET msg_rating_base = CASE WHEN msg_rating > ? THEN msg_rating - ? ELSE 0 END
+		WHERE id = ? AND msg_rating_base IS NULL`),
+	)
+	if err != nil {
+		return fmt.Errorf("prepare query: %w", err)
+	}
+	defer stmt.Close()
+
+	for id, r := range ratings {
+		if _, err = stmt.ExecContext(ctx, r, r, id); err != nil {
+			return fmt.Errorf("set message rating base: %w", err)
+		}
+	}
+
+	// Characters without ledger ratings earned all of their rating before.
+	if _, err = tx.ExecContext(
+		ctx,
+		`UPDATE character
+		SET msg_rating_base = msg_rating
+		WHERE msg_rating_base IS NULL`,
+	); err != nil {
+		return fmt.Errorf("set message rating base: %w", err)
+	}
+
+	if _, err = tx.ExecContext(
+		ctx, `UPDATE character SET msg_rating = msg_rating_base`,
+	); err != nil {
+		return fmt.Errorf("reset message rating: %w", err)
+	}
+
+	var add *sql.Stmt
+	add, err = tx.PrepareContext(
+		ctx,
+		s.c.Rebind(`UPDATE character SET msg_rating = msg_rating + ? WHERE id = ?`),
+	)
+	if err != nil {
+		return fmt.Errorf("prepare query: %w", err)
+	}
+	defer add.Close()
+
+	for id, r := range ratings {
+		if _, err = add.ExecContext(ctx, r, id); err != nil {
+			return fmt.Errorf("update message rating: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// InitMultiplayer initialises a multiplayer session for the given
+// characterID.
+func (s *sqlService) InitMultiplayer(ctx context.Context, id string) error {
+	stmt, err := s.c.PrepareWrite(
+		`UPDATE character SET sessions = sessions + 1 WHERE id = ?`,
+	)
+	if err != nil {
+		return fmt.Errorf("prepare query: %w", err)
+	}
+
+	if _, err = stmt.ExecContext(ctx, id); err != nil {
+		return fmt.Errorf("update message rating: %w", err)
+	}
+
+	return nil
+}
+
+// AddGrade records a multiplayer grade in the grade ledger and adds it to the
+// stats of the receiver. The session and creation time of the grade are set
+// when it is recorded.
+//
+// A giver may grade a receiver once per multiplayer session of the receiver.
+// A grade with no giver, reported by the receiver themselves, is only recorded
+// if nobody has graded the receiver in the session and is replaced by any
+// grade given later. The returned error will be one of InvalidGradeError,
+// SelfGradeError or DuplicateGradeError if the grade was rejected.
+func (s *sqlService) AddGrade(ctx context.Context, g *Grade) (err error) {
+	if !g.Grade.Valid() {
+		return InvalidGradeError(g.Grade)
+	}
+	if g.GiverID != "" && g.GiverID == g.ReceiverID {
+		return SelfGradeError(g.GiverID)
+	}
+
+	var tx *sql.Tx
+	tx, err = s.c.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("db tx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Lock the receiver, so concurrent grades for them are serialised. SQLite
+	// has a single writer, so they already are.
+	lock := ""
+	if s.c.Dialect == database.PostgresDialect {
+		lock = " FOR UPDATE"
+	}
+	switch err = tx.QueryRowContext(
+		ctx,
+		s.c.Rebind(`SELECT sessions FROM character WHERE id = ?`+lock), g.ReceiverID,
+	).Scan(&g.Session); {
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrNotFound
+	case err != nil:
+		return fmt.Errorf("query session: %w", err)
+	}
+	g.Created = time.Now()
+
+	dup := DuplicateGradeError{
+		GiverID:    g.GiverID,
+		ReceiverID: g.ReceiverID,
+		Session:    g.Session,
+	}
+
+	if g.GiverID == "" {
+		var n int
+		if err = tx.QueryRowContext(
+			ctx,
+			s.c.Rebind(`SELECT count(*)
+			FROM multiplayer_grade
+			WHERE receiver_id = ?
+			AND session = ?`),
+			g.ReceiverID, g.Session,
+		).Scan(&n); err != nil {
+			return fmt.Errorf("query grade count: %w", err)
+		}
+		if n > 0 {
+			return dup
+		}
+	} else {
+		// Replace any grade the receiver reported themselves.
+		var reported MultiplayerGrade
+		err = tx.QueryRowContext(
+			ctx,
+			s.c.Rebind(`SELECT grade
+			FROM multiplayer_grade
+			WHERE giver_id = ''
+			AND receiver_id = ?
+			AND session = ?`),
+			g.ReceiverID, g.Session,
+		).Scan(&reported)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			err = nil
+		case err != nil:
+			return fmt.Errorf("query reported grade: %w", err)
+		case reported.Valid():
+			if _, err = tx.ExecContext(
+				ctx,
+				s.c.Rebind(`DELETE FROM multiplayer_grade
+				WHERE giver_id = ''
+				AND receiver_id = ?
+				AND session = ?`),
+				g.ReceiverID, g.Session,
+			); err != nil {
+				return fmt.Errorf("delete reported grade: %w", err)
+			}
+			col := string(reported)
+			if _, err = tx.ExecContext(
+				ctx,
+				s.c.Rebind(`UPDATE character SET `+col+` = `+col+` - 1 WHERE id = ?`),
+				g.ReceiverID,
+			); err != nil {
+				return fmt.Errorf("update grade: %w", err)
+			}
+		}
+	}
+
+	var res sql.Result
+	res, err = tx.ExecContext(
+		ctx,
+		s.c.Rebind(`INSERT INTO multiplayer_grade (
+			giver_id,
+			receiver_id,
+			grade,
+			session,
+			created
+		) VALUES (?,?,?,?,?)
+		ON CONFLICT DO NOTHING`),
+		g.GiverID, g.ReceiverID, g.Grade, g.Session, g.Created.Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("add grade: %w", err)
+	}
+
+	var n int64
+	if n, err = res.RowsAffected(); err != nil {
+		return fmt.Errorf("rows affected: %w", err)
+	} else if n == 0 {
+		return dup
+	}
+
+	// Column names cannot be bound, but valid grades are column names.
+	col := string(g.Grade)
+	if _, err = tx.ExecContext(
+		ctx,
+		s.c.Rebind(`UPDATE character SET `+col+` = `+col+` + 1 WHERE id = ?`),
+		g.ReceiverID,
+	); err != nil {
+		return fmt.Errorf("update grade: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// RecountGrades rebuilds the multiplayer grades of every character from the
+// grade ledger.
+func (s *sqlService) RecountGrades(ctx context.Context) error {
+	if _, err := s.c.Writer.ExecContext(
+		ctx, s.c.Rebind(recountGradesQuery()), recountGradesArgs()...,
+	); err != nil {
+		return fmt.Errorf("recount grades: %w", err)
+	}
+
+	return nil
+}
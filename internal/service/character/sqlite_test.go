@@ -0,0 +1,87 @@
+package character
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/danmrichards/dessego/internal/database"
+)
+
+func TestSQLiteService_SetMsgRatings(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := database.NewSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	// Characters rated before the rating ledger existed, character0 once more
+	// since.
+	if _, err = db.Writer.Exec(
+		`CREATE TABLE character (
+			id TEXT PRIMARY KEY ,
+			grade_s INTEGER DEFAULT 0,
+			grade_a INTEGER DEFAULT 0,
+			grade_b INTEGER DEFAULT 0,
+			grade_c INTEGER DEFAULT 0,
+			grade_d INTEGER DEFAULT 0,
+			sessions INTEGER DEFAULT 0,
+			msg_rating INTEGER DEFAULT 0
+		);
+		INSERT INTO character (id, msg_rating) VALUES ('character0', 3), ('character1', 2);`,
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewSQLiteService(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.EnsureCreate(ctx, "character2"); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"character0", "character2"} {
+		if err = s.UpdateMsgRating(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = s.SetMsgRatings(ctx, map[string]int{"character0": 2, "character2": 1}); err != nil {
+		t.Fatal(err)
+	}
+	assertMsgRatings(t, s, map[string]int{"character0": 4, "character1": 2, "character2": 1})
+
+	// Once known, the rating base is kept, so later farmed ratings are dropped.
+	if _, err = db.Writer.Exec(
+		`UPDATE character SET msg_rating = 50 WHERE id = 'character0'`,
+	); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.UpdateMsgRating(ctx, "character0"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.SetMsgRatings(ctx, map[string]int{"character0": 3, "character2": 1}); err != nil {
+		t.Fatal(err)
+	}
+	assertMsgRatings(t, s, map[string]int{"character0": 5, "character1": 2, "character2": 1})
+}
+
+// assertMsgRatings fails the test if the message rating of any character is
+// not as expected.
+func assertMsgRatings(t *testing.T, s *SQLiteService, exp map[string]int) {
+	t.Helper()
+
+	for id, mr := range exp {
+		got, err := s.MsgRating(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != mr {
+			t.Fatalf("expected %s message rating: %d got: %d", id, mr, got)
+		}
+	}
+}
@@ -22,5 +22,6 @@ CREATE TABLE IF NOT EXISTS world_tendency (
     area_7 INTEGER DEFAULT 0,
     wb_7 INTEGER DEFAULT 0,
     lr_7 INTEGER DEFAULT 0,
+    region TEXT DEFAULT '',
     FOREIGN KEY(character_id) REFERENCES character(id)
 );
\ No newline at end of file
@@ -1,5 +1,10 @@
 package gamestate
 
+import (
+	"sort"
+	"strings"
+)
+
 var blockNames = map[int32]string{
 	-1:      "Loading Area",
 	-10079:  "Nexus",
@@ -61,6 +66,22 @@ var blockNames = map[int32]string{
 	-50279:  "5-3 Maiden Astraea",
 }
 
+// Blocks returns the IDs of every block with a name starting with the given
+// prefix. For example, "4-2" returns every block in the 4-2 area.
+func Blocks(prefix string) []int32 {
+	ids := make([]int32, 0)
+	for id, bn := range blockNames {
+		if strings.HasPrefix(bn, prefix) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+
+	return ids
+}
+
 // Block represents an area of the Demon's Souls map.
 type Block int32
 
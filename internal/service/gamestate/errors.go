@@ -8,3 +8,11 @@ type PlayerNotFoundError string
 func (p PlayerNotFoundError) Error() string {
 	return fmt.Sprintf("no character found with IP %q", string(p))
 }
+
+// CharacterNotFoundError is returned when no connected character belongs to
+// an NPID.
+type CharacterNotFoundError string
+
+func (c CharacterNotFoundError) Error() string {
+	return fmt.Sprintf("no character found for NPID %q", string(c))
+}
@@ -0,0 +1,44 @@
+package gamestate
+
+import "sort"
+
+// Language is a language in which Demon's Souls renders blood messages.
+type Language string
+
+// English is the English language. It is the only supported language, as only
+// the English blood message tables are available.
+const English Language = "en"
+
+// messageTables are the blood message templates for each language which has
+// translations available.
+var messageTables = map[Language]map[int]string{
+	English: Messages,
+}
+
+// Languages returns the languages which have blood message translations
+// available, sorted by language code.
+func Languages() []Language {
+	ls := make([]Language, 0, len(messageTables))
+	for l := range messageTables {
+		ls = append(ls, l)
+	}
+	sort.Slice(ls, func(i, j int) bool {
+		return ls[i] < ls[j]
+	})
+
+	return ls
+}
+
+// Supported returns true if blood messages can be rendered in the language.
+func (l Language) Supported() bool {
+	_, ok := messageTables[l]
+	return ok
+}
+
+// Message returns the template of the message with the given ID in the given
+// language. False is returned if the message is unknown, or the language is
+// not supported.
+func Message(lang Language, id int) (string, bool) {
+	m, ok := messageTables[lang][id]
+	return m, ok
+}
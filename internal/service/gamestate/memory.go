@@ -1,7 +1,7 @@
 package gamestate
 
 import (
-	"strconv"
+	"strings"
 	"sync"
 )
 
@@ -20,18 +20,6 @@ func NewMemory() *Memory {
 	}
 }
 
-// Motd returns the messages of the day.
-func (m *Memory) Motd() []string {
-	motd := "Welcome to DeSSE Go\r\n"
-	motd += "A server emulator for Demon's Souls implemented in Go\r\n"
-	motd += "Source code:\r\n"
-	motd += "https://github.com/danmrichards/dessego\r\n"
-
-	motd2 := "Current players online: " + strconv.Itoa(m.playerCount())
-
-	return []string{motd, motd2}
-}
-
 // AddPlayer adds a new player to the current gamestate state.
 func (m *Memory) AddPlayer(ip, id string) {
 	m.Lock()
@@ -53,9 +41,71 @@ func (m *Memory) Player(ip string) (string, error) {
 	return id, nil
 }
 
-func (m *Memory) playerCount() int {
+// PlayerCharacter returns the ID of the connected character belonging to the
+// player with the given NPID.
+//
+// The game identifies other players by NPID alone, whereas character IDs are
+// the NPID followed by the index of the character.
+func (m *Memory) PlayerCharacter(npid string) (string, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	for _, id := range m.players {
+		if IsCharacterOf(id, npid) {
+			return id, nil
+		}
+	}
+
+	return "", CharacterNotFoundError(npid)
+}
+
+// IsCharacterOf returns true if id is a character ID for the given NPID.
+func IsCharacterOf(id, npid string) bool {
+	if npid == "" || !strings.HasPrefix(id, npid) {
+		return false
+	}
+
+	idx := id[len(npid):]
+	if idx == "" {
+		return false
+	}
+	for _, c := range idx {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// PlayerCount returns the number of connected players.
+func (m *Memory) PlayerCount() int {
 	m.Lock()
 	defer m.Unlock()
 
 	return len(m.players)
 }
+
+// Players returns the ID of every connected player, keyed by IP address.
+func (m *Memory) Players() map[string]string {
+	m.Lock()
+	defer m.Unlock()
+
+	players := make(map[string]string, len(m.players))
+	for ip, id := range m.players {
+		players[ip] = id
+	}
+
+	return players
+}
+
+// Restore adds the given players, keyed by IP address, replacing any current
+// player at the same address.
+func (m *Memory) Restore(players map[string]string) {
+	m.Lock()
+	defer m.Unlock()
+
+	for ip, id := range players {
+		m.players[ip] = id
+	}
+}
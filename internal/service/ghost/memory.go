@@ -1,6 +1,7 @@
 package ghost
 
 import (
+	"sort"
 	"sync"
 	"time"
 
@@ -90,3 +91,72 @@ func (m *Memory) Set(characterID string, g *Ghost) {
 
 	m.ghosts[characterID] = g
 }
+
+// Block returns every ghost within the given block ID.
+func (m *Memory) Block(blockID int32) []*Ghost {
+	m.Lock()
+	defer m.Unlock()
+
+	g := make([]*Ghost, 0)
+	for _, mg := range m.ghosts {
+		if mg.BlockID == blockID {
+			g = append(g, mg)
+		}
+	}
+
+	return g
+}
+
+// State is the saved state of a ghost manager.
+type State struct {
+	Ghosts []SavedGhost `json:"ghosts"`
+}
+
+// SavedGhost is a ghost saved in the state of a ghost manager.
+type SavedGhost struct {
+	BlockID     int32     `json:"block_id"`
+	CharacterID string    `json:"character_id"`
+	ReplayData  []byte    `json:"replay_data"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// State returns the saved state of every ghost.
+func (m *Memory) State() State {
+	m.Lock()
+	defer m.Unlock()
+
+	st := State{Ghosts: make([]SavedGhost, 0, len(m.ghosts))}
+	for _, g := range m.ghosts {
+		st.Ghosts = append(st.Ghosts, SavedGhost{
+			BlockID:     g.BlockID,
+			CharacterID: g.CharacterID,
+			ReplayData:  g.ReplayData,
+			Timestamp:   g.timestamp,
+		})
+	}
+
+	return st
+}
+
+// Restore adds the ghosts of a saved state, replacing any current ghost of
+// the same character.
+func (m *Memory) Restore(st State) {
+	m.Lock()
+	defer m.Unlock()
+
+	for _, sg := range st.Ghosts {
+		if _, ok := m.ghosts[sg.CharacterID]; !ok {
+			m.ghostAge = append(m.ghostAge, sg.CharacterID)
+		}
+		m.ghosts[sg.CharacterID] = &Ghost{
+			BlockID:     sg.BlockID,
+			CharacterID: sg.CharacterID,
+			ReplayData:  sg.ReplayData,
+			timestamp:   sg.Timestamp,
+		}
+	}
+
+	sort.SliceStable(m.ghostAge, func(i, j int) bool {
+		return m.ghosts[m.ghostAge[i]].timestamp.Before(m.ghosts[m.ghostAge[j]].timestamp)
+	})
+}
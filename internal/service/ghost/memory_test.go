@@ -4,6 +4,8 @@ import (
 	"reflect"
 	"testing"
 	"time"
+
+	"github.com/rs/zerolog"
 )
 
 func TestMemory_Get(t *testing.T) {
@@ -106,3 +108,27 @@ func TestMemory_ClearBefore(t *testing.T) {
 		t.Fatalf("expected %d ghost ages got %d", len(expGhosts), len(gm.ghosts))
 	}
 }
+
+func TestMemory_Restore(t *testing.T) {
+	gt := time.Date(2020, 11, 17, 13, 0, 0, 0, time.UTC)
+
+	src := NewMemory(zerolog.Nop())
+	src.Set("new", &Ghost{BlockID: 123, CharacterID: "new", ReplayData: []byte{1}, timestamp: gt})
+	src.Set("old", &Ghost{BlockID: 456, CharacterID: "old", ReplayData: []byte{2}, timestamp: gt.Add(-time.Minute)})
+
+	gm := NewMemory(zerolog.Nop())
+	gm.Set("new", &Ghost{BlockID: 789, CharacterID: "new", timestamp: gt.Add(-time.Hour)})
+	gm.ghostAge = []string{"new"}
+	gm.Restore(src.State())
+
+	expGhosts := map[string]*Ghost{
+		"new": {BlockID: 123, CharacterID: "new", ReplayData: []byte{1}, timestamp: gt},
+		"old": {BlockID: 456, CharacterID: "old", ReplayData: []byte{2}, timestamp: gt.Add(-time.Minute)},
+	}
+	if !reflect.DeepEqual(expGhosts, gm.ghosts) {
+		t.Fatalf("expected ghosts: %+v got: %+v", expGhosts, gm.ghosts)
+	}
+	if exp := []string{"old", "new"}; !reflect.DeepEqual(exp, gm.ghostAge) {
+		t.Fatalf("expected ghost ages: %v got: %v", exp, gm.ghostAge)
+	}
+}
@@ -0,0 +1,50 @@
+package msg_test
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/danmrichards/dessego/internal/server/game"
+	"github.com/danmrichards/dessego/internal/service/msg"
+	"github.com/danmrichards/dessego/internal/service/servicetest"
+	"github.com/rs/zerolog"
+)
+
+func TestMain(m *testing.M) {
+	// The service loads its DDL relative to the repository root.
+	if err := os.Chdir("../../.."); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	os.Exit(servicetest.Run(m))
+}
+
+func TestConformance(t *testing.T) {
+	t.Run("Memory", func(t *testing.T) {
+		servicetest.Messages(t, func(t *testing.T) game.Messages {
+			return msg.NewMemoryService(zerolog.Nop())
+		})
+	})
+
+	t.Run("SQLite", func(t *testing.T) {
+		servicetest.Messages(t, func(t *testing.T) game.Messages {
+			s, err := msg.NewSQLiteService(servicetest.SQLite(t), zerolog.Nop())
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s
+		})
+	})
+
+	t.Run("Postgres", func(t *testing.T) {
+		servicetest.Messages(t, func(t *testing.T) game.Messages {
+			s, err := msg.NewPostgresService(servicetest.Postgres(t), zerolog.Nop())
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s
+		})
+	})
+}
@@ -0,0 +1,43 @@
+package msg
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNotFound is returned when a message does not exist.
+var ErrNotFound = errors.New("message not found")
+
+// SelfRatingError is returned when a character attempts to rate one of their
+// own messages.
+type SelfRatingError struct {
+	ID          int
+	CharacterID string
+}
+
+func (s SelfRatingError) Error() string {
+	return fmt.Sprintf(
+		"character %q cannot rate their own message %d", s.CharacterID, s.ID,
+	)
+}
+
+// DuplicateRatingError is returned when a character attempts to rate a message
+// they have already rated.
+type DuplicateRatingError struct {
+	ID          int
+	CharacterID string
+}
+
+func (d DuplicateRatingError) Error() string {
+	return fmt.Sprintf(
+		"character %q has already rated message %d", d.CharacterID, d.ID,
+	)
+}
+
+// RatingLimitError is returned when a character has exceeded the configured
+// number of ratings within the rate limit window.
+type RatingLimitError string
+
+func (r RatingLimitError) Error() string {
+	return fmt.Sprintf("character %q exceeded the rating limit", string(r))
+}
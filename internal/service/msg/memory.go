@@ -0,0 +1,495 @@
+package msg
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danmrichards/dessego/internal/service/gamestate"
+	"github.com/danmrichards/dessego/internal/spatial"
+	"github.com/rs/zerolog"
+)
+
+// ratingKey identifies a rating in the in-memory rating ledger.
+type ratingKey struct {
+	id      uint32
+	raterID string
+}
+
+// memRating is a rating in the in-memory rating ledger.
+type memRating struct {
+	authorID string
+	created  time.Time
+}
+
+// MemoryService is a msg service which holds messages in memory, for tests and
+// ephemeral servers.
+type MemoryService struct {
+	sync.Mutex
+
+	l zerolog.Logger
+
+	msgs    map[uint32]*BloodMsg
+	ratings map[ratingKey]memRating
+	retired map[string]int
+	nextID  uint32
+
+	options
+}
+
+// NewMemoryService returns an empty in-memory messages service.
+func NewMemoryService(l zerolog.Logger, opts ...Option) *MemoryService {
+	return &MemoryService{
+		l:       l,
+		msgs:    make(map[uint32]*BloodMsg),
+		ratings: make(map[ratingKey]memRating),
+		retired: make(map[string]int),
+		nextID:  1,
+		options: newOptions(opts),
+	}
+}
+
+// Character returns n messages for the given character and within the given
+// block ID, visible in the given region. Messages from every region are
+// returned if region is empty.
+func (s *MemoryService) Character(_ context.Context, region, playerID string, blockID int32, n int) ([]BloodMsg, error) {
+	return s.selectMsgs(n, func(bm *BloodMsg) bool {
+		return bm.BlockID == blockID && bm.Legacy == 0 &&
+			bm.CharacterID == playerID && bm.visibleIn(region)
+	}), nil
+}
+
+// NonCharacter returns n messages for anyone other than the given character and
+// within the given block ID, visible in the given region. Messages from every
+// region are returned if region is empty.
+func (s *MemoryService) NonCharacter(_ context.Context, region, playerID string, blockID int32, n int) ([]BloodMsg, error) {
+	return s.selectMsgs(n, func(bm *BloodMsg) bool {
+		return bm.BlockID == blockID && bm.Legacy == 0 &&
+			bm.CharacterID != playerID && bm.visibleIn(region)
+	}), nil
+}
+
+// Legacy returns n legacy messages within the given block ID.
+func (s *MemoryService) Legacy(_ context.Context, blockID int32, n int) ([]BloodMsg, error) {
+	return s.selectMsgs(n, func(bm *BloodMsg) bool {
+		return bm.BlockID == blockID && bm.Legacy == 1
+	}), nil
+}
+
+// selectMsgs returns n messages matching the given filter, chosen by the
+// selection strategy of the service from the same pools of candidates as
+// SQLiteService.
+func (s *MemoryService) selectMsgs(n int, match func(bm *BloodMsg) bool) []BloodMsg {
+	if n <= 0 {
+		return []BloodMsg{}
+	}
+	k := n * candidateFactor
+
+	// Matching messages in ID order.
+	bms := s.filter(match)
+
+	var c Candidates
+	c.Fresh = make([]BloodMsg, 0, k)
+	for i := len(bms) - 1; i >= 0 && len(c.Fresh) < k; i-- {
+		c.Fresh = append(c.Fresh, bms[i])
+	}
+	if len(c.Fresh) < k {
+		// Every matching message is a candidate already.
+		return s.strategy.Select(c, n)
+	}
+
+	top := make([]BloodMsg, len(bms))
+	copy(top, bms)
+	sort.SliceStable(top, func(i, j int) bool {
+		if top[i].Rating != top[j].Rating {
+			return top[i].Rating > top[j].Rating
+		}
+		return top[i].ID > top[j].ID
+	})
+	c.Top = top[:k]
+
+	// A window starting from a random message, wrapping around to the start.
+	pivot := rand.Intn(len(bms))
+	c.Sample = make([]BloodMsg, 0, k)
+	for i := 0; i < k; i++ {
+		c.Sample = append(c.Sample, bms[(pivot+i)%len(bms)])
+	}
+
+	return s.strategy.Select(c, n)
+}
+
+// filter returns copies of the messages matching the given filter, in ID
+// order.
+func (s *MemoryService) filter(match func(bm *BloodMsg) bool) []BloodMsg {
+	s.Lock()
+	defer s.Unlock()
+
+	bms := make([]BloodMsg, 0)
+	for _, bm := range s.msgs {
+		if match(bm) {
+			bms = append(bms, *bm)
+		}
+	}
+	sort.Slice(bms, func(i, j int) bool {
+		return bms[i].ID < bms[j].ID
+	})
+
+	return bms
+}
+
+// Add adds a new message.
+//
+// If the retention policy limits the number of messages per character, the
+// oldest messages for the character beyond that limit are deleted.
+func (s *MemoryService) Add(_ context.Context, bm BloodMsg) error {
+	s.Lock()
+	defer s.Unlock()
+
+	bm.ID = s.nextID
+	bm.Rating = 0
+	bm.Legacy = 0
+	bm.Created = time.Now()
+	bm.Text = bm.Render(gamestate.English)
+	s.msgs[bm.ID] = &bm
+	s.nextID++
+
+	if max := s.retention.MaxPerCharacter; max > 0 {
+		n := s.deleteRanked(
+			func(m *BloodMsg) bool {
+				return m.CharacterID == bm.CharacterID && m.Legacy == 0
+			},
+			newestFirst,
+			max,
+		)
+		if n > 0 {
+			s.deleteOrphanRatings()
+			s.l.Debug().Msgf(
+				"deleted %d oldest messages for character: %q",
+				n, bm.CharacterID,
+			)
+		}
+	}
+
+	return nil
+}
+
+// newestFirst orders messages by creation time then ID, newest first.
+func newestFirst(a, b *BloodMsg) bool {
+	if !a.Created.Equal(b.Created) {
+		return a.Created.After(b.Created)
+	}
+	return a.ID > b.ID
+}
+
+// deleteRanked deletes the messages matching the filter which are ranked below
+// max by the given ordering, returning the number deleted. The caller must
+// hold the lock.
+func (s *MemoryService) deleteRanked(match func(bm *BloodMsg) bool, less func(a, b *BloodMsg) bool, max int) int64 {
+	bms := make([]*BloodMsg, 0)
+	for _, bm := range s.msgs {
+		if match(bm) {
+			bms = append(bms, bm)
+		}
+	}
+	if len(bms) <= max {
+		return 0
+	}
+
+	sort.Slice(bms, func(i, j int) bool {
+		return less(bms[i], bms[j])
+	})
+	for _, bm := range bms[max:] {
+		delete(s.msgs, bm.ID)
+	}
+
+	return int64(len(bms) - max)
+}
+
+// Delete deletes the message with the given ID, retiring its ratings.
+func (s *MemoryService) Delete(_ context.Context, id int) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.msgs, uint32(id))
+	s.deleteOrphanRatings()
+
+	return nil
+}
+
+// deleteOrphanRatings deletes the ratings of deleted messages, adding them to
+// the retired ratings of their authors. The caller must hold the lock.
+func (s *MemoryService) deleteOrphanRatings() {
+	for k, r := range s.ratings {
+		if _, ok := s.msgs[k.id]; !ok {
+			s.retired[r.authorID]++
+			delete(s.ratings, k)
+		}
+	}
+}
+
+// Get returns the message with the given ID.
+func (s *MemoryService) Get(_ context.Context, id int) (*BloodMsg, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	bm, ok := s.msgs[uint32(id)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	cp := *bm
+
+	return &cp, nil
+}
+
+// Rate records a rating for the message with the given ID by the character
+// with the given rater ID.
+//
+// Each character may only rate a given message once and may not rate their
+// own messages. The returned error will be one of SelfRatingError,
+// DuplicateRatingError or RatingLimitError if the rating was rejected.
+func (s *MemoryService) Rate(_ context.Context, id int, raterID string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	bm, ok := s.msgs[uint32(id)]
+	if !ok {
+		return ErrNotFound
+	}
+	if bm.CharacterID == raterID {
+		return SelfRatingError{ID: id, CharacterID: raterID}
+	}
+
+	// Check for a duplicate before the limit, so a repeated rating is not
+	// reported as exceeding it.
+	k := ratingKey{id: bm.ID, raterID: raterID}
+	if _, ok = s.ratings[k]; ok {
+		return DuplicateRatingError{ID: id, CharacterID: raterID}
+	}
+
+	now := time.Now()
+	if s.ratingLimit > 0 {
+		var n int
+		since := now.Add(-s.ratingWindow)
+		for k, r := range s.ratings {
+			if k.raterID == raterID && r.created.After(since) {
+				n++
+			}
+		}
+		if n >= s.ratingLimit {
+			return RatingLimitError(raterID)
+		}
+	}
+
+	s.ratings[k] = memRating{authorID: bm.CharacterID, created: now}
+	bm.Rating++
+
+	return nil
+}
+
+// RecountRatings rebuilds the rating of every non-legacy message from the
+// rating ledger. In memory every rating is in the ledger, so there are no
+// pre-ledger ratings to keep.
+func (s *MemoryService) RecountRatings(context.Context) error {
+	s.Lock()
+	defer s.Unlock()
+
+	ratings := make(map[uint32]int)
+	for k := range s.ratings {
+		ratings[k.id]++
+	}
+	for id, bm := range s.msgs {
+		if bm.Legacy == 0 {
+			bm.Rating = uint32(ratings[id])
+		}
+	}
+
+	return nil
+}
+
+// AuthorRatings returns the number of ratings received by each message author,
+// according to the rating ledger, including the retired ratings of deleted
+// messages.
+func (s *MemoryService) AuthorRatings(context.Context) (map[string]int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	ar := make(map[string]int, len(s.retired))
+	for id, n := range s.retired {
+		ar[id] = n
+	}
+	for _, r := range s.ratings {
+		ar[r.authorID]++
+	}
+
+	return ar, nil
+}
+
+// Prune deletes messages according to the retention policy of the service.
+//
+// If dryRun is true, nothing is deleted and the report details the messages
+// which would have been deleted.
+func (s *MemoryService) Prune(_ context.Context, dryRun bool) (PruneReport, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	pr := PruneReport{DryRun: dryRun}
+
+	// Prune a copy when dry running, so the rules see the effect of earlier
+	// rules as they would in a transaction.
+	msgs := s.msgs
+	if dryRun {
+		s.msgs = make(map[uint32]*BloodMsg, len(msgs))
+		for id, bm := range msgs {
+			s.msgs[id] = bm
+		}
+		defer func() { s.msgs = msgs }()
+	}
+
+	rp := s.retention
+	if rp.MaxPerCharacter > 0 {
+		for _, id := range s.characterIDs() {
+			pr.PerCharacter += s.deleteRanked(
+				func(bm *BloodMsg) bool {
+					return bm.CharacterID == id && bm.Legacy == 0
+				},
+				newestFirst,
+				rp.MaxPerCharacter,
+			)
+		}
+	}
+
+	if rp.LowRatedAge > 0 {
+		before := time.Now().Add(-rp.LowRatedAge)
+		for id, bm := range s.msgs {
+			if bm.Legacy == 0 && int(bm.Rating) < rp.LowRating && bm.Created.Before(before) {
+				delete(s.msgs, id)
+				pr.LowRated++
+			}
+		}
+	}
+
+	if rp.MaxPerBlock > 0 {
+		for _, blockID := range s.blockIDs() {
+			pr.PerBlock += s.deleteRanked(
+				func(bm *BloodMsg) bool {
+					return bm.BlockID == blockID && bm.Legacy == 0
+				},
+				func(a, b *BloodMsg) bool {
+					if a.Rating != b.Rating {
+						return a.Rating > b.Rating
+					}
+					return newestFirst(a, b)
+				},
+				rp.MaxPerBlock,
+			)
+		}
+	}
+
+	if !dryRun {
+		s.deleteOrphanRatings()
+	}
+
+	return pr, nil
+}
+
+// characterIDs returns the ID of every character with a non-legacy message.
+// The caller must hold the lock.
+func (s *MemoryService) characterIDs() []string {
+	seen := make(map[string]struct{})
+	ids := make([]string, 0)
+	for _, bm := range s.msgs {
+		if _, ok := seen[bm.CharacterID]; bm.Legacy == 0 && !ok {
+			seen[bm.CharacterID] = struct{}{}
+			ids = append(ids, bm.CharacterID)
+		}
+	}
+
+	return ids
+}
+
+// blockIDs returns the ID of every block with a non-legacy message. The
+// caller must hold the lock.
+func (s *MemoryService) blockIDs() []int32 {
+	seen := make(map[int32]struct{})
+	ids := make([]int32, 0)
+	for _, bm := range s.msgs {
+		if _, ok := seen[bm.BlockID]; bm.Legacy == 0 && !ok {
+			seen[bm.BlockID] = struct{}{}
+			ids = append(ids, bm.BlockID)
+		}
+	}
+
+	return ids
+}
+
+// Search returns the messages matching the given query, highest rated first.
+func (s *MemoryService) Search(_ context.Context, q Query) ([]BloodMsg, error) {
+	blocks := make(map[int32]struct{}, len(q.BlockIDs))
+	for _, id := range q.BlockIDs {
+		blocks[id] = struct{}{}
+	}
+	text := strings.ToLower(q.Text)
+
+	bms := s.filter(func(bm *BloodMsg) bool {
+		if _, ok := blocks[bm.BlockID]; len(blocks) > 0 && !ok {
+			return false
+		}
+
+		return (text == "" || strings.Contains(strings.ToLower(bm.Text), text)) &&
+			(q.CharacterID == "" || bm.CharacterID == q.CharacterID) &&
+			(q.MinRating <= 0 || int(bm.Rating) >= q.MinRating) &&
+			(q.MaxRating <= 0 || int(bm.Rating) <= q.MaxRating)
+	})
+	sort.SliceStable(bms, func(i, j int) bool {
+		if bms[i].Rating != bms[j].Rating {
+			return bms[i].Rating > bms[j].Rating
+		}
+		return bms[i].ID > bms[j].ID
+	})
+
+	if q.Offset >= len(bms) {
+		return []BloodMsg{}, nil
+	}
+	if q.Offset > 0 {
+		bms = bms[q.Offset:]
+	}
+	if limit := q.limit(); len(bms) > limit {
+		bms = bms[:limit]
+	}
+
+	return bms, nil
+}
+
+// Positions returns the position of every message within the given block.
+func (s *MemoryService) Positions(_ context.Context, blockID int32) ([]spatial.Item, error) {
+	bms := s.filter(func(bm *BloodMsg) bool {
+		return bm.BlockID == blockID
+	})
+
+	items := make([]spatial.Item, 0, len(bms))
+	for _, bm := range bms {
+		items = append(items, spatial.Item{
+			Kind:        spatial.KindMessage,
+			ID:          bm.ID,
+			CharacterID: bm.CharacterID,
+			BlockID:     bm.BlockID,
+			Point:       spatial.Point{X: bm.PosX, Y: bm.PosY, Z: bm.PosZ},
+		})
+	}
+
+	return items, nil
+}
+
+// Near returns the position of every message within radius of the center point
+// in the given block.
+func (s *MemoryService) Near(ctx context.Context, blockID int32, center spatial.Point, radius float64) ([]spatial.Item, error) {
+	items, err := s.Positions(ctx, blockID)
+	if err != nil {
+		return nil, err
+	}
+
+	return spatial.Within(items, center, radius), nil
+}
@@ -0,0 +1,117 @@
+package msg
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// memRatingCount returns the number of ledger ratings of the message with the
+// given ID.
+func memRatingCount(s *MemoryService, id uint32) (n int) {
+	for k := range s.ratings {
+		if k.id == id {
+			n++
+		}
+	}
+
+	return n
+}
+
+func TestMemoryService_Add_maxPerCharacter(t *testing.T) {
+	s := NewMemoryService(zerolog.Nop(), Retention(RetentionPolicy{MaxPerCharacter: 2}))
+
+	for i := 0; i < 3; i++ {
+		if err := s.Add(context.Background(), BloodMsg{CharacterID: "author0", BlockID: 20070}); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			if err := s.Rate(context.Background(), 1, "rater0"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	bms, err := s.Character(context.Background(), "", "author0", 20070, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bms) != 2 {
+		t.Fatalf("expected 2 messages got: %d", len(bms))
+	}
+	for _, bm := range bms {
+		if bm.ID == 1 {
+			t.Fatal("expected oldest message to be deleted")
+		}
+	}
+	if n := memRatingCount(s, 1); n != 0 {
+		t.Fatalf("expected ratings of deleted message to be deleted got: %d", n)
+	}
+
+	ar, err := s.AuthorRatings(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ar["author0"] != 1 {
+		t.Fatalf("expected author to keep ratings of deleted message got: %d", ar["author0"])
+	}
+}
+
+func TestMemoryService_Prune(t *testing.T) {
+	s := NewMemoryService(zerolog.Nop(), Retention(RetentionPolicy{
+		LowRatedAge: time.Hour,
+		LowRating:   1,
+		MaxPerBlock: 2,
+	}))
+
+	for i := 0; i < 4; i++ {
+		if err := s.Add(context.Background(), BloodMsg{
+			CharacterID: fmt.Sprintf("author%d", i),
+			BlockID:     20070,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Message 1 is old and unrated, message 2 is highly rated.
+	s.msgs[1].Created = time.Now().Add(-2 * time.Hour)
+	s.msgs[2].Rating = 5
+
+	// A ledger entry which was not counted, so message 1 is still unrated.
+	s.ratings[ratingKey{id: 1, raterID: "rater0"}] = memRating{authorID: "author0"}
+
+	exp := PruneReport{DryRun: true, LowRated: 1, PerBlock: 1}
+	pr, err := s.Prune(context.Background(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr != exp {
+		t.Fatalf("expected: %s got: %s", exp, pr)
+	}
+
+	// Dry runs must not delete anything.
+	if len(s.msgs) != 4 {
+		t.Fatalf("expected 4 messages got: %d", len(s.msgs))
+	}
+	if n := memRatingCount(s, 1); n != 1 {
+		t.Fatalf("expected dry run to keep ratings got: %d", n)
+	}
+
+	exp.DryRun = false
+	if pr, err = s.Prune(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	if pr != exp {
+		t.Fatalf("expected: %s got: %s", exp, pr)
+	}
+
+	if _, err = s.Get(context.Background(), 2); err != nil {
+		t.Fatalf("expected highly rated message to be kept: %v", err)
+	}
+	if n := memRatingCount(s, 1); n != 0 {
+		t.Fatalf("expected ratings of pruned message to be deleted got: %d", n)
+	}
+}
@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS message (
+    id INTEGER PRIMARY KEY autoincrement,
+    character_id TEXT,
+    block_id INTEGER DEFAULT 0,
+    posx REAL,
+    posy REAL,
+    posz REAL,
+    angx REAL,
+    angy REAL,
+    angz REAL,
+    msg_id INTEGER DEFAULT 0,
+    main_msg_id INTEGER DEFAULT 0,
+    add_msg_cate_id INTEGER DEFAULT 0,
+    rating INTEGER DEFAULT 0,
+    rating_base INTEGER DEFAULT 0,
+    legacy INTEGER DEFAULT 0,
+    created INTEGER DEFAULT 0,
+    text TEXT DEFAULT '',
+    region TEXT DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS message_block_character
+    ON message (block_id, legacy, character_id);
+
+CREATE INDEX IF NOT EXISTS message_block_id
+    ON message (block_id, legacy, id);
+
+CREATE INDEX IF NOT EXISTS message_block_rating
+    ON message (block_id, legacy, rating);
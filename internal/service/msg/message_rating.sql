@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS message_rating (
+    message_id INTEGER NOT NULL,
+    character_id TEXT NOT NULL,
+    author_id TEXT NOT NULL,
+    created INTEGER DEFAULT 0,
+    PRIMARY KEY (message_id, character_id)
+)
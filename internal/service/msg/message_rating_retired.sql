@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS message_rating_retired (
+    author_id TEXT PRIMARY KEY,
+    ratings INTEGER DEFAULT 0
+)
@@ -3,10 +3,12 @@ package msg
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"math"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/danmrichards/dessego/internal/service/gamestate"
 )
@@ -30,6 +32,9 @@ import (
 //   - Main message ID
 //   - Add Message Cate ID (?)
 //   - Rating
+//
+// The creation time and rendered text of the message are not part of the
+// binary format.
 type BloodMsg struct {
 	ID           uint32
 	CharacterID  string
@@ -45,8 +50,37 @@ type BloodMsg struct {
 	AddMsgCateID uint32
 	Rating       uint32
 	Legacy       uint32
+	Created      time.Time
+
+	// Text is the message rendered in English.
+	Text string
+
+	// Region is the region the message was written in. It is empty for legacy
+	// messages and messages written before regions were recorded.
+	Region string
+}
+
+// visibleIn returns true if the message is visible to players in the given
+// region. Messages without a region are visible in every region, as is every
+// message if region is empty.
+func (bm BloodMsg) visibleIn(region string) bool {
+	return region == "" || bm.Region == "" || bm.Region == region
 }
 
+// inRegion restricts the filter to messages visible to players in the given
+// region, unless region is empty.
+func inRegion(filter string, args []interface{}, region string) (string, []interface{}) {
+	if region == "" {
+		return filter, args
+	}
+
+	return filter + ` AND region IN (?, '')`, append(args, region)
+}
+
+// headerSize is the size in bytes of the fixed size fields following the
+// character ID in a binary message.
+const headerSize = 4 + 24 + 16
+
 // NewBloodMsgFromBytes returns a blood message parsed from the given byte slice.
 func NewBloodMsgFromBytes(b []byte) (bm *BloodMsg, err error) {
 	bm = &BloodMsg{
@@ -54,7 +88,7 @@ func NewBloodMsgFromBytes(b []byte) (bm *BloodMsg, err error) {
 	}
 
 	if len(b) < 4 {
-		return nil, nil
+		return nil, errors.New("message too short")
 	}
 
 	// Message ID.
@@ -62,13 +96,16 @@ func NewBloodMsgFromBytes(b []byte) (bm *BloodMsg, err error) {
 	bm.ID = binary.LittleEndian.Uint32(b[:cursor])
 
 	// Character ID.
-	for i := cursor; ; i++ {
-		c := b[i : i+1][0]
-		if c == 0x00 {
-			cursor = i + 1
-			break
-		}
-		bm.CharacterID += string(c)
+	n := bytes.IndexByte(b[cursor:], 0x00)
+	if n < 0 {
+		return nil, errors.New("unterminated character ID")
+	}
+	bm.CharacterID = string(b[cursor : cursor+n])
+	cursor += n + 1
+
+	// Block ID, positional data and metadata.
+	if len(b) < cursor+headerSize {
+		return nil, errors.New("message header too short")
 	}
 
 	// Block ID.
@@ -132,20 +169,30 @@ func (bm BloodMsg) Bytes() []byte {
 	return data.Bytes()
 }
 
-// String implements fmt.Stringer.
-func (bm BloodMsg) String() string {
+// Render returns the text of the message in the given language, with the
+// placeholder in the main message replaced by the detail message. An empty
+// string is returned if the main message is unknown, or the language is not
+// supported.
+func (bm BloodMsg) Render(lang gamestate.Language) string {
 	// Find the main/outer message.
-	mm, ok := gamestate.Messages[int(bm.MainMsgID)]
-	if ok {
-		// Find the detail/inner message.
-		m, ok := gamestate.Messages[int(bm.MsgID)]
-		if !ok {
-			m = strconv.Itoa(int(bm.MsgID))
-		}
+	mm, ok := gamestate.Message(lang, int(bm.MainMsgID))
+	if !ok {
+		return ""
+	}
 
-		// Replace the placeholder with details.
-		mm = strings.Replace(mm, "***", m, -1)
+	// Find the detail/inner message.
+	m, ok := gamestate.Message(lang, int(bm.MsgID))
+	if !ok {
+		m = strconv.Itoa(int(bm.MsgID))
+	}
+
+	// Replace the placeholder with details.
+	return strings.Replace(mm, "***", m, -1)
+}
 
+// String implements fmt.Stringer.
+func (bm BloodMsg) String() string {
+	if mm := bm.Render(gamestate.English); mm != "" {
 		return fmt.Sprintf(
 			"id: %d block: %q character: %q message: %q rating: %d",
 			bm.ID,
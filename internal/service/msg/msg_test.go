@@ -3,6 +3,8 @@ package msg
 import (
 	"reflect"
 	"testing"
+
+	"github.com/danmrichards/dessego/internal/service/gamestate"
 )
 
 func TestNewBloodMsgFromBytes(t *testing.T) {
@@ -32,3 +34,44 @@ func TestNewBloodMsgFromBytes(t *testing.T) {
 		t.Fatalf("expected: %+v\ngot: %+v", exp, bm)
 	}
 }
+
+func TestBloodMsg_Render(t *testing.T) {
+	tcs := []struct {
+		name string
+		bm   BloodMsg
+		lang gamestate.Language
+		exp  string
+	}{
+		{
+			name: "placeholder",
+			bm:   BloodMsg{MainMsgID: 10010, MsgID: 14001},
+			lang: gamestate.English,
+			exp:  "Beware of Watch out. ahead.",
+		},
+		{
+			name: "unknown detail",
+			bm:   BloodMsg{MainMsgID: 10010, MsgID: 1},
+			lang: gamestate.English,
+			exp:  "Beware of 1 ahead.",
+		},
+		{
+			name: "unknown main",
+			bm:   BloodMsg{MainMsgID: 1},
+			lang: gamestate.English,
+			exp:  "",
+		},
+		{
+			name: "unsupported language",
+			bm:   BloodMsg{MainMsgID: 14001},
+			lang: gamestate.Language("ko"),
+			exp:  "",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if m := tc.bm.Render(tc.lang); m != tc.exp {
+				t.Fatalf("expected: %q got: %q", tc.exp, m)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package msg
+
+import "time"
+
+// Option is a functional option that configures a messages service.
+type Option func(*options)
+
+// options are the settings shared by the messages services.
+type options struct {
+	// Maximum number of ratings a character may give within the rating
+	// window. Zero means unlimited.
+	ratingLimit  int
+	ratingWindow time.Duration
+
+	retention RetentionPolicy
+	strategy  Strategy
+}
+
+// newOptions returns the default options with opts applied.
+func newOptions(opts []Option) options {
+	o := options{strategy: DefaultStrategy}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
+
+// RatingLimit configures the service to allow each character to give at most
+// n ratings within the given window.
+func RatingLimit(n int, window time.Duration) Option {
+	return func(o *options) {
+		o.ratingLimit = n
+		o.ratingWindow = window
+	}
+}
+
+// Retention configures the service to delete messages according to the given
+// retention policy.
+func Retention(p RetentionPolicy) Option {
+	return func(o *options) {
+		o.retention = p
+	}
+}
+
+// Selection configures the service to select messages using the given
+// strategy.
+func Selection(st Strategy) Option {
+	return func(o *options) {
+		o.strategy = st
+	}
+}
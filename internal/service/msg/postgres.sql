@@ -0,0 +1,46 @@
+CREATE TABLE IF NOT EXISTS message (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    character_id TEXT,
+    block_id INTEGER DEFAULT 0,
+    posx REAL,
+    posy REAL,
+    posz REAL,
+    angx REAL,
+    angy REAL,
+    angz REAL,
+    msg_id INTEGER DEFAULT 0,
+    main_msg_id INTEGER DEFAULT 0,
+    add_msg_cate_id INTEGER DEFAULT 0,
+    rating INTEGER DEFAULT 0,
+    rating_base INTEGER DEFAULT 0,
+    legacy INTEGER DEFAULT 0,
+    created BIGINT DEFAULT 0,
+    text TEXT DEFAULT '',
+    region TEXT DEFAULT ''
+);
+
+ALTER TABLE message ADD COLUMN IF NOT EXISTS region TEXT DEFAULT '';
+
+ALTER TABLE message ADD COLUMN IF NOT EXISTS rating_base INTEGER;
+
+CREATE INDEX IF NOT EXISTS message_block_character
+    ON message (block_id, legacy, character_id);
+
+CREATE INDEX IF NOT EXISTS message_block_id
+    ON message (block_id, legacy, id);
+
+CREATE INDEX IF NOT EXISTS message_block_rating
+    ON message (block_id, legacy, rating);
+
+CREATE TABLE IF NOT EXISTS message_rating (
+    message_id BIGINT NOT NULL,
+    character_id TEXT NOT NULL,
+    author_id TEXT NOT NULL,
+    created BIGINT DEFAULT 0,
+    PRIMARY KEY (message_id, character_id)
+);
+
+CREATE TABLE IF NOT EXISTS message_rating_retired (
+    author_id TEXT PRIMARY KEY,
+    ratings BIGINT DEFAULT 0
+);
@@ -0,0 +1,175 @@
+package msg
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// RetentionPolicy determines how long non-legacy messages are kept for. Zero
+// values disable the corresponding rule.
+type RetentionPolicy struct {
+	// MaxPerCharacter is the maximum number of active messages per character.
+	// The oldest messages beyond this limit are deleted.
+	MaxPerCharacter int
+
+	// LowRatedAge is the age after which messages rated below LowRating are
+	// deleted.
+	LowRatedAge time.Duration
+
+	// LowRating is the rating below which a message is considered low rated.
+	LowRating int
+
+	// MaxPerBlock is the maximum number of messages per block. The lowest
+	// rated, then oldest, messages beyond this limit are deleted.
+	MaxPerBlock int
+}
+
+// PruneReport details the number of messages deleted by each rule of the
+// retention policy.
+type PruneReport struct {
+	DryRun       bool
+	PerCharacter int64
+	LowRated     int64
+	PerBlock     int64
+}
+
+// Total returns the total number of messages deleted.
+func (p PruneReport) Total() int64 {
+	return p.PerCharacter + p.LowRated + p.PerBlock
+}
+
+// String implements fmt.Stringer.
+func (p PruneReport) String() string {
+	return fmt.Sprintf(
+		"dry run: %t per character: %d low rated: %d per block: %d total: %d",
+		p.DryRun, p.PerCharacter, p.LowRated, p.PerBlock, p.Total(),
+	)
+}
+
+// Prune deletes messages according to the retention policy of the service.
+//
+// If dryRun is true, the deletions are rolled back and the report details the
+// messages which would have been deleted.
+func (s *sqlService) Prune(ctx context.Context, dryRun bool) (pr PruneReport, err error) {
+	pr.DryRun = dryRun
+
+	var tx *sql.Tx
+	tx, err = s.c.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return pr, fmt.Errorf("db tx: %w", err)
+	}
+	defer func() {
+		if err != nil || dryRun {
+			tx.Rollback()
+		}
+	}()
+
+	rp := s.retention
+	if rp.MaxPerCharacter > 0 {
+		pr.PerCharacter, err = s.deleteMsgs(
+			ctx, tx,
+			`SELECT id FROM (
+				SELECT id, row_number() OVER (
+					PARTITION BY character_id
+					ORDER BY created DESC, id DESC
+				) AS n
+				FROM message
+				WHERE legacy = 0
+			) AS ranked
+			WHERE n > ?`,
+			rp.MaxPerCharacter,
+		)
+		if err != nil {
+			return pr, fmt.Errorf("prune per character: %w", err)
+		}
+	}
+
+	if rp.LowRatedAge > 0 {
+		pr.LowRated, err = s.deleteMsgs(
+			ctx, tx,
+			`SELECT id
+			FROM message
+			WHERE legacy = 0
+			AND rating < ?
+			AND created < ?`,
+			rp.LowRating, time.Now().Add(-rp.LowRatedAge).Unix(),
+		)
+		if err != nil {
+			return pr, fmt.Errorf("prune low rated: %w", err)
+		}
+	}
+
+	if rp.MaxPerBlock > 0 {
+		pr.PerBlock, err = s.deleteMsgs(
+			ctx, tx,
+			`SELECT id FROM (
+				SELECT id, row_number() OVER (
+					PARTITION BY block_id
+					ORDER BY rating DESC, created DESC, id DESC
+				) AS n
+				FROM message
+				WHERE legacy = 0
+			) AS ranked
+			WHERE n > ?`,
+			rp.MaxPerBlock,
+		)
+		if err != nil {
+			return pr, fmt.Errorf("prune per block: %w", err)
+		}
+	}
+
+	if dryRun {
+		return pr, nil
+	}
+
+	return pr, tx.Commit()
+}
+
+// deleteMsgs deletes the messages with the IDs selected by the given query,
+// retiring their ratings, and returns the number of messages deleted.
+func (s *sqlService) deleteMsgs(ctx context.Context, tx *sql.Tx, ids string, args ...interface{}) (int64, error) {
+	if err := s.retireRatings(
+		ctx, tx, `message_id IN (`+ids+`)`, args...,
+	); err != nil {
+		return 0, err
+	}
+
+	res, err := tx.ExecContext(
+		ctx, s.c.Rebind(`DELETE FROM message WHERE id IN (`+ids+`)`), args...,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// retireRatings deletes the ratings matching the where clause from the rating
+// ledger, adding them to the retired ratings of their authors. Authors keep
+// the ratings of their deleted messages when message ratings are recounted,
+// as the game never takes them away.
+func (s *sqlService) retireRatings(ctx context.Context, tx *sql.Tx, where string, args ...interface{}) error {
+	if _, err := tx.ExecContext(
+		ctx,
+		s.c.Rebind(`INSERT INTO message_rating_retired (author_id, ratings)
+		SELECT author_id, count(*)
+		FROM message_rating
+		WHERE `+where+`
+		GROUP BY author_id
+		ON CONFLICT (author_id) DO UPDATE
+		SET ratings = message_rating_retired.ratings + excluded.ratings`),
+		args...,
+	); err != nil {
+		return fmt.Errorf("retire ratings: %w", err)
+	}
+
+	if _, err := tx.ExecContext(
+		ctx, s.c.Rebind(`DELETE FROM message_rating WHERE `+where), args...,
+	); err != nil {
+		return fmt.Errorf("delete ratings: %w", err)
+	}
+
+	return nil
+}
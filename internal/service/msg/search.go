@@ -0,0 +1,126 @@
+package msg
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const (
+	// defaultSearchLimit is the number of messages returned by a search if no
+	// limit is given.
+	defaultSearchLimit = 100
+
+	// maxSearchLimit is the maximum number of messages returned by a search.
+	maxSearchLimit = 1000
+)
+
+// Query is a set of criteria to search messages with. Zero values match any
+// message.
+type Query struct {
+	// BlockIDs restricts the search to messages within any of the blocks.
+	BlockIDs []int32
+
+	// Text restricts the search to messages with rendered English text
+	// containing the given text, ignoring case.
+	Text string
+
+	// CharacterID restricts the search to messages from the given character.
+	CharacterID string
+
+	// MinRating restricts the search to messages rated at least MinRating.
+	MinRating int
+
+	// MaxRating restricts the search to messages rated at most MaxRating. Zero
+	// means there is no maximum.
+	MaxRating int
+
+	// Limit is the maximum number of messages to return.
+	Limit int
+
+	// Offset is the number of matching messages to skip.
+	Offset int
+}
+
+// Search returns the messages matching the given query, highest rated first.
+func (s *sqlService) Search(ctx context.Context, q Query) ([]BloodMsg, error) {
+	clauses, args := q.clauses()
+
+	// Searches vary too much to be worth caching the prepared statement.
+	rows, err := s.c.Reader.QueryContext(
+		ctx,
+		s.c.Rebind(`SELECT `+msgColumns+` FROM message `+clauses), args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("search messages: %w", err)
+	}
+
+	bms, err := scanMsgs(rows, nil)
+	if err != nil {
+		return nil, fmt.Errorf("search messages: %w", err)
+	}
+
+	return bms, nil
+}
+
+// clauses returns the query clauses and arguments selecting the messages
+// matching q, highest rated first.
+func (q Query) clauses() (string, []interface{}) {
+	var (
+		where = make([]string, 0, 5)
+		args  = make([]interface{}, 0, 8)
+	)
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "?"
+	}
+
+	if len(q.BlockIDs) > 0 {
+		ph := make([]string, len(q.BlockIDs))
+		for i, id := range q.BlockIDs {
+			ph[i] = arg(id)
+		}
+		where = append(where, "block_id IN ("+strings.Join(ph, ",")+")")
+	}
+	if q.Text != "" {
+		// LIKE ignores case in SQLite but not PostgreSQL.
+		pattern := arg("%" + escapeLike(q.Text) + "%")
+		where = append(where, "lower(text) LIKE lower("+pattern+`) ESCAPE '\'`)
+	}
+	if q.CharacterID != "" {
+		where = append(where, "character_id = "+arg(q.CharacterID))
+	}
+	if q.MinRating > 0 {
+		where = append(where, "rating >= "+arg(q.MinRating))
+	}
+	if q.MaxRating > 0 {
+		where = append(where, "rating <= "+arg(q.MaxRating))
+	}
+
+	var clauses strings.Builder
+	if len(where) > 0 {
+		clauses.WriteString("WHERE " + strings.Join(where, " AND ") + " ")
+	}
+	clauses.WriteString(
+		"ORDER BY rating DESC, id DESC LIMIT " + arg(q.limit()) + " OFFSET " + arg(q.Offset),
+	)
+
+	return clauses.String(), args
+}
+
+// limit returns the maximum number of messages to return for the query.
+func (q Query) limit() int {
+	switch {
+	case q.Limit <= 0:
+		return defaultSearchLimit
+	case q.Limit > maxSearchLimit:
+		return maxSearchLimit
+	default:
+		return q.Limit
+	}
+}
+
+// escapeLike escapes the wildcard characters in a LIKE pattern.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
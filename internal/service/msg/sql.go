@@ -0,0 +1,549 @@
+package msg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/danmrichards/dessego/internal/database"
+	"github.com/danmrichards/dessego/internal/service/gamestate"
+	"github.com/rs/zerolog"
+)
+
+// msgColumns is the list of message columns scanned by scanMsg.
+const msgColumns = `id,
+	character_id,
+	block_id,
+	posx,
+	posy,
+	posz,
+	angx,
+	angy,
+	angz,
+	msg_id,
+	main_msg_id,
+	add_msg_cate_id,
+	rating,
+	legacy,
+	created,
+	text,
+	region`
+
+// candidateFactor is the size of each pool of candidate messages, relative to
+// the number of messages requested.
+const candidateFactor = 4
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// sqlService implements the messages service for both SQLite and PostgreSQL,
+// so the two cannot drift apart. Queries are written in the SQL common to
+// both, with ? placeholders rebound for the dialect of the database.
+type sqlService struct {
+	c *database.Conn
+	l zerolog.Logger
+
+	options
+}
+
+// Character returns n messages for the given character and within the given
+// block ID, visible in the given region. Messages from every region are
+// returned if region is empty.
+func (s *sqlService) Character(ctx context.Context, region, playerID string, blockID int32, n int) ([]BloodMsg, error) {
+	filter, args := inRegion(
+		`block_id = ? AND legacy = 0 AND character_id = ?`,
+		[]interface{}{blockID, playerID}, region,
+	)
+	return s.selectMsgs(ctx, n, filter, args...)
+}
+
+// NonCharacter returns n messages for anyone other than the given character and
+// within the given block ID, visible in the given region. Messages from every
+// region are returned if region is empty.
+func (s *sqlService) NonCharacter(ctx context.Context, region, playerID string, blockID int32, n int) ([]BloodMsg, error) {
+	filter, args := inRegion(
+		`block_id = ? AND legacy = 0 AND character_id != ?`,
+		[]interface{}{blockID, playerID}, region,
+	)
+	return s.selectMsgs(ctx, n, filter, args...)
+}
+
+// Legacy returns n legacy messages within the given block ID.
+func (s *sqlService) Legacy(ctx context.Context, blockID int32, n int) ([]BloodMsg, error) {
+	return s.selectMsgs(ctx, n, `block_id = ? AND legacy = 1`, blockID)
+}
+
+// selectMsgs returns n messages matching the given filter, chosen by the
+// selection strategy of the service.
+//
+// Rather than ordering every matching message randomly, the strategy chooses
+// from bounded pools of candidates: the freshest, the top rated and a window
+// of messages starting from a random ID.
+func (s *sqlService) selectMsgs(ctx context.Context, n int, filter string, args ...interface{}) ([]BloodMsg, error) {
+	if n <= 0 {
+		return []BloodMsg{}, nil
+	}
+	k := n * candidateFactor
+
+	var (
+		c   Candidates
+		err error
+	)
+
+	c.Fresh, err = s.queryMsgs(
+		ctx,
+		`WHERE `+filter+` ORDER BY id DESC LIMIT ?`, append(args, k)...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("fresh candidates: %w", err)
+	}
+	if len(c.Fresh) < k {
+		// Every matching message is a candidate already.
+		return s.strategy.Select(c, n), nil
+	}
+
+	c.Top, err = s.queryMsgs(
+		ctx,
+		`WHERE `+filter+` ORDER BY rating DESC, id DESC LIMIT ?`,
+		append(args, k)...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("top candidates: %w", err)
+	}
+
+	c.Sample, err = s.sampleMsgs(ctx, k, filter, args...)
+	if err != nil {
+		return nil, fmt.Errorf("sample candidates: %w", err)
+	}
+
+	return s.strategy.Select(c, n), nil
+}
+
+// sampleMsgs returns a window of n messages matching the given filter, in ID
+// order, starting from a random ID and wrapping around to the lowest ID.
+func (s *sqlService) sampleMsgs(ctx context.Context, n int, filter string, args ...interface{}) ([]BloodMsg, error) {
+	// Separate sub-queries, as SQLite only uses the index to find the minimum
+	// or maximum when it is the only aggregate.
+	stmt, err := s.c.PrepareRead(
+		`SELECT
+			(SELECT min(id) FROM message WHERE ` + filter + `),
+			(SELECT max(id) FROM message WHERE ` + filter + `)`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("prepare select: %w", err)
+	}
+
+	var minID, maxID sql.NullInt64
+	if err = stmt.QueryRowContext(
+		ctx,
+		append(args, args...)...,
+	).Scan(&minID, &maxID); err != nil {
+		return nil, fmt.Errorf("query id range: %w", err)
+	}
+	if !minID.Valid || !maxID.Valid {
+		return []BloodMsg{}, nil
+	}
+
+	pivot := minID.Int64 + rand.Int63n(maxID.Int64-minID.Int64+1)
+
+	bms, err := s.queryMsgs(
+		ctx,
+		`WHERE `+filter+` AND id >= ? ORDER BY id LIMIT ?`,
+		append(args, pivot, n)...,
+	)
+	if err != nil || len(bms) == n {
+		return bms, err
+	}
+
+	wrapped, err := s.queryMsgs(
+		ctx,
+		`WHERE `+filter+` AND id < ? ORDER BY id LIMIT ?`,
+		append(args, pivot, n-len(bms))...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(bms, wrapped...), nil
+}
+
+// queryMsgs returns the messages selected by the given query clauses.
+//
+// The clauses must be one of a fixed set, as the query is cached.
+func (s *sqlService) queryMsgs(ctx context.Context, clauses string, args ...interface{}) ([]BloodMsg, error) {
+	stmt, err := s.c.PrepareRead(
+		`SELECT ` + msgColumns + ` FROM message ` + clauses,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("prepare select: %w", err)
+	}
+
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query rows: %w", err)
+	}
+
+	return scanMsgs(rows, nil)
+}
+
+// Add adds a new message.
+//
+// If the retention policy limits the number of messages per character, the
+// oldest messages for the character beyond that limit are deleted.
+func (s *sqlService) Add(ctx context.Context, bm BloodMsg) (err error) {
+	var tx *sql.Tx
+	tx, err = s.c.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("db tx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(
+		ctx,
+		s.c.Rebind(`INSERT INTO message (
+			character_id,
+			block_id,
+			posx,
+			posy,
+			posz,
+			angx,
+			angy,
+			angz,
+			msg_id,
+			main_msg_id,
+			add_msg_cate_id,
+			created,
+			text,
+			region
+		) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?)`),
+		bm.CharacterID,
+		bm.BlockID,
+		bm.PosX,
+		bm.PosY,
+		bm.PosZ,
+		bm.AngX,
+		bm.AngY,
+		bm.AngZ,
+		bm.MsgID,
+		bm.MainMsgID,
+		bm.AddMsgCateID,
+		time.Now().Unix(),
+		bm.Render(gamestate.English),
+		bm.Region,
+	); err != nil {
+		return fmt.Errorf("add message: %w", err)
+	}
+
+	if s.retention.MaxPerCharacter > 0 {
+		var n int64
+		n, err = s.deleteMsgs(
+			ctx, tx,
+			`SELECT id FROM (
+				SELECT id, row_number() OVER (
+					ORDER BY created DESC, id DESC
+				) AS n
+				FROM message
+				WHERE character_id = ?
+				AND legacy = 0
+			) AS ranked
+			WHERE n > ?`,
+			bm.CharacterID, s.retention.MaxPerCharacter,
+		)
+		if err != nil {
+			return fmt.Errorf("delete oldest messages: %w", err)
+		}
+		if n > 0 {
+			s.l.Debug().Msgf(
+				"deleted %d oldest messages for character: %q",
+				n, bm.CharacterID,
+			)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Delete deletes the message with the given ID, along with its ratings.
+func (s *sqlService) Delete(ctx context.Context, id int) (err error) {
+	var tx *sql.Tx
+	tx, err = s.c.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("db tx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err = s.retireRatings(ctx, tx, `message_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(
+		ctx, s.c.Rebind(`DELETE FROM message WHERE id = ?`), id,
+	); err != nil {
+		return fmt.Errorf("delete message: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// Get returns the message with the given ID.
+func (s *sqlService) Get(ctx context.Context, id int) (*BloodMsg, error) {
+	stmt, err := s.c.PrepareRead(
+		`SELECT ` + msgColumns + ` FROM message WHERE id = ?`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("prepare select: %w", err)
+	}
+
+	bm := &BloodMsg{}
+	switch err = scanMsg(stmt.QueryRowContext(ctx, id), bm); {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, ErrNotFound
+	case err != nil:
+		return nil, fmt.Errorf("query row: %w", err)
+	}
+
+	return bm, nil
+}
+
+// Rate records a rating for the message with the given ID by the character
+// with the given rater ID.
+//
+// Each character may only rate a given message once and may not rate their
+// own messages. The returned error will be one of SelfRatingError,
+// DuplicateRatingError or RatingLimitError if the rating was rejected.
+func (s *sqlService) Rate(ctx context.Context, id int, raterID string) (err error) {
+	var tx *sql.Tx
+	tx, err = s.c.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("db tx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var authorID string
+	switch err = tx.QueryRowContext(
+		ctx,
+		s.c.Rebind(`SELECT character_id FROM message WHERE id = ?`), id,
+	).Scan(&authorID); {
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrNotFound
+	case err != nil:
+		return fmt.Errorf("query author: %w", err)
+	}
+	if authorID == raterID {
+		return SelfRatingError{ID: id, CharacterID: raterID}
+	}
+
+	// Check for a duplicate before the limit, so a repeated rating is not
+	// reported as exceeding it.
+	var rated int
+	if err = tx.QueryRowContext(
+		ctx,
+		s.c.Rebind(`SELECT count(*)
+		FROM message_rating
+		WHERE message_id = ?
+		AND character_id = ?`),
+		id, raterID,
+	).Scan(&rated); err != nil {
+		return fmt.Errorf("query rating: %w", err)
+	}
+	if rated > 0 {
+		return DuplicateRatingError{ID: id, CharacterID: raterID}
+	}
+
+	now := time.Now()
+	if s.ratingLimit > 0 {
+		var n int
+		if err = tx.QueryRowContext(
+			ctx,
+			s.c.Rebind(`SELECT count(*)
+			FROM message_rating
+			WHERE character_id = ?
+			AND created > ?`),
+			raterID, now.Add(-s.ratingWindow).Unix(),
+		).Scan(&n); err != nil {
+			return fmt.Errorf("query rating count: %w", err)
+		}
+		if n >= s.ratingLimit {
+			return RatingLimitError(raterID)
+		}
+	}
+
+	var res sql.Result
+	res, err = tx.ExecContext(
+		ctx,
+		s.c.Rebind(`INSERT INTO message_rating (
+			message_id,
+			character_id,
+			author_id,
+			created
+		) VALUES (?,?,?,?)
+		ON CONFLICT DO NOTHING`),
+		id, raterID, authorID, now.Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("add rating: %w", err)
+	}
+
+	var n int64
+	if n, err = res.RowsAffected(); err != nil {
+		return fmt.Errorf("rows affected: %w", err)
+	} else if n == 0 {
+		return DuplicateRatingError{ID: id, CharacterID: raterID}
+	}
+
+	if _, err = tx.ExecContext(
+		ctx,
+		s.c.Rebind(`UPDATE message SET rating = rating + 1 WHERE id = ?`), id,
+	); err != nil {
+		return fmt.Errorf("update message rating: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// ledgerCount selects the number of ratings of a message in the rating ledger.
+const ledgerCount = `SELECT count(*)
+	FROM message_rating
+	WHERE message_rating.message_id = message.id`
+
+// RecountRatings rebuilds the rating of every non-legacy message from the
+// rating ledger, on top of the ratings it was given before the ledger existed.
+//
+// Messages migrated or imported with an unknown baseline have it set to the
+// ratings they have beyond the ledger, the first time they are recounted.
+func (s *sqlService) RecountRatings(ctx context.Context) (err error) {
+	var tx *sql.Tx
+	tx, err = s.c.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("db tx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(
+		ctx,
+		`UPDATE message
+		SET rating_base = CASE
+			WHEN rating > (`+ledgerCount+`) THEN rating - (`+ledgerCount+`)
+			ELSE 0
+		END
+		WHERE rating_base IS NULL`,
+	); err != nil {
+		return fmt.Errorf("set rating base: %w", err)
+	}
+
+	if _, err = tx.ExecContext(
+		ctx,
+		`UPDATE message
+		SET rating = rating_base + (`+ledgerCount+`)
+		WHERE legacy = 0`,
+	); err != nil {
+		return fmt.Errorf("recount message ratings: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// AuthorRatings returns the number of ratings received by each message author,
+// according to the rating ledger, including the retired ratings of deleted
+// messages.
+func (s *sqlService) AuthorRatings(ctx context.Context) (map[string]int, error) {
+	rows, err := s.c.Reader.QueryContext(
+		ctx,
+		`SELECT author_id, sum(ratings)
+		FROM (
+			SELECT author_id, count(*) AS ratings
+			FROM message_rating
+			GROUP BY author_id
+			UNION ALL
+			SELECT author_id, ratings
+			FROM message_rating_retired
+		) AS author_ratings
+		GROUP BY author_id`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query rows: %w", err)
+	}
+	defer rows.Close()
+
+	ar := make(map[string]int)
+	for rows.Next() {
+		var (
+			id string
+			n  int
+		)
+		if err = rows.Scan(&id, &n); err != nil {
+			return nil, fmt.Errorf("scan row: %w", err)
+		}
+		ar[id] = n
+	}
+
+	return ar, rows.Err()
+}
+
+// scanMsg scans a row selected using msgColumns into bm.
+func scanMsg(row scanner, bm *BloodMsg) error {
+	var created int64
+	if err := row.Scan(
+		&bm.ID,
+		&bm.CharacterID,
+		&bm.BlockID,
+		&bm.PosX,
+		&bm.PosY,
+		&bm.PosZ,
+		&bm.AngX,
+		&bm.AngY,
+		&bm.AngZ,
+		&bm.MsgID,
+		&bm.MainMsgID,
+		&bm.AddMsgCateID,
+		&bm.Rating,
+		&bm.Legacy,
+		&created,
+		&bm.Text,
+		&bm.Region,
+	); err != nil {
+		return err
+	}
+
+	// Legacy messages have no creation time.
+	if created > 0 {
+		bm.Created = time.Unix(created, 0)
+	}
+
+	return nil
+}
+
+// scanMsgs scans every row selected using msgColumns, appending them to bms.
+func scanMsgs(rows *sql.Rows, bms []BloodMsg) ([]BloodMsg, error) {
+	defer rows.Close()
+
+	for rows.Next() {
+		var bm BloodMsg
+		if err := scanMsg(rows, &bm); err != nil {
+			return nil, fmt.Errorf("scan row: %w", err)
+		}
+
+		bms = append(bms, bm)
+	}
+
+	return bms, rows.Err()
+}
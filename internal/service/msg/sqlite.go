@@ -1,48 +1,37 @@
 package msg
 
 import (
-	"bufio"
 	"context"
 	"database/sql"
-	"encoding/binary"
 	"fmt"
-	"io"
 	"io/ioutil"
-	"os"
+	"time"
 
+	"github.com/danmrichards/dessego/internal/database"
+	"github.com/danmrichards/dessego/internal/service/gamestate"
 	"github.com/rs/zerolog"
 )
 
 type sqlPreparer interface {
-	Prepare(query string) (*sql.Stmt, error)
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
 }
 
-// Option is a functional option that configures the SQLite service.
-type Option func(*SQLiteService)
-
 // SQLiteService is a msg service backed by a SQLite database.
 type SQLiteService struct {
-	db   *sql.DB
-	l    zerolog.Logger
-	seed bool
-}
+	db *database.DB
 
-// Seed configures the service to seed the database on startup.
-func Seed() Option {
-	return func(s *SQLiteService) {
-		s.seed = true
-	}
+	sqlService
 }
 
 // NewSQLiteService returns an initialised SQLite messages service.
-func NewSQLiteService(db *sql.DB, l zerolog.Logger, opts ...Option) (*SQLiteService, error) {
+func NewSQLiteService(db *database.DB, l zerolog.Logger, opts ...Option) (*SQLiteService, error) {
 	s := &SQLiteService{
 		db: db,
-		l:  l,
-	}
-
-	for _, o := range opts {
-		o(s)
+		sqlService: sqlService{
+			c:       database.SQLiteConn(db),
+			l:       l,
+			options: newOptions(opts),
+		},
 	}
 
 	if err := s.init(); err != nil {
@@ -52,348 +41,147 @@ func NewSQLiteService(db *sql.DB, l zerolog.Logger, opts ...Option) (*SQLiteServ
 	return s, nil
 }
 
-// Character returns n messages for the given character and within the given
-// block ID.
-func (s *SQLiteService) Character(playerID string, blockID int32, n int) (bms []BloodMsg, err error) {
-	bms = make([]BloodMsg, 0, n)
-
-	var stmt *sql.Stmt
-	stmt, err = s.db.Prepare(
-		`SELECT *
-		FROM message 
-		WHERE character_id = ?
-		AND block_id = ?
-		AND legacy = ?
-		ORDER BY random()
-		LIMIT ?`,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("prepare select: %w", err)
-	}
-
-	var rows *sql.Rows
-	rows, err = stmt.Query(playerID, blockID, 0, n)
-	if err != nil {
-		return nil, fmt.Errorf("query rows: %w", err)
-	}
-
-	for rows.Next() {
-		var bm BloodMsg
-		if err = rows.Scan(
-			&bm.ID,
-			&bm.CharacterID,
-			&bm.BlockID,
-			&bm.PosX,
-			&bm.PosY,
-			&bm.PosZ,
-			&bm.AngX,
-			&bm.AngY,
-			&bm.AngZ,
-			&bm.MsgID,
-			&bm.MainMsgID,
-			&bm.AddMsgCateID,
-			&bm.Rating,
-			&bm.Legacy,
-		); err != nil {
-			return nil, fmt.Errorf("scan row: %w", err)
+// init initialises the database tables required by this service.
+func (s *SQLiteService) init() error {
+	for _, t := range []string{"message", "message_rating", "message_rating_retired"} {
+		if err := s.initTable(t); err != nil {
+			return err
 		}
+	}
 
-		bms = append(bms, bm)
+	if err := s.migrate(); err != nil {
+		return fmt.Errorf("migrate: %w", err)
 	}
 
-	return bms, nil
+	return nil
 }
 
-// NonCharacter returns n messages for anyone other than the given character and
-// within the given block ID.
-func (s *SQLiteService) NonCharacter(playerID string, blockID int32, n int) (bms []BloodMsg, err error) {
-	bms = make([]BloodMsg, 0, n)
-
-	var stmt *sql.Stmt
-	stmt, err = s.db.Prepare(
-		`SELECT *
-		FROM message 
-		WHERE character_id != ?
-		AND block_id = ?
-		AND legacy = ?
-		ORDER BY random()
-		LIMIT ?`,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("prepare select: %w", err)
-	}
-
-	var rows *sql.Rows
-	rows, err = stmt.Query(playerID, blockID, 0, n)
+// initTable creates the given database table required by this service.
+func (s *SQLiteService) initTable(table string) error {
+	ddl, err := ioutil.ReadFile("internal/service/msg/" + table + ".sql")
 	if err != nil {
-		return nil, fmt.Errorf("query rows: %w", err)
+		return fmt.Errorf("read DDL: %w", err)
 	}
 
-	for rows.Next() {
-		var bm BloodMsg
-		if err = rows.Scan(
-			&bm.ID,
-			&bm.CharacterID,
-			&bm.BlockID,
-			&bm.PosX,
-			&bm.PosY,
-			&bm.PosZ,
-			&bm.AngX,
-			&bm.AngY,
-			&bm.AngZ,
-			&bm.MsgID,
-			&bm.MainMsgID,
-			&bm.AddMsgCateID,
-			&bm.Rating,
-			&bm.Legacy,
-		); err != nil {
-			return nil, fmt.Errorf("scan row: %w", err)
-		}
-
-		bms = append(bms, bm)
+	// Exec rather than prepare, as the DDL may contain multiple statements.
+	if _, err = s.db.Writer.Exec(string(ddl)); err != nil {
+		return fmt.Errorf("init table: %w", err)
 	}
 
-	return bms, nil
+	return nil
 }
 
-// Legacy returns n legacy messages within the given block ID.
-func (s *SQLiteService) Legacy(blockID int32, n int) (bms []BloodMsg, err error) {
-	bms = make([]BloodMsg, 0, n)
-
-	var stmt *sql.Stmt
-	stmt, err = s.db.Prepare(
-		`SELECT *
-		FROM message 
-		WHERE block_id = ?
-		AND legacy = ?
-		ORDER BY random()
-		LIMIT ?`,
+// migrate adds any columns missing from tables created by older versions of
+// this service.
+func (s *SQLiteService) migrate() error {
+	added, err := database.EnsureColumn(
+		s.db.Writer, "message", "created", "INTEGER DEFAULT 0",
 	)
 	if err != nil {
-		return nil, fmt.Errorf("prepare select: %w", err)
-	}
-
-	var rows *sql.Rows
-	rows, err = stmt.Query(blockID, 1, n)
-	if err != nil {
-		return nil, fmt.Errorf("query rows: %w", err)
+		return err
 	}
-
-	for rows.Next() {
-		var bm BloodMsg
-		if err = rows.Scan(
-			&bm.ID,
-			&bm.CharacterID,
-			&bm.BlockID,
-			&bm.PosX,
-			&bm.PosY,
-			&bm.PosZ,
-			&bm.AngX,
-			&bm.AngY,
-			&bm.AngZ,
-			&bm.MsgID,
-			&bm.MainMsgID,
-			&bm.AddMsgCateID,
-			&bm.Rating,
-			&bm.Legacy,
+	if added {
+		// Existing messages have no creation time, treat them as new so they
+		// are not immediately removed by the retention policy.
+		if _, err = s.db.Writer.Exec(
+			`UPDATE message SET created = ? WHERE legacy = 0`, time.Now().Unix(),
 		); err != nil {
-			return nil, fmt.Errorf("scan row: %w", err)
+			return fmt.Errorf("backfill created: %w", err)
 		}
-
-		bms = append(bms, bm)
-	}
-
-	return bms, nil
-}
-
-// Add adds a new message.
-func (s *SQLiteService) Add(bm BloodMsg) error {
-	stmt, err := s.db.Prepare(
-		`INSERT OR IGNORE INTO message (
-			character_id,
-			block_id,
-			posx,
-			posy,
-			posz,
-			angx,
-			angy,
-			angz,
-			msg_id,
-			main_msg_id,
-			add_msg_cate_id
-		) VALUES (?,?,?,?,?,?,?,?,?,?,?)`,
-	)
-	if err != nil {
-		return fmt.Errorf("prepare insert: %w", err)
 	}
 
-	if _, err = stmt.Exec(
-		bm.CharacterID,
-		bm.BlockID,
-		bm.PosX,
-		bm.PosY,
-		bm.PosZ,
-		bm.AngX,
-		bm.AngY,
-		bm.AngZ,
-		bm.MsgID,
-		bm.MainMsgID,
-		bm.AddMsgCateID,
+	// Existing messages have no region, so are visible in every region. The
+	// column is added before the text is rendered, which reads every column.
+	if _, err = database.EnsureColumn(
+		s.db.Writer, "message", "region", "TEXT DEFAULT ''",
 	); err != nil {
-		return fmt.Errorf("add message: %w", err)
+		return err
 	}
 
-	return nil
-}
-
-// Delete deletes the message with the given ID.
-func (s *SQLiteService) Delete(id int) error {
-	stmt, err := s.db.Prepare(
-		`DELETE FROM message WHERE id = ?`,
+	added, err = database.EnsureColumn(
+		s.db.Writer, "message", "text", "TEXT DEFAULT ''",
 	)
 	if err != nil {
-		return fmt.Errorf("prepare query: %w", err)
+		return err
 	}
-
-	if _, err = stmt.Exec(id); err != nil {
-		return fmt.Errorf("delete message: %w", err)
+	if added {
+		if err = s.renderAll(); err != nil {
+			return fmt.Errorf("backfill text: %w", err)
+		}
 	}
 
-	return nil
-}
-
-// Get returns the message with the given ID.
-func (s *SQLiteService) Get(id int) (*BloodMsg, error) {
-	stmt, err := s.db.Prepare(
-		`SELECT * FROM message WHERE id = ?`,
+	// The pre-ledger ratings of existing messages are not known until they are
+	// next recounted, so they have no rating base.
+	_, err = database.EnsureColumn(
+		s.db.Writer, "message", "rating_base", "INTEGER",
 	)
-	if err != nil {
-		return nil, fmt.Errorf("prepare select: %w", err)
-	}
 
-	bm := &BloodMsg{}
-	if err = stmt.QueryRow(id).Scan(
-		&bm.ID,
-		&bm.CharacterID,
-		&bm.BlockID,
-		&bm.PosX,
-		&bm.PosY,
-		&bm.PosZ,
-		&bm.AngX,
-		&bm.AngY,
-		&bm.AngZ,
-		&bm.MsgID,
-		&bm.MainMsgID,
-		&bm.AddMsgCateID,
-		&bm.Rating,
-		&bm.Legacy,
-	); err != nil {
-		return nil, fmt.Errorf("query row: %w", err)
-	}
-
-	return bm, nil
+	return err
 }
 
-// UpdateRating updates the rating for the message with the given ID.
-func (s *SQLiteService) UpdateRating(id int) error {
-	stmt, err := s.db.Prepare(
-		`UPDATE message SET rating = rating + 1 WHERE id = ?`,
-	)
-	if err != nil {
-		return fmt.Errorf("prepare query: %w", err)
-	}
-
-	if _, err = stmt.Exec(id); err != nil {
-		return fmt.Errorf("update message rating: %w", err)
-	}
-
-	return nil
-}
+// renderAll stores the rendered English text of every message.
+func (s *SQLiteService) renderAll() error {
+	s.l.Info().Msg("rendering text for existing messages")
+	ctx := context.Background()
 
-// init initialises the database tables required by this service.
-func (s *SQLiteService) init() error {
-	if err := s.initTable(); err != nil {
+	bms, err := s.queryMsgs(ctx, "")
+	if err != nil {
 		return err
 	}
 
-	if s.seed {
-		return s.doSeed()
-	}
-	return nil
-}
-
-// initTable creates the database tables required by this service.
-func (s *SQLiteService) initTable() error {
-	ddl, err := ioutil.ReadFile("internal/service/msg/ddl.sql")
+	tx, err := s.db.Writer.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("read DDL: %w", err)
+		return fmt.Errorf("db tx: %w", err)
 	}
 
-	var stmt *sql.Stmt
-	stmt, err = s.db.Prepare(string(ddl))
+	stmt, err := tx.PrepareContext(ctx, `UPDATE message SET text = ? WHERE id = ?`)
 	if err != nil {
-		return fmt.Errorf("prepare DDL: %w", err)
+		tx.Rollback()
+		return fmt.Errorf("prepare update: %w", err)
 	}
+	defer stmt.Close()
 
-	if _, err = stmt.Exec(); err != nil {
-		return fmt.Errorf("init table: %w", err)
+	for _, bm := range bms {
+		if _, err = stmt.ExecContext(ctx, bm.Render(gamestate.English), bm.ID); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("update text: %w", err)
+		}
 	}
 
-	return nil
+	return tx.Commit()
 }
 
-// doSeed seeds the database tables required by this service.
-func (s *SQLiteService) doSeed() error {
-	s.l.Debug().Msg("seeding legacy messages")
-
-	f, err := os.Open("internal/service/msg/legacymessages.bin")
+// Import adds legacy messages, keeping their IDs. Messages which already
+// exist are ignored.
+//
+// The number of messages added is returned.
+func (s *SQLiteService) Import(ctx context.Context, bms []*BloodMsg) (n int64, err error) {
+	var tx *sql.Tx
+	tx, err = s.db.Writer.BeginTx(ctx, nil)
 	if err != nil {
-		return err
+		return 0, fmt.Errorf("db tx: %w", err)
 	}
-	defer f.Close()
-
-	r := bufio.NewReader(f)
-
-	tx, err := s.db.BeginTx(context.Background(), nil)
-	if err != nil {
-		return fmt.Errorf("db tx: %w", err)
-	}
-
-	buf := make([]byte, 512)
-	for {
-		n, err := io.ReadFull(r, buf[:4])
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			return err
-		}
-
-		// Message length.
-		ml := int(binary.LittleEndian.Uint32(buf[:n]))
-
-		// Message body.
-		n, err = io.ReadFull(r, buf[:ml])
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			return err
-		}
-
-		msg, err := NewBloodMsgFromBytes(buf[:n])
+	defer func() {
 		if err != nil {
-			return fmt.Errorf("parse blood message: %w", err)
+			tx.Rollback()
 		}
+	}()
 
-		if err = s.saveMsg(tx, msg); err != nil {
-			return err
+	for _, bm := range bms {
+		var added int64
+		if added, err = s.saveMsg(ctx, tx, bm); err != nil {
+			return 0, err
 		}
+		n += added
 	}
 
-	return tx.Commit()
+	return n, tx.Commit()
 }
 
-func (s *SQLiteService) saveMsg(tx sqlPreparer, msg *BloodMsg) error {
-	stmt, err := tx.Prepare(
+// saveMsg saves the message, returning the number of messages added.
+func (s *SQLiteService) saveMsg(ctx context.Context, tx sqlPreparer, msg *BloodMsg) (int64, error) {
+	stmt, err := tx.PrepareContext(
+		ctx,
 		`INSERT OR IGNORE INTO message (
 			id,
 			character_id,
@@ -408,14 +196,18 @@ func (s *SQLiteService) saveMsg(tx sqlPreparer, msg *BloodMsg) error {
 			main_msg_id,
 			add_msg_cate_id,
 			rating,
-			legacy
-		) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+			legacy,
+			text,
+			region
+		) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
 	)
 	if err != nil {
-		return fmt.Errorf("prepare insert: %w", err)
+		return 0, fmt.Errorf("prepare insert: %w", err)
 	}
+	defer stmt.Close()
 
-	if _, err = stmt.Exec(
+	res, err := stmt.ExecContext(
+		ctx,
 		msg.ID,
 		msg.CharacterID,
 		msg.BlockID,
@@ -430,9 +222,12 @@ func (s *SQLiteService) saveMsg(tx sqlPreparer, msg *BloodMsg) error {
 		msg.AddMsgCateID,
 		msg.Rating,
 		msg.Legacy,
-	); err != nil {
-		return fmt.Errorf("save message: %w", err)
+		msg.Render(gamestate.English),
+		msg.Region,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("save message: %w", err)
 	}
 
-	return nil
+	return res.RowsAffected()
 }
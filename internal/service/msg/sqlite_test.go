@@ -0,0 +1,628 @@
+package msg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danmrichards/dessego/internal/database"
+	"github.com/danmrichards/dessego/internal/service/gamestate"
+	"github.com/rs/zerolog"
+)
+
+func newTestService(t *testing.T, opts ...Option) *SQLiteService {
+	t.Helper()
+
+	db, err := database.NewSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	s, err := NewSQLiteService(db, zerolog.Nop(), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func TestSQLiteService_Rate(t *testing.T) {
+	s := newTestService(t, RatingLimit(2, time.Hour))
+
+	for i := 0; i < 3; i++ {
+		if err := s.Add(context.Background(), BloodMsg{CharacterID: "author0", BlockID: 20070}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.Rate(context.Background(), 1, "rater0"); err != nil {
+		t.Fatal(err)
+	}
+
+	var derr DuplicateRatingError
+	if err := s.Rate(context.Background(), 1, "rater0"); !errors.As(err, &derr) {
+		t.Fatalf("expected duplicate rating error got: %v", err)
+	}
+
+	var serr SelfRatingError
+	if err := s.Rate(context.Background(), 1, "author0"); !errors.As(err, &serr) {
+		t.Fatalf("expected self rating error got: %v", err)
+	}
+
+	if err := s.Rate(context.Background(), 2, "rater0"); err != nil {
+		t.Fatal(err)
+	}
+
+	var lerr RatingLimitError
+	if err := s.Rate(context.Background(), 3, "rater0"); !errors.As(err, &lerr) {
+		t.Fatalf("expected rating limit error got: %v", err)
+	}
+
+	// A repeated rating is a duplicate, even once the limit is reached.
+	if err := s.Rate(context.Background(), 1, "rater0"); !errors.As(err, &derr) {
+		t.Fatalf("expected duplicate rating error got: %v", err)
+	}
+
+	bm, err := s.Get(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bm.Rating != 1 {
+		t.Fatalf("expected rating: 1 got: %d", bm.Rating)
+	}
+
+	ar, err := s.AuthorRatings(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ar["author0"] != 2 {
+		t.Fatalf("expected author rating: 2 got: %d", ar["author0"])
+	}
+}
+
+func TestSQLiteService_RecountRatings(t *testing.T) {
+	s := newTestService(t)
+
+	for i := 0; i < 3; i++ {
+		if err := s.Add(context.Background(), BloodMsg{CharacterID: "author0", BlockID: 20070}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, r := range []string{"rater0", "rater1"} {
+		if err := s.Rate(context.Background(), 1, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Simulate a farmed rating which bypassed the ledger.
+	if _, err := s.db.Writer.Exec(`UPDATE message SET rating = 50 WHERE id = 1`); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate ratings given before the ledger existed, with more given since.
+	for _, id := range []int{2, 3} {
+		if _, err := s.db.Writer.Exec(
+			`UPDATE message SET rating = 3, rating_base = 3 WHERE id = ?`, id,
+		); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Rate(context.Background(), 2, "rater0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Rate(context.Background(), 3, "rater0"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The ratings of a deleted message still count towards its author.
+	if err := s.Delete(context.Background(), 3); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.RecountRatings(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for id, want := range map[int]uint32{1: 2, 2: 4} {
+		bm, err := s.Get(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bm.Rating != want {
+			t.Fatalf("message %d: expected rating: %d got: %d", id, want, bm.Rating)
+		}
+	}
+
+	ar, err := s.AuthorRatings(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ar["author0"] != 4 {
+		t.Fatalf("expected author rating: 4 got: %d", ar["author0"])
+	}
+}
+
+func TestSQLiteService_migrateRatingBase(t *testing.T) {
+	db, err := database.NewSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	// A message rated three times, once since the ledger was added.
+	if _, err = db.Writer.Exec(
+		`CREATE TABLE message (
+			id INTEGER PRIMARY KEY autoincrement,
+			character_id TEXT,
+			block_id INTEGER DEFAULT 0,
+			posx REAL,
+			posy REAL,
+			posz REAL,
+			angx REAL,
+			angy REAL,
+			angz REAL,
+			msg_id INTEGER DEFAULT 0,
+			main_msg_id INTEGER DEFAULT 0,
+			add_msg_cate_id INTEGER DEFAULT 0,
+			rating INTEGER DEFAULT 0,
+			legacy INTEGER DEFAULT 0,
+			created INTEGER DEFAULT 0,
+			text TEXT DEFAULT '',
+			region TEXT DEFAULT ''
+		);
+		INSERT INTO message (character_id, block_id, posx, posy, posz, angx, angy, angz, rating)
+		VALUES ('author0', 20070, 0, 0, 0, 0, 0, 0, 3);
+		CREATE TABLE message_rating (
+			message_id INTEGER NOT NULL,
+			character_id TEXT NOT NULL,
+			author_id TEXT NOT NULL,
+			created INTEGER DEFAULT 0,
+			PRIMARY KEY (message_id, character_id)
+		);
+		INSERT INTO message_rating VALUES (1, 'rater0', 'author0', 0);`,
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewSQLiteService(db, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.Rate(context.Background(), 1, "rater1"); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.RecountRatings(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	bm, err := s.Get(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bm.Rating != 4 {
+		t.Fatalf("expected rating: 4 got: %d", bm.Rating)
+	}
+
+	// Once known, the rating base is kept, so later farmed ratings are dropped.
+	if _, err = db.Writer.Exec(`UPDATE message SET rating = 50 WHERE id = 1`); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.RecountRatings(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if bm, err = s.Get(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	if bm.Rating != 4 {
+		t.Fatalf("expected recounted rating: 4 got: %d", bm.Rating)
+	}
+}
+
+func TestSQLiteService_migrate(t *testing.T) {
+	db, err := database.NewSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	// The message table before messages had a creation time, text or region.
+	if _, err = db.Writer.Exec(
+		`CREATE TABLE message (
+			id INTEGER PRIMARY KEY autoincrement,
+			character_id TEXT,
+			block_id INTEGER DEFAULT 0,
+			posx REAL,
+			posy REAL,
+			posz REAL,
+			angx REAL,
+			angy REAL,
+			angz REAL,
+			msg_id INTEGER DEFAULT 0,
+			main_msg_id INTEGER DEFAULT 0,
+			add_msg_cate_id INTEGER DEFAULT 0,
+			rating INTEGER DEFAULT 0,
+			legacy INTEGER DEFAULT 0
+		);
+		INSERT INTO message (character_id, block_id, posx, posy, posz, angx, angy, angz)
+		VALUES ('author0', 20070, 0, 0, 0, 0, 0, 0);`,
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewSQLiteService(db, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bm, err := s.Get(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bm.Created.IsZero() || bm.Region != "" {
+		t.Fatalf("expected new message in every region got created %v in %q", bm.Created, bm.Region)
+	}
+}
+
+// ratingCount returns the number of ratings in the ledger for the message with
+// the given ID.
+func ratingCount(t *testing.T, s *SQLiteService, id int) (n int) {
+	t.Helper()
+
+	if err := s.db.Reader.QueryRow(
+		`SELECT count(*) FROM message_rating WHERE message_id = ?`, id,
+	).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+
+	return n
+}
+
+func TestSQLiteService_Add_maxPerCharacter(t *testing.T) {
+	s := newTestService(t, Retention(RetentionPolicy{MaxPerCharacter: 2}))
+
+	for i := 0; i < 3; i++ {
+		if err := s.Add(context.Background(), BloodMsg{CharacterID: "author0", BlockID: 20070}); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			if err := s.Rate(context.Background(), 1, "rater0"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	bms, err := s.Character(context.Background(), "", "author0", 20070, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bms) != 2 {
+		t.Fatalf("expected 2 messages got: %d", len(bms))
+	}
+	for _, bm := range bms {
+		if bm.ID == 1 {
+			t.Fatal("expected oldest message to be deleted")
+		}
+	}
+	if n := ratingCount(t, s, 1); n != 0 {
+		t.Fatalf("expected ratings of deleted message to be deleted got: %d", n)
+	}
+
+	ar, err := s.AuthorRatings(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ar["author0"] != 1 {
+		t.Fatalf("expected author to keep ratings of deleted message got: %d", ar["author0"])
+	}
+}
+
+func TestSQLiteService_Prune(t *testing.T) {
+	s := newTestService(t, Retention(RetentionPolicy{
+		LowRatedAge: time.Hour,
+		LowRating:   1,
+		MaxPerBlock: 2,
+	}))
+
+	for i := 0; i < 4; i++ {
+		if err := s.Add(context.Background(), BloodMsg{
+			CharacterID: fmt.Sprintf("author%d", i),
+			BlockID:     20070,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Message 1 is old and unrated, message 2 is highly rated.
+	if _, err := s.db.Writer.Exec(
+		`UPDATE message SET created = ? WHERE id = 1`,
+		time.Now().Add(-2*time.Hour).Unix(),
+	); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.db.Writer.Exec(`UPDATE message SET rating = 5 WHERE id = 2`); err != nil {
+		t.Fatal(err)
+	}
+
+	// A ledger entry which was not counted, so message 1 is still unrated.
+	if _, err := s.db.Writer.Exec(
+		`INSERT INTO message_rating (message_id, character_id, author_id, created)
+		VALUES (1, 'rater0', 'author0', 0)`,
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := PruneReport{DryRun: true, LowRated: 1, PerBlock: 1}
+	pr, err := s.Prune(context.Background(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr != exp {
+		t.Fatalf("expected: %s got: %s", exp, pr)
+	}
+
+	// Dry runs must not delete anything.
+	bms, err := s.NonCharacter(context.Background(), "", "", 20070, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bms) != 4 {
+		t.Fatalf("expected 4 messages got: %d", len(bms))
+	}
+	if n := ratingCount(t, s, 1); n != 1 {
+		t.Fatalf("expected dry run to keep ratings got: %d", n)
+	}
+
+	exp.DryRun = false
+	if pr, err = s.Prune(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	if pr != exp {
+		t.Fatalf("expected: %s got: %s", exp, pr)
+	}
+
+	if _, err = s.Get(context.Background(), 2); err != nil {
+		t.Fatalf("expected highly rated message to be kept: %v", err)
+	}
+	if n := ratingCount(t, s, 1); n != 0 {
+		t.Fatalf("expected ratings of pruned message to be deleted got: %d", n)
+	}
+}
+
+func TestSQLiteService_Search(t *testing.T) {
+	s := newTestService(t)
+
+	bms := []BloodMsg{
+		// "If you jump down from here..." in 4-2.
+		{CharacterID: "author0", BlockID: 30271, MainMsgID: 14027},
+		{CharacterID: "author1", BlockID: 30272, MainMsgID: 14027},
+		// "If you jump down from here..." in 1-1.
+		{CharacterID: "author0", BlockID: 20070, MainMsgID: 14027},
+		// "Watch out." in 4-2.
+		{CharacterID: "author0", BlockID: 30271, MainMsgID: 14001},
+	}
+	for _, bm := range bms {
+		if err := s.Add(context.Background(), bm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Rate(context.Background(), 2, "rater0"); err != nil {
+		t.Fatal(err)
+	}
+
+	tcs := []struct {
+		name   string
+		q      Query
+		expIDs []uint32
+	}{
+		{
+			name:   "text in area",
+			q:      Query{BlockIDs: gamestate.Blocks("4-2"), Text: "JUMP DOWN"},
+			expIDs: []uint32{2, 1},
+		},
+		{
+			name:   "character",
+			q:      Query{CharacterID: "author0", Text: "jump down"},
+			expIDs: []uint32{3, 1},
+		},
+		{
+			name:   "rating",
+			q:      Query{MinRating: 1, MaxRating: 1},
+			expIDs: []uint32{2},
+		},
+		{
+			name:   "wildcards are literal",
+			q:      Query{Text: "%"},
+			expIDs: []uint32{},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := s.Search(context.Background(), tc.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ids := make([]uint32, 0, len(res))
+			for _, bm := range res {
+				ids = append(ids, bm.ID)
+			}
+			if !reflect.DeepEqual(tc.expIDs, ids) {
+				t.Fatalf("expected: %v got: %v", tc.expIDs, ids)
+			}
+		})
+	}
+}
+
+// TestSQLiteService_concurrent simulates the regional game servers adding,
+// rating and reading messages at the same time. Every write must succeed
+// rather than failing with "database is locked".
+func TestSQLiteService_concurrent(t *testing.T) {
+	s := newTestService(t)
+
+	if err := s.Add(context.Background(), BloodMsg{CharacterID: "author0", BlockID: 20070}); err != nil {
+		t.Fatal(err)
+	}
+
+	const (
+		regions    = 3
+		players    = 8
+		perPlayer  = 25
+		characters = regions * players
+	)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, characters)
+	for i := 0; i < characters; i++ {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+
+			for j := 0; j < perPlayer; j++ {
+				if err := s.Add(context.Background(), BloodMsg{CharacterID: id, BlockID: 20070}); err != nil {
+					errs <- fmt.Errorf("add: %w", err)
+					return
+				}
+				if _, err := s.NonCharacter(context.Background(), "", id, 20070, 10); err != nil {
+					errs <- fmt.Errorf("select: %w", err)
+					return
+				}
+			}
+			if err := s.Rate(context.Background(), 1, id); err != nil {
+				errs <- fmt.Errorf("rate: %w", err)
+			}
+		}(fmt.Sprintf("character%d", i))
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	var n int
+	if err := s.db.Reader.QueryRow(`SELECT count(*) FROM message`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if want := 1 + characters*perPlayer; n != want {
+		t.Fatalf("expected %d messages got %d", want, n)
+	}
+
+	bm, err := s.Get(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bm.Rating != characters {
+		t.Fatalf("expected rating: %d got: %d", characters, bm.Rating)
+	}
+}
+
+// benchMessages is the number of messages in the benchmark database.
+const benchMessages = 1000000
+
+// benchService returns a service backed by a database of benchMessages
+// messages, spread across every block with a quarter of them in 1-1. The
+// database is removed when the benchmark ends.
+func benchService(b *testing.B) *SQLiteService {
+	b.Helper()
+
+	db, err := database.NewSQLite(filepath.Join(b.TempDir(), "bench.db"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { db.Close() })
+
+	s, err := NewSQLiteService(db, zerolog.Nop())
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	blocks := []int32{20071, 20170, 20270, 30270, 40170, 50170, 60170}
+
+	tx, err := db.Writer.BeginTx(context.Background(), nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	now := time.Now()
+	for i := 0; i < benchMessages; i++ {
+		blockID := int32(20070)
+		if i%4 != 0 {
+			blockID = blocks[rand.Intn(len(blocks))]
+		}
+
+		if _, err = tx.Exec(
+			`INSERT INTO message (
+				character_id, block_id, posx, posy, posz, angx, angy, angz,
+				msg_id, main_msg_id, rating, legacy, created
+			) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+			fmt.Sprintf("character%d", rand.Intn(benchMessages/10)),
+			blockID,
+			rand.Float32()*100, rand.Float32()*100, rand.Float32()*100,
+			0, rand.Float32(), 0,
+			rand.Intn(300),
+			rand.Intn(300),
+			rand.Intn(20),
+			rand.Intn(2),
+			now.Add(-time.Duration(benchMessages-i)*time.Minute).Unix(),
+		); err != nil {
+			tx.Rollback()
+			b.Fatal(err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		b.Fatal(err)
+	}
+
+	return s
+}
+
+// BenchmarkSQLiteService shares one database between its sub-benchmarks, as
+// it is slow to fill.
+func BenchmarkSQLiteService(b *testing.B) {
+	s := benchService(b)
+
+	b.Run("NonCharacter", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := s.NonCharacter(context.Background(), "", "character1", 20070, 10); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("Character", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := s.Character(context.Background(), "", "character1", 20070, 10); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("Legacy", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := s.Legacy(context.Background(), 20070, 10); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	// The baseline, selecting messages using ORDER BY random().
+	b.Run("orderByRandom", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := s.queryMsgs(
+				context.Background(),
+				`WHERE block_id = ? AND legacy = 0 AND character_id != ?
+				ORDER BY random() LIMIT ?`,
+				20070, "character1", 10,
+			); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,181 @@
+package msg
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Candidates are the pools of messages from which a Strategy selects.
+//
+// A message may appear in more than one pool.
+type Candidates struct {
+	// Fresh are the most recently written messages.
+	Fresh []BloodMsg
+
+	// Top are the highest rated messages.
+	Top []BloodMsg
+
+	// Sample is a random window of messages.
+	Sample []BloodMsg
+}
+
+// Strategy is the interface that wraps the basic Select method.
+//
+// Select returns at most n messages chosen from the given candidates. The
+// returned messages must be unique.
+type Strategy interface {
+	Select(c Candidates, n int) []BloodMsg
+}
+
+// StrategyFunc is an adapter to allow the use of ordinary functions as a
+// message selection strategy.
+type StrategyFunc func(c Candidates, n int) []BloodMsg
+
+// Select calls f(c, n).
+func (f StrategyFunc) Select(c Candidates, n int) []BloodMsg {
+	return f(c, n)
+}
+
+// Uniform is a strategy that selects uniformly at random from all candidates.
+var Uniform = StrategyFunc(func(c Candidates, n int) []BloodMsg {
+	return weightedSample(uniqueCandidates(nil, c), n, func(BloodMsg) float64 {
+		return 1
+	})
+})
+
+// Weighted is a strategy which samples messages weighted by their rating and
+// recency, while guaranteeing a share of the selection to the freshest and top
+// rated messages.
+type Weighted struct {
+	// FreshShare is the fraction of the selection reserved for the freshest
+	// messages.
+	FreshShare float64
+
+	// TopShare is the fraction of the selection reserved for the top rated
+	// messages.
+	TopShare float64
+
+	// RatingWeight is the weight added to a message per rating it received.
+	RatingWeight float64
+
+	// HalfLife is the age at which the recency bonus of a message halves.
+	HalfLife time.Duration
+}
+
+// DefaultStrategy is the message selection strategy used unless configured
+// otherwise.
+var DefaultStrategy = Weighted{
+	FreshShare:   0.25,
+	TopShare:     0.25,
+	RatingWeight: 0.5,
+	HalfLife:     7 * 24 * time.Hour,
+}
+
+// Select implements Strategy.
+func (w Weighted) Select(c Candidates, n int) []BloodMsg {
+	sel := make([]BloodMsg, 0, n)
+	seen := make(map[uint32]struct{}, n)
+
+	pick := func(pool []BloodMsg, quota int) {
+		for _, bm := range pool {
+			if quota == 0 || len(sel) == n {
+				return
+			}
+			if _, ok := seen[bm.ID]; ok {
+				continue
+			}
+
+			seen[bm.ID] = struct{}{}
+			sel = append(sel, bm)
+			quota--
+		}
+	}
+
+	// Guaranteed fresh and top rated messages, the pools are already in order
+	// of freshness and rating respectively.
+	pick(c.Fresh, int(math.Ceil(float64(n)*w.FreshShare)))
+	pick(c.Top, int(math.Ceil(float64(n)*w.TopShare)))
+
+	// Fill the remainder with a weighted sample of everything else.
+	now := time.Now()
+	rest := uniqueCandidates(seen, c)
+	return append(sel, weightedSample(rest, n-len(sel), func(bm BloodMsg) float64 {
+		return w.weight(bm, now)
+	})...)
+}
+
+// weight returns the sampling weight of the given message.
+func (w Weighted) weight(bm BloodMsg, now time.Time) float64 {
+	wt := 1 + w.RatingWeight*float64(bm.Rating)
+
+	if w.HalfLife > 0 && !bm.Created.IsZero() {
+		age := now.Sub(bm.Created)
+		if age < 0 {
+			age = 0
+		}
+		wt += math.Exp2(-float64(age) / float64(w.HalfLife))
+	}
+
+	return wt
+}
+
+// uniqueCandidates returns all of the candidates, excluding any duplicates and
+// any which are in the seen set.
+func uniqueCandidates(seen map[uint32]struct{}, c Candidates) []BloodMsg {
+	u := make(map[uint32]struct{}, len(seen))
+	for id := range seen {
+		u[id] = struct{}{}
+	}
+
+	bms := make([]BloodMsg, 0, len(c.Fresh)+len(c.Top)+len(c.Sample))
+	for _, pool := range [][]BloodMsg{c.Fresh, c.Top, c.Sample} {
+		for _, bm := range pool {
+			if _, ok := u[bm.ID]; ok {
+				continue
+			}
+
+			u[bm.ID] = struct{}{}
+			bms = append(bms, bm)
+		}
+	}
+
+	return bms
+}
+
+// weightedSample returns n messages sampled without replacement, where the
+// probability of each message being chosen is proportional to its weight.
+//
+// See: Efraimidis, Spirakis - Weighted random sampling with a reservoir.
+func weightedSample(bms []BloodMsg, n int, weight func(BloodMsg) float64) []BloodMsg {
+	if n <= 0 {
+		return nil
+	}
+	if n >= len(bms) {
+		return bms
+	}
+
+	type keyed struct {
+		key float64
+		bm  BloodMsg
+	}
+
+	ks := make([]keyed, len(bms))
+	for i, bm := range bms {
+		ks[i] = keyed{
+			key: math.Pow(rand.Float64(), 1/weight(bm)),
+			bm:  bm,
+		}
+	}
+	sort.Slice(ks, func(i, j int) bool {
+		return ks[i].key > ks[j].key
+	})
+
+	sel := make([]BloodMsg, n)
+	for i := range sel {
+		sel[i] = ks[i].bm
+	}
+
+	return sel
+}
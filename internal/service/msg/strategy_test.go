@@ -0,0 +1,77 @@
+package msg
+
+import (
+	"testing"
+	"time"
+)
+
+func testCandidates(n int) Candidates {
+	now := time.Now()
+
+	var c Candidates
+	for i := 0; i < n; i++ {
+		c.Sample = append(c.Sample, BloodMsg{
+			ID:      uint32(i + 1),
+			Rating:  uint32(i % 3),
+			Created: now.Add(-time.Duration(n-i) * time.Hour),
+		})
+	}
+
+	// Freshest first.
+	for i := len(c.Sample) - 1; i >= len(c.Sample)-n/2; i-- {
+		c.Fresh = append(c.Fresh, c.Sample[i])
+	}
+
+	// Top rated first.
+	c.Top = []BloodMsg{{ID: uint32(n + 1), Rating: 100}}
+	for _, bm := range c.Sample {
+		if bm.Rating == 2 {
+			c.Top = append(c.Top, bm)
+		}
+	}
+
+	return c
+}
+
+func TestWeighted_Select(t *testing.T) {
+	c := testCandidates(40)
+
+	for i := 0; i < 100; i++ {
+		bms := DefaultStrategy.Select(c, 8)
+		if len(bms) != 8 {
+			t.Fatalf("expected 8 messages got: %d", len(bms))
+		}
+
+		seen := make(map[uint32]struct{}, len(bms))
+		for _, bm := range bms {
+			if _, ok := seen[bm.ID]; ok {
+				t.Fatalf("duplicate message: %d", bm.ID)
+			}
+			seen[bm.ID] = struct{}{}
+		}
+
+		// The freshest and top rated messages are guaranteed a place.
+		if _, ok := seen[c.Fresh[0].ID]; !ok {
+			t.Fatal("expected freshest message to be selected")
+		}
+		if _, ok := seen[c.Top[0].ID]; !ok {
+			t.Fatal("expected top rated message to be selected")
+		}
+	}
+}
+
+func TestWeighted_Select_fewCandidates(t *testing.T) {
+	c := testCandidates(4)
+
+	if bms := DefaultStrategy.Select(c, 10); len(bms) != 5 {
+		t.Fatalf("expected 5 messages got: %d", len(bms))
+	}
+}
+
+func TestUniform_Select(t *testing.T) {
+	c := testCandidates(40)
+
+	if bms := Uniform.Select(c, 8); len(bms) != 8 {
+		t.Fatalf("expected 8 messages got: %d", len(bms))
+	}
+}
@@ -0,0 +1,24 @@
+// Package quarantine stores rejected uploads from Demon's Souls, so that
+// corrupt data can be investigated without being served to other players.
+package quarantine
+
+import "time"
+
+const (
+	// KindReplay is a rejected bloodstain replay.
+	KindReplay = "replay"
+
+	// KindGhost is a rejected wandering ghost.
+	KindGhost = "ghost"
+)
+
+// Upload is a rejected upload.
+type Upload struct {
+	ID          uint32    `json:"id"`
+	Kind        string    `json:"kind"`
+	CharacterID string    `json:"character_id"`
+	BlockID     int32     `json:"block_id"`
+	Reason      string    `json:"reason"`
+	Data        []byte    `json:"data"`
+	Created     time.Time `json:"created"`
+}
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS quarantine (
+   id INTEGER PRIMARY KEY autoincrement,
+   kind TEXT,
+   character_id TEXT,
+   block_id INTEGER DEFAULT 0,
+   reason TEXT,
+   data TEXT,
+   created INTEGER DEFAULT 0
+);
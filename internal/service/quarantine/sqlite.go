@@ -0,0 +1,110 @@
+package quarantine
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/danmrichards/dessego/internal/database"
+	"github.com/rs/zerolog"
+)
+
+// SQLiteService is a quarantine service backed by a SQLite database.
+type SQLiteService struct {
+	db *database.DB
+	l  zerolog.Logger
+}
+
+// NewSQLiteService returns an initialised SQLite quarantine service.
+func NewSQLiteService(db *database.DB, l zerolog.Logger) (*SQLiteService, error) {
+	s := &SQLiteService{
+		db: db,
+		l:  l,
+	}
+
+	if err := s.initTable(); err != nil {
+		return nil, fmt.Errorf("initialise: %w", err)
+	}
+
+	return s, nil
+}
+
+// Add stores a rejected upload.
+func (s *SQLiteService) Add(ctx context.Context, u Upload) error {
+	if _, err := s.db.Writer.ExecContext(
+		ctx,
+		`INSERT INTO quarantine (
+			kind,
+			character_id,
+			block_id,
+			reason,
+			data,
+			created
+		) VALUES (?,?,?,?,?,?)`,
+		u.Kind,
+		u.CharacterID,
+		u.BlockID,
+		u.Reason,
+		u.Data,
+		time.Now().Unix(),
+	); err != nil {
+		return fmt.Errorf("add upload: %w", err)
+	}
+
+	return nil
+}
+
+// List returns the n most recently rejected uploads.
+func (s *SQLiteService) List(ctx context.Context, n int) ([]Upload, error) {
+	rows, err := s.db.Reader.QueryContext(
+		ctx,
+		`SELECT id, kind, character_id, block_id, reason, data, created
+		FROM quarantine
+		ORDER BY id DESC
+		LIMIT ?`,
+		n,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query rows: %w", err)
+	}
+	defer rows.Close()
+
+	us := make([]Upload, 0)
+	for rows.Next() {
+		var (
+			u       Upload
+			created int64
+		)
+		if err = rows.Scan(
+			&u.ID,
+			&u.Kind,
+			&u.CharacterID,
+			&u.BlockID,
+			&u.Reason,
+			&u.Data,
+			&created,
+		); err != nil {
+			return nil, fmt.Errorf("scan row: %w", err)
+		}
+		u.Created = time.Unix(created, 0)
+
+		us = append(us, u)
+	}
+
+	return us, rows.Err()
+}
+
+// initTable creates the database tables required by this service.
+func (s *SQLiteService) initTable() error {
+	ddl, err := ioutil.ReadFile("internal/service/quarantine/quarantine.sql")
+	if err != nil {
+		return fmt.Errorf("read DDL: %w", err)
+	}
+
+	if _, err = s.db.Writer.Exec(string(ddl)); err != nil {
+		return fmt.Errorf("init table: %w", err)
+	}
+
+	return nil
+}
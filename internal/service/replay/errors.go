@@ -0,0 +1,6 @@
+package replay
+
+import "errors"
+
+// ErrNotFound is returned when a replay does not exist.
+var ErrNotFound = errors.New("replay not found")
@@ -0,0 +1,285 @@
+package replay
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/danmrichards/dessego/internal/spatial"
+	"github.com/rs/zerolog"
+)
+
+// MemoryService is a replay service which holds replays in memory, for tests
+// and ephemeral servers.
+type MemoryService struct {
+	sync.Mutex
+
+	l zerolog.Logger
+
+	replays map[uint32]*Replay
+	nextID  uint32
+
+	options
+}
+
+// NewMemoryService returns an empty in-memory replays service.
+func NewMemoryService(l zerolog.Logger, opts ...Option) *MemoryService {
+	return &MemoryService{
+		l:       l,
+		replays: make(map[uint32]*Replay),
+		nextID:  1,
+		options: newOptions(opts),
+	}
+}
+
+// List returns n replays for the given block ID and legacy type, visible in
+// the given region. Replays from every region are returned if region is empty.
+//
+// Half of the replays are the most recently added, so players see fresh
+// bloodstains, and the remainder are sampled from older replays.
+func (s *MemoryService) List(_ context.Context, region string, blockID int32, n int, legacy LegacyType) ([]Replay, error) {
+	if n <= 0 {
+		return []Replay{}, nil
+	}
+
+	// Matching replays in ID order.
+	rs := s.filter(func(r *Replay) bool {
+		return r.BlockID == blockID && LegacyType(r.Legacy) == legacy &&
+			r.visibleIn(region)
+	})
+
+	fresh := make([]Replay, 0, n)
+	for i := len(rs) - 1; i >= 0 && len(fresh) < (n+1)/2; i-- {
+		fresh = append(fresh, rs[i])
+	}
+	older := rs[:len(rs)-len(fresh)]
+	if len(older) == 0 || len(fresh) == n {
+		// Every matching replay has been selected already.
+		return fresh, nil
+	}
+
+	// A window starting from a random older replay, wrapping around to the
+	// oldest.
+	pivot := rand.Intn(len(older))
+	for i := 0; i < len(older) && len(fresh) < n; i++ {
+		fresh = append(fresh, older[(pivot+i)%len(older)])
+	}
+
+	return fresh, nil
+}
+
+// Recent returns the n most recently added replays for the given block ID.
+func (s *MemoryService) Recent(_ context.Context, blockID int32, n int) ([]Replay, error) {
+	rs := s.filter(func(r *Replay) bool {
+		return r.BlockID == blockID
+	})
+
+	recent := make([]Replay, 0, n)
+	for i := len(rs) - 1; i >= 0 && len(recent) < n; i-- {
+		recent = append(recent, rs[i])
+	}
+
+	return recent, nil
+}
+
+// filter returns copies of the replays matching the given filter, in ID
+// order.
+func (s *MemoryService) filter(match func(r *Replay) bool) []Replay {
+	s.Lock()
+	defer s.Unlock()
+
+	rs := make([]Replay, 0)
+	for _, r := range s.replays {
+		if match(r) {
+			rs = append(rs, *r)
+		}
+	}
+	sort.Slice(rs, func(i, j int) bool {
+		return rs[i].ID < rs[j].ID
+	})
+
+	return rs
+}
+
+// Get returns a given replay.
+func (s *MemoryService) Get(_ context.Context, id uint32) (*Replay, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	r, ok := s.replays[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	cp := *r
+
+	return &cp, nil
+}
+
+// Add adds a new replay.
+//
+// Existing replays from the same character within the dedupe radius of the
+// new replay are replaced by it. If the retention policy limits the number of
+// replays per character, the oldest replays for the character beyond that
+// limit are deleted.
+func (s *MemoryService) Add(_ context.Context, r *Replay) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if rad := s.retention.DedupeRadius; rad > 0 {
+		var n int
+		for id, e := range s.replays {
+			if e.CharacterID != r.CharacterID || e.BlockID != r.BlockID || e.Legacy != 0 {
+				continue
+			}
+
+			dx, dy, dz := e.PosX-r.PosX, e.PosY-r.PosY, e.PosZ-r.PosZ
+			if float64(dx*dx+dy*dy+dz*dz) <= rad*rad {
+				delete(s.replays, id)
+				n++
+			}
+		}
+		if n > 0 {
+			s.l.Debug().Msgf(
+				"replaced %d duplicate replays for character: %q",
+				n, r.CharacterID,
+			)
+		}
+	}
+
+	r.Created = time.Now()
+	cp := *r
+	cp.ID = s.nextID
+	s.replays[cp.ID] = &cp
+	s.nextID++
+
+	if max := s.retention.MaxPerCharacter; max > 0 {
+		n := s.deleteOldest(func(e *Replay) bool {
+			return e.CharacterID == r.CharacterID && e.Legacy == 0
+		}, max)
+		if n > 0 {
+			s.l.Debug().Msgf(
+				"deleted %d oldest replays for character: %q",
+				n, r.CharacterID,
+			)
+		}
+	}
+
+	return nil
+}
+
+// deleteOldest deletes the replays matching the filter beyond the newest max,
+// returning the number deleted. The caller must hold the lock.
+func (s *MemoryService) deleteOldest(match func(r *Replay) bool, max int) int64 {
+	rs := make([]*Replay, 0)
+	for _, r := range s.replays {
+		if match(r) {
+			rs = append(rs, r)
+		}
+	}
+	if len(rs) <= max {
+		return 0
+	}
+
+	sort.Slice(rs, func(i, j int) bool {
+		if !rs[i].Created.Equal(rs[j].Created) {
+			return rs[i].Created.After(rs[j].Created)
+		}
+		return rs[i].ID > rs[j].ID
+	})
+	for _, r := range rs[max:] {
+		delete(s.replays, r.ID)
+	}
+
+	return int64(len(rs) - max)
+}
+
+// Prune deletes replays according to the retention policy of the service.
+//
+// If dryRun is true, nothing is deleted and the report details the replays
+// which would have been deleted.
+func (s *MemoryService) Prune(_ context.Context, dryRun bool) (PruneReport, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	pr := PruneReport{DryRun: dryRun}
+
+	// Prune a copy when dry running, so the rules see the effect of earlier
+	// rules as they would in a transaction.
+	replays := s.replays
+	if dryRun {
+		s.replays = make(map[uint32]*Replay, len(replays))
+		for id, r := range replays {
+			s.replays[id] = r
+		}
+		defer func() { s.replays = replays }()
+	}
+
+	for _, rule := range []struct {
+		max int
+		key func(r *Replay) interface{}
+		n   *int64
+	}{
+		{
+			s.retention.MaxPerCharacter,
+			func(r *Replay) interface{} { return r.CharacterID },
+			&pr.PerCharacter,
+		},
+		{
+			s.retention.MaxPerBlock,
+			func(r *Replay) interface{} { return r.BlockID },
+			&pr.PerBlock,
+		},
+	} {
+		if rule.max <= 0 {
+			continue
+		}
+
+		keys := make(map[interface{}]struct{})
+		for _, r := range s.replays {
+			if r.Legacy == 0 {
+				keys[rule.key(r)] = struct{}{}
+			}
+		}
+		for k := range keys {
+			key := rule.key
+			*rule.n += s.deleteOldest(func(r *Replay) bool {
+				return r.Legacy == 0 && key(r) == k
+			}, rule.max)
+		}
+	}
+
+	return pr, nil
+}
+
+// Positions returns the position of every replay within the given block.
+func (s *MemoryService) Positions(_ context.Context, blockID int32) ([]spatial.Item, error) {
+	rs := s.filter(func(r *Replay) bool {
+		return r.BlockID == blockID
+	})
+
+	items := make([]spatial.Item, 0, len(rs))
+	for _, r := range rs {
+		items = append(items, spatial.Item{
+			Kind:        spatial.KindBloodstain,
+			ID:          r.ID,
+			CharacterID: r.CharacterID,
+			BlockID:     r.BlockID,
+			Point:       spatial.Point{X: r.PosX, Y: r.PosY, Z: r.PosZ},
+		})
+	}
+
+	return items, nil
+}
+
+// Near returns the position of every replay within radius of the center point
+// in the given block.
+func (s *MemoryService) Near(ctx context.Context, blockID int32, center spatial.Point, radius float64) ([]spatial.Item, error) {
+	items, err := s.Positions(ctx, blockID)
+	if err != nil {
+		return nil, err
+	}
+
+	return spatial.Within(items, center, radius), nil
+}
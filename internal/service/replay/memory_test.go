@@ -0,0 +1,112 @@
+package replay
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func addMemReplays(t *testing.T, s *MemoryService, n int, characterID string, blockID int32) {
+	t.Helper()
+
+	for i := 0; i < n; i++ {
+		if err := s.Add(context.Background(), &Replay{
+			CharacterID: characterID,
+			BlockID:     blockID,
+			PosX:        float32(i * 10),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// countMemReplays returns the number of replays matching the filter.
+func countMemReplays(s *MemoryService, match func(r *Replay) bool) (n int) {
+	for _, r := range s.replays {
+		if match(r) {
+			n++
+		}
+	}
+
+	return n
+}
+
+func TestMemoryService_Add_dedupe(t *testing.T) {
+	s := NewMemoryService(zerolog.Nop(), Retention(RetentionPolicy{DedupeRadius: 1}))
+
+	for _, r := range []*Replay{
+		{CharacterID: "char0", BlockID: 20070, PosX: 1, PosY: 1, PosZ: 1},
+		{CharacterID: "char0", BlockID: 20070, PosX: 1.5, PosY: 1, PosZ: 1},
+		{CharacterID: "char0", BlockID: 20070, PosX: 5, PosY: 1, PosZ: 1},
+		{CharacterID: "char0", BlockID: 20071, PosX: 1, PosY: 1, PosZ: 1},
+		{CharacterID: "char1", BlockID: 20070, PosX: 1, PosY: 1, PosZ: 1},
+	} {
+		if err := s.Add(context.Background(), r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := len(s.replays); n != 4 {
+		t.Fatalf("expected 4 replays got %d", n)
+	}
+	if _, ok := s.replays[1]; ok {
+		t.Fatal("expected duplicate replay to be replaced")
+	}
+}
+
+func TestMemoryService_Add_maxPerCharacter(t *testing.T) {
+	s := NewMemoryService(zerolog.Nop(), Retention(RetentionPolicy{MaxPerCharacter: 3}))
+	addMemReplays(t, s, 5, "char0", 20070)
+	addMemReplays(t, s, 2, "char1", 20070)
+
+	if n := countMemReplays(s, func(r *Replay) bool {
+		return r.CharacterID == "char0"
+	}); n != 3 {
+		t.Fatalf("expected 3 replays got %d", n)
+	}
+	if n := countMemReplays(s, func(r *Replay) bool {
+		return r.CharacterID == "char0" && r.ID <= 2
+	}); n != 0 {
+		t.Fatal("expected oldest replays to be deleted")
+	}
+}
+
+func TestMemoryService_Prune(t *testing.T) {
+	s := NewMemoryService(zerolog.Nop())
+	addMemReplays(t, s, 6, "char0", 20070)
+	addMemReplays(t, s, 6, "char1", 20070)
+	addMemReplays(t, s, 2, "char2", 20071)
+
+	s.retention = RetentionPolicy{MaxPerCharacter: 4, MaxPerBlock: 5}
+
+	pr, err := s.Prune(context.Background(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.PerCharacter != 4 || pr.PerBlock != 3 {
+		t.Fatalf("unexpected dry run report: %s", pr)
+	}
+	if n := len(s.replays); n != 14 {
+		t.Fatalf("expected dry run to delete nothing, %d replays remain", n)
+	}
+
+	if pr, err = s.Prune(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	if pr.Total() != 7 {
+		t.Fatalf("unexpected report: %s", pr)
+	}
+
+	// The newest replays in each block should remain.
+	if n := countMemReplays(s, func(r *Replay) bool {
+		return r.BlockID == 20070 && r.ID >= 6
+	}); n != 5 {
+		t.Fatalf("expected 5 newest replays in block got %d", n)
+	}
+	if n := countMemReplays(s, func(r *Replay) bool {
+		return r.BlockID == 20071
+	}); n != 2 {
+		t.Fatalf("expected 2 replays in other block got %d", n)
+	}
+}
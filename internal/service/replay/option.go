@@ -0,0 +1,27 @@
+package replay
+
+// Option is a functional option that configures a replays service.
+type Option func(*options)
+
+// options are the settings shared by the replays services.
+type options struct {
+	retention RetentionPolicy
+}
+
+// newOptions returns the default options with opts applied.
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
+
+// Retention configures the service to delete and deduplicate replays according
+// to the given retention policy.
+func Retention(p RetentionPolicy) Option {
+	return func(o *options) {
+		o.retention = p
+	}
+}
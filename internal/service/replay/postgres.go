@@ -0,0 +1,53 @@
+package replay
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/danmrichards/dessego/internal/database"
+	"github.com/rs/zerolog"
+)
+
+// PostgresService is a replay service backed by a PostgreSQL database.
+//
+// Several servers may share the database, so the retention policy applies
+// across all of them.
+type PostgresService struct {
+	db *sql.DB
+
+	sqlService
+}
+
+// NewPostgresService returns an initialised PostgreSQL replays service.
+func NewPostgresService(db *sql.DB, l zerolog.Logger, opts ...Option) (*PostgresService, error) {
+	s := &PostgresService{
+		db: db,
+		sqlService: sqlService{
+			c:       database.PostgresConn(db),
+			l:       l,
+			options: newOptions(opts),
+		},
+	}
+
+	if err := s.init(); err != nil {
+		return nil, fmt.Errorf("initialise: %w", err)
+	}
+
+	return s, nil
+}
+
+// init initialises the database tables required by this service.
+func (s *PostgresService) init() error {
+	ddl, err := ioutil.ReadFile("internal/service/replay/postgres.sql")
+	if err != nil {
+		return fmt.Errorf("read DDL: %w", err)
+	}
+
+	// Exec rather than prepare, as the DDL contains multiple statements.
+	if _, err = s.db.Exec(string(ddl)); err != nil {
+		return fmt.Errorf("init tables: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS replay (
+   id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+   character_id TEXT,
+   block_id INTEGER DEFAULT 0,
+   posx REAL,
+   posy REAL,
+   posz REAL,
+   angx REAL,
+   angy REAL,
+   angz REAL,
+   msg_id INTEGER DEFAULT 0,
+   main_msg_id INTEGER DEFAULT 0,
+   add_msg_cate_id INTEGER DEFAULT 0,
+   data BYTEA,
+   legacy INTEGER DEFAULT 0,
+   created BIGINT DEFAULT 0,
+   region TEXT DEFAULT ''
+);
+
+ALTER TABLE replay ADD COLUMN IF NOT EXISTS region TEXT DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS replay_block_id ON replay (block_id, legacy, id);
+CREATE INDEX IF NOT EXISTS replay_character ON replay (character_id, legacy, block_id);
@@ -3,12 +3,18 @@ package replay
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"math"
+	"time"
 
 	"github.com/danmrichards/dessego/internal/service/gamestate"
 )
 
+// headerSize is the size in bytes of the fixed size fields following the
+// character ID in a binary replay.
+const headerSize = 4 + 24 + 12
+
 // LegacyType indicates if a replay is legacy or not.
 type LegacyType int
 
@@ -40,7 +46,10 @@ const (
 //   - Main message ID
 //   - Add Message Cate ID (?)
 //   - Rating
-// Data 			= n bytes (terminated by a zero byte)
+// Data 			= n bytes (optionally terminated by a zero byte)
+//
+// The data is a recording of the player's movements, in a layout which has not
+// been verified, so it is stored and served as uploaded.
 type Replay struct {
 	ID           uint32
 	CharacterID  string
@@ -56,6 +65,28 @@ type Replay struct {
 	AddMsgCateID uint32
 	Data         []byte
 	Legacy       uint32
+	Created      time.Time
+
+	// Region is the region the replay was recorded in. It is empty for legacy
+	// replays and replays recorded before regions were recorded.
+	Region string
+}
+
+// visibleIn returns true if the replay is visible to players in the given
+// region. Replays without a region are visible in every region, as is every
+// replay if region is empty.
+func (r Replay) visibleIn(region string) bool {
+	return region == "" || r.Region == "" || r.Region == region
+}
+
+// inRegion restricts the filter to replays visible to players in the given
+// region, unless region is empty.
+func inRegion(filter string, args []interface{}, region string) (string, []interface{}) {
+	if region == "" {
+		return filter, args
+	}
+
+	return filter + ` AND region IN (?, '')`, append(args, region)
 }
 
 // NewReplayFromBytes returns a replay parsed from the given byte slice.
@@ -65,7 +96,7 @@ func NewReplayFromBytes(b []byte) (r *Replay, err error) {
 	}
 
 	if len(b) < 4 {
-		return nil, nil
+		return nil, errors.New("replay too short")
 	}
 
 	// Message ID.
@@ -73,13 +104,16 @@ func NewReplayFromBytes(b []byte) (r *Replay, err error) {
 	r.ID = binary.LittleEndian.Uint32(b[:cursor])
 
 	// Character ID.
-	for i := cursor; ; i++ {
-		c := b[i : i+1][0]
-		if c == 0x00 {
-			cursor = i + 1
-			break
-		}
-		r.CharacterID += string(c)
+	n := bytes.IndexByte(b[cursor:], 0x00)
+	if n < 0 {
+		return nil, errors.New("unterminated character ID")
+	}
+	r.CharacterID = string(b[cursor : cursor+n])
+	cursor += n + 1
+
+	// Block ID, positional data and metadata.
+	if len(b) < cursor+headerSize {
+		return nil, errors.New("replay header too short")
 	}
 
 	// Block ID.
@@ -108,14 +142,9 @@ func NewReplayFromBytes(b []byte) (r *Replay, err error) {
 	r.AddMsgCateID = binary.LittleEndian.Uint32(b[cursor : cursor+4])
 	cursor += 4
 
-	// Replay data.
-	for i := cursor; ; i++ {
-		c := b[i : i+1][0]
-		if c == 0x00 {
-			break
-		}
-		r.Data = append(r.Data, c)
-	}
+	// Replay data. This runs to the end of the replay, as the data is not
+	// guaranteed to be free of zero bytes. Copy it, as callers may reuse b.
+	r.Data = append([]byte(nil), bytes.TrimSuffix(b[cursor:], []byte{0x00})...)
 
 	return r, nil
 }
@@ -12,5 +12,10 @@ CREATE TABLE IF NOT EXISTS replay (
    main_msg_id INTEGER DEFAULT 0,
    add_msg_cate_id INTEGER DEFAULT 0,
    data TEXT,
-   legacy INTEGER DEFAULT 0
-)
\ No newline at end of file
+   legacy INTEGER DEFAULT 0,
+   created INTEGER DEFAULT 0,
+   region TEXT DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS replay_block_id ON replay (block_id, legacy, id);
+CREATE INDEX IF NOT EXISTS replay_character ON replay (character_id, legacy, block_id);
@@ -0,0 +1,112 @@
+package replay
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// RetentionPolicy determines how many non-legacy replays are kept. Zero values
+// disable the corresponding rule.
+type RetentionPolicy struct {
+	// MaxPerCharacter is the maximum number of replays per character. The
+	// oldest replays beyond this limit are deleted.
+	MaxPerCharacter int
+
+	// MaxPerBlock is the maximum number of replays per block. The oldest
+	// replays beyond this limit are deleted.
+	MaxPerBlock int
+
+	// DedupeRadius is the distance within which a new replay replaces any
+	// existing replays from the same character in the same block.
+	DedupeRadius float64
+}
+
+// PruneReport details the number of replays deleted by each rule of the
+// retention policy.
+type PruneReport struct {
+	DryRun       bool
+	PerCharacter int64
+	PerBlock     int64
+}
+
+// Total returns the total number of replays deleted.
+func (p PruneReport) Total() int64 {
+	return p.PerCharacter + p.PerBlock
+}
+
+// String implements fmt.Stringer.
+func (p PruneReport) String() string {
+	return fmt.Sprintf(
+		"dry run: %t per character: %d per block: %d total: %d",
+		p.DryRun, p.PerCharacter, p.PerBlock, p.Total(),
+	)
+}
+
+// Prune deletes replays according to the retention policy of the service.
+//
+// If dryRun is true, the deletions are rolled back and the report details the
+// replays which would have been deleted.
+func (s *sqlService) Prune(ctx context.Context, dryRun bool) (pr PruneReport, err error) {
+	pr.DryRun = dryRun
+
+	var tx *sql.Tx
+	tx, err = s.c.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return pr, fmt.Errorf("db tx: %w", err)
+	}
+	defer func() {
+		if err != nil || dryRun {
+			tx.Rollback()
+		}
+	}()
+
+	for _, rule := range []struct {
+		max       int
+		partition string
+		n         *int64
+	}{
+		{s.retention.MaxPerCharacter, "character_id", &pr.PerCharacter},
+		{s.retention.MaxPerBlock, "block_id", &pr.PerBlock},
+	} {
+		if rule.max <= 0 {
+			continue
+		}
+
+		*rule.n, err = s.execCount(
+			ctx, tx,
+			`DELETE FROM replay
+			WHERE id IN (
+				SELECT id FROM (
+					SELECT id, row_number() OVER (
+						PARTITION BY `+rule.partition+`
+						ORDER BY created DESC, id DESC
+					) AS n
+					FROM replay
+					WHERE legacy = 0
+				) AS ranked
+				WHERE n > ?
+			)`,
+			rule.max,
+		)
+		if err != nil {
+			return pr, fmt.Errorf("prune per %s: %w", rule.partition, err)
+		}
+	}
+
+	if dryRun {
+		return pr, nil
+	}
+
+	return pr, tx.Commit()
+}
+
+// execCount executes the given query and returns the number of rows affected.
+func (s *sqlService) execCount(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) (int64, error) {
+	res, err := tx.ExecContext(ctx, s.c.Rebind(query), args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
@@ -0,0 +1,73 @@
+package replay
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/danmrichards/dessego/internal/spatial"
+)
+
+// Positions returns the position of every replay within the given block.
+func (s *sqlService) Positions(ctx context.Context, blockID int32) ([]spatial.Item, error) {
+	return s.positions(ctx, `WHERE block_id = ?`, blockID)
+}
+
+// Near returns the position of every replay within radius of the center point
+// in the given block.
+func (s *sqlService) Near(ctx context.Context, blockID int32, center spatial.Point, radius float64) ([]spatial.Item, error) {
+	min, max := spatial.Bounds(center, radius)
+
+	items, err := s.positions(
+		ctx,
+		`WHERE block_id = ?
+		AND posx BETWEEN ? AND ?
+		AND posy BETWEEN ? AND ?
+		AND posz BETWEEN ? AND ?`,
+		blockID, min.X, max.X, min.Y, max.Y, min.Z, max.Z,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return spatial.Within(items, center, radius), nil
+}
+
+// positions returns the position of every replay selected by the given query
+// clauses.
+func (s *sqlService) positions(ctx context.Context, clauses string, args ...interface{}) ([]spatial.Item, error) {
+	rows, err := s.c.Reader.QueryContext(
+		ctx,
+		s.c.Rebind(`SELECT id, character_id, block_id, posx, posy, posz FROM replay `+clauses),
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query rows: %w", err)
+	}
+
+	return scanPositions(rows)
+}
+
+// scanPositions scans the position of every replay selected by rows.
+func scanPositions(rows *sql.Rows) ([]spatial.Item, error) {
+	defer rows.Close()
+
+	items := make([]spatial.Item, 0)
+	for rows.Next() {
+		it := spatial.Item{Kind: spatial.KindBloodstain}
+		if err := rows.Scan(
+			&it.ID,
+			&it.CharacterID,
+			&it.BlockID,
+			&it.Point.X,
+			&it.Point.Y,
+			&it.Point.Z,
+		); err != nil {
+			return nil, fmt.Errorf("scan row: %w", err)
+		}
+
+		items = append(items, it)
+	}
+
+	return items, rows.Err()
+}
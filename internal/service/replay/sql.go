@@ -0,0 +1,396 @@
+package replay
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/danmrichards/dessego/internal/database"
+	"github.com/rs/zerolog"
+)
+
+// replayColumns is the list of replay columns scanned by scanReplay.
+const replayColumns = `id,
+	character_id,
+	block_id,
+	posx,
+	posy,
+	posz,
+	angx,
+	angy,
+	angz,
+	msg_id,
+	main_msg_id,
+	add_msg_cate_id,
+	data,
+	legacy,
+	created,
+	region`
+
+type sqlPreparer interface {
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// sqlService implements the replays service for both SQLite and PostgreSQL,
+// so the two cannot drift apart. Queries are written in the SQL common to
+// both, with ? placeholders rebound for the dialect of the database.
+type sqlService struct {
+	c *database.Conn
+	l zerolog.Logger
+
+	options
+}
+
+// List returns n replays for the given block ID and legacy type, visible in
+// the given region. Replays from every region are returned if region is empty.
+//
+// Half of the replays are the most recently added, so players see fresh
+// bloodstains, and the remainder are sampled from older replays.
+func (s *sqlService) List(ctx context.Context, region string, blockID int32, n int, legacy LegacyType) ([]Replay, error) {
+	if n <= 0 {
+		return []Replay{}, nil
+	}
+	filter, args := inRegion(
+		`block_id = ? AND legacy = ?`,
+		[]interface{}{blockID, legacy}, region,
+	)
+
+	fresh, err := s.queryReplays(
+		ctx,
+		`WHERE `+filter+` ORDER BY id DESC LIMIT ?`,
+		append(args, (n+1)/2)...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("fresh replays: %w", err)
+	}
+	if len(fresh) < (n+1)/2 || len(fresh) == n {
+		// Every matching replay has been selected already.
+		return fresh, nil
+	}
+
+	older, err := s.sampleReplays(
+		ctx,
+		n-len(fresh),
+		filter+` AND id < ?`,
+		append(args, fresh[len(fresh)-1].ID)...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("sample replays: %w", err)
+	}
+
+	return append(fresh, older...), nil
+}
+
+// sampleReplays returns up to n replays matching the given filter, starting
+// from a random ID and wrapping around to the lowest ID.
+func (s *sqlService) sampleReplays(ctx context.Context, n int, filter string, args ...interface{}) ([]Replay, error) {
+	// Separate sub-queries, as SQLite only uses the index to find the minimum
+	// or maximum when it is the only aggregate.
+	stmt, err := s.c.PrepareRead(
+		`SELECT
+			(SELECT min(id) FROM replay WHERE ` + filter + `),
+			(SELECT max(id) FROM replay WHERE ` + filter + `)`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("prepare select: %w", err)
+	}
+
+	var minID, maxID sql.NullInt64
+	if err = stmt.QueryRowContext(
+		ctx,
+		append(args, args...)...,
+	).Scan(&minID, &maxID); err != nil {
+		return nil, fmt.Errorf("query id range: %w", err)
+	}
+	if !minID.Valid || !maxID.Valid {
+		return []Replay{}, nil
+	}
+
+	pivot := minID.Int64 + rand.Int63n(maxID.Int64-minID.Int64+1)
+
+	rs, err := s.queryReplays(
+		ctx,
+		`WHERE `+filter+` AND id >= ? ORDER BY id LIMIT ?`,
+		append(args, pivot, n)...,
+	)
+	if err != nil || len(rs) == n {
+		return rs, err
+	}
+
+	wrapped, err := s.queryReplays(
+		ctx,
+		`WHERE `+filter+` AND id < ? ORDER BY id LIMIT ?`,
+		append(args, pivot, n-len(rs))...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(rs, wrapped...), nil
+}
+
+// Recent returns the n most recently added replays for the given block ID.
+func (s *sqlService) Recent(ctx context.Context, blockID int32, n int) ([]Replay, error) {
+	return s.queryReplays(
+		ctx,
+		`WHERE block_id = ? ORDER BY id DESC LIMIT ?`, blockID, n,
+	)
+}
+
+// queryReplays returns the replays selected by the given query clauses.
+//
+// The clauses must be one of a fixed set, as the query is cached.
+func (s *sqlService) queryReplays(ctx context.Context, clauses string, args ...interface{}) ([]Replay, error) {
+	stmt, err := s.c.PrepareRead(
+		`SELECT ` + replayColumns + ` FROM replay ` + clauses,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("prepare select: %w", err)
+	}
+
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query rows: %w", err)
+	}
+	defer rows.Close()
+
+	rs := make([]Replay, 0)
+	for rows.Next() {
+		var r Replay
+		if err = scanReplay(rows, &r); err != nil {
+			return nil, fmt.Errorf("scan row: %w", err)
+		}
+
+		rs = append(rs, r)
+	}
+
+	return rs, rows.Err()
+}
+
+// Get returns a given replay.
+func (s *sqlService) Get(ctx context.Context, id uint32) (r *Replay, err error) {
+	var stmt *sql.Stmt
+	stmt, err = s.c.PrepareRead(
+		`SELECT ` + replayColumns + `
+		FROM replay
+		WHERE id = ?`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("prepare select: %w", err)
+	}
+
+	r = &Replay{}
+	switch err = scanReplay(stmt.QueryRowContext(ctx, id), r); {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, ErrNotFound
+	case err != nil:
+		return nil, fmt.Errorf("query row: %w", err)
+	}
+
+	return r, nil
+}
+
+// Add adds a new replay.
+//
+// Existing replays from the same character within the dedupe radius of the
+// new replay are replaced by it. If the retention policy limits the number of
+// replays per character, the oldest replays for the character beyond that
+// limit are deleted.
+func (s *sqlService) Add(ctx context.Context, r *Replay) (err error) {
+	var tx *sql.Tx
+	tx, err = s.c.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("db tx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var res sql.Result
+	if rad := s.retention.DedupeRadius; rad > 0 {
+		res, err = tx.ExecContext(
+			ctx,
+			s.c.Rebind(`DELETE FROM replay
+			WHERE character_id = ?
+			AND block_id = ?
+			AND legacy = 0
+			AND (posx - ?) * (posx - ?)
+				+ (posy - ?) * (posy - ?)
+				+ (posz - ?) * (posz - ?) <= ?`),
+			r.CharacterID,
+			r.BlockID,
+			r.PosX, r.PosX,
+			r.PosY, r.PosY,
+			r.PosZ, r.PosZ,
+			rad*rad,
+		)
+		if err != nil {
+			return fmt.Errorf("delete duplicate replays: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			s.l.Debug().Msgf(
+				"replaced %d duplicate replays for character: %q",
+				n, r.CharacterID,
+			)
+		}
+	}
+
+	r.Created = time.Now()
+	if _, err = s.saveReplay(ctx, tx, r); err != nil {
+		return err
+	}
+
+	if s.retention.MaxPerCharacter > 0 {
+		res, err = tx.ExecContext(
+			ctx,
+			s.c.Rebind(`DELETE FROM replay
+			WHERE id IN (
+				SELECT id FROM (
+					SELECT id, row_number() OVER (
+						ORDER BY created DESC, id DESC
+					) AS n
+					FROM replay
+					WHERE character_id = ?
+					AND legacy = 0
+				) AS ranked
+				WHERE n > ?
+			)`),
+			r.CharacterID, s.retention.MaxPerCharacter,
+		)
+		if err != nil {
+			return fmt.Errorf("delete oldest replays: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			s.l.Debug().Msgf(
+				"deleted %d oldest replays for character: %q",
+				n, r.CharacterID,
+			)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// saveReplay saves the replay, returning the number of replays added. Replays
+// which already exist are ignored.
+func (s *sqlService) saveReplay(ctx context.Context, tx sqlPreparer, r *Replay) (int64, error) {
+	cols := []string{
+		"character_id",
+		"block_id",
+		"posx",
+		"posy",
+		"posz",
+		"angx",
+		"angy",
+		"angz",
+		"msg_id",
+		"main_msg_id",
+		"add_msg_cate_id",
+		"data",
+		"legacy",
+		"created",
+		"region",
+	}
+
+	// Legacy replays have no creation time.
+	var created int64
+	if !r.Created.IsZero() {
+		created = r.Created.Unix()
+	}
+	vals := []interface{}{
+		r.CharacterID,
+		r.BlockID,
+		r.PosX,
+		r.PosY,
+		r.PosZ,
+		r.AngX,
+		r.AngY,
+		r.AngZ,
+		r.MsgID,
+		r.MainMsgID,
+		r.AddMsgCateID,
+		r.Data,
+		r.Legacy,
+		created,
+		r.Region,
+	}
+
+	// Leverage the auto increment for replays with no ID.
+	if r.ID > 0 {
+		cols = append([]string{"id"}, cols...)
+		vals = append([]interface{}{r.ID}, vals...)
+	}
+
+	var qb strings.Builder
+	qb.WriteString("INSERT INTO replay (")
+	for i, c := range cols {
+		qb.WriteString(c)
+		if i < len(cols)-1 {
+			qb.WriteString(",")
+		}
+	}
+
+	qb.WriteString(") VALUES (")
+	for i := 0; i < len(vals); i++ {
+		qb.WriteString("?")
+		if i < len(vals)-1 {
+			qb.WriteString(",")
+		}
+	}
+	qb.WriteString(") ON CONFLICT DO NOTHING")
+
+	stmt, err := tx.PrepareContext(ctx, s.c.Rebind(qb.String()))
+	if err != nil {
+		return 0, fmt.Errorf("prepare insert: %w", err)
+	}
+	defer stmt.Close()
+
+	res, err := stmt.ExecContext(ctx, vals...)
+	if err != nil {
+		return 0, fmt.Errorf("save replay: %w", err)
+	}
+
+	return res.RowsAffected()
+}
+
+// scanReplay scans a row selected using replayColumns into r.
+func scanReplay(row scanner, r *Replay) error {
+	var created int64
+	if err := row.Scan(
+		&r.ID,
+		&r.CharacterID,
+		&r.BlockID,
+		&r.PosX,
+		&r.PosY,
+		&r.PosZ,
+		&r.AngX,
+		&r.AngY,
+		&r.AngZ,
+		&r.MsgID,
+		&r.MainMsgID,
+		&r.AddMsgCateID,
+		&r.Data,
+		&r.Legacy,
+		&created,
+		&r.Region,
+	); err != nil {
+		return err
+	}
+
+	// Legacy replays have no creation time.
+	if created > 0 {
+		r.Created = time.Unix(created, 0)
+	}
+
+	return nil
+}
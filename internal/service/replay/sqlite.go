@@ -1,49 +1,32 @@
 package replay
 
 import (
-	"bufio"
 	"context"
 	"database/sql"
-	"encoding/binary"
 	"fmt"
-	"io"
 	"io/ioutil"
-	"os"
-	"strings"
+	"time"
 
+	"github.com/danmrichards/dessego/internal/database"
 	"github.com/rs/zerolog"
 )
 
-type sqlPreparer interface {
-	Prepare(query string) (*sql.Stmt, error)
-}
-
-// Option is a functional option that configures the SQLite service.
-type Option func(*SQLiteService)
-
-// SQLiteService is a msg service backed by a SQLite database.
+// SQLiteService is a replay service backed by a SQLite database.
 type SQLiteService struct {
-	db   *sql.DB
-	l    zerolog.Logger
-	seed bool
-}
+	db *database.DB
 
-// Seed configures the service to seed the database on startup.
-func Seed() Option {
-	return func(s *SQLiteService) {
-		s.seed = true
-	}
+	sqlService
 }
 
 // NewSQLiteService returns an initialised SQLite replays service.
-func NewSQLiteService(db *sql.DB, l zerolog.Logger, opts ...Option) (*SQLiteService, error) {
+func NewSQLiteService(db *database.DB, l zerolog.Logger, opts ...Option) (*SQLiteService, error) {
 	s := &SQLiteService{
 		db: db,
-		l:  l,
-	}
-
-	for _, o := range opts {
-		o(s)
+		sqlService: sqlService{
+			c:       database.SQLiteConn(db),
+			l:       l,
+			options: newOptions(opts),
+		},
 	}
 
 	if err := s.init(); err != nil {
@@ -53,242 +36,84 @@ func NewSQLiteService(db *sql.DB, l zerolog.Logger, opts ...Option) (*SQLiteServ
 	return s, nil
 }
 
-// List returns n replays for the given block ID and legacy type.
-func (s *SQLiteService) List(blockID int32, n int, legacy LegacyType) (rs []Replay, err error) {
-	rs = make([]Replay, 0, n)
-
-	var stmt *sql.Stmt
-	stmt, err = s.db.Prepare(
-		`SELECT *
-		FROM replay 
-		WHERE block_id = ?
-		AND legacy = ?
-		ORDER BY random()
-		LIMIT ?`,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("prepare select: %w", err)
-	}
-
-	var rows *sql.Rows
-	rows, err = stmt.Query(blockID, legacy, n)
-	if err != nil {
-		return nil, fmt.Errorf("query rows: %w", err)
-	}
-
-	for rows.Next() {
-		var r Replay
-		if err = rows.Scan(
-			&r.ID,
-			&r.CharacterID,
-			&r.BlockID,
-			&r.PosX,
-			&r.PosY,
-			&r.PosZ,
-			&r.AngX,
-			&r.AngY,
-			&r.AngZ,
-			&r.MsgID,
-			&r.MainMsgID,
-			&r.AddMsgCateID,
-			&r.Data,
-			&r.Legacy,
-		); err != nil {
-			return nil, fmt.Errorf("scan row: %w", err)
-		}
-
-		rs = append(rs, r)
-	}
-
-	return rs, nil
-}
-
-// Get returns a given replay.
-func (s *SQLiteService) Get(id uint32) (r *Replay, err error) {
-	var stmt *sql.Stmt
-	stmt, err = s.db.Prepare(
-		`SELECT *
-		FROM replay 
-		WHERE id = ?`,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("prepare select: %w", err)
-	}
-
-	r = &Replay{}
-	if err = stmt.QueryRow(id).Scan(
-		&r.ID,
-		&r.CharacterID,
-		&r.BlockID,
-		&r.PosX,
-		&r.PosY,
-		&r.PosZ,
-		&r.AngX,
-		&r.AngY,
-		&r.AngZ,
-		&r.MsgID,
-		&r.MainMsgID,
-		&r.AddMsgCateID,
-		&r.Data,
-		&r.Legacy,
-	); err != nil {
-		return nil, fmt.Errorf("query row: %w", err)
-	}
-
-	return r, nil
-}
-
-// Add adds a new replay.
-func (s *SQLiteService) Add(r *Replay) error {
-	return s.saveReplay(s.db, r)
-}
-
 // init initialises the database tables required by this service.
 func (s *SQLiteService) init() error {
 	if err := s.initTable(); err != nil {
 		return err
 	}
 
-	if s.seed {
-		return s.doSeed()
+	if err := s.migrate(); err != nil {
+		return fmt.Errorf("migrate: %w", err)
 	}
+
 	return nil
 }
 
 // initTable creates the database tables required by this service.
 func (s *SQLiteService) initTable() error {
-	ddl, err := ioutil.ReadFile("internal/service/replay/ddl.sql")
+	ddl, err := ioutil.ReadFile("internal/service/replay/replay.sql")
 	if err != nil {
 		return fmt.Errorf("read DDL: %w", err)
 	}
 
-	var stmt *sql.Stmt
-	stmt, err = s.db.Prepare(string(ddl))
-	if err != nil {
-		return fmt.Errorf("prepare DDL: %w", err)
-	}
-
-	if _, err = stmt.Exec(); err != nil {
+	// Exec rather than prepare, as the DDL contains multiple statements.
+	if _, err = s.db.Writer.Exec(string(ddl)); err != nil {
 		return fmt.Errorf("init table: %w", err)
 	}
 
 	return nil
 }
 
-// doSeed seeds the database tables required by this service.
-func (s *SQLiteService) doSeed() error {
-	s.l.Debug().Msg("seeding legacy replays")
-
-	f, err := os.Open("internal/service/replay/legacyreplays.bin")
+// migrate adds any columns missing from tables created by older versions of
+// this service.
+func (s *SQLiteService) migrate() error {
+	added, err := database.EnsureColumn(
+		s.db.Writer, "replay", "created", "INTEGER DEFAULT 0",
+	)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-
-	r := bufio.NewReader(f)
-
-	tx, err := s.db.BeginTx(context.Background(), nil)
-	if err != nil {
-		return fmt.Errorf("db tx: %w", err)
-	}
-
-	buf := make([]byte, 2048)
-	for {
-		n, err := io.ReadFull(r, buf[:4])
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			return err
-		}
-
-		// Replay length.
-		ml := int(binary.LittleEndian.Uint32(buf[:n]))
-
-		// Replay body.
-		n, err = io.ReadFull(r, buf[:ml])
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			return err
-		}
-
-		rp, err := NewReplayFromBytes(buf[:n])
-		if err != nil {
-			return fmt.Errorf("parse replay: %w", err)
-		}
-
-		if err = s.saveReplay(tx, rp); err != nil {
-			return err
+	if added {
+		// Existing replays have no creation time, treat them as new so they
+		// are not immediately removed by the retention policy.
+		if _, err = s.db.Writer.Exec(
+			`UPDATE replay SET created = ? WHERE legacy = 0`, time.Now().Unix(),
+		); err != nil {
+			return fmt.Errorf("backfill created: %w", err)
 		}
 	}
 
-	return tx.Commit()
-}
+	// Existing replays have no region, so are visible in every region.
+	_, err = database.EnsureColumn(
+		s.db.Writer, "replay", "region", "TEXT DEFAULT ''",
+	)
 
-func (s *SQLiteService) saveReplay(tx sqlPreparer, r *Replay) error {
-	cols := []string{
-		"character_id",
-		"block_id",
-		"posx",
-		"posy",
-		"posz",
-		"angx",
-		"angy",
-		"angz",
-		"msg_id",
-		"main_msg_id",
-		"add_msg_cate_id",
-		"data",
-		"legacy",
-	}
-	vals := []interface{}{
-		r.CharacterID,
-		r.BlockID,
-		r.PosX,
-		r.PosY,
-		r.PosZ,
-		r.AngX,
-		r.AngY,
-		r.AngZ,
-		r.MsgID,
-		r.MainMsgID,
-		r.AddMsgCateID,
-		r.Data,
-		r.Legacy,
-	}
+	return err
+}
 
-	// Leverage the auto increment for replays with no ID.
-	if r.ID > 0 {
-		cols = append([]string{"id"}, cols...)
-		vals = append([]interface{}{r.ID}, vals...)
+// Import adds legacy replays, keeping their IDs. Replays which already exist
+// are ignored.
+//
+// The number of replays added is returned.
+func (s *SQLiteService) Import(ctx context.Context, rs []*Replay) (n int64, err error) {
+	var tx *sql.Tx
+	tx, err = s.db.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("db tx: %w", err)
 	}
-
-	var qb strings.Builder
-	qb.WriteString("INSERT OR IGNORE INTO replay (")
-	for i, c := range cols {
-		qb.WriteString(c)
-		if i < len(cols)-1 {
-			qb.WriteString(",")
+	defer func() {
+		if err != nil {
+			tx.Rollback()
 		}
-	}
+	}()
 
-	qb.WriteString(") VALUES (")
-	for i := 0; i < len(vals); i++ {
-		qb.WriteString("?")
-		if i < len(vals)-1 {
-			qb.WriteString(",")
+	for _, r := range rs {
+		var added int64
+		if added, err = s.saveReplay(ctx, tx, r); err != nil {
+			return 0, err
 		}
-	}
-	qb.WriteString(")")
-
-	stmt, err := tx.Prepare(qb.String())
-	if err != nil {
-		return fmt.Errorf("prepare insert: %w", err)
-	}
-
-	if _, err = stmt.Exec(vals...); err != nil {
-		return fmt.Errorf("save replay: %w", err)
+		n += added
 	}
 
-	return nil
+	return n, tx.Commit()
 }
@@ -0,0 +1,189 @@
+package replay
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/danmrichards/dessego/internal/database"
+	"github.com/rs/zerolog"
+)
+
+func newTestService(t *testing.T, opts ...Option) *SQLiteService {
+	t.Helper()
+
+	db, err := database.NewSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	s, err := NewSQLiteService(db, zerolog.Nop(), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func addReplays(t *testing.T, s *SQLiteService, n int, characterID string, blockID int32) {
+	t.Helper()
+
+	for i := 0; i < n; i++ {
+		if err := s.Add(context.Background(), &Replay{
+			CharacterID: characterID,
+			BlockID:     blockID,
+			PosX:        float32(i * 10),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func countReplays(t *testing.T, s *SQLiteService, where string, args ...interface{}) int {
+	t.Helper()
+
+	var n int
+	if err := s.db.Reader.QueryRow(
+		`SELECT count(*) FROM replay WHERE `+where, args...,
+	).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+
+	return n
+}
+
+func TestSQLiteService_List(t *testing.T) {
+	s := newTestService(t)
+	for i := 0; i < 10; i++ {
+		addReplays(t, s, 10, fmt.Sprintf("char%d", i), 20070)
+	}
+	addReplays(t, s, 5, "other", 20071)
+
+	older := make(map[uint32]bool)
+	for i := 0; i < 20; i++ {
+		rs, err := s.List(context.Background(), "", 20070, 10, NonLegacy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rs) != 10 {
+			t.Fatalf("expected 10 replays got %d", len(rs))
+		}
+
+		seen := make(map[uint32]bool)
+		for j, r := range rs {
+			if r.BlockID != 20070 {
+				t.Fatalf("unexpected block: %d", r.BlockID)
+			}
+			if seen[r.ID] {
+				t.Fatalf("duplicate replay: %d", r.ID)
+			}
+			seen[r.ID] = true
+
+			// The first half should always be the newest replays.
+			if j < 5 {
+				if exp := uint32(100 - j); r.ID != exp {
+					t.Fatalf("expected fresh replay %d got %d", exp, r.ID)
+				}
+			} else {
+				older[r.ID] = true
+			}
+		}
+	}
+
+	// Older replays should be sampled, rather than always the same set.
+	if len(older) <= 5 {
+		t.Fatalf("expected a mix of older replays got %d distinct", len(older))
+	}
+}
+
+func TestSQLiteService_List_few(t *testing.T) {
+	s := newTestService(t)
+	addReplays(t, s, 3, "char0", 20070)
+
+	rs, err := s.List(context.Background(), "", 20070, 10, NonLegacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 3 {
+		t.Fatalf("expected 3 replays got %d", len(rs))
+	}
+
+	if rs, err = s.List(context.Background(), "", 20070, 10, Legacy); err != nil {
+		t.Fatal(err)
+	} else if len(rs) != 0 {
+		t.Fatalf("expected no legacy replays got %d", len(rs))
+	}
+}
+
+func TestSQLiteService_Add_dedupe(t *testing.T) {
+	s := newTestService(t, Retention(RetentionPolicy{DedupeRadius: 1}))
+
+	for _, r := range []*Replay{
+		{CharacterID: "char0", BlockID: 20070, PosX: 1, PosY: 1, PosZ: 1},
+		{CharacterID: "char0", BlockID: 20070, PosX: 1.5, PosY: 1, PosZ: 1},
+		{CharacterID: "char0", BlockID: 20070, PosX: 5, PosY: 1, PosZ: 1},
+		{CharacterID: "char0", BlockID: 20071, PosX: 1, PosY: 1, PosZ: 1},
+		{CharacterID: "char1", BlockID: 20070, PosX: 1, PosY: 1, PosZ: 1},
+	} {
+		if err := s.Add(context.Background(), r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := countReplays(t, s, `1`); n != 4 {
+		t.Fatalf("expected 4 replays got %d", n)
+	}
+	if n := countReplays(t, s, `id = 1`); n != 0 {
+		t.Fatal("expected duplicate replay to be replaced")
+	}
+}
+
+func TestSQLiteService_Add_maxPerCharacter(t *testing.T) {
+	s := newTestService(t, Retention(RetentionPolicy{MaxPerCharacter: 3}))
+	addReplays(t, s, 5, "char0", 20070)
+	addReplays(t, s, 2, "char1", 20070)
+
+	if n := countReplays(t, s, `character_id = ?`, "char0"); n != 3 {
+		t.Fatalf("expected 3 replays got %d", n)
+	}
+	if n := countReplays(t, s, `character_id = ? AND id <= 2`, "char0"); n != 0 {
+		t.Fatal("expected oldest replays to be deleted")
+	}
+}
+
+func TestSQLiteService_Prune(t *testing.T) {
+	s := newTestService(t)
+	addReplays(t, s, 6, "char0", 20070)
+	addReplays(t, s, 6, "char1", 20070)
+	addReplays(t, s, 2, "char2", 20071)
+
+	s.retention = RetentionPolicy{MaxPerCharacter: 4, MaxPerBlock: 5}
+
+	pr, err := s.Prune(context.Background(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.PerCharacter != 4 || pr.PerBlock != 3 {
+		t.Fatalf("unexpected dry run report: %s", pr)
+	}
+	if n := countReplays(t, s, `1`); n != 14 {
+		t.Fatalf("expected dry run to delete nothing, %d replays remain", n)
+	}
+
+	if pr, err = s.Prune(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	if pr.Total() != 7 {
+		t.Fatalf("unexpected report: %s", pr)
+	}
+
+	// The newest replays in each block should remain.
+	if n := countReplays(t, s, `block_id = 20070 AND id >= 6`); n != 5 {
+		t.Fatalf("expected 5 newest replays in block got %d", n)
+	}
+	if n := countReplays(t, s, `block_id = 20071`); n != 2 {
+		t.Fatalf("expected 2 replays in other block got %d", n)
+	}
+}
@@ -0,0 +1,176 @@
+package servicetest
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danmrichards/dessego/internal/database"
+)
+
+// PostgresEnv is the environment variable holding the data source name of the
+// PostgreSQL database to run tests against. Tests needing PostgreSQL are
+// skipped if it is not set, unless Run started a local server.
+const PostgresEnv = "DESSEGO_TEST_POSTGRES"
+
+// RequirePostgresEnv is the environment variable which, if set, fails tests
+// needing PostgreSQL when no database is available rather than skipping them,
+// so CI cannot pass without running them.
+const RequirePostgresEnv = "DESSEGO_TEST_POSTGRES_REQUIRED"
+
+// errNoPostgres is returned by startPostgres if the PostgreSQL server is not
+// installed.
+var errNoPostgres = errors.New("postgres not installed")
+
+// Run runs the tests, returning the exit code for os.Exit. If PostgresEnv is
+// not set and PostgreSQL is installed, a server is started in a temporary
+// directory for the duration of the tests.
+func Run(m *testing.M) int {
+	if os.Getenv(PostgresEnv) != "" {
+		return m.Run()
+	}
+
+	stop, err := startPostgres()
+	switch {
+	case errors.Is(err, errNoPostgres):
+	case err != nil:
+		fmt.Fprintln(os.Stderr, "start postgres:", err)
+	default:
+		defer stop()
+	}
+
+	return m.Run()
+}
+
+// startPostgres initialises and starts a PostgreSQL server in a temporary
+// directory, listening only on a Unix socket, and sets PostgresEnv to its data
+// source name. The returned function stops the server and removes the
+// directory.
+func startPostgres() (stop func(), err error) {
+	bin, err := postgresBinDir()
+	if err != nil {
+		return nil, err
+	}
+	if os.Geteuid() == 0 {
+		return nil, errors.New("postgres cannot be run as root")
+	}
+
+	dir, err := ioutil.TempDir("", "dessego-postgres")
+	if err != nil {
+		return nil, err
+	}
+	data := filepath.Join(dir, "data")
+	pgCtl := filepath.Join(bin, "pg_ctl")
+
+	stop = func() {
+		exec.Command(pgCtl, "stop", "-D", data, "-m", "immediate").Run()
+		os.RemoveAll(dir)
+	}
+	defer func() {
+		if err != nil {
+			stop()
+		}
+	}()
+
+	if out, err := exec.Command(
+		filepath.Join(bin, "initdb"), "-D", data, "-U", "postgres", "-A", "trust", "-N",
+	).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("initdb: %w: %s", err, out)
+	}
+
+	if out, err := exec.Command(
+		pgCtl, "start", "-w",
+		"-D", data,
+		"-l", filepath.Join(dir, "postgres.log"),
+		"-o", "-k "+dir+" -c listen_addresses='' -F",
+	).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("pg_ctl: %w: %s", err, out)
+	}
+
+	return stop, os.Setenv(
+		PostgresEnv, "host="+dir+" user=postgres dbname=postgres sslmode=disable",
+	)
+}
+
+// postgresBinDir returns the directory holding the PostgreSQL server binaries,
+// which may not be on the path.
+func postgresBinDir() (string, error) {
+	if p, err := exec.LookPath("pg_ctl"); err == nil {
+		return filepath.Dir(p), nil
+	}
+
+	if out, err := exec.Command("pg_config", "--bindir").Output(); err == nil {
+		bin := strings.TrimSpace(string(out))
+		if _, err = os.Stat(filepath.Join(bin, "pg_ctl")); err == nil {
+			return bin, nil
+		}
+	}
+
+	return "", errNoPostgres
+}
+
+// Postgres returns a connection pool for an empty schema in the PostgreSQL
+// database given by PostgresEnv. The schema is dropped when the test ends.
+func Postgres(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv(PostgresEnv)
+	switch {
+	case dsn == "" && os.Getenv(RequirePostgresEnv) != "":
+		t.Fatal(PostgresEnv + " not set, but PostgreSQL is required by " + RequirePostgresEnv)
+	case dsn == "":
+		t.Skip(PostgresEnv + " not set")
+	}
+
+	admin, err := database.NewPostgres(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if _, err = admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`); err != nil {
+			t.Error(err)
+		}
+	})
+
+	db, err := database.NewPostgres(withSearchPath(dsn, schema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Registered after the schema cleanup, so runs before it.
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+// withSearchPath returns the data source name with the search path set to the
+// given schema, for both URL and key/value data source names.
+func withSearchPath(dsn, schema string) string {
+	if !strings.Contains(dsn, "://") {
+		return dsn + " search_path=" + schema
+	}
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return dsn
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
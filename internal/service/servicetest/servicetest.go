@@ -0,0 +1,713 @@
+// Package servicetest implements conformance tests for the storage services
+// used by the game server, so every implementation behaves the same.
+package servicetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/danmrichards/dessego/internal/server/admin"
+	"github.com/danmrichards/dessego/internal/server/game"
+	"github.com/danmrichards/dessego/internal/service/character"
+	"github.com/danmrichards/dessego/internal/service/msg"
+	"github.com/danmrichards/dessego/internal/service/replay"
+	"github.com/danmrichards/dessego/internal/spatial"
+)
+
+// gradeRecounter is implemented by character services which can rebuild
+// multiplayer grades from the grade ledger.
+type gradeRecounter interface {
+	RecountGrades(ctx context.Context) error
+}
+
+// msgRatingSetter is implemented by character services which can replace
+// message ratings rebuilt from the rating ledger.
+type msgRatingSetter interface {
+	SetMsgRatings(ctx context.Context, ratings map[string]int) error
+}
+
+// Characters tests an implementation of game.Characters. newService must
+// return a new, empty, service each time it is called.
+func Characters(t *testing.T, newService func(t *testing.T) game.Characters) {
+	ctx := context.Background()
+
+	t.Run("EnsureCreate", func(t *testing.T) {
+		s := newService(t)
+
+		for i := 0; i < 2; i++ {
+			if err := s.EnsureCreate(ctx, "character0"); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		st, err := s.Stats(ctx, "character0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *st != (character.Stats{}) {
+			t.Fatalf("expected empty stats got: %s", st)
+		}
+
+		if _, err = s.Stats(ctx, "character1"); !errors.Is(err, character.ErrNotFound) {
+			t.Fatalf("expected not found error for unknown character got: %v", err)
+		}
+	})
+
+	t.Run("WorldTendency", func(t *testing.T) {
+		s := newService(t)
+
+		for i, id := range []string{"character0", "character1", "character2"} {
+			if err := s.EnsureCreate(ctx, id); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.SetTendency(ctx, id, "US", character.WorldTendency{
+				Area1: i, WB1: i + 1, LR7: i + 2,
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		wts, err := s.WorldTendency(ctx, "", 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(wts) != 2 {
+			t.Fatalf("expected 2 world tendencies got: %d", len(wts))
+		}
+
+		// Newest first.
+		exp := character.WorldTendency{Area1: 2, WB1: 3, LR7: 4}
+		if wts[0] != exp {
+			t.Fatalf("expected: %s got: %s", exp, wts[0])
+		}
+	})
+
+	t.Run("WorldTendencyRegion", func(t *testing.T) {
+		s := newService(t)
+
+		for i, region := range []string{"US", "EU", "US"} {
+			if err := s.EnsureCreate(ctx, "character0"); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.SetTendency(ctx, "character0", region, character.WorldTendency{
+				Area1: i,
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for region, exp := range map[string]int{"": 3, "US": 2, "EU": 1, "JP": 0} {
+			wts, err := s.WorldTendency(ctx, region, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(wts) != exp {
+				t.Fatalf("expected %d world tendencies in region %q got: %d", exp, region, len(wts))
+			}
+		}
+
+		wts, err := s.WorldTendency(ctx, "US", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(wts) != 1 || wts[0].Area1 != 2 {
+			t.Fatalf("expected newest US world tendency got: %v", wts)
+		}
+	})
+
+	t.Run("MsgRating", func(t *testing.T) {
+		s := newService(t)
+
+		if err := s.EnsureCreate(ctx, "character0"); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 3; i++ {
+			if err := s.UpdateMsgRating(ctx, "character0"); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		mr, err := s.MsgRating(ctx, "character0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mr != 3 {
+			t.Fatalf("expected message rating: 3 got: %d", mr)
+		}
+
+		if _, err = s.MsgRating(ctx, "character1"); !errors.Is(err, character.ErrNotFound) {
+			t.Fatalf("expected not found error for unknown character got: %v", err)
+		}
+	})
+
+	t.Run("Grades", func(t *testing.T) {
+		s := newService(t)
+
+		for _, id := range []string{"giver0", "giver1", "receiver0"} {
+			if err := s.EnsureCreate(ctx, id); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := s.InitMultiplayer(ctx, "receiver0"); err != nil {
+			t.Fatal(err)
+		}
+
+		// The receiver's own report is replaced by the first given grade.
+		self := &character.Grade{ReceiverID: "receiver0", Grade: character.GradeD}
+		if err := s.AddGrade(ctx, self); err != nil {
+			t.Fatal(err)
+		}
+		if self.Session != 1 || self.Created.IsZero() {
+			t.Fatalf("unexpected grade: %+v", self)
+		}
+
+		given := &character.Grade{
+			GiverID:    "giver0",
+			ReceiverID: "receiver0",
+			Grade:      character.GradeS,
+		}
+		if err := s.AddGrade(ctx, given); err != nil {
+			t.Fatal(err)
+		}
+
+		var derr character.DuplicateGradeError
+		if err := s.AddGrade(ctx, given); !errors.As(err, &derr) {
+			t.Fatalf("expected duplicate grade error got: %v", err)
+		}
+		if err := s.AddGrade(ctx, self); !errors.As(err, &derr) {
+			t.Fatalf("expected duplicate grade error got: %v", err)
+		}
+
+		var serr character.SelfGradeError
+		if err := s.AddGrade(ctx, &character.Grade{
+			GiverID:    "receiver0",
+			ReceiverID: "receiver0",
+			Grade:      character.GradeS,
+		}); !errors.As(err, &serr) {
+			t.Fatalf("expected self grade error got: %v", err)
+		}
+
+		var ierr character.InvalidGradeError
+		if err := s.AddGrade(ctx, &character.Grade{
+			GiverID:    "giver1",
+			ReceiverID: "receiver0",
+			Grade:      character.GradeUnknown,
+		}); !errors.As(err, &ierr) {
+			t.Fatalf("expected invalid grade error got: %v", err)
+		}
+
+		if err := s.AddGrade(ctx, &character.Grade{
+			GiverID:    "giver1",
+			ReceiverID: "receiver1",
+			Grade:      character.GradeA,
+		}); !errors.Is(err, character.ErrNotFound) {
+			t.Fatalf("expected not found error for unknown receiver got: %v", err)
+		}
+
+		if err := s.AddGrade(ctx, &character.Grade{
+			GiverID:    "giver1",
+			ReceiverID: "receiver0",
+			Grade:      character.GradeA,
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		// The same giver may grade the receiver again in a new session.
+		if err := s.InitMultiplayer(ctx, "receiver0"); err != nil {
+			t.Fatal(err)
+		}
+		given.Grade = character.GradeB
+		if err := s.AddGrade(ctx, given); err != nil {
+			t.Fatal(err)
+		}
+		if given.Session != 2 {
+			t.Fatalf("expected session: 2 got: %d", given.Session)
+		}
+
+		exp := character.Stats{GradeS: 1, GradeA: 1, GradeB: 1, Sessions: 2}
+		st, err := s.Stats(ctx, "receiver0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *st != exp {
+			t.Fatalf("expected stats: %s got: %s", exp, st)
+		}
+
+		if err = s.AddGrade(ctx, &character.Grade{
+			GiverID:    "giver0",
+			ReceiverID: "receiver1",
+			Grade:      character.GradeS,
+		}); err == nil {
+			t.Fatal("expected error for unknown character")
+		}
+
+		rc, ok := s.(gradeRecounter)
+		if !ok {
+			return
+		}
+		if err = rc.RecountGrades(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if st, err = s.Stats(ctx, "receiver0"); err != nil {
+			t.Fatal(err)
+		}
+		if *st != exp {
+			t.Fatalf("expected recounted stats: %s got: %s", exp, st)
+		}
+	})
+
+	t.Run("SetMsgRatings", func(t *testing.T) {
+		s := newService(t)
+
+		rs, ok := s.(msgRatingSetter)
+		if !ok {
+			t.Skip("message ratings cannot be set")
+		}
+
+		for _, id := range []string{"character0", "character1"} {
+			if err := s.EnsureCreate(ctx, id); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// Farmed ratings which bypassed the rating ledger.
+		for i := 0; i < 3; i++ {
+			if err := s.UpdateMsgRating(ctx, "character0"); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := rs.SetMsgRatings(ctx, map[string]int{"character1": 2}); err != nil {
+			t.Fatal(err)
+		}
+
+		for id, exp := range map[string]int{"character0": 0, "character1": 2} {
+			mr, err := s.MsgRating(ctx, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mr != exp {
+				t.Fatalf("expected %s message rating: %d got: %d", id, exp, mr)
+			}
+		}
+	})
+
+	t.Run("InitMultiplayer", func(t *testing.T) {
+		s := newService(t)
+
+		if err := s.EnsureCreate(ctx, "character0"); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			if err := s.InitMultiplayer(ctx, "character0"); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		st, err := s.Stats(ctx, "character0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.Sessions != 2 {
+			t.Fatalf("expected sessions: 2 got: %d", st.Sessions)
+		}
+	})
+}
+
+// Messages tests an implementation of game.Messages. newService must return a
+// new, empty, service each time it is called, with no rating limit.
+func Messages(t *testing.T, newService func(t *testing.T) game.Messages) {
+	ctx := context.Background()
+
+	add := func(t *testing.T, s game.Messages, characterID string, blockID int32) {
+		t.Helper()
+
+		if err := s.Add(ctx, msg.BloodMsg{
+			CharacterID: characterID,
+			BlockID:     blockID,
+			PosX:        1.5,
+			MsgID:       1,
+			MainMsgID:   2,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("Add", func(t *testing.T) {
+		s := newService(t)
+
+		add(t, s, "author0", 20070)
+		add(t, s, "author0", 20070)
+		add(t, s, "author0", 20071)
+		add(t, s, "author1", 20070)
+
+		bms, err := s.Character(ctx, "", "author0", 20070, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(bms) != 2 {
+			t.Fatalf("expected 2 messages got: %d", len(bms))
+		}
+		for _, bm := range bms {
+			if bm.CharacterID != "author0" || bm.BlockID != 20070 {
+				t.Fatalf("unexpected message: %+v", bm)
+			}
+			if bm.PosX != 1.5 || bm.MainMsgID != 2 || bm.Created.IsZero() {
+				t.Fatalf("unexpected message: %+v", bm)
+			}
+		}
+
+		bms, err = s.NonCharacter(ctx, "", "author0", 20070, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(bms) != 1 || bms[0].CharacterID != "author1" {
+			t.Fatalf("expected 1 message from author1 got: %+v", bms)
+		}
+
+		bms, err = s.Legacy(ctx, 20070, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(bms) != 0 {
+			t.Fatalf("expected no legacy messages got: %d", len(bms))
+		}
+	})
+
+	t.Run("Limit", func(t *testing.T) {
+		s := newService(t)
+
+		for i := 0; i < 10; i++ {
+			add(t, s, "author0", 20070)
+		}
+
+		bms, err := s.NonCharacter(ctx, "", "reader0", 20070, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(bms) != 3 {
+			t.Fatalf("expected 3 messages got: %d", len(bms))
+		}
+
+		seen := make(map[uint32]bool)
+		for _, bm := range bms {
+			if seen[bm.ID] {
+				t.Fatalf("duplicate message: %d", bm.ID)
+			}
+			seen[bm.ID] = true
+		}
+	})
+
+	t.Run("Region", func(t *testing.T) {
+		s := newService(t)
+
+		for _, region := range []string{"US", "US", "EU", ""} {
+			if err := s.Add(ctx, msg.BloodMsg{
+				CharacterID: "author0",
+				BlockID:     20070,
+				Region:      region,
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		add(t, s, "author1", 20070)
+
+		// Messages without a region are visible in every region.
+		for region, exp := range map[string]int{"": 4, "US": 3, "EU": 2, "JP": 1} {
+			bms, err := s.Character(ctx, region, "author0", 20070, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(bms) != exp {
+				t.Fatalf("expected %d messages in region %q got: %d", exp, region, len(bms))
+			}
+			for _, bm := range bms {
+				if region != "" && bm.Region != region && bm.Region != "" {
+					t.Fatalf("unexpected message in region %q: %+v", region, bm)
+				}
+			}
+		}
+
+		bms, err := s.NonCharacter(ctx, "EU", "author0", 20070, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(bms) != 1 || bms[0].CharacterID != "author1" {
+			t.Fatalf("expected 1 message from author1 got: %+v", bms)
+		}
+	})
+
+	t.Run("GetDelete", func(t *testing.T) {
+		s := newService(t)
+
+		add(t, s, "author0", 20070)
+		bms, err := s.Character(ctx, "", "author0", 20070, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(bms) != 1 {
+			t.Fatalf("expected 1 message got: %d", len(bms))
+		}
+		id := int(bms[0].ID)
+
+		bm, err := s.Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bm.ID != bms[0].ID || bm.CharacterID != "author0" {
+			t.Fatalf("unexpected message: %+v", bm)
+		}
+
+		if err = s.Delete(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = s.Get(ctx, id); !errors.Is(err, msg.ErrNotFound) {
+			t.Fatalf("expected not found error getting deleted message got: %v", err)
+		}
+		if err = s.Rate(ctx, id, "rater0"); !errors.Is(err, msg.ErrNotFound) {
+			t.Fatalf("expected not found error rating deleted message got: %v", err)
+		}
+	})
+
+	t.Run("Rate", func(t *testing.T) {
+		s := newService(t)
+
+		add(t, s, "author0", 20070)
+		bms, err := s.Character(ctx, "", "author0", 20070, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id := int(bms[0].ID)
+
+		if err = s.Rate(ctx, id, "rater0"); err != nil {
+			t.Fatal(err)
+		}
+
+		var derr msg.DuplicateRatingError
+		if err = s.Rate(ctx, id, "rater0"); !errors.As(err, &derr) {
+			t.Fatalf("expected duplicate rating error got: %v", err)
+		}
+
+		var serr msg.SelfRatingError
+		if err = s.Rate(ctx, id, "author0"); !errors.As(err, &serr) {
+			t.Fatalf("expected self rating error got: %v", err)
+		}
+
+		if err = s.Rate(ctx, id, "rater1"); err != nil {
+			t.Fatal(err)
+		}
+
+		bm, err := s.Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bm.Rating != 2 {
+			t.Fatalf("expected rating: 2 got: %d", bm.Rating)
+		}
+	})
+
+	t.Run("Search", func(t *testing.T) {
+		s := newService(t)
+		as, ok := s.(admin.Messages)
+		if !ok {
+			t.Skip("service cannot be searched")
+		}
+
+		add(t, s, "author0", 20070)
+		add(t, s, "author0", 20071)
+		add(t, s, "author1", 20070)
+
+		bms, err := as.Search(ctx, msg.Query{CharacterID: "author0"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(bms) != 2 {
+			t.Fatalf("expected 2 messages got: %d", len(bms))
+		}
+
+		bms, err = as.Search(ctx, msg.Query{BlockIDs: []int32{20070}, Limit: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(bms) != 1 || bms[0].BlockID != 20070 {
+			t.Fatalf("expected 1 message in block 20070 got: %+v", bms)
+		}
+
+		items, err := as.Positions(ctx, 20070)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != 2 || items[0].Kind != spatial.KindMessage {
+			t.Fatalf("expected 2 message positions got: %+v", items)
+		}
+
+		items, err = as.Near(ctx, 20070, spatial.Point{X: 1}, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != 2 {
+			t.Fatalf("expected 2 nearby messages got: %+v", items)
+		}
+	})
+}
+
+// Replays tests an implementation of game.Replays. newService must return a
+// new, empty, service each time it is called, with no retention policy.
+func Replays(t *testing.T, newService func(t *testing.T) game.Replays) {
+	ctx := context.Background()
+
+	t.Run("Add", func(t *testing.T) {
+		s := newService(t)
+
+		for i := 0; i < 4; i++ {
+			if err := s.Add(ctx, &replay.Replay{
+				CharacterID: "character0",
+				BlockID:     20070,
+				PosX:        float32(i * 10),
+				Data:        []byte{0x00, 0x01, byte(i)},
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := s.Add(ctx, &replay.Replay{
+			CharacterID: "character0",
+			BlockID:     20071,
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		rs, err := s.List(ctx, "", 20070, 10, replay.NonLegacy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rs) != 4 {
+			t.Fatalf("expected 4 replays got: %d", len(rs))
+		}
+
+		// The newest replays come first.
+		if rs[0].PosX != 30 {
+			t.Fatalf("expected newest replay first got: %+v", rs[0])
+		}
+
+		r, err := s.Get(ctx, rs[0].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(r.Data) != string([]byte{0x00, 0x01, 0x03}) {
+			t.Fatalf("expected replay data: %x got: %x", []byte{0x00, 0x01, 0x03}, r.Data)
+		}
+		if r.Created.IsZero() {
+			t.Fatal("expected replay creation time")
+		}
+
+		rs, err = s.List(ctx, "", 20070, 10, replay.Legacy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rs) != 0 {
+			t.Fatalf("expected no legacy replays got: %d", len(rs))
+		}
+	})
+
+	t.Run("Limit", func(t *testing.T) {
+		s := newService(t)
+
+		for i := 0; i < 10; i++ {
+			if err := s.Add(ctx, &replay.Replay{
+				CharacterID: "character0",
+				BlockID:     20070,
+				PosX:        float32(i * 10),
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		rs, err := s.List(ctx, "", 20070, 4, replay.NonLegacy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rs) != 4 {
+			t.Fatalf("expected 4 replays got: %d", len(rs))
+		}
+
+		seen := make(map[uint32]bool)
+		for _, r := range rs {
+			if seen[r.ID] {
+				t.Fatalf("duplicate replay: %d", r.ID)
+			}
+			seen[r.ID] = true
+		}
+	})
+
+	t.Run("Region", func(t *testing.T) {
+		s := newService(t)
+
+		for i, region := range []string{"US", "EU", ""} {
+			if err := s.Add(ctx, &replay.Replay{
+				CharacterID: "character0",
+				BlockID:     20070,
+				PosX:        float32(i * 10),
+				Region:      region,
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Replays without a region are visible in every region.
+		for region, exp := range map[string]int{"": 3, "US": 2, "EU": 2, "JP": 1} {
+			rs, err := s.List(ctx, region, 20070, 10, replay.NonLegacy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rs) != exp {
+				t.Fatalf("expected %d replays in region %q got: %d", exp, region, len(rs))
+			}
+			for _, r := range rs {
+				if region != "" && r.Region != region && r.Region != "" {
+					t.Fatalf("unexpected replay in region %q: %+v", region, r)
+				}
+			}
+		}
+	})
+
+	t.Run("Get", func(t *testing.T) {
+		s := newService(t)
+
+		if _, err := s.Get(ctx, 1); !errors.Is(err, replay.ErrNotFound) {
+			t.Fatalf("expected not found error for unknown replay got: %v", err)
+		}
+	})
+	t.Run("Recent", func(t *testing.T) {
+		s := newService(t)
+		as, ok := s.(admin.Replays)
+		if !ok {
+			t.Skip("service cannot be queried")
+		}
+
+		for i := 0; i < 3; i++ {
+			if err := s.Add(ctx, &replay.Replay{
+				CharacterID: "character0",
+				BlockID:     20070,
+				PosX:        float32(i * 10),
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		rs, err := as.Recent(ctx, 20070, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rs) != 2 || rs[0].PosX != 20 || rs[1].PosX != 10 {
+			t.Fatalf("expected 2 newest replays got: %+v", rs)
+		}
+
+		items, err := as.Near(ctx, 20070, spatial.Point{X: 11}, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != 1 || items[0].Kind != spatial.KindBloodstain {
+			t.Fatalf("expected 1 nearby replay got: %+v", items)
+		}
+	})
+}
@@ -0,0 +1,22 @@
+package servicetest
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/danmrichards/dessego/internal/database"
+)
+
+// SQLite returns a new SQLite database in a temporary directory. The database
+// is closed when the test ends.
+func SQLite(t *testing.T) *database.DB {
+	t.Helper()
+
+	db, err := database.NewSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
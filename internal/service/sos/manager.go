@@ -4,6 +4,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/danmrichards/dessego/internal/spatial"
 	"github.com/rs/zerolog"
 )
 
@@ -156,3 +157,63 @@ func monkBlock(id int32) bool {
 
 	return false
 }
+
+// Positions returns the position of every active SOS within the given block.
+func (m *Manager) Positions(blockID int32) []spatial.Item {
+	m.Lock()
+	defer m.Unlock()
+
+	items := make([]spatial.Item, 0)
+	for _, a := range m.active {
+		if a.BlockID != blockID || a.Updated.Add(maxSOSAge).Before(time.Now()) {
+			continue
+		}
+
+		items = append(items, spatial.Item{
+			Kind:        spatial.KindSOS,
+			ID:          uint32(a.ID),
+			CharacterID: a.CharacterID,
+			BlockID:     a.BlockID,
+			Point:       spatial.Point{X: a.PosX, Y: a.PosY, Z: a.PosZ},
+		})
+	}
+
+	return items
+}
+
+// State is the saved state of an SOS manager. Pending summons are not saved,
+// as the rooms they refer to do not survive a restart.
+type State struct {
+	Index  int32  `json:"index"`
+	Active []*SOS `json:"active"`
+}
+
+// State returns the saved state of every active SOS.
+func (m *Manager) State() State {
+	m.Lock()
+	defer m.Unlock()
+
+	st := State{Index: m.index, Active: make([]*SOS, 0, len(m.active))}
+	for _, a := range m.active {
+		s := *a
+		st.Active = append(st.Active, &s)
+	}
+
+	return st
+}
+
+// Restore adds the active SOS of a saved state, replacing any current SOS of
+// the same character. SOS which are too old to be used are left to expire as
+// normal.
+func (m *Manager) Restore(st State) {
+	m.Lock()
+	defer m.Unlock()
+
+	if st.Index > m.index {
+		m.index = st.Index
+	}
+	for _, a := range st.Active {
+		s := *a
+		m.active[s.CharacterID] = &s
+	}
+}
@@ -0,0 +1,124 @@
+package spatial
+
+import (
+	"fmt"
+	"math"
+)
+
+// Cluster is a group of items at near identical positions.
+type Cluster struct {
+	// Center is the mean position of the items in the cluster.
+	Center Point  `json:"center"`
+	Items  []Item `json:"items"`
+}
+
+// cell is the index of a cell in a uniform grid.
+type cell struct {
+	x, y, z int64
+}
+
+// Clusters groups the items into clusters, where every item in a cluster is
+// within eps of at least one other item in the same cluster. Items are only
+// clustered with items of the same kind and block.
+//
+// Clusters are returned in the order of their first item. An error is
+// returned if eps is not positive, or is too small to grid the items by.
+func Clusters(items []Item, eps float64) ([]Cluster, error) {
+	if !(eps > 0) || math.IsInf(eps, 1) {
+		return nil, fmt.Errorf("eps must be a positive number, got %v", eps)
+	}
+
+	// Union-find over the item indexes.
+	parent := make([]int, len(items))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	// Bucket the items into a grid of cells eps wide, so candidate neighbours
+	// only need to be searched for in adjacent cells.
+	cellOf := func(p Point) cell {
+		return cell{
+			x: int64(math.Floor(float64(p.X) / eps)),
+			y: int64(math.Floor(float64(p.Y) / eps)),
+			z: int64(math.Floor(float64(p.Z) / eps)),
+		}
+	}
+	grid := make(map[cell][]int, len(items))
+	for i, it := range items {
+		if !gridable(it.Point, eps) {
+			return nil, fmt.Errorf("eps %v is too small for position %v", eps, it.Point)
+		}
+		c := cellOf(it.Point)
+		grid[c] = append(grid[c], i)
+	}
+
+	for i, it := range items {
+		c := cellOf(it.Point)
+		for dx := int64(-1); dx <= 1; dx++ {
+			for dy := int64(-1); dy <= 1; dy++ {
+				for dz := int64(-1); dz <= 1; dz++ {
+					for _, j := range grid[cell{c.x + dx, c.y + dy, c.z + dz}] {
+						o := items[j]
+						if j <= i || o.Kind != it.Kind || o.BlockID != it.BlockID {
+							continue
+						}
+						if it.Point.Distance(o.Point) <= eps {
+							parent[find(j)] = find(i)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	var (
+		cs    = make([]Cluster, 0)
+		index = make(map[int]int)
+	)
+	for i, it := range items {
+		root := find(i)
+		ci, ok := index[root]
+		if !ok {
+			ci = len(cs)
+			index[root] = ci
+			cs = append(cs, Cluster{})
+		}
+		cs[ci].Items = append(cs[ci].Items, it)
+	}
+
+	for i := range cs {
+		var sx, sy, sz float64
+		for _, it := range cs[i].Items {
+			sx += float64(it.Point.X)
+			sy += float64(it.Point.Y)
+			sz += float64(it.Point.Z)
+		}
+		n := float64(len(cs[i].Items))
+		cs[i].Center = Point{
+			X: float32(sx / n),
+			Y: float32(sy / n),
+			Z: float32(sz / n),
+		}
+	}
+
+	return cs, nil
+}
+
+// gridable returns true if the cell of the point in a grid of cells eps wide
+// can be indexed without overflow.
+func gridable(p Point, eps float64) bool {
+	for _, v := range []float32{p.X, p.Y, p.Z} {
+		if math.Abs(float64(v)/eps) >= math.MaxInt64/2 {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,53 @@
+package spatial
+
+import "github.com/danmrichards/dessego/internal/service/gamestate"
+
+// FeatureCollection is a GeoJSON-like collection of point features.
+//
+// Unlike GeoJSON, coordinates are game world positions in the order x, y, z
+// rather than longitude and latitude.
+type FeatureCollection struct {
+	Type     string    `json:"type"`
+	Features []Feature `json:"features"`
+}
+
+// Feature is a GeoJSON-like point feature.
+type Feature struct {
+	Type       string                 `json:"type"`
+	Geometry   Geometry               `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// Geometry is a GeoJSON-like point geometry.
+type Geometry struct {
+	Type        string     `json:"type"`
+	Coordinates [3]float32 `json:"coordinates"`
+}
+
+// NewFeatureCollection returns a feature collection containing a point
+// feature for each of the given items.
+func NewFeatureCollection(items []Item) FeatureCollection {
+	fc := FeatureCollection{
+		Type:     "FeatureCollection",
+		Features: make([]Feature, 0, len(items)),
+	}
+
+	for _, it := range items {
+		fc.Features = append(fc.Features, Feature{
+			Type: "Feature",
+			Geometry: Geometry{
+				Type:        "Point",
+				Coordinates: [3]float32{it.Point.X, it.Point.Y, it.Point.Z},
+			},
+			Properties: map[string]interface{}{
+				"kind":         it.Kind,
+				"id":           it.ID,
+				"character_id": it.CharacterID,
+				"block_id":     it.BlockID,
+				"block":        gamestate.Block(it.BlockID).String(),
+			},
+		})
+	}
+
+	return fc
+}
@@ -0,0 +1,78 @@
+// Package spatial provides queries over the positions of items placed in the
+// Demon's Souls game world, such as blood messages, bloodstains and SOS signs.
+package spatial
+
+import (
+	"fmt"
+	"math"
+)
+
+// Kind is the kind of an item placed in the game world.
+type Kind string
+
+const (
+	// KindMessage is a blood message.
+	KindMessage Kind = "message"
+
+	// KindBloodstain is a bloodstain, left where a player died.
+	KindBloodstain Kind = "bloodstain"
+
+	// KindSOS is an SOS (summon) sign.
+	KindSOS Kind = "sos"
+
+	// KindGhost is a wandering ghost.
+	KindGhost Kind = "ghost"
+)
+
+// Point is a position in the game world. Y is the vertical axis.
+type Point struct {
+	X float32 `json:"x"`
+	Y float32 `json:"y"`
+	Z float32 `json:"z"`
+}
+
+// Distance returns the euclidean distance between p and q.
+func (p Point) Distance(q Point) float64 {
+	dx := float64(p.X - q.X)
+	dy := float64(p.Y - q.Y)
+	dz := float64(p.Z - q.Z)
+
+	return math.Sqrt(dx*dx + dy*dy + dz*dz)
+}
+
+// String implements fmt.Stringer.
+func (p Point) String() string {
+	return fmt.Sprintf("(%.2f, %.2f, %.2f)", p.X, p.Y, p.Z)
+}
+
+// Item is an item placed at a point within a block of the game world.
+type Item struct {
+	Kind        Kind   `json:"kind"`
+	ID          uint32 `json:"id"`
+	CharacterID string `json:"character_id"`
+	BlockID     int32  `json:"block_id"`
+	Point       Point  `json:"point"`
+}
+
+// Within returns the items within radius of the center point.
+func Within(items []Item, center Point, radius float64) []Item {
+	w := make([]Item, 0, len(items))
+	for _, it := range items {
+		if it.Point.Distance(center) <= radius {
+			w = append(w, it)
+		}
+	}
+
+	return w
+}
+
+// Bounds returns the minimum and maximum corners of the axis aligned cube
+// containing the sphere of the given radius around center.
+func Bounds(center Point, radius float64) (min, max Point) {
+	r := float32(radius)
+
+	min = Point{X: center.X - r, Y: center.Y - r, Z: center.Z - r}
+	max = Point{X: center.X + r, Y: center.Y + r, Z: center.Z + r}
+
+	return min, max
+}
@@ -0,0 +1,78 @@
+package spatial
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+)
+
+var testItems = []Item{
+	{Kind: KindMessage, ID: 1, BlockID: 20070, Point: Point{X: 1, Y: 0, Z: 1}},
+	{Kind: KindMessage, ID: 2, BlockID: 20070, Point: Point{X: 1.05, Y: 0, Z: 1}},
+	{Kind: KindMessage, ID: 3, BlockID: 20070, Point: Point{X: 1.1, Y: 0, Z: 1}},
+	{Kind: KindBloodstain, ID: 1, BlockID: 20070, Point: Point{X: 1, Y: 0, Z: 1}},
+	{Kind: KindMessage, ID: 4, BlockID: 20070, Point: Point{X: 10, Y: 0, Z: 10}},
+	{Kind: KindMessage, ID: 5, BlockID: 20071, Point: Point{X: 1, Y: 0, Z: 1}},
+}
+
+func TestWithin(t *testing.T) {
+	w := Within(testItems, Point{X: 0, Y: 0, Z: 0}, 2)
+	if len(w) != 5 {
+		t.Fatalf("expected 5 items got: %d", len(w))
+	}
+	for _, it := range w {
+		if it.ID == 4 && it.Kind == KindMessage {
+			t.Fatal("expected distant item to be excluded")
+		}
+	}
+}
+
+func TestClusters(t *testing.T) {
+	cs, err := Clusters(testItems, 0.06)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := make([][]uint32, 0, len(cs))
+	for _, c := range cs {
+		cids := make([]uint32, 0, len(c.Items))
+		for _, it := range c.Items {
+			cids = append(cids, it.ID)
+		}
+		ids = append(ids, cids)
+	}
+
+	// Messages 1, 2 and 3 are chained together, the bloodstain and the message
+	// in another block are never clustered with them.
+	exp := [][]uint32{{1, 2, 3}, {1}, {4}, {5}}
+	if !reflect.DeepEqual(exp, ids) {
+		t.Fatalf("expected: %v got: %v", exp, ids)
+	}
+
+	if c := cs[0].Center; c.X < 1.04 || c.X > 1.06 {
+		t.Fatalf("expected center x of 1.05 got: %v", c)
+	}
+}
+
+func TestClusters_invalidEps(t *testing.T) {
+	for _, eps := range []float64{0, -1, math.NaN(), math.Inf(1), math.SmallestNonzeroFloat64} {
+		if _, err := Clusters(testItems, eps); err == nil {
+			t.Fatalf("eps %v: expected error", eps)
+		}
+	}
+}
+
+func TestNewFeatureCollection(t *testing.T) {
+	fc := NewFeatureCollection(testItems[:1])
+
+	b, err := json.Marshal(fc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `{"type":"FeatureCollection","features":[{"type":"Feature","geometry":{"type":"Point","coordinates":[1,0,1]},"properties":{"block":"1-1 Boletarian Palace","block_id":20070,"character_id":"","id":1,"kind":"message"}}]}`
+	if string(b) != exp {
+		t.Fatalf("expected: %s\ngot: %s", exp, b)
+	}
+}
@@ -30,6 +30,21 @@ func WriteResponse(w io.Writer, rt ResponseType, data []byte) error {
 	return nil
 }
 
+// ParseResponseType returns the type of a response written by WriteResponse,
+// or false if res is not such a response.
+func ParseResponseType(res []byte) (ResponseType, bool) {
+	// The first 4 bytes of the base64 encoded response hold the command flag.
+	if len(res) < 4 {
+		return 0, false
+	}
+	b := make([]byte, 3)
+	if _, err := base64.StdEncoding.Decode(b, res[:4]); err != nil {
+		return 0, false
+	}
+
+	return ResponseType(b[0]), true
+}
+
 // buildResponse returns a byte slice representing a gamestate server response.
 //
 // Responses are in the format <CMD_FLAG><DATA_LENGTH><DATA>
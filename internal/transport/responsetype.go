@@ -1,5 +1,7 @@
 package transport
 
+import "fmt"
+
 // ResponseType indicates to Demon's Souls the type of response being returned.
 type ResponseType int
 
@@ -25,3 +27,36 @@ var (
 	ResponseCharacterMPGrade       ResponseType = 0x28
 	ResponseCharacterBloodMsgGrade ResponseType = 0x29
 )
+
+// responseTypeNames are the names of the response types, as logged.
+var responseTypeNames = map[ResponseType]string{
+	ResponseLogin:                  "login",
+	ResponseAddQWCData:             "add_qwc_data",
+	ResponseAddSummonSOSData:       "add_summon_sos_data",
+	ResponseCheckSOSData:           "check_sos_data",
+	ResponseCharacterTendency:      "character_tendency",
+	ResponseGetWanderingGhost:      "get_wandering_ghost",
+	ResponseMultiplayerOp:          "multiplayer_op",
+	ResponseGeneric:                "generic",
+	ResponseAddData:                "add_data",
+	ResponseReplayData:             "replay_data",
+	ResponseGetSOSData:             "get_sos_data",
+	ResponseListData:               "list_data",
+	ResponseUpdateMsgGrade:         "update_msg_grade",
+	ResponseUpdateOtherPlayerGrade: "update_other_player_grade",
+	ResponseFinaliseMultiplayer:    "finalise_multiplayer",
+	ResponseTimeMsg:                "time_msg",
+	ResponseSummonMonk:             "summon_monk",
+	ResponseDeleteBloodMsg:         "delete_blood_msg",
+	ResponseCharacterMPGrade:       "character_mp_grade",
+	ResponseCharacterBloodMsgGrade: "character_blood_msg_grade",
+}
+
+// String implements fmt.Stringer.
+func (rt ResponseType) String() string {
+	if n, ok := responseTypeNames[rt]; ok {
+		return n
+	}
+
+	return fmt.Sprintf("0x%02x", int(rt))
+}